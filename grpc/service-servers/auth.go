@@ -0,0 +1,80 @@
+package servers
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyMetadata is the metadata service accounts send their API key in.
+const apiKeyMetadata = "x-api-key"
+
+// methodScopes are the scopes needed to call the RPCs reading or changing any
+// user or service account. The other RPCs act on the user of a password or
+// token in the request, so they need no API key.
+var methodScopes = map[string]string{
+	"GetUsers":             apikeys.ScopeUsersRead,
+	"SearchUsers":          apikeys.ScopeUsersRead,
+	"BatchGetUsers":        apikeys.ScopeUsersRead,
+	"GetUser":              apikeys.ScopeUsersRead,
+	"GetUserByEmail":       apikeys.ScopeUsersRead,
+	"UpdateUser":           apikeys.ScopeUsersWrite,
+	"DeleteUser":           apikeys.ScopeUsersWrite,
+	"RestoreUser":          apikeys.ScopeUsersWrite,
+	"PurgeUser":            apikeys.ScopeUsersWrite,
+	"RevokeAllSessions":    apikeys.ScopeUsersWrite,
+	"CreateServiceAccount": apikeys.ScopeServiceAccountsAdmin,
+	"ListServiceAccounts":  apikeys.ScopeServiceAccountsAdmin,
+	"ListAPIKeys":          apikeys.ScopeServiceAccountsAdmin,
+	"RotateAPIKey":         apikeys.ScopeServiceAccountsAdmin,
+	"RevokeAPIKey":         apikeys.ScopeServiceAccountsAdmin,
+}
+
+// requiredScope returns the scope needed to call the grpc method, and false
+// for methods any client may call.
+func requiredScope(fullMethod string) (string, bool) {
+	prefix := "/" + proto.UserService_ServiceDesc.ServiceName + "/"
+	if len(fullMethod) <= len(prefix) || fullMethod[:len(prefix)] != prefix {
+		return "", false
+	}
+	scope, ok := methodScopes[fullMethod[len(prefix):]]
+	return scope, ok
+}
+
+// AuthInterceptor authenticates the API key in the x-api-key metadata and
+// checks it has the scope of the method, the principal of the key is added
+// to the context of the handler. Requests without a key may only call the
+// methods needing one of anonymousScopes.
+func AuthInterceptor(userService services.UserService, anonymousScopes ...string) grpc.UnaryServerInterceptor {
+	anonymous := &apikeys.Principal{Scopes: anonymousScopes}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope, needsScope := requiredScope(info.FullMethod)
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(apiKeyMetadata)
+		if len(keys) == 0 {
+			if needsScope && !anonymous.HasScope(scope) {
+				return nil, status.Errorf(codes.Unauthenticated, "%s requires an API key in the %s metadata", info.FullMethod, apiKeyMetadata)
+			}
+			return handler(ctx, req)
+		}
+
+		principal, err := userService.AuthenticateAPIKey(ctx, keys[0])
+		if err != nil {
+			return nil, toStatusError(err)
+		}
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.SetTag("principal.serviceAccountId", principal.ServiceAccountID).SetTag("principal.keyId", principal.KeyID)
+		}
+		if needsScope && !principal.HasScope(scope) {
+			return nil, status.Errorf(codes.PermissionDenied, "%s requires the %s scope", info.FullMethod, scope)
+		}
+		return handler(apikeys.NewContext(ctx, principal), req)
+	}
+}
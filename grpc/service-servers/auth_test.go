@@ -0,0 +1,61 @@
+package servers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/mocks"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptor(t *testing.T) {
+	reader := &apikeys.Principal{ServiceAccountID: "account.reader", KeyID: "key.reader", Scopes: []string{apikeys.ScopeUsersRead}}
+	userService := &mocks.UserService{}
+	userService.On("AuthenticateAPIKey", mock.Anything, "usk_reader").Return(reader, nil)
+	userService.On("AuthenticateAPIKey", mock.Anything, "usk_revoked").Return(nil, apikeys.ErrInvalidKey)
+
+	withKey := func(apiKey string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", apiKey))
+	}
+	tests := []struct {
+		name            string
+		ctx             context.Context
+		method          string
+		anonymousScopes []string
+		wantCode        codes.Code
+		wantPrincipal   *apikeys.Principal
+	}{
+		{name: "anonymous read allowed", ctx: context.Background(), method: "/UserService/GetUsers", anonymousScopes: []string{apikeys.ScopeUsersRead}, wantCode: codes.OK},
+		{name: "anonymous write with reads allowed", ctx: context.Background(), method: "/UserService/PurgeUser", anonymousScopes: []string{apikeys.ScopeUsersRead}, wantCode: codes.Unauthenticated},
+		{name: "anonymous admin with reads allowed", ctx: context.Background(), method: "/UserService/CreateServiceAccount", anonymousScopes: []string{apikeys.ScopeUsersRead}, wantCode: codes.Unauthenticated},
+		{name: "anonymous denied", ctx: context.Background(), method: "/UserService/GetUsers", wantCode: codes.Unauthenticated},
+		{name: "anonymous method without scope", ctx: context.Background(), method: "/UserService/LoginUser", wantCode: codes.OK},
+		{name: "key with scope", ctx: withKey("usk_reader"), method: "/UserService/GetUsers", wantCode: codes.OK, wantPrincipal: reader},
+		{name: "key without scope", ctx: withKey("usk_reader"), method: "/UserService/PurgeUser", anonymousScopes: []string{apikeys.ScopeUsersRead}, wantCode: codes.PermissionDenied},
+		{name: "key on method without scope", ctx: withKey("usk_reader"), method: "/UserService/GetJWKS", wantCode: codes.OK, wantPrincipal: reader},
+		{name: "invalid key", ctx: withKey("usk_revoked"), method: "/UserService/GetUsers", anonymousScopes: []string{apikeys.ScopeUsersRead}, wantCode: codes.Unauthenticated},
+		{name: "other service", ctx: context.Background(), method: "/grpc.health.v1.Health/Check", wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPrincipal *apikeys.Principal
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				gotPrincipal = apikeys.FromContext(ctx)
+				return "response", nil
+			}
+			interceptor := AuthInterceptor(userService, tt.anonymousScopes...)
+			_, err := interceptor(tt.ctx, "request", &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("AuthInterceptor() error = %v, want code %v", err, tt.wantCode)
+			}
+			if gotPrincipal != tt.wantPrincipal {
+				t.Errorf("AuthInterceptor() principal = %+v, want %+v", gotPrincipal, tt.wantPrincipal)
+			}
+		})
+	}
+}
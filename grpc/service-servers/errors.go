@@ -0,0 +1,83 @@
+package servers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// toStatusError converts errors the service layer exposes to clients into
+// grpc status errors with a matching code, other errors are returned as is.
+func toStatusError(err error) error {
+	var fieldErr *services.FieldError
+	var throttledErr *services.LoginThrottledError
+	switch {
+	case errors.As(err, &fieldErr):
+		return fieldErrorStatus(fieldErr)
+	case errors.As(err, &throttledErr):
+		return retryStatus(codes.ResourceExhausted, throttledErr, throttledErr.RetryAfter)
+	case errors.Is(err, users.ErrUserNotFound), errors.Is(err, apikeys.ErrServiceAccountNotFound),
+		errors.Is(err, apikeys.ErrKeyNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, users.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, users.ErrEmailTaken):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, services.ErrInvalidPageToken), errors.Is(err, onetime.ErrInvalidToken),
+		errors.Is(err, services.ErrInvalidVerificationToken), errors.Is(err, services.ErrUnknownProvider):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, services.ErrEmailNotVerified), errors.Is(err, mfa.ErrNotEnrolled),
+		errors.Is(err, mfa.ErrAlreadyEnabled), errors.Is(err, services.ErrProviderEmailNotVerified):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, services.ErrIncorrectPassword), errors.Is(err, services.ErrNotTokenUser):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, services.ErrSearchDisabled):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, sessions.ErrInvalidRefreshToken), errors.Is(err, sessions.ErrRefreshTokenReused),
+		errors.Is(err, services.ErrTokenRevoked), errors.Is(err, services.ErrInvalidMFACode),
+		errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, apikeys.ErrInvalidKey),
+		errors.Is(err, services.ErrInvalidAccessToken), errors.Is(err, services.ErrReauthenticationRequired):
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return err
+}
+
+// fieldErrorStatus returns an InvalidArgument status error with the violations
+// of err as BadRequest details, for clients to show next to the fields.
+func fieldErrorStatus(err *services.FieldError) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range err.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+	st, detailsErr := status.New(codes.InvalidArgument, err.Error()).WithDetails(badRequest)
+	if detailsErr != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return st.Err()
+}
+
+// retryStatus returns a status error with a RetryInfo detail telling clients
+// how long to wait before retrying.
+func retryStatus(code codes.Code, err error, retryAfter time.Duration) error {
+	st, detailsErr := status.New(code, err.Error()).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(retryAfter),
+	})
+	if detailsErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
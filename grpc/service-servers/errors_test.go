@@ -0,0 +1,96 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToStatusError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "user not found", err: users.ErrUserNotFound, want: codes.NotFound},
+		{name: "wrapped user not found", err: fmt.Errorf("lookup: %w", users.ErrUserNotFound), want: codes.NotFound},
+		{name: "service account not found", err: apikeys.ErrServiceAccountNotFound, want: codes.NotFound},
+		{name: "api key not found", err: apikeys.ErrKeyNotFound, want: codes.NotFound},
+		{name: "version conflict", err: users.ErrVersionConflict, want: codes.Aborted},
+		{name: "email taken", err: users.ErrEmailTaken, want: codes.AlreadyExists},
+		{name: "field error", err: &services.FieldError{Violations: []services.FieldViolation{{Field: "password", Description: "is required"}}}, want: codes.InvalidArgument},
+		{name: "invalid page token", err: services.ErrInvalidPageToken, want: codes.InvalidArgument},
+		{name: "invalid one time token", err: onetime.ErrInvalidToken, want: codes.InvalidArgument},
+		{name: "invalid verification token", err: services.ErrInvalidVerificationToken, want: codes.InvalidArgument},
+		{name: "email not verified", err: services.ErrEmailNotVerified, want: codes.FailedPrecondition},
+		{name: "mfa not enrolled", err: mfa.ErrNotEnrolled, want: codes.FailedPrecondition},
+		{name: "mfa already enabled", err: mfa.ErrAlreadyEnabled, want: codes.FailedPrecondition},
+		{name: "unverified provider email", err: services.ErrProviderEmailNotVerified, want: codes.FailedPrecondition},
+		{name: "unknown provider", err: services.ErrUnknownProvider, want: codes.InvalidArgument},
+		{name: "incorrect password", err: services.ErrIncorrectPassword, want: codes.PermissionDenied},
+		{name: "access token of another user", err: services.ErrNotTokenUser, want: codes.PermissionDenied},
+		{name: "login throttled", err: &services.LoginThrottledError{RetryAfter: time.Minute}, want: codes.ResourceExhausted},
+		{name: "search disabled", err: services.ErrSearchDisabled, want: codes.Unimplemented},
+		{name: "invalid refresh token", err: sessions.ErrInvalidRefreshToken, want: codes.Unauthenticated},
+		{name: "reused refresh token", err: sessions.ErrRefreshTokenReused, want: codes.Unauthenticated},
+		{name: "revoked token", err: services.ErrTokenRevoked, want: codes.Unauthenticated},
+		{name: "invalid mfa code", err: services.ErrInvalidMFACode, want: codes.Unauthenticated},
+		{name: "invalid id token", err: oidc.ErrInvalidIDToken, want: codes.Unauthenticated},
+		{name: "invalid api key", err: apikeys.ErrInvalidKey, want: codes.Unauthenticated},
+		{name: "invalid access token", err: services.ErrInvalidAccessToken, want: codes.Unauthenticated},
+		{name: "reauthentication required", err: services.ErrReauthenticationRequired, want: codes.Unauthenticated},
+		{name: "unknown error", err: errors.New("an error occured"), want: codes.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(toStatusError(tt.err)); got != tt.want {
+				t.Errorf("toStatusError() code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToStatusError_FieldViolations(t *testing.T) {
+	err := fmt.Errorf("creating user: %w", &services.FieldError{Violations: []services.FieldViolation{
+		{Field: "password", Description: "must be at least 8 characters long"},
+		{Field: "password", Description: "must not contain your name"},
+	}})
+	st := status.Convert(toStatusError(err))
+	if len(st.Details()) != 1 {
+		t.Fatalf("toStatusError() details = %v, want a BadRequest", st.Details())
+	}
+	badRequest, ok := st.Details()[0].(*errdetails.BadRequest)
+	if !ok {
+		t.Fatalf("toStatusError() detail = %T, want *errdetails.BadRequest", st.Details()[0])
+	}
+	violations := badRequest.GetFieldViolations()
+	if len(violations) != 2 || violations[0].Field != "password" || violations[1].Description != "must not contain your name" {
+		t.Errorf("toStatusError() field violations = %v, want the violations of the error", violations)
+	}
+}
+
+func TestToStatusError_RetryInfo(t *testing.T) {
+	st := status.Convert(toStatusError(&services.LoginThrottledError{RetryAfter: 90 * time.Second}))
+	if len(st.Details()) != 1 {
+		t.Fatalf("toStatusError() details = %v, want a RetryInfo", st.Details())
+	}
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	if !ok {
+		t.Fatalf("toStatusError() detail = %T, want *errdetails.RetryInfo", st.Details()[0])
+	}
+	if got := retryInfo.GetRetryDelay().AsDuration(); got != 90*time.Second {
+		t.Errorf("toStatusError() retry delay = %v, want %v", got, 90*time.Second)
+	}
+}
@@ -0,0 +1,49 @@
+package servers
+
+import (
+	"fmt"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// checkUserReadMask returns an InvalidArgument error when readMask lists a
+// field users do not have.
+func checkUserReadMask(readMask *fieldmaskpb.FieldMask) error {
+	for _, path := range readMask.GetPaths() {
+		switch path {
+		case "id", "fullName", "email", "country", "version", "emailVerified":
+		default:
+			return status.Error(codes.InvalidArgument, fmt.Sprintf("unknown field %q in read mask", path))
+		}
+	}
+	return nil
+}
+
+// applyUserReadMask returns a copy of user with only the fields listed in
+// readMask, an empty mask keeps every field.
+func applyUserReadMask(user *proto.User, readMask *fieldmaskpb.FieldMask) *proto.User {
+	if len(readMask.GetPaths()) == 0 {
+		return user
+	}
+	masked := &proto.User{}
+	for _, path := range readMask.GetPaths() {
+		switch path {
+		case "id":
+			masked.Id = user.Id
+		case "fullName":
+			masked.FullName = user.FullName
+		case "email":
+			masked.Email = user.Email
+		case "country":
+			masked.Country = user.Country
+		case "version":
+			masked.Version = user.Version
+		case "emailVerified":
+			masked.EmailVerified = user.EmailVerified
+		}
+	}
+	return masked
+}
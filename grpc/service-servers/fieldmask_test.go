@@ -0,0 +1,21 @@
+package servers
+
+import (
+	"testing"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// TestCheckUserReadMask_AllFields fails when a field added to the User message
+// is not handled by the read masks.
+func TestCheckUserReadMask_AllFields(t *testing.T) {
+	fields := (&proto.User{}).ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		path := string(fields.Get(i).Name())
+		err := checkUserReadMask(&fieldmaskpb.FieldMask{Paths: []string{path}})
+		if err != nil {
+			t.Errorf("checkUserReadMask() error = %v for User field %q", err, path)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package servers
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientIP returns the ip of the client making the request. It is the last
+// address of the x-forwarded-for metadata, the one added by the proxy in
+// front of the service, or else the address of the peer. Clients reaching
+// the service without a proxy can set the metadata themselves, so the
+// service should only be exposed through a proxy that sets it.
+func clientIP(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if forwardedFor := md.Get("x-forwarded-for"); len(forwardedFor) > 0 {
+		addresses := strings.Split(forwardedFor[len(forwardedFor)-1], ",")
+		if ip := strings.TrimSpace(addresses[len(addresses)-1]); ip != "" {
+			return ip
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,46 @@
+package servers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestClientIP(t *testing.T) {
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 52000},
+	})
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "no peer", ctx: context.Background(), want: ""},
+		{name: "peer address", ctx: peerCtx, want: "10.0.0.2"},
+		{
+			name: "forwarded for",
+			ctx:  metadata.NewIncomingContext(peerCtx, metadata.Pairs("x-forwarded-for", "203.0.113.7")),
+			want: "203.0.113.7",
+		},
+		{
+			name: "forwarded through several proxies",
+			ctx:  metadata.NewIncomingContext(peerCtx, metadata.Pairs("x-forwarded-for", "198.51.100.1, 203.0.113.7")),
+			want: "203.0.113.7",
+		},
+		{
+			name: "empty forwarded for",
+			ctx:  metadata.NewIncomingContext(peerCtx, metadata.Pairs("x-forwarded-for", "")),
+			want: "10.0.0.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientIP(tt.ctx); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
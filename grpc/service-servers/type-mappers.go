@@ -1,16 +1,61 @@
 package servers
 
 import (
+	"time"
+
 	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func InternalToProtoUser(usr *users.User) *proto.User {
 	return &proto.User{
-		Id:       usr.ID,
-		FullName: usr.FullName,
-		Email:    usr.Email,
-		Country:  usr.Country,
+		Id:            usr.ID,
+		FullName:      usr.FullName,
+		Email:         usr.Email,
+		Country:       usr.Country,
+		Version:       usr.Version,
+		EmailVerified: usr.EmailVerified,
+	}
+}
+
+func InternalToProtoJWKS(jwks *keyring.JWKS) *proto.JSONWebKeySet {
+	set := &proto.JSONWebKeySet{}
+	for _, jwk := range jwks.Keys {
+		set.Keys = append(set.Keys, &proto.JSONWebKey{
+			Kty: jwk.KeyType,
+			Kid: jwk.KeyID,
+			Use: jwk.Use,
+			Alg: jwk.Algorithm,
+			N:   jwk.N,
+			E:   jwk.E,
+			Crv: jwk.Curve,
+			X:   jwk.X,
+			Y:   jwk.Y,
+		})
+	}
+	return set
+}
+
+func InternalToProtoServiceAccount(account *apikeys.ServiceAccount) *proto.ServiceAccount {
+	return &proto.ServiceAccount{
+		Id:        account.ID,
+		Name:      account.Name,
+		Scopes:    account.Scopes,
+		CreatedAt: timestamppb.New(account.CreatedAt),
+	}
+}
+
+func InternalToProtoAPIKey(key *apikeys.Key) *proto.APIKey {
+	return &proto.APIKey{
+		Id:               key.ID,
+		ServiceAccountId: key.ServiceAccountID,
+		Hint:             key.Hint,
+		CreatedAt:        timestamppb.New(key.CreatedAt),
+		ExpiresAt:        timeToProtoTimestamp(key.ExpiresAt),
+		RevokedAt:        timeToProtoTimestamp(key.RevokedAt),
 	}
 }
 
@@ -22,3 +67,56 @@ func ProtoNewUserToInternalUser(usr *proto.NewUser) *users.User {
 		Password: usr.Password,
 	}
 }
+
+func ProtoUpdateUserToInternalUser(usr *proto.UpdateUserInput) *users.User {
+	return &users.User{
+		ID:       usr.Id,
+		FullName: usr.FullName,
+		Country:  usr.Country,
+		Version:  usr.Version,
+	}
+}
+
+func ProtoGetUsersRequestToInternal(req *proto.GetUsersRequest) users.GetUsersRequest {
+	return users.GetUsersRequest{
+		Limit:             req.Limit,
+		PageToken:         req.PageToken,
+		SortBy:            protoSortFieldToInternal(req.SortBy),
+		Descending:        req.SortDirection == proto.SortDirection_SORT_DIRECTION_DESCENDING,
+		Country:           req.Country,
+		CreatedAfter:      protoTimestampToTime(req.CreatedAfter),
+		CreatedBefore:     protoTimestampToTime(req.CreatedBefore),
+		IncludeTotalCount: req.IncludeTotalCount,
+	}
+}
+
+func protoSortFieldToInternal(field proto.UserSortField) users.SortField {
+	switch field {
+	case proto.UserSortField_USER_SORT_FIELD_UNSPECIFIED:
+		return ""
+	case proto.UserSortField_USER_SORT_FIELD_TIME_ADDED:
+		return users.SortByTimeAdded
+	case proto.UserSortField_USER_SORT_FIELD_FULL_NAME:
+		return users.SortByFullName
+	case proto.UserSortField_USER_SORT_FIELD_EMAIL:
+		return users.SortByEmail
+	}
+	// unknown values are left for the service to reject.
+	return users.SortField(field.String())
+}
+
+// protoTimestampToTime returns the zero time for unset timestamps.
+func protoTimestampToTime(timestamp *timestamppb.Timestamp) time.Time {
+	if timestamp == nil {
+		return time.Time{}
+	}
+	return timestamp.AsTime()
+}
+
+// timeToProtoTimestamp returns nil for unset times.
+func timeToProtoTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
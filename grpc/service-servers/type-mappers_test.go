@@ -105,3 +105,45 @@ func TestProtoNewUserToInternalUser(t *testing.T) {
 		})
 	}
 }
+
+func TestProtoUpdateUserToInternalUser(t *testing.T) {
+	tests := []struct {
+		name string
+		usr  *proto.UpdateUserInput
+		want *users.User
+	}{
+		{
+			name: "all fields",
+			usr: &proto.UpdateUserInput{
+				Id:       "hello",
+				FullName: "Wisdom Matt",
+				Country:  "Nigeria",
+				Version:  4,
+			},
+			want: &users.User{
+				ID:       "hello",
+				FullName: "Wisdom Matt",
+				Country:  "Nigeria",
+				Version:  4,
+			},
+		},
+		{
+			name: "incomplete fields",
+			usr: &proto.UpdateUserInput{
+				Id:      "hello",
+				Country: "Nigeria",
+			},
+			want: &users.User{
+				ID:      "hello",
+				Country: "Nigeria",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ProtoUpdateUserToInternalUser(tt.usr); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ProtoUpdateUserToInternalUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package servers
 
 import (
 	"context"
+	"errors"
 
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UserServiceServer struct {
@@ -31,31 +35,119 @@ func (u *UserServiceServer) CreateUser(ctx context.Context, req *proto.NewUser)
 	ctx = opentracing.ContextWithSpan(ctx, span)
 	newUser, err := u.userService.CreateUser(ctx, ProtoNewUserToInternalUser(req))
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	return InternalToProtoUser(newUser), nil
 }
 
-func (u *UserServiceServer) GetUsers(ctx context.Context, filter *proto.GetUsersFilter) (*proto.GetUsersResponse, error) {
+// GetUsers is the grpc handler to list users a page at a time.
+func (u *UserServiceServer) GetUsers(ctx context.Context, req *proto.GetUsersRequest) (*proto.GetUsersResponse, error) {
 	span, _ := opentracing.StartSpanFromContext(ctx, "GetUsers")
 	defer span.Finish()
 	ext.SpanKindRPCServer.Set(span)
-	span.SetTag("param.filter", filter)
+	span.SetTag("param.request", req)
 
 	ctx = opentracing.ContextWithSpan(ctx, span)
-	users, err := u.userService.GetUsers(ctx, filter.AfterId, filter.Limit)
+	page, err := u.userService.GetUsers(ctx, ProtoGetUsersRequestToInternal(req))
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	var protoUsers []*proto.User
-	for _, user := range users {
+	for _, user := range page.Users {
 		protoUsers = append(protoUsers, InternalToProtoUser(&user))
 	}
 	return &proto.GetUsersResponse{
-		Users: protoUsers,
+		Users:         protoUsers,
+		NextPageToken: page.NextPageToken,
+		PrevPageToken: page.PrevPageToken,
+		TotalCount:    page.TotalCount,
 	}, nil
 }
 
+// SearchUsers is the grpc handler to find users from part of their full name
+// or email.
+func (u *UserServiceServer) SearchUsers(ctx context.Context, input *proto.SearchUsersInput) (*proto.SearchUsersResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "SearchUsers")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	hits, err := u.userService.SearchUsers(ctx, input.Query, input.Limit)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	var protoHits []*proto.UserSearchHit
+	for _, hit := range hits {
+		protoHits = append(protoHits, &proto.UserSearchHit{
+			User:       InternalToProtoUser(&hit.User),
+			Score:      hit.Score,
+			Highlights: hit.Highlights,
+		})
+	}
+	return &proto.SearchUsersResponse{Hits: protoHits}, nil
+}
+
+// BatchGetUsers is the grpc handler to get many users in a single call.
+func (u *UserServiceServer) BatchGetUsers(ctx context.Context, input *proto.BatchGetUsersInput) (*proto.BatchGetUsersResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "BatchGetUsers")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	users, missingIds, err := u.userService.BatchGetUsers(ctx, input.Ids)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	var protoUsers []*proto.User
+	for _, user := range users {
+		protoUsers = append(protoUsers, InternalToProtoUser(&user))
+	}
+	return &proto.BatchGetUsersResponse{
+		Users:      protoUsers,
+		MissingIds: missingIds,
+	}, nil
+}
+
+// GetUser is the grpc handler to get a user by id.
+func (u *UserServiceServer) GetUser(ctx context.Context, input *proto.GetUserInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "GetUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	err := checkUserReadMask(input.ReadMask)
+	if err != nil {
+		return nil, err
+	}
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	user, err := u.userService.GetUser(ctx, input.Id)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return applyUserReadMask(InternalToProtoUser(user), input.ReadMask), nil
+}
+
+// GetUserByEmail is the grpc handler to get a user by email.
+func (u *UserServiceServer) GetUserByEmail(ctx context.Context, input *proto.GetUserByEmailInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "GetUserByEmail")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	err := checkUserReadMask(input.ReadMask)
+	if err != nil {
+		return nil, err
+	}
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	user, err := u.userService.GetUserByEmail(ctx, input.Email)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return applyUserReadMask(InternalToProtoUser(user), input.ReadMask), nil
+}
+
 func (u *UserServiceServer) LoginUser(ctx context.Context, input *proto.LoginInput) (*proto.LoginResponse, error) {
 	span, _ := opentracing.StartSpanFromContext(ctx, "LoginUser")
 	defer span.Finish()
@@ -63,13 +155,102 @@ func (u *UserServiceServer) LoginUser(ctx context.Context, input *proto.LoginInp
 	span.SetTag("param.input", input)
 
 	ctx = opentracing.ContextWithSpan(ctx, span)
-	usr, jwtToken, err := u.userService.LoginUser(ctx, input.Email, input.Password)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	return loginResponse(u.userService.LoginUser(ctx, input.Email, input.Password))
+}
+
+// CompleteLoginMFA is the grpc handler to finish a login that LoginUser
+// challenged for a two-factor authentication code.
+func (u *UserServiceServer) CompleteLoginMFA(ctx context.Context, input *proto.CompleteLoginMFAInput) (*proto.LoginResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "CompleteLoginMFA")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	return loginResponse(u.userService.CompleteLoginMFA(ctx, input.ChallengeToken, input.Code))
+}
+
+// RequestMagicLink is the grpc handler to email a passwordless login link to
+// a user, it responds the same whether or not a user has the email.
+func (u *UserServiceServer) RequestMagicLink(ctx context.Context, input *proto.RequestMagicLinkInput) (*proto.RequestMagicLinkResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RequestMagicLink")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	err := u.userService.RequestMagicLink(ctx, input.Email)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
+	}
+	return &proto.RequestMagicLinkResponse{}, nil
+}
+
+// ConsumeMagicLink is the grpc handler to log a user in with the token of a
+// magic link, it responds like LoginUser.
+func (u *UserServiceServer) ConsumeMagicLink(ctx context.Context, input *proto.ConsumeMagicLinkInput) (*proto.LoginResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ConsumeMagicLink")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	return loginResponse(u.userService.ConsumeMagicLink(ctx, input.Token))
+}
+
+// LoginWithIDToken is the grpc handler to log a user in with the ID token of an
+// OpenID Connect provider, it responds like LoginUser.
+func (u *UserServiceServer) LoginWithIDToken(ctx context.Context, input *proto.LoginWithIDTokenInput) (*proto.LoginResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "LoginWithIDToken")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	return loginResponse(u.userService.LoginWithIDToken(ctx, input.Provider, input.IdToken, input.Nonce))
+}
+
+// loginResponse converts the result of a service login into the response of
+// the login rpcs, a required second factor is a response rather than an
+// error.
+func loginResponse(usr *users.User, tokens *sessions.TokenPair, err error) (*proto.LoginResponse, error) {
+	var mfaErr *services.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		return &proto.LoginResponse{
+			MfaRequired:           true,
+			MfaChallengeToken:     mfaErr.ChallengeToken,
+			MfaChallengeExpiresAt: timestamppb.New(mfaErr.ExpiresAt),
+		}, nil
+	}
+	if err != nil {
+		return nil, toStatusError(err)
 	}
 	return &proto.LoginResponse{
-		User:     InternalToProtoUser(usr),
-		JwtToken: jwtToken,
+		User:                  InternalToProtoUser(usr),
+		JwtToken:              tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(tokens.AccessTokenExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+	}, nil
+}
+
+// RefreshToken is the grpc handler to exchange a refresh token for new
+// tokens.
+func (u *UserServiceServer) RefreshToken(ctx context.Context, input *proto.RefreshTokenInput) (*proto.RefreshTokenResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RefreshToken")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	tokens, err := u.userService.RefreshToken(ctx, input.RefreshToken)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.RefreshTokenResponse{
+		AccessToken:           tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(tokens.AccessTokenExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
 	}, nil
 }
 
@@ -82,9 +263,329 @@ func (u *UserServiceServer) GetUserFromJWT(ctx context.Context, input *proto.Get
 	ctx = opentracing.ContextWithSpan(ctx, span)
 	usr, err := u.userService.GetUserFromJWT(ctx, input.JwtToken)
 	if err != nil {
-		return nil, err
+		return nil, toStatusError(err)
 	}
 	return &proto.GetUserFromJWTResponse{
 		User: InternalToProtoUser(usr),
 	}, nil
 }
+
+// LogoutUser is the grpc handler to end the session of an access token.
+func (u *UserServiceServer) LogoutUser(ctx context.Context, input *proto.LogoutUserInput) (*proto.LogoutUserResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "LogoutUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	err := u.userService.LogoutUser(ctx, input.JwtToken)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.LogoutUserResponse{}, nil
+}
+
+// RevokeAllSessions is the grpc handler to log a user out of every session.
+func (u *UserServiceServer) RevokeAllSessions(ctx context.Context, input *proto.RevokeAllSessionsInput) (*proto.RevokeAllSessionsResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RevokeAllSessions")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	revoked, err := u.userService.RevokeAllSessions(ctx, input.UserId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.RevokeAllSessionsResponse{
+		RevokedSessions: int32(revoked),
+	}, nil
+}
+
+// GetJWKS is the grpc handler returning the public keys verifying access
+// tokens.
+func (u *UserServiceServer) GetJWKS(ctx context.Context, input *proto.GetJWKSInput) (*proto.JSONWebKeySet, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "GetJWKS")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	jwks, err := u.userService.GetJWKS(ctx)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return InternalToProtoJWKS(jwks), nil
+}
+
+// RequestPasswordReset is the grpc handler to email a password reset token to
+// a user, it responds the same whether or not a user has the email.
+func (u *UserServiceServer) RequestPasswordReset(ctx context.Context, input *proto.RequestPasswordResetInput) (*proto.RequestPasswordResetResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RequestPasswordReset")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	err := u.userService.RequestPasswordReset(ctx, input.Email)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword is the grpc handler to set a new password with a password
+// reset token.
+func (u *UserServiceServer) ResetPassword(ctx context.Context, input *proto.ResetPasswordInput) (*proto.ResetPasswordResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ResetPassword")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	err := u.userService.ResetPassword(ctx, input.Token, input.NewPassword)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.ResetPasswordResponse{}, nil
+}
+
+// ChangePassword is the grpc handler to change the password of a user, the
+// tokens of a new session are returned as every other session is revoked.
+func (u *UserServiceServer) ChangePassword(ctx context.Context, input *proto.ChangePasswordInput) (*proto.ChangePasswordResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ChangePassword")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.userId", input.UserId)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	tokens, err := u.userService.ChangePassword(ctx, input.JwtToken, input.UserId, input.CurrentPassword, input.NewPassword)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.ChangePasswordResponse{
+		AccessToken:           tokens.AccessToken,
+		RefreshToken:          tokens.RefreshToken,
+		AccessTokenExpiresAt:  timestamppb.New(tokens.AccessTokenExpiresAt),
+		RefreshTokenExpiresAt: timestamppb.New(tokens.RefreshTokenExpiresAt),
+	}, nil
+}
+
+// BeginTOTPEnrollment is the grpc handler to start setting up TOTP two-factor
+// authentication for a user.
+func (u *UserServiceServer) BeginTOTPEnrollment(ctx context.Context, input *proto.BeginTOTPEnrollmentInput) (*proto.BeginTOTPEnrollmentResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "BeginTOTPEnrollment")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.userId", input.UserId)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	setup, err := u.userService.BeginTOTPEnrollment(ctx, input.JwtToken, input.UserId, input.CurrentPassword)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.BeginTOTPEnrollmentResponse{
+		Secret:     setup.Secret,
+		OtpauthUri: setup.URI,
+	}, nil
+}
+
+// ConfirmTOTPEnrollment is the grpc handler to enable TOTP two-factor
+// authentication with a first code, the recovery codes are returned once.
+func (u *UserServiceServer) ConfirmTOTPEnrollment(ctx context.Context, input *proto.ConfirmTOTPEnrollmentInput) (*proto.ConfirmTOTPEnrollmentResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ConfirmTOTPEnrollment")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.userId", input.UserId)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	recoveryCodes, err := u.userService.ConfirmTOTPEnrollment(ctx, input.JwtToken, input.UserId, input.Code)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.ConfirmTOTPEnrollmentResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+// VerifyEmail is the grpc handler to mark the email of a user as verified with
+// the token of a verification email.
+func (u *UserServiceServer) VerifyEmail(ctx context.Context, input *proto.VerifyEmailInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "VerifyEmail")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	usr, err := u.userService.VerifyEmail(ctx, input.Token)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return InternalToProtoUser(usr), nil
+}
+
+// ResendVerificationEmail is the grpc handler to send a new verification email
+// to a user, it responds the same whether or not a user has the email.
+func (u *UserServiceServer) ResendVerificationEmail(ctx context.Context, input *proto.ResendVerificationEmailInput) (*proto.ResendVerificationEmailResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ResendVerificationEmail")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	ctx = services.WithClientIP(ctx, clientIP(ctx))
+	err := u.userService.ResendVerificationEmail(ctx, input.Email)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.ResendVerificationEmailResponse{}, nil
+}
+
+// UpdateUser is the grpc handler to update the fields of a user listed in the
+// update mask.
+func (u *UserServiceServer) UpdateUser(ctx context.Context, input *proto.UpdateUserInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "UpdateUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	usr, err := u.userService.UpdateUser(ctx, input.Id, ProtoUpdateUserToInternalUser(input), input.UpdateMask.GetPaths(), input.Version)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return InternalToProtoUser(usr), nil
+}
+
+// DeleteUser is the grpc handler to soft delete a user.
+func (u *UserServiceServer) DeleteUser(ctx context.Context, input *proto.DeleteUserInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "DeleteUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	usr, err := u.userService.DeleteUser(ctx, input.Id)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return InternalToProtoUser(usr), nil
+}
+
+// RestoreUser is the grpc handler to restore a soft deleted user.
+func (u *UserServiceServer) RestoreUser(ctx context.Context, input *proto.RestoreUserInput) (*proto.User, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RestoreUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	usr, err := u.userService.RestoreUser(ctx, input.Id)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return InternalToProtoUser(usr), nil
+}
+
+// PurgeUser is the grpc handler to permanently remove a user.
+func (u *UserServiceServer) PurgeUser(ctx context.Context, input *proto.PurgeUserInput) (*proto.PurgeUserResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "PurgeUser")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	err := u.userService.PurgeUser(ctx, input.Id)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.PurgeUserResponse{}, nil
+}
+
+// CreateServiceAccount is the grpc handler to create a service account along
+// with its first API key.
+func (u *UserServiceServer) CreateServiceAccount(ctx context.Context, input *proto.CreateServiceAccountInput) (*proto.CreateServiceAccountResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "CreateServiceAccount")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	account, key, err := u.userService.CreateServiceAccount(ctx, input.Name, input.Scopes)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.CreateServiceAccountResponse{
+		ServiceAccount: InternalToProtoServiceAccount(account),
+		Key:            InternalToProtoAPIKey(&key.Key),
+		ApiKey:         key.APIKey,
+	}, nil
+}
+
+// ListServiceAccounts is the grpc handler to list every service account.
+func (u *UserServiceServer) ListServiceAccounts(ctx context.Context, input *proto.ListServiceAccountsInput) (*proto.ListServiceAccountsResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ListServiceAccounts")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	accounts, err := u.userService.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	res := &proto.ListServiceAccountsResponse{}
+	for i := range accounts {
+		res.ServiceAccounts = append(res.ServiceAccounts, InternalToProtoServiceAccount(&accounts[i]))
+	}
+	return res, nil
+}
+
+// ListAPIKeys is the grpc handler to list the API keys of a service account.
+func (u *UserServiceServer) ListAPIKeys(ctx context.Context, input *proto.ListAPIKeysInput) (*proto.ListAPIKeysResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ListAPIKeys")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	keys, err := u.userService.ListAPIKeys(ctx, input.ServiceAccountId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	res := &proto.ListAPIKeysResponse{}
+	for i := range keys {
+		res.Keys = append(res.Keys, InternalToProtoAPIKey(&keys[i]))
+	}
+	return res, nil
+}
+
+// RotateAPIKey is the grpc handler to issue a new API key to a service
+// account and expire its other keys after the grace period.
+func (u *UserServiceServer) RotateAPIKey(ctx context.Context, input *proto.RotateAPIKeyInput) (*proto.RotateAPIKeyResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RotateAPIKey")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	key, err := u.userService.RotateAPIKey(ctx, input.ServiceAccountId, input.GetGracePeriod().AsDuration())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.RotateAPIKeyResponse{
+		Key:    InternalToProtoAPIKey(&key.Key),
+		ApiKey: key.APIKey,
+	}, nil
+}
+
+// RevokeAPIKey is the grpc handler to revoke an API key right away.
+func (u *UserServiceServer) RevokeAPIKey(ctx context.Context, input *proto.RevokeAPIKeyInput) (*proto.RevokeAPIKeyResponse, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "RevokeAPIKey")
+	defer span.Finish()
+	ext.SpanKindRPCServer.Set(span)
+	span.SetTag("param.input", input)
+
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	err := u.userService.RevokeAPIKey(ctx, input.KeyId)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+	return &proto.RevokeAPIKeyResponse{}, nil
+}
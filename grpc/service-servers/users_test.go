@@ -5,11 +5,25 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/mocks"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestUserServiceServer_CreateUser(t *testing.T) {
@@ -83,46 +97,74 @@ func TestUserServiceServer_CreateUser(t *testing.T) {
 }
 
 func TestUserServiceServer_GetUsers(t *testing.T) {
+	createdAfter := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
 	userService := &mocks.UserService{}
-	userService.On("GetUsers", mock.Anything, "invalid", int32(100)).Return(nil, errors.New("an error occured"))
-	userService.On("GetUsers", mock.Anything, "valid", int32(3)).Return([]users.User{
-		{FullName: "John"}, {FullName: "Jane"}, {FullName: "Doe"},
+	userService.On("GetUsers", mock.Anything, users.GetUsersRequest{Limit: 100, Country: "invalid"}).Return(nil, errors.New("an error occured"))
+	userService.On("GetUsers", mock.Anything, users.GetUsersRequest{
+		Limit:             3,
+		PageToken:         "next",
+		SortBy:            users.SortByFullName,
+		Descending:        true,
+		Country:           "valid",
+		CreatedAfter:      createdAfter,
+		IncludeTotalCount: true,
+	}).Return(&users.GetUsersResponse{
+		Users:         []users.User{{FullName: "John"}, {FullName: "Jane"}, {FullName: "Doe"}},
+		NextPageToken: "next.next",
+		PrevPageToken: "prev",
+		TotalCount:    10,
 	}, nil)
-	userService.On("GetUsers", mock.Anything, "empty", int32(0)).Return(nil, nil)
+	userService.On("GetUsers", mock.Anything, users.GetUsersRequest{Country: "empty"}).Return(&users.GetUsersResponse{}, nil)
+	userService.On("GetUsers", mock.Anything, users.GetUsersRequest{PageToken: "tampered"}).Return(nil, services.ErrInvalidPageToken)
 
 	tests := []struct {
-		name                string
-		filter              *proto.GetUsersFilter
-		serviceGetUsersFunc func(ctx context.Context, afterId string, limit int32) ([]users.User, error)
-		want                *proto.GetUsersResponse
-		wantErr             bool
+		name     string
+		req      *proto.GetUsersRequest
+		want     *proto.GetUsersResponse
+		wantCode codes.Code
 	}{
 		{
-			name:    "GetUsers service implementation with error",
-			filter:  &proto.GetUsersFilter{AfterId: "invalid", Limit: 100},
-			wantErr: true,
+			name:     "GetUsers service implementation with error",
+			req:      &proto.GetUsersRequest{Limit: 100, Country: "invalid"},
+			wantCode: codes.Unknown,
 		},
 		{
-			name:   "GetUsers service implementation without error",
-			filter: &proto.GetUsersFilter{AfterId: "valid", Limit: 3},
+			name: "GetUsers service implementation without error",
+			req: &proto.GetUsersRequest{
+				Limit:             3,
+				PageToken:         "next",
+				SortBy:            proto.UserSortField_USER_SORT_FIELD_FULL_NAME,
+				SortDirection:     proto.SortDirection_SORT_DIRECTION_DESCENDING,
+				Country:           "valid",
+				CreatedAfter:      timestamppb.New(createdAfter),
+				IncludeTotalCount: true,
+			},
 			want: &proto.GetUsersResponse{
 				Users: []*proto.User{
 					{FullName: "John"}, {FullName: "Jane"}, {FullName: "Doe"},
 				},
+				NextPageToken: "next.next",
+				PrevPageToken: "prev",
+				TotalCount:    10,
 			},
 		},
 		{
-			name:   "GetUsers service implementation with empty reponse",
-			filter: &proto.GetUsersFilter{AfterId: "empty"},
-			want:   &proto.GetUsersResponse{Users: nil},
+			name: "GetUsers service implementation with empty reponse",
+			req:  &proto.GetUsersRequest{Country: "empty"},
+			want: &proto.GetUsersResponse{Users: nil},
+		},
+		{
+			name:     "invalid page token",
+			req:      &proto.GetUsersRequest{PageToken: "tampered"},
+			wantCode: codes.InvalidArgument,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			u := NewUserServiceServer(userService)
-			got, err := u.GetUsers(context.Background(), tt.filter)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("UserServiceServer.GetUsers() error = %v, wantErr %v", err, tt.wantErr)
+			got, err := u.GetUsers(context.Background(), tt.req)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.GetUsers() error = %v, wantCode %v", err, tt.wantCode)
 				return
 			}
 			if !reflect.DeepEqual(got, tt.want) {
@@ -132,15 +174,200 @@ func TestUserServiceServer_GetUsers(t *testing.T) {
 	}
 }
 
+func TestUserServiceServer_SearchUsers(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("SearchUsers", mock.Anything, "error", int32(0)).Return(nil, services.ErrSearchDisabled)
+	userService.On("SearchUsers", mock.Anything, "john", int32(5)).Return([]search.Hit{
+		{User: users.User{ID: "1", FullName: "John Doe"}, Score: 2, Highlights: map[string]string{"fullName": "<em>John</em> Doe"}},
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.SearchUsersInput
+		want     *proto.SearchUsersResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "SearchUsers service implementation with error",
+			input:    &proto.SearchUsersInput{Query: "error"},
+			wantCode: codes.Unimplemented,
+		},
+		{
+			name:  "SearchUsers service implementation without error",
+			input: &proto.SearchUsersInput{Query: "john", Limit: 5},
+			want: &proto.SearchUsersResponse{
+				Hits: []*proto.UserSearchHit{
+					{
+						User:       &proto.User{Id: "1", FullName: "John Doe"},
+						Score:      2,
+						Highlights: map[string]string{"fullName": "<em>John</em> Doe"},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.SearchUsers(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.SearchUsers() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.SearchUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_BatchGetUsers(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("BatchGetUsers", mock.Anything, []string(nil)).Return(nil, nil, errors.New("at least one user id is required"))
+	userService.On("BatchGetUsers", mock.Anything, []string{"1", "missing"}).Return([]users.User{{ID: "1", FullName: "John"}}, []string{"missing"}, nil)
+
+	tests := []struct {
+		name    string
+		input   *proto.BatchGetUsersInput
+		want    *proto.BatchGetUsersResponse
+		wantErr bool
+	}{
+		{
+			name:    "BatchGetUsers service implementation with error",
+			input:   &proto.BatchGetUsersInput{},
+			wantErr: true,
+		},
+		{
+			name:  "BatchGetUsers service implementation without error",
+			input: &proto.BatchGetUsersInput{Ids: []string{"1", "missing"}},
+			want: &proto.BatchGetUsersResponse{
+				Users:      []*proto.User{{Id: "1", FullName: "John"}},
+				MissingIds: []string{"missing"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.BatchGetUsers(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceServer.BatchGetUsers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.BatchGetUsers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_GetUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("GetUser", mock.Anything, "missing").Return(nil, users.ErrUserNotFound)
+	userService.On("GetUser", mock.Anything, "valid").Return(&users.User{
+		ID: "valid", FullName: "John Doe", Email: "john@example.com", Country: "Nigeria", Version: 2,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.GetUserInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "missing user",
+			input:    &proto.GetUserInput{Id: "missing"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "no read mask",
+			input: &proto.GetUserInput{Id: "valid"},
+			want:  &proto.User{Id: "valid", FullName: "John Doe", Email: "john@example.com", Country: "Nigeria", Version: 2},
+		},
+		{
+			name:  "read mask",
+			input: &proto.GetUserInput{Id: "valid", ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"id", "fullName"}}},
+			want:  &proto.User{Id: "valid", FullName: "John Doe"},
+		},
+		{
+			name:     "unknown field in read mask",
+			input:    &proto.GetUserInput{Id: "valid", ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"password"}}},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.GetUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.GetUser() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.GetUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_GetUserByEmail(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("GetUserByEmail", mock.Anything, "missing@example.com").Return(nil, users.ErrUserNotFound)
+	userService.On("GetUserByEmail", mock.Anything, "john@example.com").Return(&users.User{
+		ID: "valid", FullName: "John Doe", Email: "john@example.com", Country: "Nigeria",
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.GetUserByEmailInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "missing user",
+			input:    &proto.GetUserByEmailInput{Email: "missing@example.com"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "read mask",
+			input: &proto.GetUserByEmailInput{Email: "john@example.com", ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"id", "country"}}},
+			want:  &proto.User{Id: "valid", Country: "Nigeria"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.GetUserByEmail(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.GetUserByEmail() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.GetUserByEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUserServiceServer_LoginUser(t *testing.T) {
 	userService := &mocks.UserService{}
 	userService.On("LoginUser", mock.Anything, "invalid@example.com", "123456").
-		Return(nil, "", errors.New("an error occured"))
+		Return(nil, nil, errors.New("an error occured"))
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
 	userService.On("LoginUser", mock.Anything, "valid@example.com", "123456").
 		Return(&users.User{
 			ID:       "valid.user",
 			FullName: "Valid User",
-		}, "theJwtToken", nil)
+		}, &sessions.TokenPair{
+			AccessToken:           "theJwtToken",
+			AccessTokenExpiresAt:  accessTokenExpiresAt,
+			RefreshToken:          "theRefreshToken",
+			RefreshTokenExpiresAt: refreshTokenExpiresAt,
+		}, nil)
+	challengeExpiresAt := time.Date(2021, 11, 7, 12, 5, 0, 0, time.UTC)
+	userService.On("LoginUser", mock.Anything, "mfa@example.com", "123456").
+		Return(nil, nil, &services.MFARequiredError{ChallengeToken: "theChallengeToken", ExpiresAt: challengeExpiresAt})
 
 	type args struct {
 		input *proto.LoginInput
@@ -170,7 +397,22 @@ func TestUserServiceServer_LoginUser(t *testing.T) {
 					Id:       "valid.user",
 					FullName: "Valid User",
 				},
-				JwtToken: "theJwtToken",
+				JwtToken:              "theJwtToken",
+				RefreshToken:          "theRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+		},
+		{
+			name: "LoginUser service implementation requiring mfa",
+			args: args{input: &proto.LoginInput{
+				Email:    "mfa@example.com",
+				Password: "123456",
+			}},
+			want: &proto.LoginResponse{
+				MfaRequired:           true,
+				MfaChallengeToken:     "theChallengeToken",
+				MfaChallengeExpiresAt: timestamppb.New(challengeExpiresAt),
 			},
 		},
 	}
@@ -189,6 +431,283 @@ func TestUserServiceServer_LoginUser(t *testing.T) {
 	}
 }
 
+func TestUserServiceServer_CompleteLoginMFA(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("CompleteLoginMFA", mock.Anything, "theChallengeToken", "000000").Return(nil, nil, services.ErrInvalidMFACode)
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
+	userService.On("CompleteLoginMFA", mock.Anything, "theChallengeToken", "287082").Return(&users.User{
+		ID:       "valid.user",
+		FullName: "Valid User",
+	}, &sessions.TokenPair{
+		AccessToken:           "theJwtToken",
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          "theRefreshToken",
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.CompleteLoginMFAInput
+		want     *proto.LoginResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "invalid code",
+			input:    &proto.CompleteLoginMFAInput{ChallengeToken: "theChallengeToken", Code: "000000"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:  "valid code",
+			input: &proto.CompleteLoginMFAInput{ChallengeToken: "theChallengeToken", Code: "287082"},
+			want: &proto.LoginResponse{
+				User: &proto.User{
+					Id:       "valid.user",
+					FullName: "Valid User",
+				},
+				JwtToken:              "theJwtToken",
+				RefreshToken:          "theRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.CompleteLoginMFA(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.CompleteLoginMFA() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.CompleteLoginMFA() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RequestMagicLink(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("RequestMagicLink", mock.Anything, "").Return(errors.New("email is required"))
+	userService.On("RequestMagicLink", mock.Anything, "john@example.com").Return(nil)
+
+	tests := []struct {
+		name    string
+		input   *proto.RequestMagicLinkInput
+		want    *proto.RequestMagicLinkResponse
+		wantErr bool
+	}{
+		{
+			name:    "empty email",
+			input:   &proto.RequestMagicLinkInput{},
+			wantErr: true,
+		},
+		{
+			name:  "valid email",
+			input: &proto.RequestMagicLinkInput{Email: "john@example.com"},
+			want:  &proto.RequestMagicLinkResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RequestMagicLink(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceServer.RequestMagicLink() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RequestMagicLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_ConsumeMagicLink(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("ConsumeMagicLink", mock.Anything, "usedToken").Return(nil, nil, onetime.ErrInvalidToken)
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
+	userService.On("ConsumeMagicLink", mock.Anything, "validToken").Return(&users.User{
+		ID:       "valid.user",
+		FullName: "Valid User",
+	}, &sessions.TokenPair{
+		AccessToken:           "theJwtToken",
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          "theRefreshToken",
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil)
+	challengeExpiresAt := time.Date(2021, 11, 7, 12, 5, 0, 0, time.UTC)
+	userService.On("ConsumeMagicLink", mock.Anything, "mfaToken").
+		Return(nil, nil, &services.MFARequiredError{ChallengeToken: "theChallengeToken", ExpiresAt: challengeExpiresAt})
+
+	tests := []struct {
+		name     string
+		input    *proto.ConsumeMagicLinkInput
+		want     *proto.LoginResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "used token",
+			input:    &proto.ConsumeMagicLinkInput{Token: "usedToken"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:  "valid token",
+			input: &proto.ConsumeMagicLinkInput{Token: "validToken"},
+			want: &proto.LoginResponse{
+				User: &proto.User{
+					Id:       "valid.user",
+					FullName: "Valid User",
+				},
+				JwtToken:              "theJwtToken",
+				RefreshToken:          "theRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name:  "user requiring mfa",
+			input: &proto.ConsumeMagicLinkInput{Token: "mfaToken"},
+			want: &proto.LoginResponse{
+				MfaRequired:           true,
+				MfaChallengeToken:     "theChallengeToken",
+				MfaChallengeExpiresAt: timestamppb.New(challengeExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.ConsumeMagicLink(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.ConsumeMagicLink() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.ConsumeMagicLink() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_LoginWithIDToken(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("LoginWithIDToken", mock.Anything, "unknown", "theIdToken", "").Return(nil, nil, services.ErrUnknownProvider)
+	userService.On("LoginWithIDToken", mock.Anything, "google", "expiredIdToken", "").Return(nil, nil, oidc.ErrInvalidIDToken)
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
+	userService.On("LoginWithIDToken", mock.Anything, "google", "theIdToken", "theNonce").Return(&users.User{
+		ID:       "valid.user",
+		FullName: "Valid User",
+	}, &sessions.TokenPair{
+		AccessToken:           "theJwtToken",
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          "theRefreshToken",
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.LoginWithIDTokenInput
+		want     *proto.LoginResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "unknown provider",
+			input:    &proto.LoginWithIDTokenInput{Provider: "unknown", IdToken: "theIdToken"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid id token",
+			input:    &proto.LoginWithIDTokenInput{Provider: "google", IdToken: "expiredIdToken"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:  "valid id token",
+			input: &proto.LoginWithIDTokenInput{Provider: "google", IdToken: "theIdToken", Nonce: "theNonce"},
+			want: &proto.LoginResponse{
+				User: &proto.User{
+					Id:       "valid.user",
+					FullName: "Valid User",
+				},
+				JwtToken:              "theJwtToken",
+				RefreshToken:          "theRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.LoginWithIDToken(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.LoginWithIDToken() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.LoginWithIDToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RefreshToken(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("RefreshToken", mock.Anything, "usedRefreshToken").Return(nil, sessions.ErrRefreshTokenReused)
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
+	userService.On("RefreshToken", mock.Anything, "theRefreshToken").Return(&sessions.TokenPair{
+		AccessToken:           "newJwtToken",
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          "newRefreshToken",
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.RefreshTokenInput
+		want     *proto.RefreshTokenResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "reused refresh token",
+			input:    &proto.RefreshTokenInput{RefreshToken: "usedRefreshToken"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:  "valid refresh token",
+			input: &proto.RefreshTokenInput{RefreshToken: "theRefreshToken"},
+			want: &proto.RefreshTokenResponse{
+				AccessToken:           "newJwtToken",
+				RefreshToken:          "newRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RefreshToken(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.RefreshToken() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RefreshToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestUserServiceServer_GetUserFromJWT(t *testing.T) {
 	userService := &mocks.UserService{}
 	userService.On("GetUserFromJWT", mock.Anything, "invalidJwtToken").Return(nil, errors.New("an error occured"))
@@ -242,3 +761,635 @@ func TestUserServiceServer_GetUserFromJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestUserServiceServer_LogoutUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("LogoutUser", mock.Anything, "revokedJwtToken").Return(services.ErrTokenRevoked)
+	userService.On("LogoutUser", mock.Anything, "validJwtToken").Return(nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.LogoutUserInput
+		want     *proto.LogoutUserResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "revoked jwt token",
+			input:    &proto.LogoutUserInput{JwtToken: "revokedJwtToken"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "valid jwt token",
+			input:    &proto.LogoutUserInput{JwtToken: "validJwtToken"},
+			want:     &proto.LogoutUserResponse{},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.LogoutUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.LogoutUser() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.LogoutUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RevokeAllSessions(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("RevokeAllSessions", mock.Anything, "").Return(0, errors.New("user id is required"))
+	userService.On("RevokeAllSessions", mock.Anything, "user.valid").Return(3, nil)
+
+	tests := []struct {
+		name    string
+		input   *proto.RevokeAllSessionsInput
+		want    *proto.RevokeAllSessionsResponse
+		wantErr bool
+	}{
+		{
+			name:    "RevokeAllSessions service implementation with error",
+			input:   &proto.RevokeAllSessionsInput{},
+			wantErr: true,
+		},
+		{
+			name:  "RevokeAllSessions service implementation without error",
+			input: &proto.RevokeAllSessionsInput{UserId: "user.valid"},
+			want:  &proto.RevokeAllSessionsResponse{RevokedSessions: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RevokeAllSessions(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceServer.RevokeAllSessions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RevokeAllSessions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_GetJWKS(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("GetJWKS", mock.Anything).Return(&keyring.JWKS{Keys: []keyring.JWK{
+		{KeyType: "EC", KeyID: "2021-11", Use: "sig", Algorithm: "ES256", Curve: "P-256", X: "theX", Y: "theY"},
+		{KeyType: "RSA", KeyID: "2021-10", Use: "sig", Algorithm: "RS256", N: "theN", E: "AQAB"},
+	}}, nil)
+
+	u := NewUserServiceServer(userService)
+	got, err := u.GetJWKS(context.Background(), &proto.GetJWKSInput{})
+	if err != nil {
+		t.Fatalf("UserServiceServer.GetJWKS() error = %v", err)
+	}
+	want := &proto.JSONWebKeySet{Keys: []*proto.JSONWebKey{
+		{Kty: "EC", Kid: "2021-11", Use: "sig", Alg: "ES256", Crv: "P-256", X: "theX", Y: "theY"},
+		{Kty: "RSA", Kid: "2021-10", Use: "sig", Alg: "RS256", N: "theN", E: "AQAB"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UserServiceServer.GetJWKS() = %v, want %v", got, want)
+	}
+}
+
+func TestUserServiceServer_UpdateUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("UpdateUser", mock.Anything, "user.missing", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, users.ErrUserNotFound)
+	userService.On("UpdateUser", mock.Anything, "user.stale", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, users.ErrVersionConflict)
+	userService.On("UpdateUser", mock.Anything, "user.valid", &users.User{ID: "user.valid", FullName: "New Name", Version: 2}, []string{"fullName"}, int64(2)).
+		Return(&users.User{
+			ID:       "user.valid",
+			FullName: "New Name",
+			Country:  "Nigeria",
+			Version:  3,
+		}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.UpdateUserInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "user does not exist",
+			input:    &proto.UpdateUserInput{Id: "user.missing", Country: "Ghana", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"country"}}},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "stale version",
+			input:    &proto.UpdateUserInput{Id: "user.stale", Country: "Ghana", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"country"}}},
+			wantCode: codes.Aborted,
+		},
+		{
+			name: "UpdateUser service implementation without error",
+			input: &proto.UpdateUserInput{
+				Id:         "user.valid",
+				FullName:   "New Name",
+				UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"fullName"}},
+				Version:    2,
+			},
+			want: &proto.User{
+				Id:       "user.valid",
+				FullName: "New Name",
+				Country:  "Nigeria",
+				Version:  3,
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.UpdateUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.UpdateUser() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.UpdateUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_DeleteUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("DeleteUser", mock.Anything, "user.missing").Return(nil, users.ErrUserNotFound)
+	userService.On("DeleteUser", mock.Anything, "user.valid").Return(&users.User{ID: "user.valid", FullName: "Valid User"}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.DeleteUserInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "user does not exist",
+			input:    &proto.DeleteUserInput{Id: "user.missing"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "DeleteUser service implementation without error",
+			input: &proto.DeleteUserInput{Id: "user.valid"},
+			want:  &proto.User{Id: "user.valid", FullName: "Valid User"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.DeleteUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.DeleteUser() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.DeleteUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RestoreUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("RestoreUser", mock.Anything, "user.missing").Return(nil, users.ErrUserNotFound)
+	userService.On("RestoreUser", mock.Anything, "user.valid").Return(&users.User{ID: "user.valid", FullName: "Valid User"}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.RestoreUserInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "user is not deleted",
+			input:    &proto.RestoreUserInput{Id: "user.missing"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "RestoreUser service implementation without error",
+			input: &proto.RestoreUserInput{Id: "user.valid"},
+			want:  &proto.User{Id: "user.valid", FullName: "Valid User"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RestoreUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.RestoreUser() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RestoreUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_PurgeUser(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("PurgeUser", mock.Anything, "user.missing").Return(users.ErrUserNotFound)
+	userService.On("PurgeUser", mock.Anything, "user.valid").Return(nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.PurgeUserInput
+		want     *proto.PurgeUserResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "user does not exist",
+			input:    &proto.PurgeUserInput{Id: "user.missing"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "PurgeUser service implementation without error",
+			input: &proto.PurgeUserInput{Id: "user.valid"},
+			want:  &proto.PurgeUserResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.PurgeUser(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.PurgeUser() error = %v, wantCode %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.PurgeUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RequestPasswordReset(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("RequestPasswordReset", mock.Anything, "").Return(errors.New("email is required"))
+	userService.On("RequestPasswordReset", mock.Anything, "john@example.com").Return(nil)
+
+	tests := []struct {
+		name    string
+		input   *proto.RequestPasswordResetInput
+		want    *proto.RequestPasswordResetResponse
+		wantErr bool
+	}{
+		{
+			name:    "empty email",
+			input:   &proto.RequestPasswordResetInput{},
+			wantErr: true,
+		},
+		{
+			name:  "valid email",
+			input: &proto.RequestPasswordResetInput{Email: "john@example.com"},
+			want:  &proto.RequestPasswordResetResponse{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RequestPasswordReset(context.Background(), tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceServer.RequestPasswordReset() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RequestPasswordReset() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_ResetPassword(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("ResetPassword", mock.Anything, "usedToken", "654321").Return(onetime.ErrInvalidToken)
+	userService.On("ResetPassword", mock.Anything, "validToken", "654321").Return(nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.ResetPasswordInput
+		want     *proto.ResetPasswordResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "used token",
+			input:    &proto.ResetPasswordInput{Token: "usedToken", NewPassword: "654321"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "valid token",
+			input:    &proto.ResetPasswordInput{Token: "validToken", NewPassword: "654321"},
+			want:     &proto.ResetPasswordResponse{},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.ResetPassword(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.ResetPassword() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.ResetPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_ChangePassword(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("ChangePassword", mock.Anything, "token.valid", "user.valid", "000000", "654321").Return(nil, services.ErrIncorrectPassword)
+	accessTokenExpiresAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+	refreshTokenExpiresAt := accessTokenExpiresAt.AddDate(0, 0, 30)
+	userService.On("ChangePassword", mock.Anything, "token.valid", "user.valid", "123456", "654321").Return(&sessions.TokenPair{
+		AccessToken:           "newJwtToken",
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          "newRefreshToken",
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.ChangePasswordInput
+		want     *proto.ChangePasswordResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "incorrect current password",
+			input:    &proto.ChangePasswordInput{JwtToken: "token.valid", UserId: "user.valid", CurrentPassword: "000000", NewPassword: "654321"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:  "correct current password",
+			input: &proto.ChangePasswordInput{JwtToken: "token.valid", UserId: "user.valid", CurrentPassword: "123456", NewPassword: "654321"},
+			want: &proto.ChangePasswordResponse{
+				AccessToken:           "newJwtToken",
+				RefreshToken:          "newRefreshToken",
+				AccessTokenExpiresAt:  timestamppb.New(accessTokenExpiresAt),
+				RefreshTokenExpiresAt: timestamppb.New(refreshTokenExpiresAt),
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.ChangePassword(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.ChangePassword() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.ChangePassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_BeginTOTPEnrollment(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("BeginTOTPEnrollment", mock.Anything, "token.valid", "user.enabled", "correct-horse-42").Return(nil, mfa.ErrAlreadyEnabled)
+	userService.On("BeginTOTPEnrollment", mock.Anything, "token.valid", "user.valid", "").Return(nil, services.ErrReauthenticationRequired)
+	userService.On("BeginTOTPEnrollment", mock.Anything, "token.valid", "user.valid", "correct-horse-42").Return(&mfa.Setup{
+		Secret: "JBSWY3DPEHPK3PXP",
+		URI:    "otpauth://totp/ecommerce:john@example.com?secret=JBSWY3DPEHPK3PXP",
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.BeginTOTPEnrollmentInput
+		want     *proto.BeginTOTPEnrollmentResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "already enabled",
+			input:    &proto.BeginTOTPEnrollmentInput{JwtToken: "token.valid", UserId: "user.enabled", CurrentPassword: "correct-horse-42"},
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "reauthentication required",
+			input:    &proto.BeginTOTPEnrollmentInput{JwtToken: "token.valid", UserId: "user.valid"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:  "new enrollment",
+			input: &proto.BeginTOTPEnrollmentInput{JwtToken: "token.valid", UserId: "user.valid", CurrentPassword: "correct-horse-42"},
+			want: &proto.BeginTOTPEnrollmentResponse{
+				Secret:     "JBSWY3DPEHPK3PXP",
+				OtpauthUri: "otpauth://totp/ecommerce:john@example.com?secret=JBSWY3DPEHPK3PXP",
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.BeginTOTPEnrollment(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.BeginTOTPEnrollment() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.BeginTOTPEnrollment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_ConfirmTOTPEnrollment(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("ConfirmTOTPEnrollment", mock.Anything, "token.valid", "user.valid", "000000").Return(nil, services.ErrInvalidMFACode)
+	userService.On("ConfirmTOTPEnrollment", mock.Anything, "token.valid", "user.valid", "287082").Return([]string{"k3jd-9fxq", "a7cm-2pzt"}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.ConfirmTOTPEnrollmentInput
+		want     *proto.ConfirmTOTPEnrollmentResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "invalid code",
+			input:    &proto.ConfirmTOTPEnrollmentInput{JwtToken: "token.valid", UserId: "user.valid", Code: "000000"},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "valid code",
+			input:    &proto.ConfirmTOTPEnrollmentInput{JwtToken: "token.valid", UserId: "user.valid", Code: "287082"},
+			want:     &proto.ConfirmTOTPEnrollmentResponse{RecoveryCodes: []string{"k3jd-9fxq", "a7cm-2pzt"}},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.ConfirmTOTPEnrollment(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.ConfirmTOTPEnrollment() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.ConfirmTOTPEnrollment() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_VerifyEmail(t *testing.T) {
+	userService := &mocks.UserService{}
+	userService.On("VerifyEmail", mock.Anything, "expiredToken").Return(nil, services.ErrInvalidVerificationToken)
+	userService.On("VerifyEmail", mock.Anything, "validToken").Return(&users.User{
+		ID:            "user.valid",
+		FullName:      "John Doe",
+		Email:         "john@example.com",
+		Version:       2,
+		EmailVerified: true,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.VerifyEmailInput
+		want     *proto.User
+		wantCode codes.Code
+	}{
+		{
+			name:     "expired token",
+			input:    &proto.VerifyEmailInput{Token: "expiredToken"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:  "valid token",
+			input: &proto.VerifyEmailInput{Token: "validToken"},
+			want: &proto.User{
+				Id:            "user.valid",
+				FullName:      "John Doe",
+				Email:         "john@example.com",
+				Version:       2,
+				EmailVerified: true,
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.VerifyEmail(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.VerifyEmail() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.VerifyEmail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_CreateServiceAccount(t *testing.T) {
+	createdAt := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	account := &apikeys.ServiceAccount{ID: "account.valid", Name: "nightly export", Scopes: []string{apikeys.ScopeUsersRead}, CreatedAt: createdAt}
+	key := &apikeys.IssuedKey{
+		Key:    apikeys.Key{ID: "key.valid", ServiceAccountID: "account.valid", Hint: "usk_AbCd", CreatedAt: createdAt},
+		APIKey: "usk_AbCdsecret",
+	}
+	userService := &mocks.UserService{}
+	userService.On("CreateServiceAccount", mock.Anything, "", []string{apikeys.ScopeUsersRead}).Return(nil, nil, &services.FieldError{
+		Violations: []services.FieldViolation{{Field: "name", Description: "is required"}},
+	})
+	userService.On("CreateServiceAccount", mock.Anything, "nightly export", []string{apikeys.ScopeUsersRead}).Return(account, key, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.CreateServiceAccountInput
+		want     *proto.CreateServiceAccountResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "invalid input",
+			input:    &proto.CreateServiceAccountInput{Scopes: []string{apikeys.ScopeUsersRead}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:  "valid input",
+			input: &proto.CreateServiceAccountInput{Name: "nightly export", Scopes: []string{apikeys.ScopeUsersRead}},
+			want: &proto.CreateServiceAccountResponse{
+				ServiceAccount: &proto.ServiceAccount{
+					Id:        "account.valid",
+					Name:      "nightly export",
+					Scopes:    []string{apikeys.ScopeUsersRead},
+					CreatedAt: timestamppb.New(createdAt),
+				},
+				Key:    &proto.APIKey{Id: "key.valid", ServiceAccountId: "account.valid", Hint: "usk_AbCd", CreatedAt: timestamppb.New(createdAt)},
+				ApiKey: "usk_AbCdsecret",
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.CreateServiceAccount(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.CreateServiceAccount() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.CreateServiceAccount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserServiceServer_RotateAPIKey(t *testing.T) {
+	createdAt := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	userService := &mocks.UserService{}
+	userService.On("RotateAPIKey", mock.Anything, "account.invalid", time.Duration(0)).Return(nil, apikeys.ErrServiceAccountNotFound)
+	userService.On("RotateAPIKey", mock.Anything, "account.valid", time.Hour).Return(&apikeys.IssuedKey{
+		Key:    apikeys.Key{ID: "key.valid", ServiceAccountID: "account.valid", Hint: "usk_AbCd", CreatedAt: createdAt},
+		APIKey: "usk_AbCdsecret",
+	}, nil)
+
+	tests := []struct {
+		name     string
+		input    *proto.RotateAPIKeyInput
+		want     *proto.RotateAPIKeyResponse
+		wantCode codes.Code
+	}{
+		{
+			name:     "unknown service account without grace period",
+			input:    &proto.RotateAPIKeyInput{ServiceAccountId: "account.invalid"},
+			wantCode: codes.NotFound,
+		},
+		{
+			name:  "service account with grace period",
+			input: &proto.RotateAPIKeyInput{ServiceAccountId: "account.valid", GracePeriod: durationpb.New(time.Hour)},
+			want: &proto.RotateAPIKeyResponse{
+				Key:    &proto.APIKey{Id: "key.valid", ServiceAccountId: "account.valid", Hint: "usk_AbCd", CreatedAt: timestamppb.New(createdAt)},
+				ApiKey: "usk_AbCdsecret",
+			},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewUserServiceServer(userService)
+			got, err := u.RotateAPIKey(context.Background(), tt.input)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("UserServiceServer.RotateAPIKey() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("UserServiceServer.RotateAPIKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
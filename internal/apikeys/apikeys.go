@@ -0,0 +1,170 @@
+// Package apikeys keeps the service accounts other services and batch jobs
+// authenticate as, and their API keys. Keys are stored hashed and carry a
+// prefix so that leaked keys are easy to spot.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrKeyNotFound            = errors.New("api key not found")
+	ErrInvalidKey             = errors.New("invalid api key")
+)
+
+// Scopes of service accounts.
+const (
+	// ScopeUsersRead allows reading, listing and searching users.
+	ScopeUsersRead = "users:read"
+	// ScopeUsersWrite allows updating, deleting and restoring users and
+	// revoking their sessions.
+	ScopeUsersWrite = "users:write"
+	// ScopeServiceAccountsAdmin allows managing service accounts and their
+	// keys.
+	ScopeServiceAccountsAdmin = "service-accounts:admin"
+)
+
+// KnownScopes lists the scopes service accounts can be given.
+var KnownScopes = []string{ScopeUsersRead, ScopeUsersWrite, ScopeServiceAccountsAdmin}
+
+// ValidScope reports whether scope is one of KnownScopes.
+func ValidScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceAccount is a non-human principal authenticating with API keys.
+type ServiceAccount struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	Scopes    []string  `json:"scopes" bson:"scopes"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Key is an API key of a service account, only its hash is stored.
+type Key struct {
+	ID               string `json:"id" bson:"_id"`
+	ServiceAccountID string `json:"serviceAccountId" bson:"serviceAccountId"`
+	Hash             string `json:"-" bson:"hash"`
+	// Hint is the start of the key, enough for people to tell keys apart.
+	Hint      string    `json:"hint" bson:"hint"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// ExpiresAt is set on the keys replaced by a rotation, they keep working
+	// until then.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// Active reports whether the key can be used at now.
+func (k *Key) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// IssuedKey is a key along with the secret API key, which is only known when
+// the key is issued.
+type IssuedKey struct {
+	Key
+	APIKey string
+}
+
+// Store keeps service accounts and their keys.
+type Store interface {
+	CreateServiceAccount(ctx context.Context, account *ServiceAccount) error
+	// GetServiceAccount returns the service account or
+	// ErrServiceAccountNotFound.
+	GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error)
+	// ListServiceAccounts returns every service account, oldest first.
+	ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error)
+	CreateKey(ctx context.Context, key *Key) error
+	// GetKeyByHash returns the key with the hash, whether or not it is
+	// active, or ErrKeyNotFound.
+	GetKeyByHash(ctx context.Context, hash string) (*Key, error)
+	// ListKeys returns the keys of the service account, oldest first.
+	ListKeys(ctx context.Context, serviceAccountID string) ([]Key, error)
+	// ExpireKeys makes the unrevoked keys of the service account expire at
+	// expiresAt at the latest, it returns how many keys it changed.
+	ExpireKeys(ctx context.Context, serviceAccountID string, expiresAt time.Time) (int, error)
+	// RevokeKey revokes the key and returns it, it returns ErrKeyNotFound
+	// when the key does not exist or is already revoked.
+	RevokeKey(ctx context.Context, id string, now time.Time) (*Key, error)
+}
+
+// Principal is the service account a request is authenticated as.
+type Principal struct {
+	ServiceAccountID string
+	Name             string
+	KeyID            string
+	Scopes           []string
+}
+
+// HasScope reports whether the principal was given scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of ctx, or nil when the request is not
+// authenticated with an API key.
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Prefix starts every API key.
+const Prefix = "usk_"
+
+// hintLength is how much of a key its hint keeps, the prefix and 4 random
+// characters.
+const hintLength = len(Prefix) + 4
+
+// NewKey returns a new random API key with its hash and hint.
+func NewKey() (apiKey, hash, hint string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", "", err
+	}
+	apiKey = Prefix + base64.RawURLEncoding.EncodeToString(b)
+	return apiKey, HashKey(apiKey), Hint(apiKey), nil
+}
+
+// Hint returns the hint of a well formed API key.
+func Hint(apiKey string) string {
+	return apiKey[:hintLength]
+}
+
+// HashKey returns the hash an API key is stored as. Keys are random, so a
+// fast hash is enough.
+func HashKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// WellFormed reports whether apiKey looks like a key made by NewKey, so that
+// other credentials are rejected without a lookup.
+func WellFormed(apiKey string) bool {
+	return strings.HasPrefix(apiKey, Prefix) && len(apiKey) == len(Prefix)+43
+}
@@ -0,0 +1,61 @@
+package apikeys
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	apiKey, hash, hint, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	if !strings.HasPrefix(apiKey, Prefix) || !WellFormed(apiKey) {
+		t.Errorf("NewKey() = %q, want a well formed key starting with %q", apiKey, Prefix)
+	}
+	if hash != HashKey(apiKey) || strings.Contains(hash, apiKey) {
+		t.Errorf("NewKey() hash = %q, want HashKey of the key", hash)
+	}
+	if !strings.HasPrefix(apiKey, hint) || len(hint) != len(Prefix)+4 {
+		t.Errorf("NewKey() hint = %q, want the prefix and 4 characters of the key", hint)
+	}
+	other, _, _, _ := NewKey()
+	if other == apiKey {
+		t.Errorf("NewKey() returned %q twice", apiKey)
+	}
+}
+
+func TestWellFormed(t *testing.T) {
+	apiKey, _, _, _ := NewKey()
+	tests := []struct {
+		apiKey string
+		want   bool
+	}{
+		{apiKey: apiKey, want: true},
+		{apiKey: "", want: false},
+		{apiKey: apiKey[len(Prefix):], want: false},
+		{apiKey: apiKey[:len(apiKey)-1], want: false},
+		{apiKey: "eyJhbGciOiJIUzI1NiJ9.e30.signature", want: false},
+	}
+	for _, tt := range tests {
+		if got := WellFormed(tt.apiKey); got != tt.want {
+			t.Errorf("WellFormed(%q) = %v, want %v", tt.apiKey, got, tt.want)
+		}
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	ctx := context.Background()
+	if got := FromContext(ctx); got != nil {
+		t.Errorf("FromContext() without a principal = %+v, want nil", got)
+	}
+	principal := &Principal{ServiceAccountID: "account-1", Scopes: []string{ScopeUsersRead}}
+	got := FromContext(NewContext(ctx, principal))
+	if got != principal {
+		t.Errorf("FromContext() = %+v, want %+v", got, principal)
+	}
+	if !got.HasScope(ScopeUsersRead) || got.HasScope(ScopeUsersWrite) {
+		t.Errorf("Principal.HasScope() with scopes %v is wrong", got.Scopes)
+	}
+}
@@ -0,0 +1,143 @@
+package apikeys
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long a CachedStore serves a key or a service account
+// when no TTL is given.
+const DefaultCacheTTL = 30 * time.Second
+
+// CachedStore is a Store that caches GetKeyByHash and GetServiceAccount, the
+// two lookups made to authenticate every request with an API key. Writes
+// through the store drop the whole cache, so a key revoked or expired on this
+// replica stops working right away, and on other replicas within the TTL.
+type CachedStore struct {
+	Store
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]cachedKey
+	accounts map[string]cachedServiceAccount
+	// generation is bumped by every write, lookups made across a write are
+	// not cached as they may be stale.
+	generation uint64
+}
+
+type cachedKey struct {
+	key       Key
+	expiresAt time.Time
+}
+
+type cachedServiceAccount struct {
+	account   ServiceAccount
+	expiresAt time.Time
+}
+
+// NewCachedStore returns store with its lookups cached for ttl,
+// DefaultCacheTTL when ttl is not positive. Misses are not cached.
+func NewCachedStore(store Store, ttl time.Duration) *CachedStore {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &CachedStore{
+		Store:    store,
+		ttl:      ttl,
+		now:      time.Now,
+		keys:     map[string]cachedKey{},
+		accounts: map[string]cachedServiceAccount{},
+	}
+}
+
+func (s *CachedStore) GetKeyByHash(ctx context.Context, hash string) (*Key, error) {
+	s.mu.Lock()
+	cached, ok := s.keys[hash]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && s.now().Before(cached.expiresAt) {
+		key := cached.key
+		return &key, nil
+	}
+	key, err := s.Store.GetKeyByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		s.sweep()
+		s.keys[hash] = cachedKey{key: *key, expiresAt: s.now().Add(s.ttl)}
+	}
+	return key, nil
+}
+
+func (s *CachedStore) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	s.mu.Lock()
+	cached, ok := s.accounts[id]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && s.now().Before(cached.expiresAt) {
+		account := cached.account
+		return &account, nil
+	}
+	account, err := s.Store.GetServiceAccount(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		s.sweep()
+		s.accounts[id] = cachedServiceAccount{account: *account, expiresAt: s.now().Add(s.ttl)}
+	}
+	return account, nil
+}
+
+func (s *CachedStore) CreateServiceAccount(ctx context.Context, account *ServiceAccount) error {
+	defer s.invalidate()
+	return s.Store.CreateServiceAccount(ctx, account)
+}
+
+func (s *CachedStore) CreateKey(ctx context.Context, key *Key) error {
+	defer s.invalidate()
+	return s.Store.CreateKey(ctx, key)
+}
+
+func (s *CachedStore) ExpireKeys(ctx context.Context, serviceAccountID string, expiresAt time.Time) (int, error) {
+	defer s.invalidate()
+	return s.Store.ExpireKeys(ctx, serviceAccountID, expiresAt)
+}
+
+func (s *CachedStore) RevokeKey(ctx context.Context, id string, now time.Time) (*Key, error) {
+	defer s.invalidate()
+	return s.Store.RevokeKey(ctx, id, now)
+}
+
+// invalidate drops every cached lookup, writes are rare enough that finer
+// invalidation is not worth it.
+func (s *CachedStore) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	s.keys = map[string]cachedKey{}
+	s.accounts = map[string]cachedServiceAccount{}
+}
+
+// sweep drops the expired lookups, so that keys and accounts no longer used
+// do not stay cached. It must be called with mu held.
+func (s *CachedStore) sweep() {
+	now := s.now()
+	for hash, cached := range s.keys {
+		if !now.Before(cached.expiresAt) {
+			delete(s.keys, hash)
+		}
+	}
+	for id, cached := range s.accounts {
+		if !now.Before(cached.expiresAt) {
+			delete(s.accounts, id)
+		}
+	}
+}
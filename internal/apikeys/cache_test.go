@@ -0,0 +1,97 @@
+package apikeys
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store {
+		return NewCachedStore(NewMemoryStore(), time.Minute)
+	})
+}
+
+func TestCachedStore_Lookups(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	backend := NewMemoryStore()
+	store := NewCachedStore(backend, time.Minute)
+	store.now = func() time.Time { return now }
+	createServiceAccount(t, store, "account", now)
+	key := createKey(t, store, "key", "account", now)
+
+	if _, err := store.GetKeyByHash(ctx, key.Hash); err != nil {
+		t.Fatalf("CachedStore.GetKeyByHash() error = %v", err)
+	}
+	if _, err := store.GetServiceAccount(ctx, "account"); err != nil {
+		t.Fatalf("CachedStore.GetServiceAccount() error = %v", err)
+	}
+	// Changes made behind the cache, as by another replica, are only seen
+	// once the TTL expires.
+	if _, err := backend.RevokeKey(ctx, "key", now); err != nil {
+		t.Fatalf("Store.RevokeKey() error = %v", err)
+	}
+	got, err := store.GetKeyByHash(ctx, key.Hash)
+	if err != nil || got.RevokedAt != nil {
+		t.Errorf("CachedStore.GetKeyByHash() = %+v, %v, want the cached unrevoked key", got, err)
+	}
+	now = now.Add(time.Minute)
+	got, err = store.GetKeyByHash(ctx, key.Hash)
+	if err != nil || got.RevokedAt == nil {
+		t.Errorf("CachedStore.GetKeyByHash() after the TTL = %+v, %v, want the revoked key", got, err)
+	}
+	if len(store.accounts) != 0 {
+		t.Errorf("CachedStore kept %d expired service accounts, want them swept", len(store.accounts))
+	}
+}
+
+func TestCachedStore_WritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewCachedStore(NewMemoryStore(), time.Hour)
+	createServiceAccount(t, store, "account", now)
+	key := createKey(t, store, "key", "account", now)
+	other := createKey(t, store, "other", "account", now)
+
+	if _, err := store.GetKeyByHash(ctx, key.Hash); err != nil {
+		t.Fatalf("CachedStore.GetKeyByHash() error = %v", err)
+	}
+	if _, err := store.RevokeKey(ctx, "key", now); err != nil {
+		t.Fatalf("CachedStore.RevokeKey() error = %v", err)
+	}
+	got, err := store.GetKeyByHash(ctx, key.Hash)
+	if err != nil || got.RevokedAt == nil {
+		t.Errorf("CachedStore.GetKeyByHash() after RevokeKey = %+v, %v, want the revoked key", got, err)
+	}
+
+	if _, err := store.GetKeyByHash(ctx, other.Hash); err != nil {
+		t.Fatalf("CachedStore.GetKeyByHash() error = %v", err)
+	}
+	if _, err := store.ExpireKeys(ctx, "account", now); err != nil {
+		t.Fatalf("CachedStore.ExpireKeys() error = %v", err)
+	}
+	got, err = store.GetKeyByHash(ctx, other.Hash)
+	if err != nil || got.ExpiresAt == nil {
+		t.Errorf("CachedStore.GetKeyByHash() after ExpireKeys = %+v, %v, want the expired key", got, err)
+	}
+}
+
+func TestCachedStore_MissesNotCached(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewCachedStore(NewMemoryStore(), time.Hour)
+	_, hash, _, _ := NewKey()
+	if _, err := store.GetKeyByHash(ctx, hash); err != ErrKeyNotFound {
+		t.Fatalf("CachedStore.GetKeyByHash() error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := store.GetServiceAccount(ctx, "account"); err != ErrServiceAccountNotFound {
+		t.Fatalf("CachedStore.GetServiceAccount() error = %v, want %v", err, ErrServiceAccountNotFound)
+	}
+	// The backend is written directly so that no invalidation hides a
+	// cached miss.
+	createServiceAccount(t, store.Store, "account", now)
+	if _, err := store.GetServiceAccount(ctx, "account"); err != nil {
+		t.Errorf("CachedStore.GetServiceAccount() error = %v, want the created account", err)
+	}
+}
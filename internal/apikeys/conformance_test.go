@@ -0,0 +1,187 @@
+package apikeys
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"api_keys", "service_accounts"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) Store {
+			return newStore(t).(Store)
+		})
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share,
+// newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "service accounts", test: testServiceAccounts},
+		{name: "keys", test: testKeys},
+		{name: "ExpireKeys", test: testExpireKeys},
+		{name: "RevokeKey", test: testRevokeKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// createServiceAccount stores a service account with the id created at
+// createdAt.
+func createServiceAccount(t *testing.T, store Store, id string, createdAt time.Time) *ServiceAccount {
+	account := &ServiceAccount{
+		ID:        id,
+		Name:      "batch job " + id,
+		Scopes:    []string{ScopeUsersRead, ScopeUsersWrite},
+		CreatedAt: createdAt.UTC().Truncate(time.Millisecond),
+	}
+	err := store.CreateServiceAccount(context.Background(), account)
+	if err != nil {
+		t.Fatalf("Store.CreateServiceAccount() error = %v", err)
+	}
+	return account
+}
+
+// createKey stores a new key of the service account created at createdAt.
+func createKey(t *testing.T, store Store, id, serviceAccountID string, createdAt time.Time) *Key {
+	_, hash, hint, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+	key := &Key{
+		ID:               id,
+		ServiceAccountID: serviceAccountID,
+		Hash:             hash,
+		Hint:             hint,
+		CreatedAt:        createdAt.UTC().Truncate(time.Millisecond),
+	}
+	err = store.CreateKey(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Store.CreateKey() error = %v", err)
+	}
+	return key
+}
+
+func testServiceAccounts(t *testing.T, store Store) {
+	ctx := context.Background()
+	if _, err := store.GetServiceAccount(ctx, "unknown"); err != ErrServiceAccountNotFound {
+		t.Errorf("Store.GetServiceAccount() of an unknown account error = %v, want %v", err, ErrServiceAccountNotFound)
+	}
+	accounts, err := store.ListServiceAccounts(ctx)
+	if err != nil || accounts == nil || len(accounts) != 0 {
+		t.Errorf("Store.ListServiceAccounts() of an empty store = %+v, %v, want an empty list", accounts, err)
+	}
+
+	now := time.Now()
+	second := createServiceAccount(t, store, "account-2", now.Add(time.Minute))
+	first := createServiceAccount(t, store, "account-1", now)
+	got, err := store.GetServiceAccount(ctx, first.ID)
+	if err != nil || got.Name != first.Name || !reflect.DeepEqual(got.Scopes, first.Scopes) || !got.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("Store.GetServiceAccount() = %+v, %v, want %+v", got, err, first)
+	}
+	accounts, err = store.ListServiceAccounts(ctx)
+	if err != nil || len(accounts) != 2 || accounts[0].ID != first.ID || accounts[1].ID != second.ID {
+		t.Errorf("Store.ListServiceAccounts() = %+v, %v, want account-1 and account-2", accounts, err)
+	}
+}
+
+func testKeys(t *testing.T, store Store) {
+	ctx := context.Background()
+	account := createServiceAccount(t, store, "account-1", time.Now())
+	other := createServiceAccount(t, store, "account-2", time.Now())
+	now := time.Now()
+	second := createKey(t, store, "key-2", account.ID, now.Add(time.Minute))
+	first := createKey(t, store, "key-1", account.ID, now)
+	createKey(t, store, "key-3", other.ID, now)
+
+	got, err := store.GetKeyByHash(ctx, first.Hash)
+	if err != nil || got.ID != first.ID || got.ServiceAccountID != account.ID || got.Hint != first.Hint ||
+		got.ExpiresAt != nil || got.RevokedAt != nil {
+		t.Errorf("Store.GetKeyByHash() = %+v, %v, want %+v", got, err, first)
+	}
+	if _, err := store.GetKeyByHash(ctx, HashKey("usk_unknown")); err != ErrKeyNotFound {
+		t.Errorf("Store.GetKeyByHash() of an unknown key error = %v, want %v", err, ErrKeyNotFound)
+	}
+	keys, err := store.ListKeys(ctx, account.ID)
+	if err != nil || len(keys) != 2 || keys[0].ID != first.ID || keys[1].ID != second.ID {
+		t.Errorf("Store.ListKeys() = %+v, %v, want key-1 and key-2", keys, err)
+	}
+	keys, err = store.ListKeys(ctx, "account-3")
+	if err != nil || keys == nil || len(keys) != 0 {
+		t.Errorf("Store.ListKeys() of an account without keys = %+v, %v, want an empty list", keys, err)
+	}
+}
+
+func testExpireKeys(t *testing.T, store Store) {
+	ctx := context.Background()
+	account := createServiceAccount(t, store, "account-1", time.Now())
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	active := createKey(t, store, "key-1", account.ID, now)
+	revoked := createKey(t, store, "key-2", account.ID, now)
+	if _, err := store.RevokeKey(ctx, revoked.ID, now); err != nil {
+		t.Fatalf("Store.RevokeKey() error = %v", err)
+	}
+
+	expiresAt := now.Add(time.Hour)
+	expired, err := store.ExpireKeys(ctx, account.ID, expiresAt)
+	if err != nil || expired != 1 {
+		t.Fatalf("Store.ExpireKeys() = %d, %v, want 1 key", expired, err)
+	}
+	got, _ := store.GetKeyByHash(ctx, active.Hash)
+	if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) || !got.Active(now) || got.Active(expiresAt) {
+		t.Errorf("Store.ExpireKeys() key = %+v, want it to expire at %v", got, expiresAt)
+	}
+	if got, _ := store.GetKeyByHash(ctx, revoked.Hash); got.ExpiresAt != nil {
+		t.Errorf("Store.ExpireKeys() revoked key = %+v, want it unchanged", got)
+	}
+
+	// keys only ever expire sooner.
+	if expired, err := store.ExpireKeys(ctx, account.ID, expiresAt.Add(time.Hour)); err != nil || expired != 0 {
+		t.Errorf("Store.ExpireKeys() with a later expiry = %d, %v, want no key", expired, err)
+	}
+	if expired, err := store.ExpireKeys(ctx, account.ID, now); err != nil || expired != 1 {
+		t.Errorf("Store.ExpireKeys() with a sooner expiry = %d, %v, want 1 key", expired, err)
+	}
+}
+
+func testRevokeKey(t *testing.T, store Store) {
+	ctx := context.Background()
+	account := createServiceAccount(t, store, "account-1", time.Now())
+	key := createKey(t, store, "key-1", account.ID, time.Now())
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	revoked, err := store.RevokeKey(ctx, key.ID, now)
+	if err != nil || revoked.ID != key.ID || revoked.RevokedAt == nil || !revoked.RevokedAt.Equal(now) || revoked.Active(now) {
+		t.Fatalf("Store.RevokeKey() = %+v, %v, want the key revoked at %v", revoked, err, now)
+	}
+	if got, _ := store.GetKeyByHash(ctx, key.Hash); got == nil || got.RevokedAt == nil {
+		t.Errorf("Store.GetKeyByHash() of a revoked key = %+v, want it revoked", got)
+	}
+	if _, err := store.RevokeKey(ctx, key.ID, now); err != ErrKeyNotFound {
+		t.Errorf("Store.RevokeKey() of a revoked key error = %v, want %v", err, ErrKeyNotFound)
+	}
+	if _, err := store.RevokeKey(ctx, "unknown", now); err != ErrKeyNotFound {
+		t.Errorf("Store.RevokeKey() of an unknown key error = %v, want %v", err, ErrKeyNotFound)
+	}
+}
@@ -0,0 +1,137 @@
+package apikeys
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps service accounts and their keys in maps
+// guarded by a mutex. Keys issued or revoked on one replica are unknown to
+// the others, and a restart loses every account but the bootstrap one, which
+// is stored again at startup.
+type MemoryStore struct {
+	mu       sync.Mutex
+	accounts map[string]ServiceAccount
+	keys     map[string]Key
+}
+
+// NewMemoryStore returns an empty in memory service account store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: map[string]ServiceAccount{},
+		keys:     map[string]Key{},
+	}
+}
+
+func (s *MemoryStore) CreateServiceAccount(ctx context.Context, account *ServiceAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *account
+	stored.Scopes = append([]string(nil), account.Scopes...)
+	s.accounts[account.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return nil, ErrServiceAccountNotFound
+	}
+	account.Scopes = append([]string(nil), account.Scopes...)
+	return &account, nil
+}
+
+func (s *MemoryStore) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := []ServiceAccount{}
+	for _, account := range s.accounts {
+		account.Scopes = append([]string(nil), account.Scopes...)
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if !accounts[i].CreatedAt.Equal(accounts[j].CreatedAt) {
+			return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+		}
+		return accounts[i].ID < accounts[j].ID
+	})
+	return accounts, nil
+}
+
+func (s *MemoryStore) CreateKey(ctx context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ID] = *key
+	return nil
+}
+
+func (s *MemoryStore) GetKeyByHash(ctx context.Context, hash string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (s *MemoryStore) ListKeys(ctx context.Context, serviceAccountID string) ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []Key{}
+	for _, key := range s.keys {
+		if key.ServiceAccountID == serviceAccountID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (s *MemoryStore) ExpireKeys(ctx context.Context, serviceAccountID string, expiresAt time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := 0
+	for id, key := range s.keys {
+		if key.ServiceAccountID != serviceAccountID || key.RevokedAt != nil {
+			continue
+		}
+		if key.ExpiresAt != nil && !key.ExpiresAt.After(expiresAt) {
+			continue
+		}
+		key.ExpiresAt = &expiresAt
+		s.keys[id] = key
+		expired++
+	}
+	return expired, nil
+}
+
+func (s *MemoryStore) RevokeKey(ctx context.Context, id string, now time.Time) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok || key.RevokedAt != nil {
+		return nil, ErrKeyNotFound
+	}
+	key.RevokedAt = &now
+	s.keys[id] = key
+	return &key, nil
+}
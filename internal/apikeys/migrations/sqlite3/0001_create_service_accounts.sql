@@ -0,0 +1,18 @@
+CREATE TABLE service_accounts (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    service_account_id TEXT NOT NULL REFERENCES service_accounts (id) ON DELETE CASCADE,
+    hash TEXT NOT NULL UNIQUE,
+    hint TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX api_keys_service_account_id ON api_keys (service_account_id);
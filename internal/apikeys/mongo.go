@@ -0,0 +1,218 @@
+package apikeys
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the serviceAccounts and apiKeys collections
+// of a mongodb database.
+type MongoStore struct {
+	accounts *mongo.Collection
+	keys     *mongo.Collection
+	tracer   opentracing.Tracer
+}
+
+// NewMongoStore returns a service account store that keeps service accounts
+// and keys in the serviceAccounts and apiKeys collections of db,
+// EnsureIndexes must be called before it is used.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		accounts: db.Collection("serviceAccounts"),
+		keys:     db.Collection("apiKeys"),
+		tracer:   tracer,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on, it is safe to call on
+// every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnsureIndexes")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+
+	_, err := s.keys.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetName("hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "serviceAccountId", Value: 1}},
+			Options: options.Index().SetName("serviceAccountId"),
+		},
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateMany"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span, collection *mongo.Collection) {
+	ext.DBInstance.Set(span, collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) CreateServiceAccount(ctx context.Context, account *ServiceAccount) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateServiceAccount")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.accounts)
+
+	_, err := s.accounts.InsertOne(ctx, account)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.InsertOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetServiceAccount")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.accounts)
+	span.SetTag("param.id", id)
+
+	var account ServiceAccount
+	err := s.accounts.FindOne(ctx, bson.M{"_id": id}).Decode(&account)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	return &account, nil
+}
+
+func (s *MongoStore) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListServiceAccounts")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.accounts)
+
+	cursor, err := s.accounts.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Find"))
+		return nil, err
+	}
+	accounts := []ServiceAccount{}
+	err = cursor.All(ctx, &accounts)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Cursor.All"))
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (s *MongoStore) CreateKey(ctx context.Context, key *Key) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateKey")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+	span.SetTag("param.serviceAccountId", key.ServiceAccountID)
+
+	_, err := s.keys.InsertOne(ctx, key)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.InsertOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) GetKeyByHash(ctx context.Context, hash string) (*Key, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetKeyByHash")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+
+	var key Key
+	err := s.keys.FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (s *MongoStore) ListKeys(ctx context.Context, serviceAccountID string) ([]Key, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListKeys")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+	span.SetTag("param.serviceAccountId", serviceAccountID)
+
+	cursor, err := s.keys.Find(ctx, bson.M{"serviceAccountId": serviceAccountID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Find"))
+		return nil, err
+	}
+	keys := []Key{}
+	err = cursor.All(ctx, &keys)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Cursor.All"))
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *MongoStore) ExpireKeys(ctx context.Context, serviceAccountID string, expiresAt time.Time) (int, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ExpireKeys")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+	span.SetTag("param.serviceAccountId", serviceAccountID)
+
+	filter := bson.M{
+		"serviceAccountId": serviceAccountID,
+		"revokedAt":        bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"expiresAt": bson.M{"$exists": false}},
+			bson.M{"expiresAt": bson.M{"$gt": expiresAt}},
+		},
+	}
+	result, err := s.keys.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"expiresAt": expiresAt}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateMany"))
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+func (s *MongoStore) RevokeKey(ctx context.Context, id string, now time.Time) (*Key, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeKey")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span, s.keys)
+	span.SetTag("param.id", id)
+
+	var key Key
+	err := s.keys.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+	return &key, nil
+}
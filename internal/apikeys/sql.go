@@ -0,0 +1,282 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// SQLStore is a Store backed by a postgres or sqlite database.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns a service account store that keeps service accounts and
+// keys in an sql database, Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the service_accounts and api_keys tables, it is
+// safe to call on every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "apikeys", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "api_keys")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+// keyColumns are the columns scanned by scanKey.
+const keyColumns = `id, service_account_id, hash, hint, created_at, expires_at, revoked_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanKey(row rowScanner) (*Key, error) {
+	var key Key
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.ServiceAccountID, &key.Hash, &key.Hint, &key.CreatedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+func (s *SQLStore) CreateServiceAccount(ctx context.Context, account *ServiceAccount) error {
+	query := s.db.Rebind(`INSERT INTO service_accounts (id, name, scopes, created_at) VALUES (?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateServiceAccount")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	// scopes never contain spaces, so they are stored space separated like
+	// the scope claim of access tokens.
+	_, err := s.db.ExecContext(ctx, query, account.ID, account.Name, strings.Join(account.Scopes, " "), account.CreatedAt.UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetServiceAccount(ctx context.Context, id string) (*ServiceAccount, error) {
+	query := s.db.Rebind(`SELECT id, name, scopes, created_at FROM service_accounts WHERE id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetServiceAccount")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	var account ServiceAccount
+	var scopes string
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&account.ID, &account.Name, &scopes, &account.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	account.Scopes = strings.Fields(scopes)
+	return &account, nil
+}
+
+func (s *SQLStore) ListServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	query := `SELECT id, name, scopes, created_at FROM service_accounts ORDER BY created_at, id`
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListServiceAccounts")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := []ServiceAccount{}
+	for rows.Next() {
+		var account ServiceAccount
+		var scopes string
+		err = rows.Scan(&account.ID, &account.Name, &scopes, &account.CreatedAt)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		account.Scopes = strings.Fields(scopes)
+		accounts = append(accounts, account)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Err"))
+		return nil, err
+	}
+	return accounts, nil
+}
+
+func (s *SQLStore) CreateKey(ctx context.Context, key *Key) error {
+	query := s.db.Rebind(`INSERT INTO api_keys (` + keyColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateKey")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	_, err := s.db.ExecContext(ctx, query,
+		key.ID, key.ServiceAccountID, key.Hash, key.Hint, key.CreatedAt.UTC(), nullTime(key.ExpiresAt), nullTime(key.RevokedAt),
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetKeyByHash(ctx context.Context, hash string) (*Key, error) {
+	query := s.db.Rebind(`SELECT ` + keyColumns + ` FROM api_keys WHERE hash = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetKeyByHash")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	key, err := scanKey(s.db.QueryRowContext(ctx, query, hash))
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *SQLStore) ListKeys(ctx context.Context, serviceAccountID string) ([]Key, error) {
+	query := s.db.Rebind(`SELECT ` + keyColumns + ` FROM api_keys WHERE service_account_id = ? ORDER BY created_at, id`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListKeys")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	rows, err := s.db.QueryContext(ctx, query, serviceAccountID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Err"))
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *SQLStore) ExpireKeys(ctx context.Context, serviceAccountID string, expiresAt time.Time) (int, error) {
+	query := s.db.Rebind(`UPDATE api_keys SET expires_at = ?
+		WHERE service_account_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ExpireKeys")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	result, err := s.db.ExecContext(ctx, query, expiresAt.UTC(), serviceAccountID, expiresAt.UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return 0, err
+	}
+	expired, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return 0, err
+	}
+	return int(expired), nil
+}
+
+func (s *SQLStore) RevokeKey(ctx context.Context, id string, now time.Time) (*Key, error) {
+	query := s.db.Rebind(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeKey")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	result, err := s.db.ExecContext(ctx, query, now.UTC(), id)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return nil, err
+	}
+	if revoked == 0 {
+		return nil, ErrKeyNotFound
+	}
+	key, err := scanKey(s.db.QueryRowContext(ctx, s.db.Rebind(`SELECT `+keyColumns+` FROM api_keys WHERE id = ?`), id))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return key, nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
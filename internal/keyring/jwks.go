@@ -0,0 +1,162 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+// JWK is the JSON web key of a public key as defined by RFC 7517, RFC 7518 and
+// RFC 8037.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve, X and Y describe ECDSA keys, Ed25519 keys only have X.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON web key set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the JSON web key of the public key, HMAC keys have none.
+func (k *Key) JWK() (JWK, bool) {
+	jwk := JWK{
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: k.Algorithm(),
+	}
+	switch publicKey := k.verificationKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeJWKInt(publicKey.N, 0)
+		jwk.E = encodeJWKInt(big.NewInt(int64(publicKey.E)), 0)
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = publicKey.Curve.Params().Name
+		jwk.X = encodeJWKInt(publicKey.X, size)
+		jwk.Y = encodeJWKInt(publicKey.Y, size)
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// ParseJWK returns a verification key for the public key of jwk, such as a
+// key of the JWKS of an external token issuer.
+func ParseJWK(jwk JWK) (*Key, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decodeJWKInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid rsa exponent of key %q", jwk.KeyID)
+		}
+		return NewKey(jwk.KeyID, &rsa.PublicKey{N: n, E: int(e.Int64())})
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q of key %q", jwk.Curve, jwk.KeyID)
+		}
+		x, err := decodeJWKInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point of key %q is not on its curve", jwk.KeyID)
+		}
+		return NewKey(jwk.KeyID, &ecdsa.PublicKey{Curve: curve, X: x, Y: y})
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q of key %q", jwk.Curve, jwk.KeyID)
+		}
+		return NewKey(jwk.KeyID, ed25519.PublicKey(x))
+	}
+	return nil, fmt.Errorf("unsupported key type %q of key %q", jwk.KeyType, jwk.KeyID)
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// encodeJWKInt encodes i big endian, left padded with zeros to size bytes.
+func encodeJWKInt(i *big.Int, size int) string {
+	b := i.Bytes()
+	if len(b) < size {
+		b = append(make([]byte, size-len(b)), b...)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// JWKS returns the JSON web keys of the public keys of the ring, it is empty
+// when the ring only has HMAC keys.
+func (r *Ring) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range r.order {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// JWKSHandler serves the JSON web key set of the ring, conventionally at
+// /.well-known/jwks.json.
+func (r *Ring) JWKSHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		// verifiers refetch the keys often enough to pick up a new key before
+		// it becomes the signing key.
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(r.JWKS())
+	})
+}
@@ -0,0 +1,144 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// publicKeyFromJWK decodes the public key of a JSON web key the way a
+// verifying service would.
+func publicKeyFromJWK(t *testing.T, jwk JWK) interface{} {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decoding %q error = %v", s, err)
+		}
+		return b
+	}
+	switch jwk.KeyType {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+	case "EC":
+		if jwk.Curve != "P-256" || len(decode(jwk.X)) != 32 || len(decode(jwk.Y)) != 32 {
+			t.Errorf("JWK = %+v, want P-256 coordinates of 32 bytes", jwk)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(decode(jwk.X)), Y: new(big.Int).SetBytes(decode(jwk.Y))}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected key type %q", jwk.KeyType)
+	return nil
+}
+
+func TestRing_JWKS(t *testing.T) {
+	keys := generateKeys(t)
+	rsaKey, _ := NewKey("rsa", keys["RS256"])
+	ecKey, _ := NewKey("ec", keys["ES256"])
+	edKey, _ := NewKey("ed", keys["EdDSA"])
+	ring, err := New(ecKey, NewHMACKey("hmac", []byte("secret")), rsaKey, edKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := ring.JWKS()
+	wantKeys := []*Key{ecKey, rsaKey, edKey}
+	if len(got.Keys) != len(wantKeys) {
+		t.Fatalf("Ring.JWKS() = %+v, want the keys %v %v %v", got, ecKey.ID, rsaKey.ID, edKey.ID)
+	}
+	for i, key := range wantKeys {
+		jwk := got.Keys[i]
+		if jwk.KeyID != key.ID || jwk.Algorithm != key.Algorithm() || jwk.Use != "sig" {
+			t.Errorf("Ring.JWKS() key %d = %+v, want kid %v alg %v", i, jwk, key.ID, key.Algorithm())
+		}
+		if publicKey := publicKeyFromJWK(t, jwk); !reflect.DeepEqual(publicKey, key.PublicKey()) {
+			t.Errorf("Ring.JWKS() key %v does not decode to its public key", key.ID)
+		}
+	}
+
+	hmacOnly, _ := New(NewHMACKey("", []byte("secret")))
+	if got := hmacOnly.JWKS(); got.Keys == nil || len(got.Keys) != 0 {
+		t.Errorf("Ring.JWKS() of an hmac ring = %+v, want an empty key list", got)
+	}
+}
+
+func TestRing_JWKSHandler(t *testing.T) {
+	ecKey, _ := NewKey("ec", generateKeys(t)["ES256"])
+	ring, _ := New(ecKey)
+	server := httptest.NewServer(ring.JWKSHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("http.Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("GET jwks = %v %v, want 200 application/json", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	var got JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding jwks error = %v", err)
+	}
+	if !reflect.DeepEqual(got, ring.JWKS()) {
+		t.Errorf("GET jwks = %+v, want %+v", got, ring.JWKS())
+	}
+
+	resp, err = http.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("http.Post() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST jwks status = %v, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestParseJWK(t *testing.T) {
+	keys := generateKeys(t)
+	for _, alg := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			signingKey, _ := NewKey("kid-"+alg, keys[alg])
+			issuer, err := New(signingKey)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			jwk, _ := signingKey.JWK()
+			key, err := ParseJWK(jwk)
+			if err != nil {
+				t.Fatalf("ParseJWK() error = %v", err)
+			}
+			if key.ID != signingKey.ID || key.Algorithm() != alg {
+				t.Errorf("ParseJWK() = kid %q alg %q, want kid %q alg %q", key.ID, key.Algorithm(), signingKey.ID, alg)
+			}
+			verifier, _ := NewVerifier(key)
+			token, _ := issuer.IssueToken(jwt.MapClaims{"sub": "user-1"})
+			if err := verifier.VerifyToken(token, jwt.MapClaims{}); err != nil {
+				t.Errorf("Ring.VerifyToken() with the parsed key error = %v", err)
+			}
+		})
+	}
+
+	invalid := []JWK{
+		{KeyType: "oct", KeyID: "hmac"},
+		{KeyType: "EC", KeyID: "curve", Curve: "secp256k1", X: "AA", Y: "AA"},
+		{KeyType: "EC", KeyID: "off-curve", Curve: "P-256", X: "AQ", Y: "AQ"},
+		{KeyType: "RSA", KeyID: "encoding", N: "not base64!", E: "AQAB"},
+		{KeyType: "OKP", KeyID: "short", Curve: "Ed25519", X: "AQ"},
+	}
+	for _, jwk := range invalid {
+		if _, err := ParseJWK(jwk); err == nil {
+			t.Errorf("ParseJWK(%+v) error = nil, want an error", jwk)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Package keyring signs and verifies JSON web tokens with a ring of keys. One
+// key signs new tokens while every key of the ring verifies them, tokens name
+// their key in the kid header so that keys can be rotated without downtime:
+// the new key is added to the ring of every replica for verification first,
+// then made the signing key once every replica knows it.
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKey     = errors.New("token is signed with an unknown key")
+	ErrNoSigningKey   = errors.New("the signing key has no private key")
+	ErrAlgorithmClash = errors.New("token algorithm does not match its key")
+)
+
+// Key is a key of the ring. Keys parsed from a public key can only verify
+// tokens.
+type Key struct {
+	// ID is the kid of the tokens signed with the key. Tokens without a kid
+	// are verified with the key whose ID is empty, if any.
+	ID     string
+	method jwt.SigningMethod
+	// signingKey and verificationKey are the keys in the form the signing
+	// method expects.
+	signingKey      interface{}
+	verificationKey interface{}
+}
+
+// NewHMACKey returns a key signing tokens with HS256, every party verifying
+// the tokens needs the secret.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{
+		ID:              id,
+		method:          jwt.SigningMethodHS256,
+		signingKey:      secret,
+		verificationKey: secret,
+	}
+}
+
+// NewKey returns a key for an RSA, ECDSA or Ed25519 private or public key. RSA
+// keys sign with RS256, ECDSA keys with ES256, ES384 or ES512 depending on
+// their curve, and Ed25519 keys with EdDSA.
+func NewKey(id string, key interface{}) (*Key, error) {
+	k := &Key{ID: id}
+	if signer, ok := key.(crypto.Signer); ok {
+		k.signingKey = key
+		key = signer.Public()
+	}
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch publicKey.Curve.Params().BitSize {
+		case 256:
+			k.method = jwt.SigningMethodES256
+		case 384:
+			k.method = jwt.SigningMethodES384
+		case 521:
+			k.method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported ecdsa curve %s", publicKey.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	k.verificationKey = key
+	return k, nil
+}
+
+// Algorithm returns the alg of the tokens signed with the key.
+func (k *Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// PublicKey returns the public key of asymmetric keys and nil for HMAC keys.
+func (k *Key) PublicKey() crypto.PublicKey {
+	if _, ok := k.verificationKey.([]byte); ok {
+		return nil
+	}
+	return k.verificationKey
+}
+
+// Ring signs tokens with its signing key and verifies them with any of its
+// keys. It is safe for concurrent use.
+type Ring struct {
+	signingKey *Key
+	keys       map[string]*Key
+	// order lists the keys in the order they were given, signing key first.
+	order []*Key
+}
+
+// New returns a ring signing tokens with signingKey that also accepts the
+// tokens signed with verificationKeys.
+func New(signingKey *Key, verificationKeys ...*Key) (*Ring, error) {
+	if signingKey.signingKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	r, err := NewVerifier(append([]*Key{signingKey}, verificationKeys...)...)
+	if err != nil {
+		return nil, err
+	}
+	r.signingKey = signingKey
+	return r, nil
+}
+
+// NewVerifier returns a ring that only verifies tokens, as needed by the
+// services accepting the tokens.
+func NewVerifier(keys ...*Key) (*Ring, error) {
+	r := &Ring{
+		keys: map[string]*Key{},
+	}
+	for _, key := range keys {
+		if _, ok := r.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		r.keys[key.ID] = key
+		r.order = append(r.order, key)
+	}
+	return r, nil
+}
+
+// Keys returns the keys of the ring, the signing key first.
+func (r *Ring) Keys() []*Key {
+	return append([]*Key(nil), r.order...)
+}
+
+// IssueToken returns a token holding the claims signed with the signing key.
+func (r *Ring) IssueToken(claims jwt.Claims) (string, error) {
+	if r.signingKey == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(r.signingKey.method, claims)
+	if r.signingKey.ID != "" {
+		token.Header["kid"] = r.signingKey.ID
+	}
+	return token.SignedString(r.signingKey.signingKey)
+}
+
+// VerifyToken decodes the claims of the token into claims if it is signed by
+// a key of the ring and claims.Valid accepts them.
+func (r *Ring) VerifyToken(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, r.verificationKey)
+	return err
+}
+
+// verificationKey finds the key of the token, the algorithm of the token must
+// be the algorithm of the key so that a public key cannot be used as an HMAC
+// secret.
+func (r *Ring) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := r.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrAlgorithmClash
+	}
+	return key.verificationKey, nil
+}
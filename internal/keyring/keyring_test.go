@@ -0,0 +1,225 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writePEM writes the key to a PEM file named after id and returns its path.
+func writePEM(t *testing.T, id, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), id+".pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("os.WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func generateKeys(t *testing.T) map[string]interface{} {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	return map[string]interface{}{"RS256": rsaKey, "ES256": ecKey, "EdDSA": edKey}
+}
+
+func TestLoadPEMFile(t *testing.T) {
+	keys := generateKeys(t)
+	pkcs8 := func(key interface{}) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("x509.MarshalPKCS8PrivateKey() error = %v", err)
+		}
+		return der
+	}
+	pkix := func(key interface{}) []byte {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.Fatalf("x509.MarshalPKIXPublicKey() error = %v", err)
+		}
+		return der
+	}
+	ecKey := keys["ES256"].(*ecdsa.PrivateKey)
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("x509.MarshalECPrivateKey() error = %v", err)
+	}
+	rsaKey := keys["RS256"].(*rsa.PrivateKey)
+
+	tests := []struct {
+		name          string
+		blockType     string
+		der           []byte
+		wantAlgorithm string
+		wantSigning   bool
+		wantErr       bool
+	}{
+		{name: "pkcs8 rsa", blockType: "PRIVATE KEY", der: pkcs8(rsaKey), wantAlgorithm: "RS256", wantSigning: true},
+		{name: "pkcs1 rsa", blockType: "RSA PRIVATE KEY", der: x509.MarshalPKCS1PrivateKey(rsaKey), wantAlgorithm: "RS256", wantSigning: true},
+		{name: "pkcs8 ecdsa", blockType: "PRIVATE KEY", der: pkcs8(ecKey), wantAlgorithm: "ES256", wantSigning: true},
+		{name: "sec1 ecdsa", blockType: "EC PRIVATE KEY", der: sec1, wantAlgorithm: "ES256", wantSigning: true},
+		{name: "pkcs8 ed25519", blockType: "PRIVATE KEY", der: pkcs8(keys["EdDSA"]), wantAlgorithm: "EdDSA", wantSigning: true},
+		{name: "rsa public key", blockType: "PUBLIC KEY", der: pkix(&rsaKey.PublicKey), wantAlgorithm: "RS256"},
+		{name: "ed25519 public key", blockType: "PUBLIC KEY", der: pkix(keys["EdDSA"].(ed25519.PrivateKey).Public()), wantAlgorithm: "EdDSA"},
+		{name: "unsupported block", blockType: "CERTIFICATE REQUEST", der: []byte("garbage"), wantErr: true},
+		{name: "corrupt key", blockType: "PRIVATE KEY", der: []byte("garbage"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadPEMFile(writePEM(t, "2021-11", tt.blockType, tt.der))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPEMFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ID != "2021-11" || got.Algorithm() != tt.wantAlgorithm {
+				t.Errorf("LoadPEMFile() = %v %v, want 2021-11 %v", got.ID, got.Algorithm(), tt.wantAlgorithm)
+			}
+			if (got.signingKey != nil) != tt.wantSigning {
+				t.Errorf("LoadPEMFile() signing = %v, want %v", got.signingKey != nil, tt.wantSigning)
+			}
+		})
+	}
+}
+
+func TestRing(t *testing.T) {
+	for algorithm, privateKey := range generateKeys(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := NewKey("key-"+algorithm, privateKey)
+			if err != nil {
+				t.Fatalf("NewKey() error = %v", err)
+			}
+			ring, err := New(key)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			token, err := ring.IssueToken(jwt.MapClaims{"userId": "user.valid", "exp": time.Now().Add(time.Minute).Unix()})
+			if err != nil {
+				t.Fatalf("Ring.IssueToken() error = %v", err)
+			}
+			claims := jwt.MapClaims{}
+			err = ring.VerifyToken(token, claims)
+			if err != nil {
+				t.Fatalf("Ring.VerifyToken() error = %v", err)
+			}
+			if claims["userId"] != "user.valid" {
+				t.Errorf("Ring.VerifyToken() userId = %v, want user.valid", claims["userId"])
+			}
+
+			// a ring holding only the public key verifies the token too.
+			publicKey, err := NewKey(key.ID, key.PublicKey())
+			if err != nil {
+				t.Fatalf("NewKey() error = %v", err)
+			}
+			if _, err := New(publicKey); err != ErrNoSigningKey {
+				t.Errorf("New() with a public signing key error = %v, want %v", err, ErrNoSigningKey)
+			}
+			verifier, err := NewVerifier(publicKey)
+			if err != nil {
+				t.Fatalf("NewVerifier() error = %v", err)
+			}
+			if err := verifier.VerifyToken(token, jwt.MapClaims{}); err != nil {
+				t.Errorf("Ring.VerifyToken() with the public key error = %v", err)
+			}
+			if _, err := verifier.IssueToken(jwt.MapClaims{}); err != ErrNoSigningKey {
+				t.Errorf("Ring.IssueToken() of a verifier error = %v, want %v", err, ErrNoSigningKey)
+			}
+		})
+	}
+}
+
+func TestRing_Rotation(t *testing.T) {
+	keys := generateKeys(t)
+	oldKey, _ := NewKey("old", keys["ES256"])
+	newKey, _ := NewKey("new", keys["EdDSA"])
+	oldRing, err := New(oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	rotatedRing, err := New(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	claims := jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}
+	oldToken, _ := oldRing.IssueToken(claims)
+	newToken, _ := rotatedRing.IssueToken(claims)
+
+	if err := rotatedRing.VerifyToken(oldToken, jwt.MapClaims{}); err != nil {
+		t.Errorf("Ring.VerifyToken() of a token signed with the previous key error = %v", err)
+	}
+	if err := rotatedRing.VerifyToken(newToken, jwt.MapClaims{}); err != nil {
+		t.Errorf("Ring.VerifyToken() of a token signed with the new key error = %v", err)
+	}
+	if err := oldRing.VerifyToken(newToken, jwt.MapClaims{}); err == nil {
+		t.Errorf("Ring.VerifyToken() of a token signed with a key missing from the ring should fail")
+	}
+	if _, err := New(newKey, oldKey, oldKey); err == nil {
+		t.Errorf("New() with duplicate key ids should fail")
+	}
+	if got := rotatedRing.Keys(); len(got) != 2 || got[0] != newKey || got[1] != oldKey {
+		t.Errorf("Ring.Keys() = %v, want the new key then the old key", got)
+	}
+}
+
+func TestRing_VerifyToken(t *testing.T) {
+	rsaKey, _ := NewKey("rsa", generateKeys(t)["RS256"])
+	ring, err := New(rsaKey, NewHMACKey("", []byte("legacy secret")))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Token.SignedString() error = %v", err)
+		}
+		return signed
+	}
+	publicKeyDER, _ := x509.MarshalPKIXPublicKey(rsaKey.PublicKey())
+	valid := jwt.MapClaims{"exp": time.Now().Add(time.Minute).Unix()}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "signed by the ring", token: sign(jwt.SigningMethodRS256, "rsa", rsaKey.signingKey, valid)},
+		{name: "legacy token without kid", token: sign(jwt.SigningMethodHS256, "", []byte("legacy secret"), valid)},
+		{name: "expired", token: sign(jwt.SigningMethodRS256, "rsa", rsaKey.signingKey, jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), wantErr: true},
+		{name: "unknown kid", token: sign(jwt.SigningMethodRS256, "unknown", rsaKey.signingKey, valid), wantErr: true},
+		{name: "public key used as hmac secret", token: sign(jwt.SigningMethodHS256, "rsa", publicKeyDER, valid), wantErr: true},
+		{name: "none algorithm", token: sign(jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, valid), wantErr: true},
+		{name: "garbage", token: "invalidJwtToken", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ring.VerifyToken(tt.token, jwt.MapClaims{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Ring.VerifyToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package keyring
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadPEMFile reads a key from a PEM file, the key is named after the file
+// without its extension so that 2021-11.pem holds the key 2021-11.
+func LoadPEMFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	key, err := ParsePEM(id, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// ParsePEM parses the first private or public key of data. PKCS #8, PKCS #1
+// and SEC 1 private keys and PKIX and PKCS #1 public keys are supported.
+func ParsePEM(id string, data []byte) (*Key, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no key found in pem data")
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		default:
+			// e.g. the EC PARAMETERS block openssl writes before EC keys.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", strings.ToLower(block.Type), err)
+		}
+		return NewKey(id, key)
+	}
+}
@@ -0,0 +1,156 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"login_attempts"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) Store {
+			return newStore(t).(Store)
+		})
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share,
+// newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "RecordFailure", test: testRecordFailure},
+		{name: "RecordFailure concurrently", test: testRecordFailureConcurrently},
+		{name: "RemoveFailure", test: testRemoveFailure},
+		{name: "Reset", test: testReset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func testRecordFailure(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	got, err := store.GetAttempts(ctx, "email:john@example.com", now)
+	if err != nil || got.Failures != 0 {
+		t.Fatalf("Store.GetAttempts() of an unknown key = %+v, %v, want no failures", got, err)
+	}
+	for i := 1; i <= 3; i++ {
+		got, err = store.RecordFailure(ctx, "email:john@example.com", now.Add(time.Duration(i)*time.Minute), time.Hour)
+		if err != nil {
+			t.Fatalf("Store.RecordFailure() error = %v", err)
+		}
+		if got.Failures != i || !got.LastFailureAt.Equal(now.Add(time.Duration(i)*time.Minute)) {
+			t.Errorf("Store.RecordFailure() = %+v, want %d failures", got, i)
+		}
+		if wantPrevious := now.Add(time.Duration(i-1) * time.Minute); i > 1 && !got.PreviousFailureAt.Equal(wantPrevious) {
+			t.Errorf("Store.RecordFailure() previous failure = %v, want %v", got.PreviousFailureAt, wantPrevious)
+		}
+	}
+	lastFailureAt := now.Add(3 * time.Minute)
+	got, err = store.GetAttempts(ctx, "email:john@example.com", lastFailureAt)
+	if err != nil || got.Failures != 3 || !got.ExpiresAt.Equal(lastFailureAt.Add(time.Hour)) {
+		t.Errorf("Store.GetAttempts() = %+v, %v, want 3 failures expiring an hour after the last", got, err)
+	}
+	if got, _ := store.GetAttempts(ctx, "ip:10.0.0.1", lastFailureAt); got.Failures != 0 {
+		t.Errorf("Store.GetAttempts() of another key = %+v, want no failures", got)
+	}
+
+	// failures are forgotten once they expire.
+	expired := lastFailureAt.Add(time.Hour)
+	if got, _ := store.GetAttempts(ctx, "email:john@example.com", expired); got.Failures != 0 {
+		t.Errorf("Store.GetAttempts() of expired failures = %+v, want no failures", got)
+	}
+	got, err = store.RecordFailure(ctx, "email:john@example.com", expired, time.Hour)
+	if err != nil || got.Failures != 1 || !got.PreviousFailureAt.IsZero() {
+		t.Errorf("Store.RecordFailure() after the failures expired = %+v, %v, want 1 failure", got, err)
+	}
+}
+
+func testRecordFailureConcurrently(t *testing.T, store Store) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.RecordFailure(context.Background(), "ip:10.0.0.1", now, time.Hour)
+			if err != nil {
+				t.Errorf("Store.RecordFailure() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err := store.GetAttempts(context.Background(), "ip:10.0.0.1", now)
+	if err != nil || got.Failures != 10 {
+		t.Errorf("Store.GetAttempts() after concurrent failures = %+v, %v, want 10 failures", got, err)
+	}
+}
+
+func testRemoveFailure(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, err := store.RecordFailure(ctx, "ip:10.0.0.1", now, time.Hour)
+		if err != nil {
+			t.Fatalf("Store.RecordFailure() error = %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		err := store.RemoveFailure(ctx, "ip:10.0.0.1")
+		if err != nil {
+			t.Fatalf("Store.RemoveFailure() error = %v", err)
+		}
+	}
+	if got, _ := store.GetAttempts(ctx, "ip:10.0.0.1", now); got.Failures != 0 {
+		t.Errorf("Store.GetAttempts() after removing more failures than recorded = %+v, want no failures", got)
+	}
+	if err := store.RemoveFailure(ctx, "unknown"); err != nil {
+		t.Errorf("Store.RemoveFailure() of an unknown key error = %v", err)
+	}
+}
+
+func testReset(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, key := range []string{"email:john@example.com", "ip:10.0.0.1"} {
+		_, err := store.RecordFailure(ctx, key, now, time.Hour)
+		if err != nil {
+			t.Fatalf("Store.RecordFailure() error = %v", err)
+		}
+	}
+	err := store.Reset(ctx, "email:john@example.com")
+	if err != nil {
+		t.Fatalf("Store.Reset() error = %v", err)
+	}
+	if got, _ := store.GetAttempts(ctx, "email:john@example.com", now); got.Failures != 0 {
+		t.Errorf("Store.GetAttempts() of a reset key = %+v, want no failures", got)
+	}
+	if got, _ := store.GetAttempts(ctx, "ip:10.0.0.1", now); got.Failures != 1 {
+		t.Errorf("Store.GetAttempts() of another key = %+v, want 1 failure", got)
+	}
+	if err := store.Reset(ctx, "unknown"); err != nil {
+		t.Errorf("Store.Reset() of an unknown key error = %v", err)
+	}
+}
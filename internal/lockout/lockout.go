@@ -0,0 +1,128 @@
+// Package lockout throttles login attempts. Failed attempts are counted per
+// key, such as an email or a client ip, and a Policy turns the count into a
+// delay before the next attempt that doubles with every failure, then into a
+// temporary lockout.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Attempts is the failed login attempts of a key.
+type Attempts struct {
+	Key           string    `json:"key" bson:"_id"`
+	Failures      int       `json:"failures" bson:"failures"`
+	LastFailureAt time.Time `json:"lastFailureAt" bson:"lastFailureAt"`
+	// PreviousFailureAt is the LastFailureAt the last RecordFailure replaced,
+	// zero when it started a new count.
+	PreviousFailureAt time.Time `json:"previousFailureAt" bson:"previousFailureAt,omitempty"`
+	// ExpiresAt is when the failures are forgotten.
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// Store persists the failed login attempts of keys.
+type Store interface {
+	// GetAttempts returns the unexpired attempts of key, attempts without
+	// failures when there are none.
+	GetAttempts(ctx context.Context, key string, now time.Time) (*Attempts, error)
+	// RecordFailure adds a failure to the attempts of key and returns them,
+	// failures are forgotten window after the last one. The increment is
+	// atomic, so an attempt can be recorded before it is made and concurrent
+	// attempts each see their own count.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*Attempts, error)
+	// RemoveFailure takes back a failure of key, for an attempt recorded
+	// before it was made that succeeded.
+	RemoveFailure(ctx context.Context, key string) error
+	// Reset forgets the failures of key.
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy is how failed attempts slow down the next attempts of a key.
+type Policy struct {
+	// FreeFailures is the number of failures allowed before attempts are
+	// delayed.
+	FreeFailures int
+	// BaseDelay is the delay after the first failure past FreeFailures, it
+	// doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutFailures is the number of failures that locks the key out for
+	// LockoutDuration after the last one, zero never locks keys out.
+	LockoutFailures int
+	LockoutDuration time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// DefaultEmailPolicy delays the logins of an email after 3 failures and
+// locks it out for 15 minutes after 10.
+var DefaultEmailPolicy = Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutFailures: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// DefaultIPPolicy is more lenient than DefaultEmailPolicy as several users
+// may share an ip, it delays logins after 20 failures and locks the ip out
+// for 15 minutes after 100.
+var DefaultIPPolicy = Policy{
+	FreeFailures:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutFailures: 100,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// RetryAfter returns how long the key of the attempts must wait before its
+// next attempt, zero when it can try now.
+func (p Policy) RetryAfter(attempts *Attempts, now time.Time) time.Duration {
+	if attempts == nil || attempts.Failures <= p.FreeFailures {
+		return 0
+	}
+	var delay time.Duration
+	if p.Locked(attempts) {
+		delay = p.LockoutDuration
+	} else {
+		delay = p.BaseDelay
+		for i := p.FreeFailures + 1; i < attempts.Failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+	if wait := attempts.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// RecordedRetryAfter returns the RetryAfter of the attempts before the failure
+// RecordFailure just added to them. Attempts recorded before they are made go
+// ahead when it is zero, and stay counted when it is not.
+func (p Policy) RecordedRetryAfter(attempts *Attempts, now time.Time) time.Duration {
+	return p.RetryAfter(&Attempts{
+		Key:           attempts.Key,
+		Failures:      attempts.Failures - 1,
+		LastFailureAt: attempts.PreviousFailureAt,
+	}, now)
+}
+
+// Locked reports whether the attempts lock their key out.
+func (p Policy) Locked(attempts *Attempts) bool {
+	return p.LockoutFailures > 0 && attempts.Failures >= p.LockoutFailures
+}
+
+// RecordWindow is the window to record failures with, failures are kept at
+// least as long as the lockout they cause.
+func (p Policy) RecordWindow() time.Duration {
+	if p.Window < p.LockoutDuration {
+		return p.LockoutDuration
+	}
+	return p.Window
+}
@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicy_RetryAfter(t *testing.T) {
+	policy := Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutFailures: 10,
+		LockoutDuration: 15 * time.Minute,
+	}
+	lastFailureAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		now      time.Time
+		want     time.Duration
+	}{
+		{name: "no failures", failures: 0, now: lastFailureAt, want: 0},
+		{name: "free failures", failures: 3, now: lastFailureAt, want: 0},
+		{name: "first delayed failure", failures: 4, now: lastFailureAt, want: time.Second},
+		{name: "delay doubles", failures: 6, now: lastFailureAt, want: 4 * time.Second},
+		{name: "delay is capped", failures: 9, now: lastFailureAt, want: 10 * time.Second},
+		{name: "delay partly elapsed", failures: 6, now: lastFailureAt.Add(3 * time.Second), want: time.Second},
+		{name: "delay elapsed", failures: 6, now: lastFailureAt.Add(5 * time.Second), want: 0},
+		{name: "locked out", failures: 10, now: lastFailureAt.Add(time.Minute), want: 14 * time.Minute},
+		{name: "lockout elapsed", failures: 12, now: lastFailureAt.Add(15 * time.Minute), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := &Attempts{Failures: tt.failures, LastFailureAt: lastFailureAt}
+			if got := policy.RetryAfter(attempts, tt.now); got != tt.want {
+				t.Errorf("Policy.RetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy_RecordedRetryAfter(t *testing.T) {
+	policy := Policy{FreeFailures: 1, BaseDelay: time.Minute, MaxDelay: time.Minute}
+	previousFailureAt := time.Date(2021, 11, 7, 13, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		failures int
+		now      time.Time
+		want     time.Duration
+	}{
+		{name: "first attempt", failures: 1, now: previousFailureAt, want: 0},
+		{name: "free failure before", failures: 2, now: previousFailureAt, want: 0},
+		{name: "delayed failure before", failures: 3, now: previousFailureAt.Add(20 * time.Second), want: 40 * time.Second},
+		{name: "delay elapsed", failures: 3, now: previousFailureAt.Add(time.Minute), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the attempt being made is the last failure.
+			attempts := &Attempts{Failures: tt.failures, LastFailureAt: tt.now, PreviousFailureAt: previousFailureAt}
+			if got := policy.RecordedRetryAfter(attempts, tt.now); got != tt.want {
+				t.Errorf("Policy.RecordedRetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often RecordFailure drops the expired attempts of
+// every key, the attempts of a single key are dropped when it is read.
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store that counts failed attempts in a map guarded by a
+// mutex. Each replica counts on its own, so the policies are only enforced
+// per replica and a restart forgets every lockout.
+type MemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	sweptAt  time.Time
+}
+
+// NewMemoryStore returns an empty in memory attempts store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		attempts: map[string]Attempts{},
+	}
+}
+
+func (s *MemoryStore) GetAttempts(ctx context.Context, key string, now time.Time) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.unexpired(key, now)
+	if !ok {
+		return &Attempts{Key: key}, nil
+	}
+	return &attempts, nil
+}
+
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the keys that are not read again are swept now and then to keep the
+	// store bounded.
+	if now.Sub(s.sweptAt) >= sweepInterval {
+		for k, attempts := range s.attempts {
+			if !now.Before(attempts.ExpiresAt) {
+				delete(s.attempts, k)
+			}
+		}
+		s.sweptAt = now
+	}
+	attempts, _ := s.unexpired(key, now)
+	attempts.Key = key
+	attempts.Failures++
+	attempts.PreviousFailureAt = attempts.LastFailureAt
+	attempts.LastFailureAt = now
+	attempts.ExpiresAt = now.Add(window)
+	s.attempts[key] = attempts
+	return &attempts, nil
+}
+
+func (s *MemoryStore) RemoveFailure(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempts, ok := s.attempts[key]
+	if ok && attempts.Failures > 0 {
+		attempts.Failures--
+		s.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+// unexpired returns the attempts of key and whether it has any, expired
+// attempts are dropped. s.mu must be held.
+func (s *MemoryStore) unexpired(key string, now time.Time) (Attempts, bool) {
+	attempts, ok := s.attempts[key]
+	if ok && !now.Before(attempts.ExpiresAt) {
+		delete(s.attempts, key)
+		return Attempts{}, false
+	}
+	return attempts, ok
+}
@@ -0,0 +1,8 @@
+CREATE TABLE login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX login_attempts_expires_at ON login_attempts (expires_at);
@@ -0,0 +1,8 @@
+CREATE TABLE login_attempts (
+    attempt_key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_attempts_expires_at ON login_attempts (expires_at);
@@ -0,0 +1 @@
+ALTER TABLE login_attempts ADD COLUMN previous_failure_at TIMESTAMP;
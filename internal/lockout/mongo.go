@@ -0,0 +1,135 @@
+package lockout
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the loginAttempts collection of a mongodb
+// database.
+type MongoStore struct {
+	collection *mongo.Collection
+	tracer     opentracing.Tracer
+}
+
+// NewMongoStore returns an attempts store that keeps attempts in the
+// loginAttempts collection of db, EnsureIndexes must be called before it is
+// used.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("loginAttempts"),
+		tracer:     tracer,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on, expired attempts are
+// removed by mongodb. It is safe to call on every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnsureIndexes")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span) {
+	ext.DBInstance.Set(span, s.collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) GetAttempts(ctx context.Context, key string, now time.Time) (*Attempts, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetAttempts")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	// expired attempts are only removed periodically by mongodb.
+	var attempts Attempts
+	err := s.collection.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": now}}).Decode(&attempts)
+	if err == mongo.ErrNoDocuments {
+		return &Attempts{Key: key}, nil
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	return &attempts, nil
+}
+
+func (s *MongoStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*Attempts, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RecordFailure")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	// the pipeline restarts the count of expired attempts in the same atomic
+	// update that increments it.
+	change := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"failures": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$expiresAt", now}},
+			bson.M{"$add": bson.A{"$failures", 1}},
+			1,
+		}},
+		"previousFailureAt": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{"$expiresAt", now}},
+			"$lastFailureAt",
+			"$$REMOVE",
+		}},
+		"lastFailureAt": now,
+		"expiresAt":     now.Add(window),
+	}}}}
+	var attempts Attempts
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, change, opts).Decode(&attempts)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+	span.SetTag("failures", attempts.Failures)
+	return &attempts, nil
+}
+
+func (s *MongoStore) RemoveFailure(ctx context.Context, key string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RemoveFailure")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": key, "failures": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"failures": -1}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) Reset(ctx context.Context, key string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Reset")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.DeleteOne"))
+		return err
+	}
+	return nil
+}
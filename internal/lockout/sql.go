@@ -0,0 +1,170 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const attemptsColumns = "attempt_key, failures, last_failure_at, expires_at, previous_failure_at"
+
+// SQLStore is a Store backed by a postgres or sqlite database.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns an attempts store that keeps attempts in an sql
+// database, Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the login_attempts table, it is safe to call on
+// every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "lockout", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "login_attempts")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+func (s *SQLStore) GetAttempts(ctx context.Context, key string, now time.Time) (*Attempts, error) {
+	query := s.db.Rebind(`SELECT ` + attemptsColumns + ` FROM login_attempts WHERE attempt_key = ? AND expires_at > ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetAttempts")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	attempts, err := scanAttempts(s.db.QueryRowContext(ctx, query, key, now.UTC()))
+	if err == sql.ErrNoRows {
+		return &Attempts{Key: key}, nil
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (s *SQLStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*Attempts, error) {
+	// the upsert restarts the count of expired attempts in the same statement
+	// that increments it, so concurrent failures are all counted.
+	query := s.db.Rebind(`INSERT INTO login_attempts (` + attemptsColumns + `) VALUES (?, 1, ?, ?, NULL)
+		ON CONFLICT (attempt_key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.expires_at > ? THEN login_attempts.failures + 1 ELSE 1 END,
+			previous_failure_at = CASE WHEN login_attempts.expires_at > ? THEN login_attempts.last_failure_at ELSE NULL END,
+			last_failure_at = excluded.last_failure_at,
+			expires_at = excluded.expires_at`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RecordFailure")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	now = now.UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query, key, now, now.Add(window), now, now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	attempts, err := scanAttempts(tx.QueryRowContext(ctx, s.db.Rebind(`SELECT `+attemptsColumns+` FROM login_attempts WHERE attempt_key = ?`), key))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	// expired attempts are dropped on writes to keep the table bounded.
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`DELETE FROM login_attempts WHERE expires_at < ?`), now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	span.SetTag("failures", attempts.Failures)
+	return attempts, nil
+}
+
+func (s *SQLStore) RemoveFailure(ctx context.Context, key string) error {
+	query := s.db.Rebind(`UPDATE login_attempts SET failures = failures - 1 WHERE attempt_key = ? AND failures > 0`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RemoveFailure")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	_, err := s.db.ExecContext(ctx, query, key)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) Reset(ctx context.Context, key string) error {
+	query := s.db.Rebind(`DELETE FROM login_attempts WHERE attempt_key = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Reset")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	_, err := s.db.ExecContext(ctx, query, key)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func scanAttempts(row *sql.Row) (*Attempts, error) {
+	var attempts Attempts
+	var previousFailureAt sql.NullTime
+	err := row.Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &attempts.ExpiresAt, &previousFailureAt)
+	if err != nil {
+		return nil, err
+	}
+	attempts.PreviousFailureAt = previousFailureAt.Time
+	return &attempts, nil
+}
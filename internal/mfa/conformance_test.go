@@ -0,0 +1,215 @@
+package mfa
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"totp_recovery_codes", "totp_enrollments"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) Store {
+			return newStore(t).(Store)
+		})
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share,
+// newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "enrollment", test: testEnrollment},
+		{name: "UseStep", test: testUseStep},
+		{name: "UseRecoveryCode", test: testUseRecoveryCode},
+		{name: "UseRecoveryCode concurrently", test: testUseRecoveryCodeConcurrently},
+		{name: "DeleteTOTP", test: testDeleteTOTP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// enableTOTP enrolls userID and enables the enrollment with the recovery code
+// hashes at step 100.
+func enableTOTP(t *testing.T, store Store, userID string, recoveryCodeHashes []string) {
+	ctx := context.Background()
+	err := store.SavePendingTOTP(ctx, &TOTP{UserID: userID, Secret: "JBSWY3DPEHPK3PXP", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Store.SavePendingTOTP() error = %v", err)
+	}
+	err = store.EnableTOTP(ctx, userID, recoveryCodeHashes, 100, time.Now())
+	if err != nil {
+		t.Fatalf("Store.EnableTOTP() error = %v", err)
+	}
+}
+
+func testEnrollment(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	if _, err := store.GetTOTP(ctx, "user-1"); err != ErrNotEnrolled {
+		t.Errorf("Store.GetTOTP() of an unknown user error = %v, want %v", err, ErrNotEnrolled)
+	}
+	if err := store.EnableTOTP(ctx, "user-1", nil, 1, now); err != ErrNotEnrolled {
+		t.Errorf("Store.EnableTOTP() without enrollment error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	err := store.SavePendingTOTP(ctx, &TOTP{UserID: "user-1", Secret: "FIRSTSECRET", CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Store.SavePendingTOTP() error = %v", err)
+	}
+	// enrolling again replaces the pending enrollment.
+	err = store.SavePendingTOTP(ctx, &TOTP{UserID: "user-1", Secret: "SECONDSECRET", CreatedAt: now})
+	if err != nil {
+		t.Fatalf("Store.SavePendingTOTP() of a pending enrollment error = %v", err)
+	}
+	got, err := store.GetTOTP(ctx, "user-1")
+	if err != nil || got.Secret != "SECONDSECRET" || got.Enabled() || !got.CreatedAt.Equal(now) {
+		t.Fatalf("Store.GetTOTP() = %+v, %v, want the second pending enrollment", got, err)
+	}
+	if err := store.UseStep(ctx, "user-1", 1); err != ErrNotEnrolled {
+		t.Errorf("Store.UseStep() of a pending enrollment error = %v, want %v", err, ErrNotEnrolled)
+	}
+
+	err = store.EnableTOTP(ctx, "user-1", []string{"hash-1", "hash-2"}, 42, now)
+	if err != nil {
+		t.Fatalf("Store.EnableTOTP() error = %v", err)
+	}
+	got, err = store.GetTOTP(ctx, "user-1")
+	if err != nil || !got.Enabled() || !got.EnabledAt.Equal(now) || got.LastUsedStep != 42 {
+		t.Fatalf("Store.GetTOTP() = %+v, %v, want an enabled enrollment at step 42", got, err)
+	}
+	sort.Strings(got.RecoveryCodeHashes)
+	if !reflect.DeepEqual(got.RecoveryCodeHashes, []string{"hash-1", "hash-2"}) {
+		t.Errorf("Store.GetTOTP() recovery codes = %v, want %v", got.RecoveryCodeHashes, []string{"hash-1", "hash-2"})
+	}
+
+	if err := store.EnableTOTP(ctx, "user-1", nil, 43, now); err != ErrAlreadyEnabled {
+		t.Errorf("Store.EnableTOTP() of an enabled enrollment error = %v, want %v", err, ErrAlreadyEnabled)
+	}
+	if err := store.SavePendingTOTP(ctx, &TOTP{UserID: "user-1", Secret: "THIRDSECRET", CreatedAt: now}); err != ErrAlreadyEnabled {
+		t.Errorf("Store.SavePendingTOTP() over an enabled enrollment error = %v, want %v", err, ErrAlreadyEnabled)
+	}
+	if got, _ := store.GetTOTP(ctx, "user-1"); got.Secret != "SECONDSECRET" {
+		t.Errorf("Store.GetTOTP() secret = %q, want the enabled secret kept", got.Secret)
+	}
+}
+
+func testUseStep(t *testing.T, store Store) {
+	ctx := context.Background()
+	enableTOTP(t, store, "user-1", nil)
+
+	tests := []struct {
+		step    int64
+		wantErr error
+	}{
+		{step: 100, wantErr: ErrCodeUsed},
+		{step: 99, wantErr: ErrCodeUsed},
+		{step: 101, wantErr: nil},
+		{step: 101, wantErr: ErrCodeUsed},
+		{step: 103, wantErr: nil},
+		{step: 102, wantErr: ErrCodeUsed},
+	}
+	for _, tt := range tests {
+		if err := store.UseStep(ctx, "user-1", tt.step); err != tt.wantErr {
+			t.Errorf("Store.UseStep(%d) error = %v, want %v", tt.step, err, tt.wantErr)
+		}
+	}
+	if got, _ := store.GetTOTP(ctx, "user-1"); got.LastUsedStep != 103 {
+		t.Errorf("Store.GetTOTP() last used step = %d, want 103", got.LastUsedStep)
+	}
+	if err := store.UseStep(ctx, "user-2", 200); err != ErrNotEnrolled {
+		t.Errorf("Store.UseStep() of an unknown user error = %v, want %v", err, ErrNotEnrolled)
+	}
+}
+
+func testUseRecoveryCode(t *testing.T, store Store) {
+	ctx := context.Background()
+	enableTOTP(t, store, "user-1", []string{"hash-1", "hash-2"})
+
+	if err := store.UseRecoveryCode(ctx, "user-1", "hash-1"); err != nil {
+		t.Fatalf("Store.UseRecoveryCode() error = %v", err)
+	}
+	if err := store.UseRecoveryCode(ctx, "user-1", "hash-1"); err != ErrCodeUsed {
+		t.Errorf("Store.UseRecoveryCode() of a used code error = %v, want %v", err, ErrCodeUsed)
+	}
+	if err := store.UseRecoveryCode(ctx, "user-1", "hash-3"); err != ErrCodeUsed {
+		t.Errorf("Store.UseRecoveryCode() of an unknown code error = %v, want %v", err, ErrCodeUsed)
+	}
+	if err := store.UseRecoveryCode(ctx, "user-2", "hash-2"); err != ErrNotEnrolled {
+		t.Errorf("Store.UseRecoveryCode() of an unknown user error = %v, want %v", err, ErrNotEnrolled)
+	}
+	got, err := store.GetTOTP(ctx, "user-1")
+	if err != nil || !reflect.DeepEqual(got.RecoveryCodeHashes, []string{"hash-2"}) {
+		t.Errorf("Store.GetTOTP() recovery codes = %v, %v, want [hash-2]", got.RecoveryCodeHashes, err)
+	}
+}
+
+func testUseRecoveryCodeConcurrently(t *testing.T, store Store) {
+	ctx := context.Background()
+	enableTOTP(t, store, "user-1", []string{"hash-1"})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.UseRecoveryCode(ctx, "user-1", "hash-1")
+			if err == nil {
+				mu.Lock()
+				used++
+				mu.Unlock()
+			} else if err != ErrCodeUsed {
+				t.Errorf("Store.UseRecoveryCode() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if used != 1 {
+		t.Errorf("Store.UseRecoveryCode() succeeded %d times concurrently, want 1", used)
+	}
+}
+
+func testDeleteTOTP(t *testing.T, store Store) {
+	ctx := context.Background()
+	if err := store.DeleteTOTP(ctx, "user.none"); err != nil {
+		t.Errorf("Store.DeleteTOTP() of a user without an enrollment error = %v", err)
+	}
+	enableTOTP(t, store, "user.enabled", []string{"hash.a"})
+	if err := store.DeleteTOTP(ctx, "user.enabled"); err != nil {
+		t.Fatalf("Store.DeleteTOTP() error = %v", err)
+	}
+	if _, err := store.GetTOTP(ctx, "user.enabled"); err != ErrNotEnrolled {
+		t.Errorf("Store.GetTOTP() of a deleted enrollment error = %v, want %v", err, ErrNotEnrolled)
+	}
+	// the user can enroll again from scratch.
+	enableTOTP(t, store, "user.enabled", []string{"hash.b"})
+	totp, err := store.GetTOTP(ctx, "user.enabled")
+	if err != nil || !reflect.DeepEqual(totp.RecoveryCodeHashes, []string{"hash.b"}) {
+		t.Errorf("Store.GetTOTP() after enrolling again = %+v, %v, want only the new recovery code", totp, err)
+	}
+}
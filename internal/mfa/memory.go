@@ -0,0 +1,110 @@
+package mfa
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps TOTP enrollments in a map keyed by user
+// id, recording used steps and recovery codes under a mutex so that a code is
+// accepted once. Enrollments are lost when the process restarts.
+type MemoryStore struct {
+	mu    sync.Mutex
+	totps map[string]TOTP
+}
+
+// NewMemoryStore returns an empty in memory enrollment store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		totps: map[string]TOTP{},
+	}
+}
+
+func (s *MemoryStore) SavePendingTOTP(ctx context.Context, totp *TOTP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.totps[totp.UserID]; ok && existing.Enabled() {
+		return ErrAlreadyEnabled
+	}
+	stored := *totp
+	stored.EnabledAt = nil
+	stored.RecoveryCodeHashes = nil
+	stored.LastUsedStep = 0
+	s.totps[totp.UserID] = stored
+	return nil
+}
+
+func (s *MemoryStore) GetTOTP(ctx context.Context, userID string) (*TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return nil, ErrNotEnrolled
+	}
+	totp.RecoveryCodeHashes = append([]string(nil), totp.RecoveryCodeHashes...)
+	return &totp, nil
+}
+
+func (s *MemoryStore) EnableTOTP(ctx context.Context, userID string, recoveryCodeHashes []string, step int64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok {
+		return ErrNotEnrolled
+	}
+	if totp.Enabled() {
+		return ErrAlreadyEnabled
+	}
+	totp.EnabledAt = &now
+	totp.RecoveryCodeHashes = append([]string(nil), recoveryCodeHashes...)
+	totp.LastUsedStep = step
+	s.totps[userID] = totp
+	return nil
+}
+
+func (s *MemoryStore) UseStep(ctx context.Context, userID string, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok || !totp.Enabled() {
+		return ErrNotEnrolled
+	}
+	if step <= totp.LastUsedStep {
+		return ErrCodeUsed
+	}
+	totp.LastUsedStep = step
+	s.totps[userID] = totp
+	return nil
+}
+
+func (s *MemoryStore) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totp, ok := s.totps[userID]
+	if !ok || !totp.Enabled() {
+		return ErrNotEnrolled
+	}
+	for i, h := range totp.RecoveryCodeHashes {
+		if h == hash {
+			hashes := append([]string(nil), totp.RecoveryCodeHashes[:i]...)
+			totp.RecoveryCodeHashes = append(hashes, totp.RecoveryCodeHashes[i+1:]...)
+			s.totps[userID] = totp
+			return nil
+		}
+	}
+	return ErrCodeUsed
+}
+
+func (s *MemoryStore) DeleteTOTP(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totps, userID)
+	return nil
+}
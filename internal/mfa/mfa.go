@@ -0,0 +1,72 @@
+// Package mfa implements two-factor authentication with RFC 6238 time based
+// one-time passwords (TOTP) and single use recovery codes, and keeps the TOTP
+// enrollments of users.
+package mfa
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotEnrolled    = errors.New("two-factor authentication is not set up")
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrCodeUsed       = errors.New("code was already used")
+)
+
+// TOTP is the TOTP enrollment of a user. An enrollment is pending until the
+// user confirms it with a first code, only enabled enrollments are required
+// to log in.
+type TOTP struct {
+	UserID string `json:"userId" bson:"_id"`
+	// Secret is the base32 encoded shared secret.
+	Secret string `json:"-" bson:"secret"`
+	// EnabledAt is when the enrollment was confirmed, nil while it is pending.
+	EnabledAt *time.Time `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+	// RecoveryCodeHashes are the hashes of the unused recovery codes.
+	RecoveryCodeHashes []string `json:"-" bson:"recoveryCodeHashes"`
+	// LastUsedStep is the time step of the last accepted code, codes of that
+	// step or earlier are rejected so that a code cannot be replayed.
+	LastUsedStep int64     `json:"-" bson:"lastUsedStep"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// Enabled reports whether the enrollment was confirmed.
+func (t *TOTP) Enabled() bool {
+	return t.EnabledAt != nil
+}
+
+// Setup is what a user adds to their authenticator app to enroll.
+type Setup struct {
+	// Secret is the base32 encoded secret, for apps that cannot scan the URI.
+	Secret string
+	// URI is the otpauth URI of the secret, usually shown as a QR code.
+	URI string
+}
+
+// Store persists the TOTP enrollments of users.
+type Store interface {
+	// SavePendingTOTP stores totp as the pending enrollment of its user,
+	// replacing any pending one. It returns ErrAlreadyEnabled when the user
+	// has an enabled enrollment.
+	SavePendingTOTP(ctx context.Context, totp *TOTP) error
+	// GetTOTP returns the enrollment of the user, ErrNotEnrolled when there is
+	// none.
+	GetTOTP(ctx context.Context, userID string) (*TOTP, error)
+	// EnableTOTP enables the pending enrollment of the user with the recovery
+	// code hashes, step is the step of the confirming code. It returns
+	// ErrNotEnrolled when there is no enrollment and ErrAlreadyEnabled when
+	// it is already enabled.
+	EnableTOTP(ctx context.Context, userID string, recoveryCodeHashes []string, step int64, now time.Time) error
+	// UseStep records step as used by the enabled enrollment of the user, it
+	// returns ErrCodeUsed when step is not after the last used step.
+	UseStep(ctx context.Context, userID string, step int64) error
+	// UseRecoveryCode removes hash from the recovery codes of the enabled
+	// enrollment of the user, it returns ErrCodeUsed when hash is not one of
+	// them.
+	UseRecoveryCode(ctx context.Context, userID, hash string) error
+	// DeleteTOTP removes the enrollment of the user, pending or enabled, along
+	// with its recovery codes. Users without one are not an error.
+	DeleteTOTP(ctx context.Context, userID string) error
+}
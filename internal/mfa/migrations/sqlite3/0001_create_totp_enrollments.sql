@@ -0,0 +1,13 @@
+CREATE TABLE totp_enrollments (
+    user_id TEXT PRIMARY KEY,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP,
+    last_used_step INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE totp_recovery_codes (
+    user_id TEXT NOT NULL REFERENCES totp_enrollments (user_id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    PRIMARY KEY (user_id, code_hash)
+);
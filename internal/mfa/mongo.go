@@ -0,0 +1,169 @@
+package mfa
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the totpEnrollments collection of a mongodb
+// database.
+type MongoStore struct {
+	collection *mongo.Collection
+	tracer     opentracing.Tracer
+}
+
+// NewMongoStore returns an enrollment store that keeps enrollments in the
+// totpEnrollments collection of db.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("totpEnrollments"),
+		tracer:     tracer,
+	}
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span) {
+	ext.DBInstance.Set(span, s.collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) SavePendingTOTP(ctx context.Context, totp *TOTP) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "SavePendingTOTP")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	// the filter skips enabled enrollments, so the upsert then tries to insert
+	// a second document with the same _id and fails.
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": totp.UserID, "enabledAt": bson.M{"$exists": false}}, bson.M{
+		"_id":                totp.UserID,
+		"secret":             totp.Secret,
+		"recoveryCodeHashes": bson.A{},
+		"lastUsedStep":       int64(0),
+		"createdAt":          totp.CreatedAt,
+	}, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrAlreadyEnabled
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.ReplaceOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) GetTOTP(ctx context.Context, userID string) (*TOTP, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetTOTP")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	var totp TOTP
+	err := s.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&totp)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (s *MongoStore) EnableTOTP(ctx context.Context, userID string, recoveryCodeHashes []string, step int64, now time.Time) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnableTOTP")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": userID, "enabledAt": bson.M{"$exists": false}}, bson.M{"$set": bson.M{
+		"enabledAt":          now,
+		"recoveryCodeHashes": recoveryCodeHashes,
+		"lastUsedStep":       step,
+	}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return s.notUpdatedError(ctx, userID, ErrAlreadyEnabled)
+	}
+	return nil
+}
+
+func (s *MongoStore) UseStep(ctx context.Context, userID string, step int64) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "UseStep")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{
+		"_id":          userID,
+		"enabledAt":    bson.M{"$exists": true},
+		"lastUsedStep": bson.M{"$lt": step},
+	}, bson.M{"$set": bson.M{"lastUsedStep": step}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return s.notUpdatedError(ctx, userID, ErrCodeUsed)
+	}
+	return nil
+}
+
+func (s *MongoStore) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "UseRecoveryCode")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{
+		"_id":                userID,
+		"enabledAt":          bson.M{"$exists": true},
+		"recoveryCodeHashes": hash,
+	}, bson.M{"$pull": bson.M{"recoveryCodeHashes": hash}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return s.notUpdatedError(ctx, userID, ErrCodeUsed)
+	}
+	return nil
+}
+
+// notUpdatedError returns why a conditional update of the enrollment of the
+// user matched nothing, ErrNotEnrolled when the user has no enabled
+// enrollment and errEnrolled otherwise.
+func (s *MongoStore) DeleteTOTP(ctx context.Context, userID string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteTOTP")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.DeleteOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) notUpdatedError(ctx context.Context, userID string, errEnrolled error) error {
+	totp, err := s.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if errEnrolled != ErrAlreadyEnabled && !totp.Enabled() {
+		return ErrNotEnrolled
+	}
+	return errEnrolled
+}
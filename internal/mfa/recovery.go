@@ -0,0 +1,41 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"strings"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued on enrollment.
+const RecoveryCodeCount = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes returns RecoveryCodeCount random recovery codes, such as
+// "k3jd-9fxq", along with the hashes to store.
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		encoded := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		code := encoded[:4] + "-" + encoded[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode returns the hash a recovery code is stored under, case,
+// spaces and dashes are ignored so codes can be typed loosely. Codes are
+// random enough for a fast hash.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package mfa
+
+import "testing"
+
+func TestHashRecoveryCode(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes() error = %v", err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("NewRecoveryCodes() returned %d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 9 || code[4] != '-' {
+			t.Errorf("NewRecoveryCodes() code = %q, want xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("NewRecoveryCodes() returned %q twice", code)
+		}
+		seen[code] = true
+		if HashRecoveryCode(code) != hashes[i] {
+			t.Errorf("HashRecoveryCode(%q) does not match its hash", code)
+		}
+	}
+	if HashRecoveryCode("K3JD 9FXQ") != HashRecoveryCode("k3jd-9fxq") {
+		t.Errorf("HashRecoveryCode() differs by case and separators")
+	}
+}
@@ -0,0 +1,290 @@
+package mfa
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// SQLStore is a Store backed by a postgres or sqlite database.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns an enrollment store that keeps enrollments in an sql
+// database, Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the totp_enrollments and totp_recovery_codes
+// tables, it is safe to call on every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "mfa", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "totp_enrollments")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+func (s *SQLStore) SavePendingTOTP(ctx context.Context, totp *TOTP) error {
+	// the upsert leaves enabled enrollments untouched, which is reported as
+	// no affected rows.
+	query := s.db.Rebind(`INSERT INTO totp_enrollments (user_id, secret, enabled_at, last_used_step, created_at) VALUES (?, ?, NULL, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = excluded.secret,
+			last_used_step = 0,
+			created_at = excluded.created_at
+		WHERE totp_enrollments.enabled_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "SavePendingTOTP")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	result, err := s.db.ExecContext(ctx, query, totp.UserID, totp.Secret, totp.CreatedAt.UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	saved, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return err
+	}
+	if saved == 0 {
+		return ErrAlreadyEnabled
+	}
+	return nil
+}
+
+func (s *SQLStore) GetTOTP(ctx context.Context, userID string) (*TOTP, error) {
+	query := s.db.Rebind(`SELECT user_id, secret, enabled_at, last_used_step, created_at FROM totp_enrollments WHERE user_id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetTOTP")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	var totp TOTP
+	var enabledAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&totp.UserID, &totp.Secret, &enabledAt, &totp.LastUsedStep, &totp.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotEnrolled
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	if enabledAt.Valid {
+		totp.EnabledAt = &enabledAt.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`SELECT code_hash FROM totp_recovery_codes WHERE user_id = ?`), userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		totp.RecoveryCodeHashes = append(totp.RecoveryCodeHashes, hash)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Err"))
+		return nil, err
+	}
+	return &totp, nil
+}
+
+func (s *SQLStore) EnableTOTP(ctx context.Context, userID string, recoveryCodeHashes []string, step int64, now time.Time) error {
+	query := s.db.Rebind(`UPDATE totp_enrollments SET enabled_at = ?, last_used_step = ? WHERE user_id = ? AND enabled_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnableTOTP")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, now.UTC(), step, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	enabled, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return err
+	}
+	if enabled == 0 {
+		tx.Rollback()
+		return s.notUpdatedError(ctx, userID, ErrAlreadyEnabled)
+	}
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`DELETE FROM totp_recovery_codes WHERE user_id = ?`), userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	insert := s.db.Rebind(`INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES (?, ?)`)
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, insert, userID, hash)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Exec"))
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) UseStep(ctx context.Context, userID string, step int64) error {
+	query := s.db.Rebind(`UPDATE totp_enrollments SET last_used_step = ? WHERE user_id = ? AND enabled_at IS NOT NULL AND last_used_step < ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "UseStep")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	result, err := s.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return err
+	}
+	if used == 0 {
+		return s.notUpdatedError(ctx, userID, ErrCodeUsed)
+	}
+	return nil
+}
+
+func (s *SQLStore) UseRecoveryCode(ctx context.Context, userID, hash string) error {
+	query := s.db.Rebind(`DELETE FROM totp_recovery_codes WHERE user_id = ? AND code_hash = ?
+		AND EXISTS (SELECT 1 FROM totp_enrollments WHERE user_id = ? AND enabled_at IS NOT NULL)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "UseRecoveryCode")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	result, err := s.db.ExecContext(ctx, query, userID, hash, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return err
+	}
+	if used == 0 {
+		return s.notUpdatedError(ctx, userID, ErrCodeUsed)
+	}
+	return nil
+}
+
+// notUpdatedError returns why a conditional update of the enrollment of the
+// user matched nothing, ErrNotEnrolled when the user has no enabled
+// enrollment and errEnrolled otherwise.
+func (s *SQLStore) DeleteTOTP(ctx context.Context, userID string) error {
+	query := s.db.Rebind(`DELETE FROM totp_enrollments WHERE user_id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteTOTP")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return err
+	}
+	defer tx.Rollback()
+
+	// the recovery codes go first as sqlite does not cascade deletes
+	// unless foreign keys are turned on.
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`DELETE FROM totp_recovery_codes WHERE user_id = ?`), userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) notUpdatedError(ctx context.Context, userID string, errEnrolled error) error {
+	totp, err := s.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if errEnrolled != ErrAlreadyEnabled && !totp.Enabled() {
+		return ErrNotEnrolled
+	}
+	return errEnrolled
+}
@@ -0,0 +1,108 @@
+package mfa
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is the number of digits of a code.
+	Digits = 6
+	// Period is how long a code is valid for.
+	Period = 30 * time.Second
+	// Skew is the number of steps before and after the current one whose
+	// codes are accepted, to allow for clock drift and slow typing.
+	Skew = 1
+
+	secretBytes = 20
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns a random base32 encoded secret.
+func NewSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return secretEncoding.EncodeToString(b), nil
+}
+
+// Step returns the time step of t.
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code of the base32 encoded secret for step.
+func Code(secret string, step int64) (string, error) {
+	key, err := secretEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, step, Digits), nil
+}
+
+// hotp is the RFC 4226 HOTP value of key for counter.
+func hotp(key []byte, counter int64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// Validate checks code against the secret at now, allowing Skew steps of
+// drift. It returns the step of the matching code, which callers must record
+// to reject its reuse.
+func Validate(secret, code string, now time.Time) (step int64, ok bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(now)
+	for s := current - Skew; s <= current+Skew; s++ {
+		want, err := Code(secret, s)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(want), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// KeyURI returns the otpauth URI of the secret that authenticator apps
+// enroll from, usually shown as a QR code. issuer is the name the apps show
+// and account is the email of the user.
+func KeyURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
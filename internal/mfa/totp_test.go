@@ -0,0 +1,90 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of the RFC 6238 test vectors.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the RFC 6238 SHA1 test vectors, truncated to 6 digits.
+	tests := []struct {
+		time int64
+		want string
+	}{
+		{time: 59, want: "287082"},
+		{time: 1111111109, want: "081804"},
+		{time: 1111111111, want: "050471"},
+		{time: 1234567890, want: "005924"},
+		{time: 2000000000, want: "279037"},
+		{time: 20000000000, want: "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.time, 0)))
+		if err != nil || got != tt.want {
+			t.Errorf("Code() at %d = %q, %v, want %q", tt.time, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(step int64) string {
+		c, _ := Code(rfcSecret, step)
+		return c
+	}
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous step", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "too old", code: code(step - 2)},
+		{name: "too far ahead", code: code(step + 2)},
+		{name: "wrong length", code: code(step)[:5]},
+		{name: "empty", code: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Validate(rfcSecret, tt.code, now)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate() = %d, %v, want %d, %v", gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatalf("NewSecret() error = %v", err)
+	}
+	if _, err := Code(secret, 1); err != nil {
+		t.Errorf("Code() of a new secret error = %v", err)
+	}
+	if other, _ := NewSecret(); other == secret {
+		t.Errorf("NewSecret() returned the same secret twice")
+	}
+}
+
+func TestKeyURI(t *testing.T) {
+	got, err := url.Parse(KeyURI("Marketplace", "john@example.com", "JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatalf("url.Parse() error = %v", err)
+	}
+	if got.Scheme != "otpauth" || got.Host != "totp" || got.Path != "/Marketplace:john@example.com" {
+		t.Errorf("KeyURI() = %v, want an otpauth://totp/Marketplace:john@example.com URI", got)
+	}
+	query := got.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "Marketplace" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("KeyURI() query = %v, want the secret, issuer, digits and period", query)
+	}
+}
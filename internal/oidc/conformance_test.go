@@ -0,0 +1,132 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"user_identities"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) IdentityStore {
+			return newStore(t).(IdentityStore)
+		})
+	})
+}
+
+// testStore checks the behaviour every IdentityStore implementation must
+// share, newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) IdentityStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store IdentityStore)
+	}{
+		{name: "CreateIdentity", test: testCreateIdentity},
+		{name: "ListUserIdentities", test: testListUserIdentities},
+		{name: "DeleteUserIdentities", test: testDeleteUserIdentities},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+func newIdentity(id, provider, subject, userID string, createdAt time.Time) *Identity {
+	return &Identity{
+		ID:        id,
+		Provider:  provider,
+		Subject:   subject,
+		UserID:    userID,
+		Email:     userID + "@example.com",
+		CreatedAt: createdAt.UTC().Truncate(time.Millisecond),
+	}
+}
+
+func testCreateIdentity(t *testing.T, store IdentityStore) {
+	ctx := context.Background()
+	if _, err := store.GetIdentity(ctx, "google", "sub-1"); err != ErrIdentityNotFound {
+		t.Errorf("IdentityStore.GetIdentity() of an unknown identity error = %v, want %v", err, ErrIdentityNotFound)
+	}
+	identity := newIdentity("identity-1", "google", "sub-1", "user-1", time.Now())
+	if err := store.CreateIdentity(ctx, identity); err != nil {
+		t.Fatalf("IdentityStore.CreateIdentity() error = %v", err)
+	}
+	got, err := store.GetIdentity(ctx, "google", "sub-1")
+	if err != nil || got.ID != identity.ID || got.UserID != identity.UserID || got.Email != identity.Email || !got.CreatedAt.Equal(identity.CreatedAt) {
+		t.Errorf("IdentityStore.GetIdentity() = %+v, %v, want %+v", got, err, identity)
+	}
+
+	// the account can only be linked once, whichever user it is linked to.
+	duplicate := newIdentity("identity-2", "google", "sub-1", "user-2", time.Now())
+	if err := store.CreateIdentity(ctx, duplicate); err != ErrIdentityExists {
+		t.Errorf("IdentityStore.CreateIdentity() of a linked account error = %v, want %v", err, ErrIdentityExists)
+	}
+	// subjects are only unique within a provider.
+	other := newIdentity("identity-3", "apple", "sub-1", "user-2", time.Now())
+	if err := store.CreateIdentity(ctx, other); err != nil {
+		t.Errorf("IdentityStore.CreateIdentity() of the subject at another provider error = %v", err)
+	}
+}
+
+func testListUserIdentities(t *testing.T, store IdentityStore) {
+	ctx := context.Background()
+	now := time.Now()
+	for _, identity := range []*Identity{
+		newIdentity("identity-1", "google", "sub-1", "user-1", now.Add(time.Minute)),
+		newIdentity("identity-2", "apple", "sub-2", "user-1", now),
+		newIdentity("identity-3", "google", "sub-3", "user-2", now),
+	} {
+		if err := store.CreateIdentity(ctx, identity); err != nil {
+			t.Fatalf("IdentityStore.CreateIdentity() error = %v", err)
+		}
+	}
+	identities, err := store.ListUserIdentities(ctx, "user-1")
+	if err != nil || len(identities) != 2 || identities[0].ID != "identity-2" || identities[1].ID != "identity-1" {
+		t.Errorf("IdentityStore.ListUserIdentities() = %+v, %v, want identity-2 and identity-1", identities, err)
+	}
+	identities, err = store.ListUserIdentities(ctx, "user-3")
+	if err != nil || identities == nil || len(identities) != 0 {
+		t.Errorf("IdentityStore.ListUserIdentities() of a user without identities = %+v, %v, want an empty list", identities, err)
+	}
+}
+
+func testDeleteUserIdentities(t *testing.T, store IdentityStore) {
+	ctx := context.Background()
+	for _, identity := range []*Identity{
+		newIdentity("identity-1", "google", "sub-1", "user-1", time.Now()),
+		newIdentity("identity-2", "apple", "sub-2", "user-1", time.Now()),
+		newIdentity("identity-3", "google", "sub-3", "user-2", time.Now()),
+	} {
+		if err := store.CreateIdentity(ctx, identity); err != nil {
+			t.Fatalf("IdentityStore.CreateIdentity() error = %v", err)
+		}
+	}
+	if err := store.DeleteUserIdentities(ctx, "user-1"); err != nil {
+		t.Fatalf("IdentityStore.DeleteUserIdentities() error = %v", err)
+	}
+	if _, err := store.GetIdentity(ctx, "google", "sub-1"); err != ErrIdentityNotFound {
+		t.Errorf("IdentityStore.GetIdentity() of a deleted identity error = %v, want %v", err, ErrIdentityNotFound)
+	}
+	if _, err := store.GetIdentity(ctx, "google", "sub-3"); err != nil {
+		t.Errorf("IdentityStore.GetIdentity() of another user's identity error = %v", err)
+	}
+	// the account can be linked again once unlinked.
+	if err := store.CreateIdentity(ctx, newIdentity("identity-4", "google", "sub-1", "user-4", time.Now())); err != nil {
+		t.Errorf("IdentityStore.CreateIdentity() of an unlinked account error = %v", err)
+	}
+}
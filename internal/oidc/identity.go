@@ -0,0 +1,39 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdentityExists   = errors.New("identity is already linked")
+	ErrIdentityNotFound = errors.New("identity not found")
+)
+
+// Identity links the account of a user at a provider to the user.
+type Identity struct {
+	ID       string `json:"id" bson:"_id"`
+	Provider string `json:"provider" bson:"provider"`
+	// Subject is the sub claim of the ID tokens of the account, it is unique
+	// and stable at the provider.
+	Subject string `json:"subject" bson:"subject"`
+	UserID  string `json:"userId" bson:"userId"`
+	// Email is the email of the account when it was linked.
+	Email     string    `json:"email" bson:"email"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// IdentityStore keeps the linked identities.
+type IdentityStore interface {
+	// CreateIdentity stores identity, it returns ErrIdentityExists when the
+	// account of the provider is already linked.
+	CreateIdentity(ctx context.Context, identity *Identity) error
+	// GetIdentity returns the identity of the account of the provider or
+	// ErrIdentityNotFound.
+	GetIdentity(ctx context.Context, provider, subject string) (*Identity, error)
+	// ListUserIdentities returns the identities of the user, oldest first.
+	ListUserIdentities(ctx context.Context, userID string) ([]Identity, error)
+	// DeleteUserIdentities removes every identity of the user.
+	DeleteUserIdentities(ctx context.Context, userID string) error
+}
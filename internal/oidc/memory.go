@@ -0,0 +1,78 @@
+package oidc
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryStore is an IdentityStore that keeps identities in a map keyed by
+// provider and subject, the mutex makes linking an identity that is already
+// linked fail with ErrIdentityExists. Links are lost when the process
+// restarts.
+type MemoryStore struct {
+	mu         sync.Mutex
+	identities map[identityKey]Identity
+}
+
+type identityKey struct {
+	provider, subject string
+}
+
+// NewMemoryStore returns an empty in memory identity store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		identities: map[identityKey]Identity{},
+	}
+}
+
+func (s *MemoryStore) CreateIdentity(ctx context.Context, identity *Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey{identity.Provider, identity.Subject}
+	if _, ok := s.identities[key]; ok {
+		return ErrIdentityExists
+	}
+	s.identities[key] = *identity
+	return nil
+}
+
+func (s *MemoryStore) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity, ok := s.identities[identityKey{provider, subject}]
+	if !ok {
+		return nil, ErrIdentityNotFound
+	}
+	return &identity, nil
+}
+
+func (s *MemoryStore) ListUserIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identities := []Identity{}
+	for _, identity := range s.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+func (s *MemoryStore) DeleteUserIdentities(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, identity := range s.identities {
+		if identity.UserID == userID {
+			delete(s.identities, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+CREATE TABLE user_identities (
+    id TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,134 @@
+package oidc
+
+import (
+	"context"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is an IdentityStore backed by the identities collection of a
+// mongodb database.
+type MongoStore struct {
+	collection *mongo.Collection
+	tracer     opentracing.Tracer
+}
+
+// NewMongoStore returns an identity store that keeps identities in the
+// identities collection of db, EnsureIndexes must be called before it is used.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("identities"),
+		tracer:     tracer,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on, the unique index
+// keeps an account of a provider from being linked twice. It is safe to call
+// on every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnsureIndexes")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "provider", Value: 1}, {Key: "subject", Value: 1}},
+			Options: options.Index().SetName("provider_subject_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("userId"),
+		},
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateMany"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span) {
+	ext.DBInstance.Set(span, s.collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) CreateIdentity(ctx context.Context, identity *Identity) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateIdentity")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.provider", identity.Provider).SetTag("param.userId", identity.UserID)
+
+	_, err := s.collection.InsertOne(ctx, identity)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrIdentityExists
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.InsertOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetIdentity")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.provider", provider)
+
+	var identity Identity
+	err := s.collection.FindOne(ctx, bson.M{"provider": provider, "subject": subject}).Decode(&identity)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *MongoStore) ListUserIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListUserIdentities")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.userId", userID)
+
+	cursor, err := s.collection.Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Find"))
+		return nil, err
+	}
+	identities := []Identity{}
+	err = cursor.All(ctx, &identities)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Cursor.All"))
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (s *MongoStore) DeleteUserIdentities(ctx context.Context, userID string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserIdentities")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.userId", userID)
+
+	_, err := s.collection.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.DeleteMany"))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+// Package oidc verifies the ID tokens of external OpenID Connect providers and
+// keeps the identities linking provider accounts to users, a user can have an
+// identity at several providers.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidIDToken      = errors.New("invalid id token")
+	ErrProviderUnavailable = errors.New("identity provider is unavailable")
+)
+
+// Leeway tolerates the clock skew between providers and the service when
+// checking exp, nbf and iat.
+const Leeway = time.Minute
+
+// Provider is an OpenID Connect provider users can log in with.
+type Provider struct {
+	// Name is how clients refer to the provider, such as "google".
+	Name string
+	// Issuer is the iss claim of the ID tokens of the provider.
+	Issuer string
+	// ClientIDs are the ids of our clients at the provider, ID tokens must be
+	// issued to one of them.
+	ClientIDs []string
+	// JWKSURL is where the provider publishes its signing keys, it is found
+	// with OpenID Connect discovery when empty.
+	JWKSURL string
+}
+
+// Claims are the claims of an ID token used to log users in.
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email,omitempty"`
+	EmailVerified Bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+
+	// provider is set before the claims are decoded, it is not part of the
+	// token.
+	provider Provider
+}
+
+// Valid implements jwt.Claims, unlike access tokens ID tokens must have an
+// exp claim and a subject.
+func (c *Claims) Valid() error {
+	now := jwt.TimeFunc()
+	switch {
+	case c.ExpiresAt == nil || !now.Before(c.ExpiresAt.Add(Leeway)):
+		return jwt.ErrTokenExpired
+	case c.NotBefore != nil && now.Add(Leeway).Before(c.NotBefore.Time):
+		return jwt.ErrTokenNotValidYet
+	case c.IssuedAt != nil && now.Add(Leeway).Before(c.IssuedAt.Time):
+		return jwt.ErrTokenUsedBeforeIssued
+	case c.Issuer != c.provider.Issuer:
+		return jwt.ErrTokenInvalidIssuer
+	case !c.hasAudience(c.provider.ClientIDs):
+		return jwt.ErrTokenInvalidAudience
+	case c.Subject == "":
+		return errors.New("token has no subject")
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim holds one of audience.
+func (c *Claims) hasAudience(audience []string) bool {
+	for _, want := range audience {
+		for _, got := range c.Audience {
+			if got == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Bool is a JSON boolean that also accepts the strings "true" and "false",
+// as some providers send email_verified as a string.
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case bool:
+		*b = Bool(value)
+	case string:
+		*b = value == "true"
+	case nil:
+		*b = false
+	default:
+		return errors.New("invalid boolean")
+	}
+	return nil
+}
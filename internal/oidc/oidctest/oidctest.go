@@ -0,0 +1,136 @@
+// Package oidctest provides a stand-in OpenID Connect issuer for tests, it
+// serves discovery and the JWKS of its signing key over a local HTTP server.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+)
+
+// Nonce is the nonce claim of the tokens of NewClaims.
+const Nonce = "test-nonce"
+
+// Issuer is a local OpenID Connect issuer signing ID tokens with an RSA key.
+type Issuer struct {
+	// URL is the issuer identifier, the iss claim of its tokens.
+	URL string
+	// ClientID is the audience of the tokens of NewClaims.
+	ClientID string
+
+	server *httptest.Server
+
+	mu         sync.Mutex
+	keys       *keyring.Ring
+	keyCount   int
+	jwksServed int
+}
+
+// NewIssuer starts an issuer of ID tokens for clientID, it must be closed
+// when the test is done. It panics when no key can be generated.
+func NewIssuer(clientID string) *Issuer {
+	issuer := &Issuer{ClientID: clientID}
+	issuer.RotateKey()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.serveDiscovery)
+	mux.HandleFunc("/jwks", issuer.serveJWKS)
+	issuer.server = httptest.NewServer(mux)
+	issuer.URL = issuer.server.URL
+	return issuer
+}
+
+// Close shuts the issuer down.
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// Provider returns the provider named name for the issuer, it finds its keys
+// with discovery.
+func (i *Issuer) Provider(name string) oidc.Provider {
+	return oidc.Provider{
+		Name:      name,
+		Issuer:    i.URL,
+		ClientIDs: []string{i.ClientID},
+	}
+}
+
+// RotateKey replaces the signing key by a new key with a new id, tokens
+// signed with the old key cannot be verified anymore.
+func (i *Issuer) RotateKey() {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: generating key: %v", err))
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keyCount++
+	key, err := keyring.NewKey(fmt.Sprintf("key-%d", i.keyCount), privateKey)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: %v", err))
+	}
+	i.keys, err = keyring.New(key)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: %v", err))
+	}
+}
+
+// JWKSRequests returns how many times the JWKS was fetched.
+func (i *Issuer) JWKSRequests() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksServed
+}
+
+// NewClaims returns the claims of a valid ID token of the subject for the
+// client of the issuer, with a verified email and Nonce.
+func (i *Issuer) NewClaims(subject, email string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL,
+		"sub":            subject,
+		"aud":            i.ClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          email,
+		"email_verified": true,
+		"nonce":          Nonce,
+	}
+}
+
+// Sign returns an ID token holding claims signed with the current key.
+func (i *Issuer) Sign(claims jwt.Claims) string {
+	i.mu.Lock()
+	keys := i.keys
+	i.mu.Unlock()
+	token, err := keys.IssueToken(claims)
+	if err != nil {
+		panic(fmt.Sprintf("oidctest: signing token: %v", err))
+	}
+	return token
+}
+
+func (i *Issuer) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                i.URL,
+		"jwks_uri":                              i.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (i *Issuer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	keys := i.keys
+	i.jwksServed++
+	i.mu.Unlock()
+	keys.JWKSHandler().ServeHTTP(w, r)
+}
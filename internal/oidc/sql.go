@@ -0,0 +1,146 @@
+package oidc
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+// SQLStore is an IdentityStore backed by a postgres or sqlite database.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns an identity store that keeps identities in an sql
+// database, Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the user_identities table, it is safe to call on
+// every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "oidc", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "user_identities")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+func (s *SQLStore) CreateIdentity(ctx context.Context, identity *Identity) error {
+	query := s.db.Rebind(`INSERT INTO user_identities (id, provider, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateIdentity")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	_, err := s.db.ExecContext(ctx, query,
+		identity.ID, identity.Provider, identity.Subject, identity.UserID, identity.Email, identity.CreatedAt.UTC(),
+	)
+	if sqldb.IsUniqueViolation(err) {
+		return ErrIdentityExists
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := s.db.Rebind(`SELECT id, provider, subject, user_id, email, created_at FROM user_identities WHERE provider = ? AND subject = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetIdentity")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	var identity Identity
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID, &identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (s *SQLStore) ListUserIdentities(ctx context.Context, userID string) ([]Identity, error) {
+	query := s.db.Rebind(`SELECT id, provider, subject, user_id, email, created_at FROM user_identities WHERE user_id = ? ORDER BY created_at, id`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListUserIdentities")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	identities := []Identity{}
+	for rows.Next() {
+		var identity Identity
+		err = rows.Scan(&identity.ID, &identity.Provider, &identity.Subject, &identity.UserID, &identity.Email, &identity.CreatedAt)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Err"))
+		return nil, err
+	}
+	return identities, nil
+}
+
+func (s *SQLStore) DeleteUserIdentities(ctx context.Context, userID string) error {
+	query := s.db.Rebind(`DELETE FROM user_identities WHERE user_id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserIdentities")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+)
+
+const (
+	// keysMaxAge is how long fetched keys are used before they are fetched
+	// again.
+	keysMaxAge = time.Hour
+	// minRefreshInterval limits how often tokens signed with an unknown key
+	// trigger a fetch, so that they cannot be used to flood the provider.
+	minRefreshInterval = time.Minute
+	maxResponseBytes   = 1 << 20
+)
+
+// Verifier verifies the ID tokens of a provider, the keys of the provider are
+// fetched on first use and cached. It is safe for concurrent use.
+type Verifier struct {
+	provider Provider
+	client   *http.Client
+
+	mu        sync.Mutex
+	keys      *keyring.Ring
+	fetchedAt time.Time
+	// fetching is the fetch of the keys in flight, callers needing new keys
+	// wait for it rather than fetching them again.
+	fetching *keysFetch
+}
+
+// keysFetch is a fetch of the keys of the provider, keys and err are set
+// before done is closed.
+type keysFetch struct {
+	done chan struct{}
+	keys *keyring.Ring
+	err  error
+}
+
+// NewVerifier returns a verifier of the ID tokens of provider that fetches
+// keys with client, a nil client uses a client with a 10 seconds timeout.
+func NewVerifier(provider Provider, client *http.Client) *Verifier {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Verifier{
+		provider: provider,
+		client:   client,
+	}
+}
+
+// Provider returns the provider of the verifier.
+func (v *Verifier) Provider() Provider {
+	return v.provider
+}
+
+// Verify returns the claims of idToken when it is signed by the provider for
+// one of its client ids, is unexpired and carries nonce, invalid tokens return
+// an error wrapping ErrInvalidIDToken. The nonce is required as it is what
+// binds the token to the login of the caller.
+func (v *Verifier) Verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	if nonce == "" {
+		return nil, fmt.Errorf("%w: nonce is required", ErrInvalidIDToken)
+	}
+	keys, err := v.keySet(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{provider: v.provider}
+	err = keys.VerifyToken(idToken, claims)
+	if errors.Is(err, keyring.ErrUnknownKey) {
+		// the provider may have rotated its keys since they were fetched.
+		keys, err = v.keySet(ctx, true)
+		if err != nil {
+			return nil, err
+		}
+		claims = &Claims{provider: v.provider}
+		err = keys.VerifyToken(idToken, claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// keySet returns the keys of the provider, fetching them when they are too
+// old or when refresh is set and they were not fetched recently. Stale keys
+// are kept when a fetch fails. The keys are fetched without holding the lock,
+// concurrent callers wait for the fetch in flight.
+func (v *Verifier) keySet(ctx context.Context, refresh bool) (*keyring.Ring, error) {
+	v.mu.Lock()
+	age := time.Since(v.fetchedAt)
+	if v.keys != nil && age < keysMaxAge && (!refresh || age < minRefreshInterval) {
+		keys := v.keys
+		v.mu.Unlock()
+		return keys, nil
+	}
+	fetch := v.fetching
+	if fetch != nil {
+		v.mu.Unlock()
+		select {
+		case <-fetch.done:
+			return fetch.keys, fetch.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %v", ErrProviderUnavailable, ctx.Err())
+		}
+	}
+	fetch = &keysFetch{done: make(chan struct{})}
+	v.fetching = fetch
+	v.mu.Unlock()
+
+	keys, err := v.fetchKeys(ctx)
+
+	v.mu.Lock()
+	v.fetching = nil
+	switch {
+	case err == nil:
+		v.keys = keys
+		v.fetchedAt = time.Now()
+		fetch.keys = keys
+	case v.keys != nil:
+		fetch.keys = v.keys
+	default:
+		fetch.err = fmt.Errorf("%w: %v", ErrProviderUnavailable, err)
+	}
+	v.mu.Unlock()
+	close(fetch.done)
+	return fetch.keys, fetch.err
+}
+
+func (v *Verifier) fetchKeys(ctx context.Context) (*keyring.Ring, error) {
+	jwksURL := v.provider.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		err := v.getJSON(ctx, strings.TrimSuffix(v.provider.Issuer, "/")+"/.well-known/openid-configuration", &discovery)
+		if err != nil {
+			return nil, err
+		}
+		if discovery.Issuer != v.provider.Issuer {
+			return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, v.provider.Issuer)
+		}
+		jwksURL = discovery.JWKSURI
+	}
+	var jwks keyring.JWKS
+	err := v.getJSON(ctx, jwksURL, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*keyring.Key
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// keys of unsupported types are skipped rather than failing the
+		// whole set.
+		key, err := keyring.ParseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing key in the jwks")
+	}
+	return keyring.NewVerifier(keys...)
+}
+
+func (v *Verifier) getJSON(ctx context.Context, url string, value interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(value)
+}
@@ -0,0 +1,244 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+)
+
+// testIssuer serves discovery and the JWKS of its signing key, tokens are
+// signed with sign. The oidctest package cannot be used here as it imports
+// this package.
+type testIssuer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	keys         *keyring.Ring
+	issuer       string
+	jwksRequests int
+	// jwksGate, when set, holds the JWKS responses until it is closed.
+	jwksGate chan struct{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	issuer := &testIssuer{}
+	issuer.rotateKey(t, "key-1")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.issuer, "jwks_uri": issuer.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		keys := issuer.keys
+		issuer.jwksRequests++
+		gate := issuer.jwksGate
+		issuer.mu.Unlock()
+		if gate != nil {
+			<-gate
+		}
+		keys.JWKSHandler().ServeHTTP(w, r)
+	})
+	issuer.Server = httptest.NewServer(mux)
+	issuer.issuer = issuer.URL
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (i *testIssuer) rotateKey(t *testing.T, id string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+	key, err := keyring.NewKey(id, privateKey)
+	if err != nil {
+		t.Fatalf("keyring.NewKey() error = %v", err)
+	}
+	keys, err := keyring.New(key)
+	if err != nil {
+		t.Fatalf("keyring.New() error = %v", err)
+	}
+	i.mu.Lock()
+	i.keys = keys
+	i.mu.Unlock()
+}
+
+func (i *testIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	token, err := i.keys.IssueToken(claims)
+	if err != nil {
+		t.Fatalf("Ring.IssueToken() error = %v", err)
+	}
+	return token
+}
+
+func (i *testIssuer) claims(subject string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            i.URL,
+		"sub":            subject,
+		"aud":            []string{"other-client", "shop"},
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"email":          "john@example.com",
+		"email_verified": "true",
+		"name":           "John Doe",
+		"nonce":          "nonce-1",
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	verifier := NewVerifier(Provider{Name: "test", Issuer: issuer.URL, ClientIDs: []string{"shop"}}, nil)
+
+	claims, err := verifier.Verify(ctx, issuer.sign(t, issuer.claims("sub-1")), "nonce-1")
+	if err != nil {
+		t.Fatalf("Verifier.Verify() error = %v", err)
+	}
+	if claims.Subject != "sub-1" || claims.Email != "john@example.com" || !claims.EmailVerified || claims.Name != "John Doe" {
+		t.Errorf("Verifier.Verify() = %+v, want the claims of the token", claims)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		nonce  string
+	}{
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{name: "no exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "issued in the future", modify: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }},
+		{name: "other issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://accounts.example.com" }},
+		{name: "other audience", modify: func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{name: "no subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "wrong nonce", modify: func(c jwt.MapClaims) {}, nonce: "nonce-2"},
+		{name: "no nonce claim", modify: func(c jwt.MapClaims) { delete(c, "nonce") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims("sub-1")
+			tt.modify(claims)
+			nonce := "nonce-1"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			_, err := verifier.Verify(ctx, issuer.sign(t, claims), nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("Verifier.Verify() error = %v, want %v", err, ErrInvalidIDToken)
+			}
+		})
+	}
+
+	// a token is only accepted for the login that sent its nonce.
+	if _, err := verifier.Verify(ctx, issuer.sign(t, issuer.claims("sub-1")), ""); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Verifier.Verify() without a nonce error = %v, want %v", err, ErrInvalidIDToken)
+	}
+
+	// tokens signed with another key are invalid even with a known kid.
+	other := newTestIssuer(t)
+	forged := other.claims("sub-1")
+	forged["iss"] = issuer.URL
+	if _, err := verifier.Verify(ctx, other.sign(t, forged), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Verifier.Verify() of a token signed by another issuer error = %v, want %v", err, ErrInvalidIDToken)
+	}
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	if issuer.jwksRequests != 1 {
+		t.Errorf("JWKS fetched %d times, want the keys to be cached after the first fetch", issuer.jwksRequests)
+	}
+}
+
+func TestVerifier_KeyRotation(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	verifier := NewVerifier(Provider{Name: "test", Issuer: issuer.URL, ClientIDs: []string{"shop"}}, nil)
+	if _, err := verifier.Verify(ctx, issuer.sign(t, issuer.claims("sub-1")), "nonce-1"); err != nil {
+		t.Fatalf("Verifier.Verify() error = %v", err)
+	}
+
+	// unknown keys are only fetched once a minute.
+	issuer.rotateKey(t, "key-2")
+	token := issuer.sign(t, issuer.claims("sub-1"))
+	if _, err := verifier.Verify(ctx, token, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Verifier.Verify() right after the keys were fetched error = %v, want %v", err, ErrInvalidIDToken)
+	}
+	verifier.fetchedAt = verifier.fetchedAt.Add(-minRefreshInterval)
+	if _, err := verifier.Verify(ctx, token, "nonce-1"); err != nil {
+		t.Errorf("Verifier.Verify() with a rotated key error = %v", err)
+	}
+
+	// the cached keys are used while the provider is down.
+	issuer.Close()
+	verifier.fetchedAt = verifier.fetchedAt.Add(-keysMaxAge)
+	if _, err := verifier.Verify(ctx, token, "nonce-1"); err != nil {
+		t.Errorf("Verifier.Verify() while the provider is down error = %v", err)
+	}
+	down := NewVerifier(Provider{Name: "test", Issuer: issuer.URL, ClientIDs: []string{"shop"}}, nil)
+	if _, err := down.Verify(ctx, token, "nonce-1"); !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Verifier.Verify() without keys while the provider is down error = %v, want %v", err, ErrProviderUnavailable)
+	}
+}
+
+func TestVerifier_ConcurrentFetch(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t)
+	gate := make(chan struct{})
+	issuer.mu.Lock()
+	issuer.jwksGate = gate
+	issuer.mu.Unlock()
+	verifier := NewVerifier(Provider{Name: "test", Issuer: issuer.URL, ClientIDs: []string{"shop"}}, nil)
+
+	token := issuer.sign(t, issuer.claims("sub-1"))
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := verifier.Verify(ctx, token, "nonce-1")
+			errs <- err
+		}()
+	}
+	// the lock is not held while the keys are fetched.
+	for {
+		verifier.mu.Lock()
+		fetching := verifier.fetching != nil
+		verifier.mu.Unlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Verifier.Verify() error = %v", err)
+		}
+	}
+	issuer.mu.Lock()
+	defer issuer.mu.Unlock()
+	if issuer.jwksRequests != 1 {
+		t.Errorf("JWKS fetched %d times, want concurrent verifications to share one fetch", issuer.jwksRequests)
+	}
+}
+
+func TestVerifier_DiscoveryIssuerMismatch(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.mu.Lock()
+	issuer.issuer = "https://accounts.example.com"
+	issuer.mu.Unlock()
+	verifier := NewVerifier(Provider{Name: "test", Issuer: issuer.URL, ClientIDs: []string{"shop"}}, nil)
+	_, err := verifier.Verify(context.Background(), issuer.sign(t, issuer.claims("sub-1")), "nonce-1")
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Errorf("Verifier.Verify() with a mismatched discovery issuer error = %v, want %v", err, ErrProviderUnavailable)
+	}
+}
@@ -0,0 +1,220 @@
+package onetime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"one_time_tokens"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) Store {
+			return newStore(t).(Store)
+		})
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share,
+// newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "GetToken", test: testGetToken},
+		{name: "ConsumeToken", test: testConsumeToken},
+		{name: "ConsumeToken concurrently", test: testConsumeTokenConcurrently},
+		{name: "DeleteUserTokens", test: testDeleteUserTokens},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// newTestToken stores a password reset token created at now.
+func newTestToken(t *testing.T, store Store, token string, now time.Time, lifetime time.Duration) *Token {
+	stored := &Token{
+		Hash:        HashToken(token),
+		Purpose:     PurposePasswordReset,
+		UserID:      primitive.NewObjectID().Hex(),
+		UserVersion: 3,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(lifetime),
+	}
+	err := store.CreateToken(context.Background(), stored)
+	if err != nil {
+		t.Fatalf("Store.CreateToken() error = %v", err)
+	}
+	return stored
+}
+
+func testGetToken(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	live := newTestToken(t, store, "live", now, time.Hour)
+	newTestToken(t, store, "expiring", now.Add(-time.Hour), time.Hour)
+	newTestToken(t, store, "used", now, time.Hour)
+	_, err := store.ConsumeToken(ctx, HashToken("used"), PurposePasswordReset, now)
+	if err != nil {
+		t.Fatalf("Store.ConsumeToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose Purpose
+		want    *Token
+		wantErr error
+	}{
+		{name: "unknown token", token: "unknown", purpose: PurposePasswordReset, wantErr: ErrInvalidToken},
+		{name: "expired token", token: "expiring", purpose: PurposePasswordReset, wantErr: ErrInvalidToken},
+		{name: "used token", token: "used", purpose: PurposePasswordReset, wantErr: ErrInvalidToken},
+		{name: "other purpose", token: "live", purpose: Purpose("other"), wantErr: ErrInvalidToken},
+		{name: "live token", token: "live", purpose: PurposePasswordReset, want: live},
+		// getting a token does not consume it.
+		{name: "live token again", token: "live", purpose: PurposePasswordReset, want: live},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.GetToken(ctx, HashToken(tt.token), tt.purpose, now)
+			if err != tt.wantErr {
+				t.Errorf("Store.GetToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.UserID != tt.want.UserID || got.UserVersion != tt.want.UserVersion || got.UsedAt != nil {
+				t.Errorf("Store.GetToken() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testConsumeToken(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	live := newTestToken(t, store, "live", now, time.Hour)
+	newTestToken(t, store, "expiring", now.Add(-time.Hour), time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose Purpose
+		want    *Token
+		wantErr error
+	}{
+		{
+			name:    "unknown token",
+			token:   "unknown",
+			purpose: PurposePasswordReset,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "expired token",
+			token:   "expiring",
+			purpose: PurposePasswordReset,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "other purpose",
+			token:   "live",
+			purpose: Purpose("other"),
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "live token",
+			token:   "live",
+			purpose: PurposePasswordReset,
+			want:    live,
+		},
+		{
+			name:    "used token",
+			token:   "live",
+			purpose: PurposePasswordReset,
+			wantErr: ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.ConsumeToken(ctx, HashToken(tt.token), tt.purpose, now)
+			if err != tt.wantErr {
+				t.Errorf("Store.ConsumeToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.UserID != tt.want.UserID || got.UserVersion != tt.want.UserVersion || got.Purpose != tt.want.Purpose {
+				t.Errorf("Store.ConsumeToken() = %+v, want %+v", got, tt.want)
+			}
+			if got.UsedAt == nil || !got.UsedAt.Equal(now) {
+				t.Errorf("Store.ConsumeToken() usedAt = %v, want %v", got.UsedAt, now)
+			}
+		})
+	}
+}
+
+func testConsumeTokenConcurrently(t *testing.T, store Store) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	newTestToken(t, store, "live", now, time.Hour)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.ConsumeToken(context.Background(), HashToken("live"), PurposePasswordReset, now)
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if consumed != 1 {
+		t.Errorf("Store.ConsumeToken() succeeded %d times, want 1", consumed)
+	}
+}
+
+func testDeleteUserTokens(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	deleted := newTestToken(t, store, "deleted", now, time.Hour)
+	kept := newTestToken(t, store, "kept", now, time.Hour)
+
+	if err := store.DeleteUserTokens(ctx, deleted.UserID); err != nil {
+		t.Fatalf("Store.DeleteUserTokens() error = %v", err)
+	}
+	if _, err := store.GetToken(ctx, HashToken("deleted"), PurposePasswordReset, now); err != ErrInvalidToken {
+		t.Errorf("Store.GetToken() of a deleted token error = %v, want %v", err, ErrInvalidToken)
+	}
+	got, err := store.GetToken(ctx, HashToken("kept"), PurposePasswordReset, now)
+	if err != nil || got.UserID != kept.UserID {
+		t.Errorf("Store.GetToken() of the token of another user = %+v, %v, want %+v", got, err, kept)
+	}
+	if err := store.DeleteUserTokens(ctx, primitive.NewObjectID().Hex()); err != nil {
+		t.Errorf("Store.DeleteUserTokens() of a user without tokens error = %v", err)
+	}
+}
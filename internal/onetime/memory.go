@@ -0,0 +1,82 @@
+package onetime
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps tokens in a map keyed by their hash. Reset
+// and magic links sent before a restart stop working, as do links consumed
+// on another replica.
+type MemoryStore struct {
+	mu     sync.Mutex
+	tokens map[string]*Token
+}
+
+// NewMemoryStore returns an empty in memory token store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens: map[string]*Token{},
+	}
+}
+
+func (s *MemoryStore) CreateToken(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// expired tokens are dropped on writes to keep the store bounded.
+	now := time.Now()
+	for hash, t := range s.tokens {
+		if t.ExpiresAt.Before(now) {
+			delete(s.tokens, hash)
+		}
+	}
+	s.tokens[token.Hash] = copyToken(token)
+	return nil
+}
+
+func (s *MemoryStore) GetToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok || !token.consumable(purpose, now) {
+		return nil, ErrInvalidToken
+	}
+	return copyToken(token), nil
+}
+
+func (s *MemoryStore) ConsumeToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[hash]
+	if !ok || !token.consumable(purpose, now) {
+		return nil, ErrInvalidToken
+	}
+	token.UsedAt = &now
+	return copyToken(token), nil
+}
+
+func (s *MemoryStore) DeleteUserTokens(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.UserID == userID {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// copyToken returns a copy of token that shares no memory with it.
+func copyToken(token *Token) *Token {
+	tokenCopy := *token
+	if token.UsedAt != nil {
+		usedAt := *token.UsedAt
+		tokenCopy.UsedAt = &usedAt
+	}
+	return &tokenCopy
+}
@@ -0,0 +1,130 @@
+package onetime
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the oneTimeTokens collection of a mongodb
+// database.
+type MongoStore struct {
+	collection *mongo.Collection
+	tracer     opentracing.Tracer
+}
+
+// NewMongoStore returns a token store that keeps tokens in the oneTimeTokens
+// collection of db, EnsureIndexes must be called before it is used.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("oneTimeTokens"),
+		tracer:     tracer,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on, expired tokens are
+// removed by mongodb. It is safe to call on every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnsureIndexes")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span) {
+	ext.DBInstance.Set(span, s.collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) CreateToken(ctx context.Context, token *Token) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateToken")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.purpose", token.Purpose).SetTag("param.userId", token.UserID)
+
+	_, err := s.collection.InsertOne(ctx, token)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.InsertOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) GetToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetToken")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.purpose", purpose)
+
+	filter := bson.M{"_id": hash, "purpose": purpose, "usedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}}
+	var token Token
+	err := s.collection.FindOne(ctx, filter).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
+		return nil, err
+	}
+	span.SetTag("userId", token.UserID)
+	return &token, nil
+}
+
+func (s *MongoStore) ConsumeToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ConsumeToken")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.purpose", purpose)
+
+	// the usedAt filter makes consuming atomic, a concurrent use of the same
+	// token matches nothing.
+	filter := bson.M{"_id": hash, "purpose": purpose, "usedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}}
+	var token Token
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"usedAt": now}}, opts).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+	span.SetTag("userId", token.UserID)
+	return &token, nil
+}
+
+func (s *MongoStore) DeleteUserTokens(ctx context.Context, userID string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserTokens")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.userId", userID)
+
+	result, err := s.collection.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.DeleteMany"))
+		return err
+	}
+	span.SetTag("deletedTokens", result.DeletedCount)
+	return nil
+}
@@ -0,0 +1,194 @@
+package onetime
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const tokenColumns = "token_hash, purpose, user_id, user_version, created_at, expires_at, used_at"
+
+// SQLStore is a Store backed by a postgres or sqlite database.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns a token store that keeps tokens in an sql database,
+// Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the one_time_tokens table, it is safe to call on
+// every startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "onetime", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "one_time_tokens")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+func (s *SQLStore) CreateToken(ctx context.Context, token *Token) error {
+	query := s.db.Rebind(`INSERT INTO one_time_tokens (` + tokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateToken")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.purpose", token.Purpose).SetTag("param.userId", token.UserID)
+
+	var usedAt sql.NullTime
+	if token.UsedAt != nil {
+		usedAt = sql.NullTime{Time: token.UsedAt.UTC(), Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, query,
+		token.Hash, string(token.Purpose), token.UserID, token.UserVersion,
+		token.CreatedAt.UTC(), token.ExpiresAt.UTC(), usedAt,
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	// expired tokens are dropped on writes to keep the table bounded.
+	_, err = s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM one_time_tokens WHERE expires_at < ?`), time.Now().UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) GetToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	query := s.db.Rebind(`SELECT ` + tokenColumns + ` FROM one_time_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetToken")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.purpose", purpose)
+
+	var token Token
+	var usedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, hash, string(purpose), now.UTC()).Scan(
+		&token.Hash, &token.Purpose, &token.UserID, &token.UserVersion,
+		&token.CreatedAt, &token.ExpiresAt, &usedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	span.SetTag("userId", token.UserID)
+	return &token, nil
+}
+
+func (s *SQLStore) ConsumeToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error) {
+	query := s.db.Rebind(`UPDATE one_time_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ConsumeToken")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.purpose", purpose)
+	now = now.UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the used_at condition makes consuming atomic, a concurrent use of the
+	// same token updates nothing.
+	result, err := tx.ExecContext(ctx, query, now, hash, string(purpose), now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var token Token
+	var usedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, s.db.Rebind(`SELECT `+tokenColumns+` FROM one_time_tokens WHERE token_hash = ?`), hash).Scan(
+		&token.Hash, &token.Purpose, &token.UserID, &token.UserVersion,
+		&token.CreatedAt, &token.ExpiresAt, &usedAt,
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	span.SetTag("userId", token.UserID)
+	return &token, nil
+}
+
+func (s *SQLStore) DeleteUserTokens(ctx context.Context, userID string) error {
+	query := s.db.Rebind(`DELETE FROM one_time_tokens WHERE user_id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserTokens")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.userId", userID)
+
+	result, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil {
+		span.SetTag("deletedTokens", deleted)
+	}
+	return nil
+}
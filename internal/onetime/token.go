@@ -0,0 +1,77 @@
+// Package onetime keeps the single use tokens sent to users by email, such as
+// password reset tokens. Only the hash of a token is stored, and a token can
+// be consumed once before it expires.
+package onetime
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Purpose is what a token can be used for, a token is only consumed for the
+// purpose it was created with.
+type Purpose string
+
+const (
+	PurposePasswordReset Purpose = "password_reset"
+	PurposeMagicLink     Purpose = "magic_link"
+	// PurposeMFAChallenge tokens are returned by logins awaiting a second
+	// factor rather than emailed.
+	PurposeMFAChallenge Purpose = "mfa_challenge"
+)
+
+// Token is a single use token issued to a user.
+type Token struct {
+	Hash    string  `json:"-" bson:"_id"`
+	Purpose Purpose `json:"purpose" bson:"purpose"`
+	UserID  string  `json:"userId" bson:"userId"`
+	// UserVersion is the version of the user when the token was created, it
+	// lets consumers reject tokens issued before the user last changed.
+	UserVersion int64      `json:"userVersion" bson:"userVersion"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt   time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt      *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+// Store persists single use tokens.
+type Store interface {
+	CreateToken(ctx context.Context, token *Token) error
+	// GetToken returns the unused and unexpired token with hash and purpose
+	// without consuming it, any other token returns ErrInvalidToken.
+	GetToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error)
+	// ConsumeToken marks the unused and unexpired token with hash and purpose
+	// as used and returns it, any other token returns ErrInvalidToken.
+	ConsumeToken(ctx context.Context, hash string, purpose Purpose, now time.Time) (*Token, error)
+	// DeleteUserTokens deletes every token of the user, used or not.
+	DeleteUserTokens(ctx context.Context, userID string) error
+}
+
+// NewToken returns a random token along with the hash to store.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash tokens are stored under, tokens are random
+// enough for a fast hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// consumable reports whether the token can be consumed for purpose at now.
+func (t *Token) consumable(purpose Purpose, now time.Time) bool {
+	return t.Purpose == purpose && t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
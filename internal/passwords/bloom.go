@@ -0,0 +1,134 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// BloomFilter is a set of passwords that answers membership queries in
+// constant memory, at the cost of a small rate of false positives. Passwords
+// are added by their SHA-1 hash so that corpora of hashes, such as the one
+// of Have I Been Pwned, can be loaded without the passwords.
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint64
+}
+
+// NewBloomFilter returns a filter sized for n passwords with a false positive
+// rate of falsePositiveRate.
+func NewBloomFilter(n int, falsePositiveRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = 0.001
+	}
+	size := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(size/float64(n)*math.Ln2))
+	return &BloomFilter{
+		bits:   make([]uint64, (uint64(size)+63)/64),
+		size:   uint64(size),
+		hashes: uint64(hashes),
+	}
+}
+
+// Add adds the password to the filter.
+func (f *BloomFilter) Add(password string) {
+	f.AddHash(sha1.Sum([]byte(password)))
+}
+
+// AddHash adds the password with the SHA-1 hash to the filter.
+func (f *BloomFilter) AddHash(hash [sha1.Size]byte) {
+	h1, h2 := splitHash(hash)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Contains reports whether the password may have been added to the filter, it
+// is never false for an added password.
+func (f *BloomFilter) Contains(password string) bool {
+	h1, h2 := splitHash(sha1.Sum([]byte(password)))
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitHash derives the two hashes the bit positions of a password are
+// computed from, SHA-1 is uniform enough to use its bytes directly.
+func splitHash(hash [sha1.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(hash[:8]), binary.BigEndian.Uint64(hash[8:16]) | 1
+}
+
+// LoadBreachedPasswords returns a filter of the passwords of the file, which
+// has a password per line. Lines may also be the hex SHA-1 hash of a password
+// optionally followed by a colon and a count, as in the Have I Been Pwned
+// corpus. Empty lines are skipped.
+func LoadBreachedPasswords(path string, falsePositiveRate float64) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// the file is read twice so that the filter is sized for its lines
+	// without holding them in memory.
+	lines := 0
+	err = scanLines(file, func(string) { lines++ })
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	filter := NewBloomFilter(lines, falsePositiveRate)
+	err = scanLines(file, func(line string) {
+		if hash, ok := parseSHA1Line(line); ok {
+			filter.AddHash(hash)
+			return
+		}
+		filter.Add(line)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return filter, nil
+}
+
+func scanLines(r io.Reader, fn func(line string)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" {
+			fn(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseSHA1Line returns the hash of a line holding a hex SHA-1 hash, with or
+// without a :count suffix.
+func parseSHA1Line(line string) (hash [sha1.Size]byte, ok bool) {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	if len(line) != hex.EncodedLen(sha1.Size) {
+		return hash, false
+	}
+	_, err := hex.Decode(hash[:], []byte(line))
+	return hash, err == nil
+}
@@ -0,0 +1,60 @@
+package passwords
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add("password" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !filter.Contains("password" + strconv.Itoa(i)) {
+			t.Fatalf("BloomFilter.Contains(%q) = false, want true", "password"+strconv.Itoa(i))
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.Contains("other" + strconv.Itoa(i)) {
+			falsePositives++
+		}
+	}
+	// the rate is 1% on average, 3% leaves room for variance.
+	if falsePositives > 300 {
+		t.Errorf("BloomFilter.Contains() had %d false positives in 10000, want about 100", falsePositives)
+	}
+}
+
+func TestLoadBreachedPasswords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	corpus := "123456\r\n\nqwerty\n" +
+		// the SHA-1 hashes of "letmein" and "monkey".
+		"B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3:4\n" +
+		"ab87d24bdc7452e55738deb5f868e1f16dea5ace\n"
+	err := os.WriteFile(path, []byte(corpus), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := LoadBreachedPasswords(path, 0.0001)
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() error = %v", err)
+	}
+	for _, password := range []string{"123456", "qwerty", "letmein", "monkey"} {
+		if !filter.Contains(password) {
+			t.Errorf("BloomFilter.Contains(%q) = false, want true", password)
+		}
+	}
+	if filter.Contains("correct horse battery") {
+		t.Errorf("BloomFilter.Contains(%q) = true, want false", "correct horse battery")
+	}
+
+	_, err = LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"), 0.0001)
+	if err == nil {
+		t.Errorf("LoadBreachedPasswords() of a missing file should fail")
+	}
+}
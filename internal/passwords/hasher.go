@@ -0,0 +1,195 @@
+package passwords
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUnknownHash      = errors.New("password hash has an unknown format")
+	ErrPepperRequired   = errors.New("password hash was made with a pepper but none is configured")
+	ErrUnknownAlgorithm = errors.New("unknown password hash algorithm")
+)
+
+// Algorithm is a password hashing algorithm.
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+// Argon2idParams are the cost parameters of argon2id hashes.
+type Argon2idParams struct {
+	// Memory is the memory used by a hash in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idParams follows the second recommendation of RFC 9106 with
+// 64 MiB of memory.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// pepperPrefix marks the hashes of peppered passwords, it is followed by the
+// hash of the algorithm.
+const pepperPrefix = "$pepper"
+
+// Hasher hashes new passwords with an algorithm and verifies the hashes of
+// every algorithm, so that stored hashes can be migrated as users log in.
+type Hasher struct {
+	// Algorithm hashes new passwords.
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2id   Argon2idParams
+	// Pepper is a secret mixed into passwords before they are hashed, it is
+	// kept out of the database so that leaked hashes cannot be cracked
+	// without it. Hashes made without the pepper are still verified.
+	Pepper []byte
+}
+
+// DefaultHasher returns a hasher of argon2id with DefaultArgon2idParams and no
+// pepper, bcrypt hashes are verified with any cost.
+func DefaultHasher() *Hasher {
+	return &Hasher{
+		Algorithm:  Argon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		Argon2id:   DefaultArgon2idParams,
+	}
+}
+
+// Hash returns the hash of the password with the algorithm of the hasher.
+func (h *Hasher) Hash(password string) (string, error) {
+	input, prefix := []byte(password), ""
+	if len(h.Pepper) > 0 {
+		input, prefix = h.pepper(password), pepperPrefix
+	}
+	switch h.Algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword(input, h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return prefix + string(hash), nil
+	case Argon2id:
+		salt := make([]byte, h.Argon2id.SaltLength)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return "", err
+		}
+		p := h.Argon2id
+		key := argon2.IDKey(input, salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return prefix + fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	}
+	return "", ErrUnknownAlgorithm
+}
+
+// Verify reports whether the password matches the hash, whichever algorithm
+// and parameters it was made with.
+func (h *Hasher) Verify(hash, password string) (bool, error) {
+	input := []byte(password)
+	if strings.HasPrefix(hash, pepperPrefix) {
+		if len(h.Pepper) == 0 {
+			return false, ErrPepperRequired
+		}
+		hash, input = strings.TrimPrefix(hash, pepperPrefix), h.pepper(password)
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey(input, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		return subtle.ConstantTimeCompare(got, key) == 1, nil
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return false, ErrUnknownHash
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), input)
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// NeedsRehash reports whether the hash was made with another algorithm, with
+// weaker parameters than those of the hasher or without its pepper.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	peppered := strings.HasPrefix(hash, pepperPrefix)
+	if peppered != (len(h.Pepper) > 0) {
+		return true
+	}
+	hash = strings.TrimPrefix(hash, pepperPrefix)
+	switch h.Algorithm {
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < h.BcryptCost
+	case Argon2id:
+		if !strings.HasPrefix(hash, "$argon2id$") {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(hash)
+		return err != nil ||
+			params.Memory < h.Argon2id.Memory ||
+			params.Iterations < h.Argon2id.Iterations ||
+			params.Parallelism < h.Argon2id.Parallelism ||
+			params.SaltLength < h.Argon2id.SaltLength ||
+			params.KeyLength < h.Argon2id.KeyLength
+	}
+	return false
+}
+
+// pepper returns the HMAC of the password keyed by the pepper, encoded so
+// that it stays under the 72 bytes bcrypt hashes.
+func (h *Hasher) pepper(password string) []byte {
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write([]byte(password))
+	return []byte(base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// decodeArgon2id parses a hash in the $argon2id$v=19$m=,t=,p=$salt$key format.
+func decodeArgon2id(hash string) (params Argon2idParams, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	var version int
+	_, err = fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHash
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+	return params, salt, key, nil
+}
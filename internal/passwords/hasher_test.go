@@ -0,0 +1,103 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2idParams keep the tests fast.
+var testArgon2idParams = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		prefix string
+	}{
+		{name: "bcrypt", hasher: &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}, prefix: "$2a$04$"},
+		{name: "argon2id", hasher: &Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams}, prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "peppered bcrypt", hasher: &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost, Pepper: []byte("pepper")}, prefix: "$pepper$2a$04$"},
+		{name: "peppered argon2id", hasher: &Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams, Pepper: []byte("pepper")}, prefix: "$pepper$argon2id$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("correct horse battery")
+			if err != nil {
+				t.Fatalf("Hasher.Hash() error = %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("Hasher.Hash() = %q, want prefix %q", hash, tt.prefix)
+			}
+			if ok, err := tt.hasher.Verify(hash, "correct horse battery"); !ok || err != nil {
+				t.Errorf("Hasher.Verify() of the password = %v, %v, want true", ok, err)
+			}
+			if ok, err := tt.hasher.Verify(hash, "correct horse"); ok || err != nil {
+				t.Errorf("Hasher.Verify() of another password = %v, %v, want false", ok, err)
+			}
+			if tt.hasher.NeedsRehash(hash) {
+				t.Errorf("Hasher.NeedsRehash() of its own hash = true, want false")
+			}
+		})
+	}
+}
+
+func TestHasher_Verify(t *testing.T) {
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("correct horse battery"), bcrypt.MinCost)
+	pepperedHash, _ := (&Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams, Pepper: []byte("pepper")}).Hash("correct horse battery")
+	hasher := &Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams}
+
+	if ok, err := hasher.Verify(string(bcryptHash), "correct horse battery"); !ok || err != nil {
+		t.Errorf("Hasher.Verify() of a bcrypt hash = %v, %v, want true", ok, err)
+	}
+	if _, err := hasher.Verify(pepperedHash, "correct horse battery"); err != ErrPepperRequired {
+		t.Errorf("Hasher.Verify() of a peppered hash without the pepper error = %v, want %v", err, ErrPepperRequired)
+	}
+	otherPepper := &Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams, Pepper: []byte("other")}
+	if ok, _ := otherPepper.Verify(pepperedHash, "correct horse battery"); ok {
+		t.Errorf("Hasher.Verify() with another pepper = true, want false")
+	}
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=1024$salt$key", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+		if _, err := hasher.Verify(hash, "correct horse battery"); err != ErrUnknownHash {
+			t.Errorf("Hasher.Verify(%q) error = %v, want %v", hash, err, ErrUnknownHash)
+		}
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	hash := func(h *Hasher) string {
+		hash, err := h.Hash("correct horse battery")
+		if err != nil {
+			t.Fatalf("Hasher.Hash() error = %v", err)
+		}
+		return hash
+	}
+	hasher := &Hasher{Algorithm: Argon2id, BcryptCost: bcrypt.MinCost + 1, Argon2id: testArgon2idParams}
+	weakerParams := testArgon2idParams
+	weakerParams.Memory = 512
+	strongerParams := testArgon2idParams
+	strongerParams.Iterations = 2
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   string
+		want   bool
+	}{
+		{name: "same parameters", hasher: hasher, hash: hash(hasher), want: false},
+		{name: "stronger parameters", hasher: hasher, hash: hash(&Hasher{Algorithm: Argon2id, Argon2id: strongerParams}), want: false},
+		{name: "weaker parameters", hasher: hasher, hash: hash(&Hasher{Algorithm: Argon2id, Argon2id: weakerParams}), want: true},
+		{name: "other algorithm", hasher: hasher, hash: hash(&Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}), want: true},
+		{name: "without the pepper", hasher: &Hasher{Algorithm: Argon2id, Argon2id: testArgon2idParams, Pepper: []byte("pepper")}, hash: hash(hasher), want: true},
+		{name: "lower bcrypt cost", hasher: &Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1}, hash: hash(&Hasher{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}), want: true},
+		{name: "unknown hash", hasher: hasher, hash: "plaintext", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("Hasher.NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
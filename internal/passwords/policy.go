@@ -0,0 +1,96 @@
+// Package passwords checks new passwords against a configurable policy: a
+// minimum length, a maximum length in bytes, the personal information of the
+// user and an offline corpus of passwords known from data breaches. It also
+// hashes passwords with bcrypt or argon2id.
+package passwords
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBcryptBytes is the number of bytes of a password bcrypt hashes, it
+// silently ignores the rest.
+const MaxBcryptBytes = 72
+
+// Policy is the rules new passwords must follow.
+type Policy struct {
+	// MinLength is the minimum number of characters of a password.
+	MinLength int
+	// MaxBytes is the maximum length of a password in bytes, zero is
+	// MaxBcryptBytes. Longer passwords are rejected rather than truncated.
+	MaxBytes int
+	// Breached holds the passwords known from data breaches, nil skips the
+	// check.
+	Breached *BloomFilter
+}
+
+// DefaultPolicy returns the policy of passwords of at least 8 characters and
+// at most MaxBcryptBytes bytes.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength: 8,
+		MaxBytes:  MaxBcryptBytes,
+	}
+}
+
+// Check returns a description of every rule the password breaks, email and
+// fullName are those of the user the password is for.
+func (p Policy) Check(password, email, fullName string) []string {
+	if password == "" {
+		return []string{"is required"}
+	}
+	var violations []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = MaxBcryptBytes
+	}
+	if len(password) > maxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", maxBytes))
+	}
+	lowerPassword := strings.ToLower(password)
+	if containsEmail(lowerPassword, strings.ToLower(strings.TrimSpace(email))) {
+		violations = append(violations, "must not contain your email")
+	}
+	if containsName(lowerPassword, strings.ToLower(fullName)) {
+		violations = append(violations, "must not contain your name")
+	}
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, "appears in a known data breach, choose another password")
+	}
+	return violations
+}
+
+// minPersonalLength is the length below which parts of the email or name are
+// too common to reject passwords containing them.
+const minPersonalLength = 3
+
+// containsEmail reports whether the password contains the email or the part
+// of it before the @.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	local := email
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		local = email[:at]
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	return len(local) >= minPersonalLength && strings.Contains(password, local)
+}
+
+// containsName reports whether the password contains any word of the name.
+func containsName(password, fullName string) bool {
+	for _, name := range strings.Fields(fullName) {
+		if utf8.RuneCountInString(name) >= minPersonalLength && strings.Contains(password, name) {
+			return true
+		}
+	}
+	return false
+}
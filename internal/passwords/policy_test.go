@@ -0,0 +1,39 @@
+package passwords
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	breached := NewBloomFilter(10, 0.001)
+	breached.Add("password123")
+	breached.Add("jonathan1")
+	policy := Policy{MinLength: 8, Breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "empty password", password: "", want: []string{"is required"}},
+		{name: "short password", password: "x7#kq", want: []string{"must be at least 8 characters long"}},
+		{name: "length counts characters", password: "ééééééé", want: []string{"must be at least 8 characters long"}},
+		{name: "password past the bcrypt limit", password: strings.Repeat("x7#kq", 15), want: []string{"must be at most 72 bytes long"}},
+		{name: "password with the email", password: "John.Doe@Example.com!", want: []string{"must not contain your email"}},
+		{name: "password with the email user", password: "john.doe2021", want: []string{"must not contain your email"}},
+		{name: "password with the name", password: "ilovejonathan", want: []string{"must not contain your name"}},
+		{name: "breached password", password: "password123", want: []string{"appears in a known data breach, choose another password"}},
+		{name: "several violations", password: "jonathan1", want: []string{"must not contain your name", "appears in a known data breach, choose another password"}},
+		{name: "valid password", password: "correct horse battery", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := policy.Check(tt.password, "john.doe@example.com", "Jonathan Li")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Policy.Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/not.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// loadTimeout bounds the lookup of a user announced by a change event.
+const loadTimeout = 5 * time.Second
+
+var errUnknownUser = errors.New("user change event has no userId")
+
+// Subscriber applies the user change events published on nats to an Index,
+// so that the writes made through other instances of the service are
+// searchable right away rather than after the next rebuild.
+type Subscriber struct {
+	index  *Index
+	repo   users.Repository
+	tracer opentracing.Tracer
+}
+
+// NewSubscriber returns a subscriber updating index with the users of repo.
+// repo should not be cached, as the cached copy of a changed user may not be
+// dropped yet when its event is handled.
+func NewSubscriber(index *Index, repo users.Repository, tracer opentracing.Tracer) *Subscriber {
+	return &Subscriber{index: index, repo: repo, tracer: tracer}
+}
+
+// Subscribe subscribes to the user change events.
+func (s *Subscriber) Subscribe(natsConn *nats.Conn) error {
+	for _, subject := range []string{users.EventCreated, users.EventUpdated, users.EventDeleted, users.EventRestored, users.EventPurged} {
+		_, err := natsConn.Subscribe(subject, s.handleChangeEvent)
+		if err != nil {
+			return err
+		}
+	}
+	return natsConn.Flush()
+}
+
+func (s *Subscriber) handleChangeEvent(msg *nats.Msg) {
+	traceMsg := not.NewTraceMsg(msg)
+	spanOptions := []opentracing.StartSpanOption{ext.SpanKindConsumer}
+	spanContext, err := s.tracer.Extract(opentracing.Binary, traceMsg)
+	if err == nil {
+		spanOptions = append(spanOptions, opentracing.FollowsFrom(spanContext))
+	}
+	span := s.tracer.StartSpan("search.IndexUser", spanOptions...)
+	defer span.Finish()
+	ext.MessageBusDestination.Set(span, msg.Subject)
+
+	var event users.ChangeEvent
+	err = json.Unmarshal(traceMsg.Bytes(), &event)
+	if err != nil {
+		// the publisher may not have injected a span context.
+		err = json.Unmarshal(msg.Data, &event)
+	}
+	if err == nil && event.UserID == "" {
+		err = errUnknownUser
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("decoding user change event"), log.String("nats.message", string(msg.Data)))
+		return
+	}
+	span.SetTag("param.userId", event.UserID)
+
+	switch msg.Subject {
+	case users.EventPurged:
+		s.index.Purge(event.UserID)
+		return
+	case users.EventDeleted:
+		s.index.Remove(&users.User{ID: event.UserID, Version: event.Version})
+		return
+	}
+	if event.Version > 0 && s.index.upToDate(event.UserID, event.Version) {
+		// the write was made through this instance.
+		span.SetTag("search.upToDate", true)
+		return
+	}
+	ctx, cancel := context.WithTimeout(opentracing.ContextWithSpan(context.Background(), span), loadTimeout)
+	defer cancel()
+	user, err := s.repo.GetUserByID(ctx, event.UserID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		// the user was deleted since, its own event removes it.
+		return
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.GetUserByID"))
+		return
+	}
+	s.index.Add(user)
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestSubscriber(t *testing.T) {
+	server := natsserver.RunRandClientPortServer()
+	t.Cleanup(server.Shutdown)
+	natsConn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("nats.Connect() error = %v", err)
+	}
+	t.Cleanup(natsConn.Close)
+
+	ctx := context.Background()
+	// repo stands for the storage shared with another instance, whose
+	// writes do not go through the index.
+	repo := users.NewMemoryRepository()
+	index := NewIndex()
+	if err := NewSubscriber(index, repo, &opentracing.NoopTracer{}).Subscribe(natsConn); err != nil {
+		t.Fatalf("Subscriber.Subscribe() error = %v", err)
+	}
+	publish := func(subject string, event interface{}) {
+		data, _ := json.Marshal(event)
+		natsConn.Publish(subject, data)
+		natsConn.Flush()
+	}
+	user := &users.User{FullName: "John Walker", Email: "john@example.com"}
+	repo.CreateUser(ctx, user)
+	fullName := "Jane Doe"
+
+	tests := []struct {
+		name    string
+		write   func() (subject string, event interface{})
+		query   string
+		want    int
+		ignored bool
+	}{
+		{
+			name: "user created",
+			write: func() (string, interface{}) {
+				return users.EventCreated, users.ChangeEvent{UserID: user.ID, Version: user.Version}
+			},
+			query: "walker",
+			want:  1,
+		},
+		{
+			name: "user updated",
+			write: func() (string, interface{}) {
+				updated, _ := repo.UpdateUser(ctx, user.ID, users.UserUpdate{FullName: &fullName})
+				return users.EventUpdated, users.ChangeEvent{UserID: user.ID, Version: updated.Version}
+			},
+			query: "jane",
+			want:  1,
+		},
+		{
+			name: "user deleted",
+			write: func() (string, interface{}) {
+				deleted, _ := repo.DeleteUser(ctx, user.ID)
+				return users.EventDeleted, users.ChangeEvent{UserID: user.ID, Version: deleted.Version}
+			},
+			query: "jane",
+			want:  0,
+		},
+		{
+			name: "user restored",
+			write: func() (string, interface{}) {
+				restored, _ := repo.RestoreUser(ctx, user.ID)
+				return users.EventRestored, users.ChangeEvent{UserID: user.ID, Version: restored.Version}
+			},
+			query: "jane",
+			want:  1,
+		},
+		{
+			name: "invalid event",
+			write: func() (string, interface{}) {
+				return users.EventUpdated, "invalid"
+			},
+			query:   "jane",
+			want:    1,
+			ignored: true,
+		},
+		{
+			name: "user purged",
+			write: func() (string, interface{}) {
+				repo.PurgeUser(ctx, user.ID)
+				return users.EventPurged, map[string]string{"userId": user.ID, "purgedAt": "now"}
+			},
+			query: "jane",
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publish(tt.write())
+			if tt.ignored {
+				// gives the event time to be handled.
+				time.Sleep(20 * time.Millisecond)
+			}
+			got := index.Search(tt.query, 10)
+			for deadline := time.Now().Add(time.Second); len(got) != tt.want && time.Now().Before(deadline); {
+				time.Sleep(5 * time.Millisecond)
+				got = index.Search(tt.query, 10)
+			}
+			if len(got) != tt.want {
+				t.Errorf("Index.Search(%q) = %d hits, want %d", tt.query, len(got), tt.want)
+			}
+		})
+	}
+}
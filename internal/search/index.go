@@ -0,0 +1,448 @@
+// Package search keeps an in memory full text index of the users so that
+// support staff can find users from part of their name or email, typos
+// included.
+package search
+
+import (
+	"context"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// field is a bit set of the indexed user fields.
+type field uint8
+
+const (
+	fieldFullName field = 1 << iota
+	fieldEmail
+)
+
+// boosts weighs matches on a field, names are what support staff usually
+// search by.
+var boosts = map[field]float64{
+	fieldFullName: 2,
+	fieldEmail:    1,
+}
+
+// Hit is a user matching a search query.
+type Hit struct {
+	User  users.User
+	Score float64
+	// Highlights holds the matching fields by name with the matching words
+	// wrapped in <em> tags, the text is html escaped.
+	Highlights map[string]string
+}
+
+// Index is an in memory full text index over the full name and email of
+// users. It is safe for concurrent use.
+type Index struct {
+	// rebuildMu serializes the calls to Rebuild.
+	rebuildMu sync.Mutex
+	mu        sync.RWMutex
+	data      *indexData
+	// rebuilding is the index being built by Rebuild, writes are applied to it
+	// as well so that none is lost when it replaces data.
+	rebuilding *indexData
+}
+
+type indexData struct {
+	users map[string]*users.User
+	// postings holds the ids of the users containing a term, along with the
+	// fields containing it.
+	postings map[string]map[string]field
+	// removed holds the version the removed users had when they were removed,
+	// older copies of them are not indexed again.
+	removed map[string]int64
+}
+
+func newIndexData() *indexData {
+	return &indexData{
+		users:    map[string]*users.User{},
+		postings: map[string]map[string]field{},
+		removed:  map[string]int64{},
+	}
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{data: newIndexData()}
+}
+
+// Add indexes the user, replacing the indexed copy of the user unless it is
+// newer.
+func (idx *Index) Add(user *users.User) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.data.add(user)
+	if idx.rebuilding != nil {
+		idx.rebuilding.add(user)
+	}
+}
+
+// Remove removes the user from the index, user is the removed user as
+// returned by the repository.
+func (idx *Index) Remove(user *users.User) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.data.remove(user.ID, user.Version)
+	if idx.rebuilding != nil {
+		idx.rebuilding.remove(user.ID, user.Version)
+	}
+}
+
+// Purge removes the user from the index for good.
+func (idx *Index) Purge(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.data.remove(id, math.MaxInt64)
+	if idx.rebuilding != nil {
+		idx.rebuilding.remove(id, math.MaxInt64)
+	}
+}
+
+// Rebuild replaces the content of the index with the users of repo, the index
+// keeps answering queries while it is rebuilt.
+func (idx *Index) Rebuild(ctx context.Context, repo users.Repository) error {
+	idx.rebuildMu.Lock()
+	defer idx.rebuildMu.Unlock()
+	rebuilding := newIndexData()
+	idx.mu.Lock()
+	idx.rebuilding = rebuilding
+	idx.mu.Unlock()
+	defer func() {
+		idx.mu.Lock()
+		idx.rebuilding = nil
+		idx.mu.Unlock()
+	}()
+
+	filter := users.GetUsersFilter{Limit: 500}
+	for {
+		page, err := repo.GetUsers(ctx, filter)
+		if err != nil {
+			return err
+		}
+		idx.mu.Lock()
+		for i := range page.Users {
+			rebuilding.add(&page.Users[i])
+		}
+		idx.mu.Unlock()
+		if !page.HasMore || len(page.Users) == 0 {
+			break
+		}
+		cursor := users.NewCursor(&page.Users[len(page.Users)-1], users.SortByTimeAdded)
+		filter.After = &cursor
+	}
+	idx.mu.Lock()
+	idx.data = rebuilding
+	idx.data.removed = map[string]int64{}
+	idx.mu.Unlock()
+	return nil
+}
+
+// upToDate reports whether the index already holds or removed the user at
+// version or later.
+func (idx *Index) upToDate(id string, version int64) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if user, ok := idx.data.users[id]; ok && user.Version >= version {
+		return true
+	}
+	removedVersion, ok := idx.data.removed[id]
+	return ok && removedVersion >= version
+}
+
+// Len returns the number of indexed users.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.data.users)
+}
+
+func (d *indexData) add(user *users.User) {
+	if removedVersion, ok := d.removed[user.ID]; ok && user.Version <= removedVersion {
+		return
+	}
+	if existing, ok := d.users[user.ID]; ok {
+		if existing.Version > user.Version {
+			return
+		}
+		d.unindex(existing)
+	}
+	delete(d.removed, user.ID)
+	indexed := *user
+	indexed.Password = ""
+	d.users[user.ID] = &indexed
+	for f, text := range userFields(&indexed) {
+		for _, token := range tokenize(text) {
+			postings, ok := d.postings[token.term]
+			if !ok {
+				postings = map[string]field{}
+				d.postings[token.term] = postings
+			}
+			postings[user.ID] |= f
+		}
+	}
+}
+
+func (d *indexData) remove(id string, version int64) {
+	if removedVersion, ok := d.removed[id]; ok && removedVersion >= version {
+		return
+	}
+	if existing, ok := d.users[id]; ok {
+		if existing.Version > version {
+			return
+		}
+		d.unindex(existing)
+		delete(d.users, id)
+	}
+	d.removed[id] = version
+}
+
+func (d *indexData) unindex(user *users.User) {
+	for _, text := range userFields(user) {
+		for _, token := range tokenize(text) {
+			delete(d.postings[token.term], user.ID)
+			if len(d.postings[token.term]) == 0 {
+				delete(d.postings, token.term)
+			}
+		}
+	}
+}
+
+func userFields(user *users.User) map[field]string {
+	return map[field]string{
+		fieldFullName: user.FullName,
+		fieldEmail:    user.Email,
+	}
+}
+
+// fieldNames are the names of the fields in highlights.
+var fieldNames = map[field]string{
+	fieldFullName: "fullName",
+	fieldEmail:    "email",
+}
+
+// Search returns at most limit users matching every word of the query, best
+// matches first. Words match the indexed words they are equal to, prefixes of
+// or a few typos away from.
+func (idx *Index) Search(query string, limit int) []Hit {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	queryTokens := tokenize(query)
+	if len(queryTokens) == 0 {
+		return nil
+	}
+	type candidate struct {
+		score float64
+		// terms holds the indexed terms matching the query.
+		terms map[string]bool
+	}
+	var candidates map[string]*candidate
+	for _, queryToken := range queryTokens {
+		// best score of the query word for each user.
+		scores := map[string]float64{}
+		matchedTerms := map[string][]string{}
+		for term, postings := range idx.data.postings {
+			termScore := matchTerm(queryToken.term, term)
+			if termScore == 0 {
+				continue
+			}
+			for id, fields := range postings {
+				if candidates != nil && candidates[id] == nil {
+					continue
+				}
+				score := termScore * fieldsBoost(fields)
+				if score > scores[id] {
+					scores[id] = score
+				}
+				matchedTerms[id] = append(matchedTerms[id], term)
+			}
+		}
+		next := map[string]*candidate{}
+		for id, score := range scores {
+			c := candidates[id]
+			if c == nil {
+				c = &candidate{terms: map[string]bool{}}
+			}
+			c.score += score
+			for _, term := range matchedTerms[id] {
+				c.terms[term] = true
+			}
+			next[id] = c
+		}
+		candidates = next
+		if len(candidates) == 0 {
+			return nil
+		}
+	}
+
+	hits := make([]Hit, 0, len(candidates))
+	for id, c := range candidates {
+		user := idx.data.users[id]
+		hit := Hit{User: *user, Score: c.score, Highlights: map[string]string{}}
+		for f, text := range userFields(user) {
+			if highlighted, ok := highlight(text, c.terms); ok {
+				hit.Highlights[fieldNames[f]] = highlighted
+			}
+		}
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].User.FullName != hits[j].User.FullName {
+			return hits[i].User.FullName < hits[j].User.FullName
+		}
+		return hits[i].User.ID < hits[j].User.ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+func fieldsBoost(fields field) float64 {
+	boost := 0.0
+	for f, fieldBoost := range boosts {
+		if fields&f != 0 && fieldBoost > boost {
+			boost = fieldBoost
+		}
+	}
+	return boost
+}
+
+// matchTerm scores how well the indexed term matches the query word, from 1
+// for equal words down to 0 for words that do not match.
+func matchTerm(query, term string) float64 {
+	if query == term {
+		return 1
+	}
+	queryLen, termLen := utf8.RuneCountInString(query), utf8.RuneCountInString(term)
+	if strings.HasPrefix(term, query) {
+		return 0.5 + 0.4*float64(queryLen)/float64(termLen)
+	}
+	maxEdits := allowedEdits(queryLen)
+	if maxEdits == 0 {
+		return 0
+	}
+	if distance := levenshtein(query, term, maxEdits); distance <= maxEdits {
+		return 0.6 - 0.2*float64(distance)
+	}
+	// the query word may be an unfinished word with a typo.
+	if termLen > queryLen {
+		prefix := string([]rune(term)[:queryLen])
+		if distance := levenshtein(query, prefix, maxEdits); distance <= maxEdits {
+			return 0.4 - 0.1*float64(distance)
+		}
+	}
+	return 0
+}
+
+// allowedEdits returns the number of typos tolerated in a query word, short
+// words would match too much otherwise.
+func allowedEdits(length int) int {
+	switch {
+	case length < 4:
+		return 0
+	case length < 7:
+		return 1
+	}
+	return 2
+}
+
+// levenshtein returns the edit distance between a and b, or max+1 when it is
+// greater than max.
+func levenshtein(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return max + 1
+	}
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		rowMin := current[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(minInt(previous[j]+1, current[j-1]+1), previous[j-1]+cost)
+			if current[j] < rowMin {
+				rowMin = current[j]
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower cased words of letters and digits along
+// with their byte offsets in text.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		isWordRune := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWordRune && start < 0 {
+			start = i
+		}
+		if !isWordRune && start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// highlight wraps the words of text that are in terms in <em> tags, it
+// reports false when no word matched.
+func highlight(text string, terms map[string]bool) (string, bool) {
+	var b strings.Builder
+	matched := false
+	last := 0
+	for _, token := range tokenize(text) {
+		if !terms[token.term] {
+			continue
+		}
+		matched = true
+		b.WriteString(html.EscapeString(text[last:token.start]))
+		b.WriteString("<em>" + html.EscapeString(text[token.start:token.end]) + "</em>")
+		last = token.end
+	}
+	if !matched {
+		return "", false
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String(), true
+}
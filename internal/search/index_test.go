@@ -0,0 +1,115 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func newTestIndex() *Index {
+	index := NewIndex()
+	for _, user := range []users.User{
+		{ID: "1", FullName: "Jonathan Smith", Email: "jsmith@example.com", Version: 1},
+		{ID: "2", FullName: "John Doe", Email: "john.doe@example.com", Version: 1},
+		{ID: "3", FullName: "Mary Johnson", Email: "mary@shop.ng", Version: 1},
+		{ID: "4", FullName: "Wisdom Matt", Email: "wisdom<matt>@example.com", Password: "hash", Version: 1},
+	} {
+		user := user
+		index.Add(&user)
+	}
+	return index
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := newTestIndex()
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "exact word ranks first", query: "john", want: []string{"2", "3"}},
+		{name: "prefix", query: "jonat", want: []string{"1"}},
+		{name: "typo", query: "jonhson", want: []string{"3"}},
+		{name: "typo in an unfinished word", query: "jonatj", want: []string{"1"}},
+		{name: "every word must match", query: "john doe", want: []string{"2"}},
+		{name: "case insensitive", query: "MARY", want: []string{"3"}},
+		{name: "email", query: "shop.ng", want: []string{"3"}},
+		{name: "short words tolerate no typo", query: "jon", want: []string{"1"}},
+		{name: "limit", query: "john", limit: 1, want: []string{"2"}},
+		{name: "no match", query: "zzz", want: nil},
+		{name: "empty query", query: " ", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, hit := range index.Search(tt.query, tt.limit) {
+				got = append(got, hit.User.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Index.Search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndex_Search_Highlights(t *testing.T) {
+	index := newTestIndex()
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]string
+	}{
+		{
+			name:  "name and email",
+			query: "john",
+			want:  map[string]string{"fullName": "<em>John</em> Doe", "email": "<em>john</em>.doe@example.com"},
+		},
+		{
+			name:  "text is escaped",
+			query: "matt",
+			want:  map[string]string{"fullName": "Wisdom <em>Matt</em>", "email": "wisdom&lt;<em>matt</em>&gt;@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := index.Search(tt.query, 1)
+			if len(hits) != 1 {
+				t.Fatalf("Index.Search() = %v, want 1 hit", hits)
+			}
+			if !reflect.DeepEqual(hits[0].Highlights, tt.want) {
+				t.Errorf("Index.Search() highlights = %v, want %v", hits[0].Highlights, tt.want)
+			}
+			if hits[0].User.Password != "" {
+				t.Errorf("Index.Search() returned the password hash")
+			}
+		})
+	}
+}
+
+func TestIndex_Versions(t *testing.T) {
+	index := NewIndex()
+	index.Add(&users.User{ID: "1", FullName: "New Name", Version: 2})
+	index.Add(&users.User{ID: "1", FullName: "Old Name", Version: 1})
+	if hits := index.Search("old", 0); len(hits) != 0 {
+		t.Errorf("Index.Add() replaced a user with an older copy")
+	}
+
+	index.Remove(&users.User{ID: "1", Version: 3})
+	index.Add(&users.User{ID: "1", FullName: "New Name", Version: 2})
+	if index.Len() != 0 {
+		t.Errorf("Index.Add() indexed a copy older than the removal")
+	}
+
+	index.Add(&users.User{ID: "1", FullName: "Restored Name", Version: 4})
+	if hits := index.Search("restored", 0); len(hits) != 1 {
+		t.Errorf("Index.Add() did not index the restored user")
+	}
+
+	index.Purge("1")
+	index.Add(&users.User{ID: "1", FullName: "Restored Name", Version: 5})
+	if index.Len() != 0 {
+		t.Errorf("Index.Add() indexed a purged user")
+	}
+}
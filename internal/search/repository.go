@@ -0,0 +1,60 @@
+package search
+
+import (
+	"context"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// Repository is a users.Repository that keeps an Index in sync with the
+// writes made through it. Writes made by other instances of the service are
+// picked up by a Subscriber, or when the index is rebuilt.
+type Repository struct {
+	users.Repository
+	index *Index
+}
+
+// NewRepository returns repo with its writes applied to index.
+func NewRepository(repo users.Repository, index *Index) *Repository {
+	return &Repository{Repository: repo, index: index}
+}
+
+func (r *Repository) CreateUser(ctx context.Context, user *users.User) error {
+	err := r.Repository.CreateUser(ctx, user)
+	if err == nil {
+		r.index.Add(user)
+	}
+	return err
+}
+
+func (r *Repository) UpdateUser(ctx context.Context, id string, update users.UserUpdate) (*users.User, error) {
+	user, err := r.Repository.UpdateUser(ctx, id, update)
+	if err == nil {
+		r.index.Add(user)
+	}
+	return user, err
+}
+
+func (r *Repository) DeleteUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.DeleteUser(ctx, id)
+	if err == nil {
+		r.index.Remove(user)
+	}
+	return user, err
+}
+
+func (r *Repository) RestoreUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.RestoreUser(ctx, id)
+	if err == nil {
+		r.index.Add(user)
+	}
+	return user, err
+}
+
+func (r *Repository) PurgeUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.PurgeUser(ctx, id)
+	if err == nil {
+		r.index.Purge(id)
+	}
+	return user, err
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	memoryRepo := users.NewMemoryRepository()
+	existing := &users.User{FullName: "Existing User", Email: "existing@example.com"}
+	memoryRepo.CreateUser(ctx, existing)
+	index := NewIndex()
+	repo := NewRepository(memoryRepo, index)
+	if err := index.Rebuild(ctx, repo); err != nil {
+		t.Fatalf("Index.Rebuild() error = %v", err)
+	}
+
+	user := &users.User{FullName: "John Walker", Email: "john@example.com"}
+	repo.CreateUser(ctx, user)
+	fullName := "Jane Doe"
+	repo.UpdateUser(ctx, user.ID, users.UserUpdate{FullName: &fullName})
+	repo.DeleteUser(ctx, existing.ID)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "created and updated user", query: "jane", want: 1},
+		{name: "updated away name", query: "walker", want: 0},
+		{name: "deleted user", query: "existing", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(index.Search(tt.query, 0)); got != tt.want {
+				t.Errorf("Index.Search() = %v hits, want %v", got, tt.want)
+			}
+		})
+	}
+
+	repo.RestoreUser(ctx, existing.ID)
+	repo.PurgeUser(ctx, user.ID)
+	if err := index.Rebuild(ctx, repo); err != nil {
+		t.Fatalf("Index.Rebuild() error = %v", err)
+	}
+	if got := len(index.Search("existing", 0)); got != 1 {
+		t.Errorf("Index.Search() after RestoreUser = %v hits, want 1", got)
+	}
+	if got := len(index.Search("jane", 0)); got != 0 {
+		t.Errorf("Index.Search() after PurgeUser = %v hits, want 0", got)
+	}
+}
@@ -0,0 +1,303 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryStore() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewMongoStore(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLStore(db, tracer)
+		},
+		Tables: []string{"session_used_tokens", "sessions", "denylist"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testStore(t, func(t *testing.T) Store {
+			return newStore(t).(Store)
+		})
+	})
+}
+
+// testStore checks the behaviour every Store implementation must share,
+// newStore must return an empty store on every call.
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store Store)
+	}{
+		{name: "RotateToken", test: testRotateToken},
+		{name: "RotateToken reuse", test: testRotateTokenReuse},
+		{name: "RotateToken concurrently", test: testRotateTokenConcurrently},
+		{name: "RevokeSession", test: testRevokeSession},
+		{name: "RevokeUserSessions", test: testRevokeUserSessions},
+		{name: "DeleteUserSessions", test: testDeleteUserSessions},
+		{name: "Deny", test: testDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// newTestSession stores a session created at now whose refresh token is
+// token.
+func newTestSession(t *testing.T, store Store, token string, now time.Time, lifetime time.Duration) *Session {
+	session := &Session{
+		ID:         primitive.NewObjectID().Hex(),
+		UserID:     primitive.NewObjectID().Hex(),
+		TokenHash:  HashToken(token),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(lifetime),
+	}
+	err := store.CreateSession(context.Background(), session)
+	if err != nil {
+		t.Fatalf("Store.CreateSession() error = %v", err)
+	}
+	return session
+}
+
+func testRotateToken(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	session := newTestSession(t, store, "live", now, time.Hour)
+	newTestSession(t, store, "expired", now.Add(-2*time.Hour), time.Hour)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "unknown token", token: "unknown", wantErr: ErrInvalidRefreshToken},
+		{name: "expired session", token: "expired", wantErr: ErrInvalidRefreshToken},
+		{name: "live session", token: "live"},
+		{name: "rotated token", token: "rotated"},
+	}
+	newToken := map[string]string{"live": "rotated", "rotated": "rotated again"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			later := now.Add(time.Minute)
+			got, err := store.RotateToken(ctx, HashToken(tt.token), HashToken(newToken[tt.token]), later.Add(time.Hour), later)
+			if err != tt.wantErr {
+				t.Fatalf("Store.RotateToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.ID != session.ID || got.UserID != session.UserID {
+				t.Errorf("Store.RotateToken() = session %s of %s, want %s of %s", got.ID, got.UserID, session.ID, session.UserID)
+			}
+			if got.TokenHash != HashToken(newToken[tt.token]) {
+				t.Errorf("Store.RotateToken() token hash = %v, want %v", got.TokenHash, HashToken(newToken[tt.token]))
+			}
+			if !got.CreatedAt.Equal(now) || !got.LastUsedAt.Equal(later) || !got.ExpiresAt.Equal(later.Add(time.Hour)) {
+				t.Errorf("Store.RotateToken() times = %v %v %v, want %v %v %v", got.CreatedAt, got.LastUsedAt, got.ExpiresAt, now, later, later.Add(time.Hour))
+			}
+			if got.RevokedAt != nil {
+				t.Errorf("Store.RotateToken() revokedAt = %v, want nil", got.RevokedAt)
+			}
+		})
+	}
+}
+
+func testRotateTokenReuse(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	newTestSession(t, store, "first", now, time.Hour)
+	rotated, err := store.RotateToken(ctx, HashToken("first"), HashToken("second"), now.Add(time.Hour), now)
+	if err != nil {
+		t.Fatalf("Store.RotateToken() error = %v", err)
+	}
+
+	revoked, err := store.RotateToken(ctx, HashToken("first"), HashToken("stolen"), now.Add(time.Hour), now)
+	if err != ErrRefreshTokenReused || revoked == nil || revoked.ID != rotated.ID {
+		t.Fatalf("Store.RotateToken() with a used token = %+v, %v, want session %s and %v", revoked, err, rotated.ID, ErrRefreshTokenReused)
+	}
+	// the whole session is revoked, including the current token.
+	_, err = store.RotateToken(ctx, HashToken("second"), HashToken("third"), now.Add(time.Hour), now)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Store.RotateToken() on a revoked session error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	_, err = store.RotateToken(ctx, HashToken("stolen"), HashToken("third"), now.Add(time.Hour), now)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Store.RotateToken() with the token of a rejected reuse error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func testRotateTokenConcurrently(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	newTestSession(t, store, "token", now, time.Hour)
+
+	const attempts = 5
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = store.RotateToken(ctx, HashToken("token"), HashToken(primitive.NewObjectID().Hex()), now.Add(time.Hour), now)
+		}(i)
+	}
+	wg.Wait()
+
+	rotated := 0
+	for _, err := range errs {
+		switch err {
+		case nil:
+			rotated++
+		case ErrRefreshTokenReused, ErrInvalidRefreshToken:
+		default:
+			t.Errorf("Store.RotateToken() error = %v", err)
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("Store.RotateToken() succeeded %d times, want 1", rotated)
+	}
+}
+
+func testRevokeSession(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	session := newTestSession(t, store, "token", now, time.Hour)
+
+	err := store.RevokeSession(ctx, primitive.NewObjectID().Hex(), now)
+	if err != ErrSessionNotFound {
+		t.Errorf("Store.RevokeSession() of an unknown session error = %v, want %v", err, ErrSessionNotFound)
+	}
+	for i := 0; i < 2; i++ {
+		err = store.RevokeSession(ctx, session.ID, now)
+		if err != nil {
+			t.Fatalf("Store.RevokeSession() error = %v", err)
+		}
+	}
+	_, err = store.RotateToken(ctx, HashToken("token"), HashToken("new"), now.Add(time.Hour), now)
+	if err != ErrInvalidRefreshToken {
+		t.Errorf("Store.RotateToken() on a revoked session error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func testRevokeUserSessions(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	first := newTestSession(t, store, "first", now, time.Hour)
+	second := &Session{
+		ID:         primitive.NewObjectID().Hex(),
+		UserID:     first.UserID,
+		TokenHash:  HashToken("second"),
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(time.Hour),
+	}
+	if err := store.CreateSession(ctx, second); err != nil {
+		t.Fatalf("Store.CreateSession() error = %v", err)
+	}
+	other := newTestSession(t, store, "other", now, time.Hour)
+
+	if err := store.RevokeSession(ctx, first.ID, now); err != nil {
+		t.Fatalf("Store.RevokeSession() error = %v", err)
+	}
+	got, err := store.RevokeUserSessions(ctx, first.UserID, now)
+	if err != nil {
+		t.Fatalf("Store.RevokeUserSessions() error = %v", err)
+	}
+	// the first session was already revoked.
+	if len(got) != 1 || got[0] != second.ID {
+		t.Errorf("Store.RevokeUserSessions() = %v, want [%v]", got, second.ID)
+	}
+	if _, err := store.RotateToken(ctx, HashToken("second"), HashToken("third"), now.Add(time.Hour), now); err != ErrInvalidRefreshToken {
+		t.Errorf("Store.RotateToken() on a revoked session error = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, err := store.RotateToken(ctx, HashToken("other"), HashToken("other2"), now.Add(time.Hour), now); err != nil {
+		t.Errorf("Store.RotateToken() on the session %v of another user error = %v", other.ID, err)
+	}
+
+	got, err = store.RevokeUserSessions(ctx, primitive.NewObjectID().Hex(), now)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Store.RevokeUserSessions() of a user without sessions = %v, %v, want none", got, err)
+	}
+}
+
+func testDeleteUserSessions(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	session := newTestSession(t, store, "first", now, time.Hour)
+	other := newTestSession(t, store, "other", now, time.Hour)
+	if _, err := store.RotateToken(ctx, HashToken("first"), HashToken("second"), now.Add(time.Hour), now); err != nil {
+		t.Fatalf("Store.RotateToken() error = %v", err)
+	}
+
+	if err := store.DeleteUserSessions(ctx, session.UserID); err != nil {
+		t.Fatalf("Store.DeleteUserSessions() error = %v", err)
+	}
+	// a token rotated out of a deleted session is no longer known as reused.
+	for _, token := range []string{"first", "second"} {
+		if _, err := store.RotateToken(ctx, HashToken(token), HashToken("third"), now.Add(time.Hour), now); err != ErrInvalidRefreshToken {
+			t.Errorf("Store.RotateToken(%q) on a deleted session error = %v, want %v", token, err, ErrInvalidRefreshToken)
+		}
+	}
+	if _, err := store.RotateToken(ctx, HashToken("other"), HashToken("other2"), now.Add(time.Hour), now); err != nil {
+		t.Errorf("Store.RotateToken() on the session %v of another user error = %v", other.ID, err)
+	}
+	if err := store.DeleteUserSessions(ctx, primitive.NewObjectID().Hex()); err != nil {
+		t.Errorf("Store.DeleteUserSessions() of a user without sessions error = %v", err)
+	}
+}
+
+func testDeny(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	for _, deny := range []struct {
+		id        string
+		expiresAt time.Time
+	}{
+		{id: "token", expiresAt: now.Add(time.Minute)},
+		{id: "session", expiresAt: now.Add(time.Hour)},
+		// an earlier expiry does not shorten the denial.
+		{id: "session", expiresAt: now.Add(time.Minute)},
+		{id: "expired", expiresAt: now.Add(-time.Minute)},
+	} {
+		if err := store.Deny(ctx, deny.id, deny.expiresAt); err != nil {
+			t.Fatalf("Store.Deny() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		ids  []string
+		at   time.Time
+		want bool
+	}{
+		{name: "no ids", at: now, want: false},
+		{name: "unknown id", ids: []string{"unknown"}, at: now, want: false},
+		{name: "denied id", ids: []string{"token"}, at: now, want: true},
+		{name: "one of the ids denied", ids: []string{"unknown", "session"}, at: now, want: true},
+		{name: "expired denial", ids: []string{"expired"}, at: now, want: false},
+		{name: "after the denial of the token", ids: []string{"token"}, at: now.Add(2 * time.Minute), want: false},
+		{name: "longest denial kept", ids: []string{"session"}, at: now.Add(2 * time.Minute), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.IsDenied(ctx, tt.ids, tt.at)
+			if err != nil {
+				t.Fatalf("Store.IsDenied() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Store.IsDenied() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps sessions and the denylist in maps guarded
+// by a single mutex. Every user is logged out when the process restarts, and
+// sessions revoked on one replica stay usable on the others.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// denied maps the denied ids to the time they are denied until.
+	denied map[string]time.Time
+}
+
+// NewMemoryStore returns an empty in memory session store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]*Session{},
+		denied:   map[string]time.Time{},
+	}
+}
+
+func (s *MemoryStore) CreateSession(ctx context.Context, session *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (s *MemoryStore) RotateToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt, now time.Time) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.TokenHash == tokenHash {
+			if !session.usable(now) {
+				return nil, ErrInvalidRefreshToken
+			}
+			session.rotate(newTokenHash, expiresAt, now)
+			return copySession(session), nil
+		}
+		for _, usedTokenHash := range session.UsedTokenHashes {
+			if usedTokenHash == tokenHash {
+				if session.RevokedAt == nil {
+					session.RevokedAt = &now
+				}
+				return copySession(session), ErrRefreshTokenReused
+			}
+		}
+	}
+	return nil, ErrInvalidRefreshToken
+}
+
+func (s *MemoryStore) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(ctx context.Context, userID string, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revoked []string
+	for _, session := range s.sessions {
+		if session.UserID == userID && session.usable(now) {
+			session.RevokedAt = &now
+			revoked = append(revoked, session.ID)
+		}
+	}
+	return revoked, nil
+}
+
+func (s *MemoryStore) DeleteUserSessions(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Deny(ctx context.Context, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expiresAt.After(s.denied[id]) {
+		s.denied[id] = expiresAt
+	}
+	// expired entries are dropped on writes to keep the denylist bounded.
+	now := time.Now()
+	for deniedID, deniedUntil := range s.denied {
+		if deniedUntil.Before(now) {
+			delete(s.denied, deniedID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) IsDenied(ctx context.Context, ids []string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if deniedUntil, ok := s.denied[id]; ok && now.Before(deniedUntil) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// copySession returns a copy of session that shares no memory with it.
+func copySession(session *Session) *Session {
+	sessionCopy := *session
+	sessionCopy.UsedTokenHashes = append([]string(nil), session.UsedTokenHashes...)
+	if session.RevokedAt != nil {
+		revokedAt := *session.RevokedAt
+		sessionCopy.RevokedAt = &revokedAt
+	}
+	return &sessionCopy
+}
@@ -0,0 +1,6 @@
+CREATE TABLE denylist (
+    id TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX denylist_expires_at ON denylist (expires_at);
@@ -0,0 +1,20 @@
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX sessions_token_hash_unique ON sessions (token_hash);
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+CREATE TABLE session_used_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    used_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX session_used_tokens_session_id ON session_used_tokens (session_id);
@@ -0,0 +1,239 @@
+package sessions
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the sessions and denylist collections of a
+// mongodb database.
+type MongoStore struct {
+	collection *mongo.Collection
+	denylist   *mongo.Collection
+	tracer     opentracing.Tracer
+}
+
+// NewMongoStore returns a session store that keeps sessions in the sessions
+// collection of db, EnsureIndexes must be called before it is used.
+func NewMongoStore(db *mongo.Database, tracer opentracing.Tracer) *MongoStore {
+	return &MongoStore{
+		collection: db.Collection("sessions"),
+		denylist:   db.Collection("denylist"),
+		tracer:     tracer,
+	}
+}
+
+// EnsureIndexes creates the indexes the store relies on, expired sessions and
+// denylist entries are removed by mongodb. It is safe to call on every startup.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "EnsureIndexes")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetName("tokenHash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "usedTokenHashes", Value: 1}},
+			Options: options.Index().SetName("usedTokenHashes"),
+		},
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}},
+			Options: options.Index().SetName("userId"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateMany"))
+		return err
+	}
+	_, err = s.denylist.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) setMongoDBSpanComponentTags(span opentracing.Span) {
+	ext.DBInstance.Set(span, s.collection.Name())
+	ext.DBType.Set(span, "mongodb")
+	ext.SpanKindRPCClient.Set(span)
+}
+
+func (s *MongoStore) CreateSession(ctx context.Context, session *Session) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateSession")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.sessionId", session.ID).SetTag("param.userId", session.UserID)
+
+	_, err := s.collection.InsertOne(ctx, session)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.InsertOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) RotateToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt, now time.Time) (*Session, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RotateToken")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+
+	// the token hash filter makes the rotation atomic, a concurrent use of the
+	// same token finds it in usedTokenHashes.
+	filter := bson.M{"tokenHash": tokenHash, "revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}}
+	change := bson.M{
+		"$set": bson.M{"tokenHash": newTokenHash, "lastUsedAt": now, "expiresAt": expiresAt},
+		"$push": bson.M{"usedTokenHashes": bson.M{
+			"$each":  bson.A{tokenHash},
+			"$slice": -maxUsedTokenHashes,
+		}},
+	}
+	var session Session
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.collection.FindOneAndUpdate(ctx, filter, change, opts).Decode(&session)
+	if err == nil {
+		span.SetTag("sessionId", session.ID)
+		return &session, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+
+	filter = bson.M{"usedTokenHashes": tokenHash}
+	change = bson.M{"$min": bson.M{"revokedAt": now}}
+	err = s.collection.FindOneAndUpdate(ctx, filter, change, opts).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(ErrRefreshTokenReused), log.String("sessionId", session.ID))
+	return &session, ErrRefreshTokenReused
+}
+
+func (s *MongoStore) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeSession")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.id", id)
+
+	// $min keeps the time of an earlier revocation.
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$min": bson.M{"revokedAt": now}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MongoStore) RevokeUserSessions(ctx context.Context, userID string, now time.Time) ([]string, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeUserSessions")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.userId", userID)
+
+	filter := bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}, "expiresAt": bson.M{"$gt": now}}
+	ids, err := s.collection.Distinct(ctx, "_id", filter)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Distinct"))
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	// sessions revoked concurrently keep their revocation time.
+	_, err = s.collection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$min": bson.M{"revokedAt": now}})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateMany"))
+		return nil, err
+	}
+	revoked := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id, ok := id.(string); ok {
+			revoked = append(revoked, id)
+		}
+	}
+	span.SetTag("revokedSessions", len(revoked))
+	return revoked, nil
+}
+
+func (s *MongoStore) DeleteUserSessions(ctx context.Context, userID string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserSessions")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.userId", userID)
+
+	result, err := s.collection.DeleteMany(ctx, bson.M{"userId": userID})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.DeleteMany"))
+		return err
+	}
+	span.SetTag("deletedSessions", result.DeletedCount)
+	return nil
+}
+
+func (s *MongoStore) Deny(ctx context.Context, id string, expiresAt time.Time) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Deny")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.id", id)
+
+	opts := options.Update().SetUpsert(true)
+	_, err := s.denylist.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$max": bson.M{"expiresAt": expiresAt}}, opts)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+		return err
+	}
+	return nil
+}
+
+func (s *MongoStore) IsDenied(ctx context.Context, ids []string, now time.Time) (bool, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "IsDenied")
+	defer span.Finish()
+	s.setMongoDBSpanComponentTags(span)
+	span.SetTag("param.ids", ids)
+
+	// expired ids are only removed periodically by mongodb.
+	filter := bson.M{"_id": bson.M{"$in": ids}, "expiresAt": bson.M{"$gt": now}}
+	denied, err := s.denylist.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.CountDocuments"))
+		return false, err
+	}
+	return denied > 0, nil
+}
@@ -0,0 +1,109 @@
+// Package sessions keeps the login sessions of users. A session is a family of
+// refresh tokens: every refresh rotates the token of the session, and using a
+// rotated out token again revokes the whole session as the token must have
+// been stolen.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used, the session has been revoked")
+	ErrSessionNotFound     = errors.New("session does not exist")
+)
+
+// maxUsedTokenHashes bounds the number of rotated out token hashes kept per
+// session for reuse detection.
+const maxUsedTokenHashes = 100
+
+// Session is a login session of a user, only the hash of its current refresh
+// token is stored.
+type Session struct {
+	ID        string `json:"id" bson:"_id"`
+	UserID    string `json:"userId" bson:"userId"`
+	TokenHash string `json:"-" bson:"tokenHash"`
+	// UsedTokenHashes holds the hashes of the refresh tokens rotated out of
+	// the session, most recent last.
+	UsedTokenHashes []string   `json:"-" bson:"usedTokenHashes,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt      time.Time  `json:"lastUsedAt" bson:"lastUsedAt"`
+	ExpiresAt       time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt       *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// Store persists sessions along with the denylist of revoked access tokens.
+type Store interface {
+	CreateSession(ctx context.Context, session *Session) error
+	// RotateToken replaces tokenHash, the current token of a live session,
+	// with newTokenHash and returns the updated session. Presenting a token
+	// that was already rotated out revokes its session and returns it along
+	// with ErrRefreshTokenReused, any other token returns
+	// ErrInvalidRefreshToken.
+	RotateToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt, now time.Time) (*Session, error)
+	RevokeSession(ctx context.Context, id string, now time.Time) error
+	// RevokeUserSessions revokes every live session of the user and returns
+	// the ids of the sessions it revoked.
+	RevokeUserSessions(ctx context.Context, userID string, now time.Time) ([]string, error)
+	// DeleteUserSessions deletes every session of the user along with the
+	// refresh tokens rotated out of them.
+	DeleteUserSessions(ctx context.Context, userID string) error
+
+	// Deny adds id, the id of an access token or of a session, to the
+	// denylist until expiresAt. Denying an id again keeps the later expiry.
+	Deny(ctx context.Context, id string, expiresAt time.Time) error
+	// IsDenied reports whether any of the ids is on the denylist at now.
+	IsDenied(ctx context.Context, ids []string, now time.Time) (bool, error)
+}
+
+// TokenPair is the pair of tokens returned when a user logs in or refreshes
+// a session.
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// NewRefreshToken returns a random refresh token along with the hash to
+// store.
+func NewRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hash refresh tokens are stored under, tokens are
+// random enough for a fast hash.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// usable reports whether the session can still be refreshed.
+func (s *Session) usable(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// rotate replaces the token of the session, keeping the old token hash for
+// reuse detection.
+func (s *Session) rotate(newTokenHash string, expiresAt, now time.Time) {
+	s.UsedTokenHashes = append(s.UsedTokenHashes, s.TokenHash)
+	if len(s.UsedTokenHashes) > maxUsedTokenHashes {
+		s.UsedTokenHashes = s.UsedTokenHashes[len(s.UsedTokenHashes)-maxUsedTokenHashes:]
+	}
+	s.TokenHash = newTokenHash
+	s.LastUsedAt = now
+	s.ExpiresAt = expiresAt
+}
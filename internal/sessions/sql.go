@@ -0,0 +1,387 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const sessionColumns = "id, user_id, token_hash, created_at, last_used_at, expires_at, revoked_at"
+
+// SQLStore is a Store backed by a postgres or sqlite database. The rotated out
+// token hashes are kept in the session_used_tokens table, they are not
+// returned in Session.UsedTokenHashes.
+type SQLStore struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLStore returns a session store that keeps sessions in an sql database,
+// Migrate must be called before it is used.
+func NewSQLStore(db *sqldb.DB, tracer opentracing.Tracer) *SQLStore {
+	return &SQLStore{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the sessions tables, it is safe to call on every
+// startup.
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Migrate")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, s.db, "sessions", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "sessions")
+	ext.DBType.Set(span, string(s.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+func (s *SQLStore) CreateSession(ctx context.Context, session *Session) error {
+	query := s.db.Rebind(`INSERT INTO sessions (` + sessionColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateSession")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.sessionId", session.ID).SetTag("param.userId", session.UserID)
+
+	_, err := s.db.ExecContext(ctx, query,
+		session.ID, session.UserID, session.TokenHash, session.CreatedAt.UTC(),
+		session.LastUsedAt.UTC(), session.ExpiresAt.UTC(), nullTime(session.RevokedAt),
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) RotateToken(ctx context.Context, tokenHash, newTokenHash string, expiresAt, now time.Time) (*Session, error) {
+	query := s.db.Rebind(`UPDATE sessions SET token_hash = ?, last_used_at = ?, expires_at = ?
+		WHERE token_hash = ? AND revoked_at IS NULL AND expires_at > ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RotateToken")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	now = now.UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the token hash condition makes the rotation atomic, a concurrent use of
+	// the same token finds it in session_used_tokens.
+	result, err := tx.ExecContext(ctx, query, newTokenHash, now, expiresAt.UTC(), tokenHash, now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return nil, err
+	}
+	if updated == 0 {
+		return s.revokeReused(ctx, span, tx, tokenHash, now)
+	}
+
+	session, err := scanSession(tx.QueryRowContext(ctx, s.db.Rebind(`SELECT `+sessionColumns+` FROM sessions WHERE token_hash = ?`), newTokenHash))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	span.SetTag("sessionId", session.ID)
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`INSERT INTO session_used_tokens (token_hash, session_id, used_at) VALUES (?, ?, ?)`), tokenHash, session.ID, now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`DELETE FROM session_used_tokens WHERE session_id = ? AND token_hash NOT IN (
+		SELECT token_hash FROM session_used_tokens WHERE session_id = ? ORDER BY used_at DESC LIMIT ?
+	)`), session.ID, session.ID, maxUsedTokenHashes)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	return session, nil
+}
+
+// revokeReused revokes the session tokenHash was rotated out of and returns
+// it with ErrRefreshTokenReused, or ErrInvalidRefreshToken when the token is
+// unknown.
+func (s *SQLStore) revokeReused(ctx context.Context, span opentracing.Span, tx *sql.Tx, tokenHash string, now time.Time) (*Session, error) {
+	var sessionID string
+	err := tx.QueryRowContext(ctx, s.db.Rebind(`SELECT session_id FROM session_used_tokens WHERE token_hash = ?`), tokenHash).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`), now, sessionID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	session, err := scanSession(tx.QueryRowContext(ctx, s.db.Rebind(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`), sessionID))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(ErrRefreshTokenReused), log.String("sessionId", sessionID))
+	return session, ErrRefreshTokenReused
+}
+
+func (s *SQLStore) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	query := s.db.Rebind(`UPDATE sessions SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeSession")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	result, err := s.db.ExecContext(ctx, query, now.UTC(), id)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return err
+	}
+	if updated == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// scanSession reads a session selected with sessionColumns.
+func scanSession(row *sql.Row) (*Session, error) {
+	var session Session
+	var revokedAt sql.NullTime
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.TokenHash, &session.CreatedAt,
+		&session.LastUsedAt, &session.ExpiresAt, &revokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	return &session, nil
+}
+
+func (s *SQLStore) RevokeUserSessions(ctx context.Context, userID string, now time.Time) ([]string, error) {
+	query := s.db.Rebind(`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeUserSessions")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.userId", userID)
+	now = now.UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, s.db.Rebind(`SELECT id FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?`), userID, now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Next"))
+		return nil, err
+	}
+
+	var revoked []string
+	for _, id := range ids {
+		result, err := tx.ExecContext(ctx, query, now, id)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Exec"))
+			return nil, err
+		}
+		// a session revoked concurrently is not reported again.
+		if updated, _ := result.RowsAffected(); updated > 0 {
+			revoked = append(revoked, id)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	span.SetTag("revokedSessions", len(revoked))
+	return revoked, nil
+}
+
+func (s *SQLStore) DeleteUserSessions(ctx context.Context, userID string) error {
+	query := s.db.Rebind(`DELETE FROM sessions WHERE user_id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUserSessions")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.userId", userID)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return err
+	}
+	defer tx.Rollback()
+
+	// sqlite does not enforce the cascade unless foreign keys are enabled, so
+	// the rotated out tokens are deleted first.
+	_, err = tx.ExecContext(ctx, s.db.Rebind(`DELETE FROM session_used_tokens
+		WHERE session_id IN (SELECT id FROM sessions WHERE user_id = ?)`), userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	result, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err == nil {
+		span.SetTag("deletedSessions", deleted)
+	}
+	return nil
+}
+
+func (s *SQLStore) Deny(ctx context.Context, id string, expiresAt time.Time) error {
+	query := s.db.Rebind(`INSERT INTO denylist (id, expires_at) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET expires_at = excluded.expires_at WHERE denylist.expires_at < excluded.expires_at`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "Deny")
+	defer span.Finish()
+	s.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	_, err := s.db.ExecContext(ctx, query, id, expiresAt.UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	// expired entries are dropped on writes to keep the denylist bounded.
+	_, err = s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM denylist WHERE expires_at < ?`), time.Now().UTC())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+func (s *SQLStore) IsDenied(ctx context.Context, ids []string, now time.Time) (bool, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "IsDenied")
+	defer span.Finish()
+	span.SetTag("param.ids", ids)
+	if len(ids) == 0 {
+		s.setSQLSpanComponentTags(span, "")
+		return false, nil
+	}
+
+	args := []interface{}{now.UTC()}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	query := s.db.Rebind(`SELECT COUNT(*) FROM denylist WHERE expires_at > ? AND id IN (?` + strings.Repeat(", ?", len(ids)-1) + `)`)
+	s.setSQLSpanComponentTags(span, query)
+	var denied int
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&denied)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return false, err
+	}
+	return denied > 0, nil
+}
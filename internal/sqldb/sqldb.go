@@ -0,0 +1,159 @@
+// Package sqldb holds the helpers shared by the database/sql backed
+// repositories: opening a database, rewriting query placeholders for the
+// dialect in use and running embedded schema migrations.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite3"
+)
+
+// DB is a database handle that knows which dialect it speaks.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Open opens the database at dsn for the dialect and checks that it can be
+// reached.
+func Open(ctx context.Context, dialect Dialect, dsn string) (*DB, error) {
+	if dialect != Postgres && dialect != SQLite {
+		return nil, fmt.Errorf("unsupported sql dialect %q", dialect)
+	}
+	db, err := sql.Open(string(dialect), dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == SQLite {
+		// sqlite allows a single writer, sharing one connection avoids
+		// "database is locked" errors under concurrent writes.
+		db.SetMaxOpenConns(1)
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db, Dialect: dialect}, nil
+}
+
+// Rebind rewrites the ? placeholders of query to the placeholder style of the
+// dialect.
+func (db *DB) Rebind(query string) string {
+	if db.Dialect != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// IsUniqueViolation reports whether err was caused by a unique constraint.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	return false
+}
+
+// Migrate applies the migrations of the dialect found in migrations that have
+// not been applied yet. Migrations are read from a directory named after the
+// dialect, applied in file name order and recorded in the schema_migrations
+// table under namespace so that several repositories can share a database.
+func Migrate(ctx context.Context, db *DB, namespace string, migrations fs.FS) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+	dir := string(db.Dialect)
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return fmt.Errorf("reading %s migrations: %w", namespace, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = applyMigration(ctx, db, namespace+"/"+name, migrations, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *DB, version string, migrations fs.FS, file string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if db.Dialect == Postgres {
+		// serializes migrations of replicas starting at the same time.
+		_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(7254113)`)
+		if err != nil {
+			return err
+		}
+	}
+	var applied int
+	err = tx.QueryRowContext(ctx, db.Rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+	statements, err := fs.ReadFile(migrations, file)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, string(statements))
+	if err != nil {
+		return fmt.Errorf("applying migration %s: %w", version, err)
+	}
+	_, err = tx.ExecContext(ctx, db.Rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), version, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,80 @@
+package sqldb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDB_Rebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "postgres",
+			dialect: Postgres,
+			query:   "SELECT * FROM users WHERE id > ? AND email = ? LIMIT ?",
+			want:    "SELECT * FROM users WHERE id > $1 AND email = $2 LIMIT $3",
+		},
+		{
+			name:    "sqlite",
+			dialect: SQLite,
+			query:   "SELECT * FROM users WHERE id > ? AND email = ? LIMIT ?",
+			want:    "SELECT * FROM users WHERE id > ? AND email = ? LIMIT ?",
+		},
+		{
+			name:    "no placeholders",
+			dialect: Postgres,
+			query:   "SELECT COUNT(*) FROM users",
+			want:    "SELECT COUNT(*) FROM users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &DB{Dialect: tt.dialect}
+			if got := db.Rebind(tt.query); got != tt.want {
+				t.Errorf("DB.Rebind() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	db, err := Open(ctx, SQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	migrations := fstest.MapFS{
+		"sqlite3/0001_create_things.sql":  {Data: []byte(`CREATE TABLE things (name TEXT PRIMARY KEY);`)},
+		"sqlite3/0002_add_thing.sql":      {Data: []byte(`INSERT INTO things (name) VALUES ('first');`)},
+		"postgres/0001_create_things.sql": {Data: []byte(`this is not valid sql`)},
+	}
+	for i := 0; i < 2; i++ {
+		err = Migrate(ctx, db, "things", migrations)
+		if err != nil {
+			t.Fatalf("Migrate() run %d error = %v", i+1, err)
+		}
+	}
+	var things int
+	db.QueryRow(`SELECT COUNT(*) FROM things`).Scan(&things)
+	if things != 1 {
+		t.Errorf("Migrate() applied migrations more than once, things = %d, want 1", things)
+	}
+
+	_, err = db.Exec(`INSERT INTO things (name) VALUES ('first')`)
+	if !IsUniqueViolation(err) {
+		t.Errorf("IsUniqueViolation(%v) = false, want true", err)
+	}
+
+	migrations["sqlite3/0003_broken.sql"] = &fstest.MapFile{Data: []byte(`INSERT INTO missing_table VALUES (1);`)}
+	if err = Migrate(ctx, db, "things", migrations); err == nil {
+		t.Errorf("Migrate() with broken migration error = nil")
+	}
+}
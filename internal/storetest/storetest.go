@@ -0,0 +1,183 @@
+// Package storetest runs the conformance tests of the stores and
+// repositories against every backend. Tests against mongodb and postgres are
+// skipped unless TEST_MONGODB_URI and TEST_POSTGRES_DSN point at a server,
+// sqlite databases are created in a temporary directory.
+package storetest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Stores holds the constructors of the implementations of a store, the
+// stores they return are passed to the conformance test as is.
+type Stores struct {
+	Memory func() interface{}
+	// Mongo returns the store kept in db, its EnsureIndexes method is called
+	// when it has one.
+	Mongo func(db *mongo.Database, tracer opentracing.Tracer) interface{}
+	// SQL returns the store kept in db, it must have a Migrate method.
+	SQL func(db *sqldb.DB, tracer opentracing.Tracer) interface{}
+	// Tables are the tables the SQL store uses, emptied in order before each
+	// postgres test as the database is shared.
+	Tables []string
+}
+
+// NewStore returns a new empty store of the backend under test.
+type NewStore func(t *testing.T) interface{}
+
+type indexer interface {
+	EnsureIndexes(ctx context.Context) error
+}
+
+type migrator interface {
+	Migrate(ctx context.Context) error
+}
+
+// Run runs test once for every backend, as a subtest named after it.
+func Run(t *testing.T, stores Stores, test func(t *testing.T, newStore NewStore)) {
+	tracer := &opentracing.NoopTracer{}
+	backends := []struct {
+		name string
+		// open returns the constructor of the stores of the backend, it
+		// skips t when the backend is not available.
+		open func(t *testing.T) NewStore
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T) NewStore {
+				return func(t *testing.T) interface{} {
+					return stores.Memory()
+				}
+			},
+		},
+		{
+			name: "mongodb",
+			open: func(t *testing.T) NewStore {
+				newDatabase := Mongo(t)
+				return func(t *testing.T) interface{} {
+					store := stores.Mongo(newDatabase(t), tracer)
+					if store, ok := store.(indexer); ok {
+						Prepare(t, store.EnsureIndexes)
+					}
+					return store
+				}
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(t *testing.T) NewStore {
+				return func(t *testing.T) interface{} {
+					return migrated(t, stores.SQL(SQLite(t), tracer))
+				}
+			},
+		},
+		{
+			name: "postgres",
+			open: func(t *testing.T) NewStore {
+				openDB := postgres(t)
+				return func(t *testing.T) interface{} {
+					db := openDB(t)
+					store := migrated(t, stores.SQL(db, tracer))
+					emptyTables(t, db, stores.Tables)
+					return store
+				}
+			},
+		},
+	}
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend.open(t))
+		})
+	}
+}
+
+// Mongo connects to the mongodb server in TEST_MONGODB_URI for the duration of
+// t and returns a function that creates a new database for a test, the
+// database is dropped when that test ends. t is skipped when TEST_MONGODB_URI
+// is not set.
+func Mongo(t *testing.T) func(t *testing.T) *mongo.Database {
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("mongo.Connect() error = %v", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return func(t *testing.T) *mongo.Database {
+		db := client.Database("user_service_test_" + primitive.NewObjectID().Hex())
+		t.Cleanup(func() { db.Drop(context.Background()) })
+		return db
+	}
+}
+
+// SQLite opens a new sqlite database that is closed when t ends.
+func SQLite(t *testing.T) *sqldb.DB {
+	db, err := sqldb.Open(context.Background(), sqldb.SQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("sqldb.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Prepare runs setup, a Migrate or EnsureIndexes method, twice to check that
+// what it already applied is skipped.
+func Prepare(t *testing.T, setup func(ctx context.Context) error) {
+	for i := 0; i < 2; i++ {
+		err := setup(context.Background())
+		if err != nil {
+			t.Fatalf("preparing the store error = %v", err)
+		}
+	}
+}
+
+// postgres returns a function that opens the database in TEST_POSTGRES_DSN for
+// a test, the connection is closed when that test ends. t is skipped when
+// TEST_POSTGRES_DSN is not set.
+func postgres(t *testing.T) func(t *testing.T) *sqldb.DB {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	return func(t *testing.T) *sqldb.DB {
+		db, err := sqldb.Open(context.Background(), sqldb.Postgres, dsn)
+		if err != nil {
+			t.Fatalf("sqldb.Open() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+}
+
+func migrated(t *testing.T, store interface{}) interface{} {
+	sqlStore, ok := store.(migrator)
+	if !ok {
+		t.Fatalf("%T has no Migrate method", store)
+	}
+	Prepare(t, sqlStore.Migrate)
+	return store
+}
+
+// emptyTables deletes every row of tables in order, tables referenced by
+// others must come first.
+func emptyTables(t *testing.T, db *sqldb.DB, tables []string) {
+	for _, table := range tables {
+		_, err := db.Exec(`DELETE FROM ` + table)
+		if err != nil {
+			t.Fatalf("emptying %s table error = %v", table, err)
+		}
+	}
+}
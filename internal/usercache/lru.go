@@ -0,0 +1,97 @@
+package usercache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// lru is a bounded least recently used cache of users whose entries expire
+// after a ttl. It is safe for concurrent use.
+type lru struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type entry struct {
+	key       string
+	user      users.User
+	expiresAt time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru {
+	return &lru{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// get returns the user cached under key unless it has expired.
+func (c *lru) get(key string) (users.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return users.User{}, false
+	}
+	e := element.Value.(*entry)
+	if c.now().After(e.expiresAt) {
+		c.removeElement(element)
+		return users.User{}, false
+	}
+	c.order.MoveToFront(element)
+	return e.user, true
+}
+
+// add caches the user under key, evicting the least recently used user when
+// the cache is full.
+func (c *lru) add(key string, user users.User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		e.user, e.expiresAt = user, expiresAt
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, user: user, expiresAt: expiresAt})
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove drops the user cached under key, if any.
+func (c *lru) remove(key string) (users.User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return users.User{}, false
+	}
+	c.removeElement(element)
+	return element.Value.(*entry).user, true
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *lru) removeElement(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).key)
+}
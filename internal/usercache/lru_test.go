@@ -0,0 +1,48 @@
+package usercache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestLRU(t *testing.T) {
+	now := time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+	cache := newLRU(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.add("a", users.User{ID: "a"})
+	cache.add("b", users.User{ID: "b"})
+	cache.get("a")
+	cache.add("c", users.User{ID: "c"})
+	if _, ok := cache.get("b"); ok {
+		t.Errorf("lru.add() did not evict the least recently used user")
+	}
+	if _, ok := cache.get("a"); !ok {
+		t.Errorf("lru.add() evicted a recently used user")
+	}
+	if cache.len() != 2 {
+		t.Errorf("lru.len() = %v, want 2", cache.len())
+	}
+
+	cache.add("c", users.User{ID: "c", FullName: "updated"})
+	if user, _ := cache.get("c"); user.FullName != "updated" {
+		t.Errorf("lru.get() = %v, want the updated user", user)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := cache.get("a"); ok {
+		t.Errorf("lru.get() returned an expired user")
+	}
+	if cache.len() != 1 {
+		t.Errorf("lru.len() = %v, want 1 after the expired user was read", cache.len())
+	}
+
+	if _, ok := cache.remove("c"); !ok {
+		t.Errorf("lru.remove() did not find the cached user")
+	}
+	if _, ok := cache.remove("c"); ok {
+		t.Errorf("lru.remove() found a removed user")
+	}
+}
@@ -0,0 +1,274 @@
+// Package usercache caches the users looked up by id and email, the lookups
+// made on every authenticated request, in front of a users.Repository.
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/not.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"golang.org/x/sync/singleflight"
+)
+
+var errUnknownUser = errors.New("user change event has no userId")
+
+// Options configures the cache, zero values select the defaults.
+type Options struct {
+	// Size is the maximum number of cached lookups, 10000 by default.
+	Size int
+	// TTL bounds how long a user is served from the cache, 1 minute by
+	// default. It also bounds staleness when an invalidation event is lost.
+	TTL time.Duration
+	// LoadTimeout bounds a repository call shared by concurrent misses, 5
+	// seconds by default. The call does not use the context of the caller
+	// that started it, so that the other callers are not failed when that
+	// caller gives up.
+	LoadTimeout time.Duration
+}
+
+// Repository is a users.Repository that caches GetUserByID and GetUserByEmail
+// in a bounded LRU. Concurrent misses for the same user share a single
+// repository call, and cached users are dropped when they are changed through
+// the repository or when a user change event is received.
+type Repository struct {
+	users.Repository
+	tracer      opentracing.Tracer
+	cache       *lru
+	group       singleflight.Group
+	loadTimeout time.Duration
+
+	mu sync.Mutex
+	// generation is bumped by every invalidation, users loaded across an
+	// invalidation are not cached as they may be stale.
+	generation uint64
+}
+
+// NewRepository returns repo with its user lookups cached.
+func NewRepository(repo users.Repository, tracer opentracing.Tracer, opts Options) *Repository {
+	if opts.Size <= 0 {
+		opts.Size = 10000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = 5 * time.Second
+	}
+	return &Repository{
+		Repository:  repo,
+		tracer:      tracer,
+		cache:       newLRU(opts.Size, opts.TTL),
+		loadTimeout: opts.LoadTimeout,
+	}
+}
+
+func idKey(id string) string {
+	return "id:" + id
+}
+
+func emailKey(email string) string {
+	return "email:" + users.NormalizeEmail(email)
+}
+
+func (r *Repository) GetUserByID(ctx context.Context, id string) (*users.User, error) {
+	return r.get(ctx, "GetUserByID", idKey(id), func(ctx context.Context) (*users.User, error) {
+		return r.Repository.GetUserByID(ctx, id)
+	})
+}
+
+// GetUserByEmail returns the user with the email or nil if there is none,
+// missing users are not cached so that new users can be found right away.
+func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	return r.get(ctx, "GetUserByEmail", emailKey(email), func(ctx context.Context) (*users.User, error) {
+		return r.Repository.GetUserByEmail(ctx, email)
+	})
+}
+
+func (r *Repository) get(ctx context.Context, operationName, key string, load func(ctx context.Context) (*users.User, error)) (*users.User, error) {
+	span, ctx := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "cache."+operationName)
+	defer span.Finish()
+	span.SetTag("cache.key", key)
+
+	if user, ok := r.cache.get(key); ok {
+		span.SetTag("cache.hit", true)
+		return copyUser(&user), nil
+	}
+	span.SetTag("cache.hit", false)
+	results := r.group.DoChan(key, func() (interface{}, error) {
+		r.mu.Lock()
+		generation := r.generation
+		r.mu.Unlock()
+
+		loadCtx, cancel := context.WithTimeout(detachedContext{ctx}, r.loadTimeout)
+		defer cancel()
+		user, err := load(loadCtx)
+		if err != nil || user == nil {
+			return user, err
+		}
+		r.store(generation, user)
+		return user, nil
+	})
+	var result singleflight.Result
+	select {
+	case result = <-results:
+	case <-ctx.Done():
+		// the shared call goes on for the other callers.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ctx.Err()), log.Event("waiting for the shared lookup"))
+		return nil, ctx.Err()
+	}
+	span.SetTag("cache.shared", result.Shared)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	user := result.Val.(*users.User)
+	if user == nil {
+		return nil, nil
+	}
+	return copyUser(user), nil
+}
+
+// detachedContext keeps the values of a context, such as its span, without its
+// deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// store caches the user under its id and email unless an invalidation
+// happened since generation.
+func (r *Repository) store(generation uint64, user *users.User) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation != generation {
+		return
+	}
+	r.cache.add(idKey(user.ID), *user)
+	r.cache.add(emailKey(user.Email), *user)
+}
+
+// invalidate drops the cached lookups of the user.
+func (r *Repository) invalidate(id, email string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	if cached, ok := r.cache.remove(idKey(id)); ok {
+		r.cache.remove(emailKey(cached.Email))
+	}
+	if email != "" {
+		r.cache.remove(emailKey(email))
+	}
+}
+
+func (r *Repository) UpdateUser(ctx context.Context, id string, update users.UserUpdate) (*users.User, error) {
+	user, err := r.Repository.UpdateUser(ctx, id, update)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, id, passwordHash string, expectedVersion int64) (*users.User, error) {
+	user, err := r.Repository.UpdatePassword(ctx, id, passwordHash, expectedVersion)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+func (r *Repository) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (*users.User, error) {
+	user, err := r.Repository.ReplacePasswordHash(ctx, id, oldHash, newHash)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+func (r *Repository) DeleteUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.DeleteUser(ctx, id)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+func (r *Repository) RestoreUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.RestoreUser(ctx, id)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+func (r *Repository) PurgeUser(ctx context.Context, id string) (*users.User, error) {
+	user, err := r.Repository.PurgeUser(ctx, id)
+	r.invalidateAfterWrite(id, user)
+	return user, err
+}
+
+// invalidateAfterWrite drops the user even when the write failed, the write
+// may have been rejected because the cached copy is stale.
+func (r *Repository) invalidateAfterWrite(id string, user *users.User) {
+	email := ""
+	if user != nil {
+		email = user.Email
+	}
+	r.invalidate(id, email)
+}
+
+// SubscribeInvalidations drops the cached users changed through other
+// replicas, as announced by the user change events published on nats.
+func (r *Repository) SubscribeInvalidations(natsConn *nats.Conn) error {
+	for _, subject := range []string{users.EventUpdated, users.EventDeleted, users.EventRestored, users.EventPurged} {
+		_, err := natsConn.Subscribe(subject, r.handleChangeEvent)
+		if err != nil {
+			return err
+		}
+	}
+	return natsConn.Flush()
+}
+
+func (r *Repository) handleChangeEvent(msg *nats.Msg) {
+	traceMsg := not.NewTraceMsg(msg)
+	spanOptions := []opentracing.StartSpanOption{ext.SpanKindConsumer}
+	spanContext, err := r.tracer.Extract(opentracing.Binary, traceMsg)
+	if err == nil {
+		spanOptions = append(spanOptions, opentracing.FollowsFrom(spanContext))
+	}
+	span := r.tracer.StartSpan("cache.InvalidateUser", spanOptions...)
+	defer span.Finish()
+	ext.MessageBusDestination.Set(span, msg.Subject)
+
+	var event users.ChangeEvent
+	err = json.Unmarshal(traceMsg.Bytes(), &event)
+	if err != nil {
+		// the publisher may not have injected a span context.
+		err = json.Unmarshal(msg.Data, &event)
+	}
+	if err == nil && event.UserID == "" {
+		err = errUnknownUser
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("decoding user change event"), log.String("nats.message", string(msg.Data)))
+		return
+	}
+	span.SetTag("param.userId", event.UserID)
+	r.invalidate(event.UserID, event.Email)
+}
+
+// copyUser returns a copy of user that shares no memory with it, so callers
+// cannot modify the cached users.
+func copyUser(user *users.User) *users.User {
+	userCopy := *user
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		userCopy.DeletedAt = &deletedAt
+	}
+	return &userCopy
+}
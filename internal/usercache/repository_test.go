@@ -0,0 +1,238 @@
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// countingRepo counts the lookups that reach the repository, lookups wait
+// for release when it is set or until their context is done.
+type countingRepo struct {
+	users.Repository
+	lookups int32
+	release chan struct{}
+}
+
+func (r *countingRepo) GetUserByID(ctx context.Context, id string) (*users.User, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	if r.release != nil {
+		select {
+		case <-r.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return r.Repository.GetUserByID(ctx, id)
+}
+
+func (r *countingRepo) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	atomic.AddInt32(&r.lookups, 1)
+	return r.Repository.GetUserByEmail(ctx, email)
+}
+
+func newTestRepository(t *testing.T) (*Repository, *countingRepo, *users.User) {
+	memoryRepo := users.NewMemoryRepository()
+	user := &users.User{FullName: "John Doe", Email: "john@example.com"}
+	if err := memoryRepo.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("MemoryRepo.CreateUser() error = %v", err)
+	}
+	counting := &countingRepo{Repository: memoryRepo}
+	return NewRepository(counting, &opentracing.NoopTracer{}, Options{}), counting, user
+}
+
+func TestRepository_Lookups(t *testing.T) {
+	ctx := context.Background()
+	repo, counting, user := newTestRepository(t)
+
+	got, err := repo.GetUserByID(ctx, user.ID)
+	if err != nil || got.FullName != user.FullName {
+		t.Fatalf("Repository.GetUserByID() = %v, %v, want %v", got, err, user)
+	}
+	got.FullName = "Modified"
+	repo.GetUserByID(ctx, user.ID)
+	got, _ = repo.GetUserByEmail(ctx, "JOHN@example.com")
+	if got == nil || got.FullName != user.FullName {
+		t.Errorf("Repository.GetUserByEmail() = %v, want the unmodified user", got)
+	}
+	if counting.lookups != 1 {
+		t.Errorf("repository lookups = %v, want 1", counting.lookups)
+	}
+
+	got, err = repo.GetUserByEmail(ctx, "missing@example.com")
+	if got != nil || err != nil {
+		t.Errorf("Repository.GetUserByEmail() = %v, %v, want nil, nil", got, err)
+	}
+	repo.GetUserByEmail(ctx, "missing@example.com")
+	if counting.lookups != 3 {
+		t.Errorf("repository lookups = %v, want 3 as missing users are not cached", counting.lookups)
+	}
+
+	_, err = repo.GetUserByID(ctx, "missing")
+	if err != users.ErrUserNotFound {
+		t.Errorf("Repository.GetUserByID() error = %v, want %v", err, users.ErrUserNotFound)
+	}
+}
+
+func TestRepository_ConcurrentMisses(t *testing.T) {
+	repo, counting, user := newTestRepository(t)
+	counting.release = make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := repo.GetUserByID(context.Background(), user.ID)
+			if err != nil || got.ID != user.ID {
+				t.Errorf("Repository.GetUserByID() = %v, %v, want %v", got, err, user)
+			}
+		}()
+	}
+	// lets the lookups pile up behind the first one.
+	time.Sleep(50 * time.Millisecond)
+	close(counting.release)
+	wg.Wait()
+	if counting.lookups != 1 {
+		t.Errorf("repository lookups = %v, want 1", counting.lookups)
+	}
+}
+
+func TestRepository_SharedLookupOutlivesCaller(t *testing.T) {
+	repo, counting, user := newTestRepository(t)
+	counting.release = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := repo.GetUserByID(ctx, user.ID)
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&counting.lookups) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan *users.User, 1)
+	go func() {
+		got, err := repo.GetUserByID(context.Background(), user.ID)
+		if err != nil {
+			t.Errorf("Repository.GetUserByID() of the second caller error = %v", err)
+		}
+		second <- got
+	}()
+	// lets the second lookup join the shared one.
+	time.Sleep(50 * time.Millisecond)
+
+	// the first caller gives up without failing the shared lookup.
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("Repository.GetUserByID() of the canceled caller error = %v, want %v", err, context.Canceled)
+	}
+	close(counting.release)
+	if got := <-second; got == nil || got.ID != user.ID {
+		t.Errorf("Repository.GetUserByID() of the second caller = %v, want %v", got, user)
+	}
+	if counting.lookups != 1 {
+		t.Errorf("repository lookups = %v, want 1", counting.lookups)
+	}
+}
+
+func TestRepository_LoadTimeout(t *testing.T) {
+	memoryRepo := users.NewMemoryRepository()
+	counting := &countingRepo{Repository: memoryRepo, release: make(chan struct{})}
+	repo := NewRepository(counting, &opentracing.NoopTracer{}, Options{LoadTimeout: 10 * time.Millisecond})
+
+	_, err := repo.GetUserByID(context.Background(), "user.slow")
+	if err != context.DeadlineExceeded {
+		t.Errorf("Repository.GetUserByID() of a slow lookup error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestRepository_InvalidatedByWrites(t *testing.T) {
+	ctx := context.Background()
+	repo, _, user := newTestRepository(t)
+	repo.GetUserByID(ctx, user.ID)
+
+	fullName := "Jane Doe"
+	repo.UpdateUser(ctx, user.ID, users.UserUpdate{FullName: &fullName})
+	got, _ := repo.GetUserByID(ctx, user.ID)
+	if got.FullName != fullName {
+		t.Errorf("Repository.GetUserByID() after UpdateUser = %v, want %v", got.FullName, fullName)
+	}
+
+	repo.GetUserByEmail(ctx, user.Email)
+	repo.UpdatePassword(ctx, user.ID, "newPasswordHash", got.Version)
+	got, _ = repo.GetUserByEmail(ctx, user.Email)
+	if got.Password != "newPasswordHash" {
+		t.Errorf("Repository.GetUserByEmail() after UpdatePassword password = %v, want newPasswordHash", got.Password)
+	}
+
+	repo.GetUserByEmail(ctx, user.Email)
+	repo.DeleteUser(ctx, user.ID)
+	if _, err := repo.GetUserByID(ctx, user.ID); err != users.ErrUserNotFound {
+		t.Errorf("Repository.GetUserByID() after DeleteUser error = %v, want %v", err, users.ErrUserNotFound)
+	}
+	if got, _ := repo.GetUserByEmail(ctx, user.Email); got != nil {
+		t.Errorf("Repository.GetUserByEmail() after DeleteUser = %v, want nil", got)
+	}
+}
+
+func TestRepository_SubscribeInvalidations(t *testing.T) {
+	server := natsserver.RunRandClientPortServer()
+	t.Cleanup(server.Shutdown)
+	natsConn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("nats.Connect() error = %v", err)
+	}
+	t.Cleanup(natsConn.Close)
+
+	ctx := context.Background()
+	repo, counting, user := newTestRepository(t)
+	if err := repo.SubscribeInvalidations(natsConn); err != nil {
+		t.Fatalf("Repository.SubscribeInvalidations() error = %v", err)
+	}
+	tests := []struct {
+		name    string
+		subject string
+		event   interface{}
+		want    bool
+	}{
+		{name: "user updated", subject: users.EventUpdated, event: users.ChangeEvent{UserID: user.ID}, want: true},
+		{name: "user purged", subject: users.EventPurged, event: map[string]string{"userId": user.ID, "purgedAt": "now"}, want: true},
+		{name: "another user", subject: users.EventDeleted, event: users.ChangeEvent{UserID: "another"}},
+		{name: "invalid event", subject: users.EventDeleted, event: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.GetUserByID(ctx, user.ID)
+			lookups := atomic.LoadInt32(&counting.lookups)
+			data, _ := json.Marshal(tt.event)
+			natsConn.Publish(tt.subject, data)
+			natsConn.Flush()
+
+			invalidated := false
+			for deadline := time.Now().Add(time.Second); !invalidated && time.Now().Before(deadline); {
+				repo.GetUserByID(ctx, user.ID)
+				invalidated = atomic.LoadInt32(&counting.lookups) > lookups
+				if !tt.want {
+					// gives the event time to be handled.
+					time.Sleep(20 * time.Millisecond)
+					repo.GetUserByID(ctx, user.ID)
+					invalidated = atomic.LoadInt32(&counting.lookups) > lookups
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if invalidated != tt.want {
+				t.Errorf("user invalidated = %v, want %v", invalidated, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+package users
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRepositories(t *testing.T) {
+	storetest.Run(t, storetest.Stores{
+		Memory: func() interface{} { return NewMemoryRepository() },
+		Mongo: func(db *mongo.Database, tracer opentracing.Tracer) interface{} {
+			return NewRepository(db, tracer)
+		},
+		SQL: func(db *sqldb.DB, tracer opentracing.Tracer) interface{} {
+			return NewSQLRepository(db, tracer)
+		},
+		Tables: []string{"users"},
+	}, func(t *testing.T, newStore storetest.NewStore) {
+		testRepository(t, func(t *testing.T) Repository {
+			return newStore(t).(Repository)
+		})
+	})
+}
+
+// testRepository checks the behaviour every Repository implementation must
+// share, newRepo must return an empty repository on every call.
+func testRepository(t *testing.T, newRepo func(t *testing.T) Repository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo Repository)
+	}{
+		{name: "CreateUser", test: testCreateUser},
+		{name: "CreateUser concurrently", test: testCreateUserConcurrently},
+		{name: "GetUsers", test: testGetUsers},
+		{name: "lookups", test: testLookups},
+		{name: "GetUsersByIDs", test: testGetUsersByIDs},
+		{name: "UpdateUser", test: testUpdateUser},
+		{name: "UpdatePassword", test: testUpdatePassword},
+		{name: "ReplacePasswordHash", test: testReplacePasswordHash},
+		{name: "DeleteUser RestoreUser and PurgeUser", test: testDeleteRestorePurge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newRepo(t))
+		})
+	}
+}
+
+func testCreateUser(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	existing := &User{FullName: "Existing User", Email: "existing@example.com"}
+	if err := repo.CreateUser(ctx, existing); err != nil {
+		t.Fatalf("Repository.CreateUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		newUser   *User
+		wantEmail string
+		wantErr   error
+	}{
+		{
+			name:      "new user",
+			newUser:   &User{FullName: "John Doe", Email: "john@example.com"},
+			wantEmail: "john@example.com",
+		},
+		{
+			name:      "email is normalized",
+			newUser:   &User{FullName: "Jane Doe", Email: " Jane@Example.com "},
+			wantEmail: "jane@example.com",
+		},
+		{
+			name:    "existing email",
+			newUser: &User{FullName: "Existing User", Email: "existing@example.com"},
+			wantErr: ErrEmailTaken,
+		},
+		{
+			name:    "existing email with different case",
+			newUser: &User{FullName: "Existing User", Email: "EXISTING@example.com"},
+			wantErr: ErrEmailTaken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.CreateUser(ctx, tt.newUser)
+			if err != tt.wantErr {
+				t.Errorf("Repository.CreateUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if tt.newUser.ID == "" || tt.newUser.Version != 1 || tt.newUser.TimeAdded.IsZero() {
+				t.Errorf("Repository.CreateUser() did not set id, version and timeAdded: %+v", tt.newUser)
+			}
+			if tt.newUser.Email != tt.wantEmail {
+				t.Errorf("Repository.CreateUser() email = %v, want %v", tt.newUser.Email, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func testCreateUserConcurrently(t *testing.T, repo Repository) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.CreateUser(context.Background(), &User{Email: "double.click@example.com"})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	created := 0
+	for err := range errs {
+		if err == nil {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("Repository.CreateUser() created %d users with the same email, want 1", created)
+	}
+}
+
+func testGetUsers(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	var ids []string
+	for _, user := range []*User{
+		{FullName: "Zed", Email: "a@example.com", Country: "NG"},
+		{FullName: "Amy", Email: "b@example.com", Country: "US"},
+		{FullName: "Bob", Email: "c@example.com", Country: "NG"},
+		{FullName: "Carl", Email: "d@example.com", Country: "NG"},
+		{FullName: "Dan", Email: "e@example.com", Country: "US"},
+	} {
+		if err := repo.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Repository.CreateUser() error = %v", err)
+		}
+		ids = append(ids, user.ID)
+		// keeps the creation times of the users apart on stores that only
+		// keep milliseconds.
+		time.Sleep(2 * time.Millisecond)
+	}
+	repo.DeleteUser(ctx, ids[2])
+	// the cursors and time ranges are built from the stored users, whose
+	// times may have been rounded by the store.
+	all, err := repo.GetUsers(ctx, GetUsersFilter{})
+	if err != nil || len(all.Users) != 4 {
+		t.Fatalf("Repository.GetUsers() = %v, %v, want 4 users", all, err)
+	}
+	stored := map[string]*User{}
+	for i := range all.Users {
+		stored[all.Users[i].ID] = &all.Users[i]
+	}
+	cursor := func(i int, sortBy SortField) *Cursor {
+		cursor := NewCursor(stored[ids[i]], sortBy)
+		return &cursor
+	}
+
+	tests := []struct {
+		name        string
+		filter      GetUsersFilter
+		want        []string
+		wantHasMore bool
+		wantTotal   int64
+	}{
+		{name: "no limit skips deleted users", want: []string{ids[0], ids[1], ids[3], ids[4]}},
+		{
+			name:        "first page",
+			filter:      GetUsersFilter{Limit: 2},
+			want:        []string{ids[0], ids[1]},
+			wantHasMore: true,
+		},
+		{
+			name:   "after cursor",
+			filter: GetUsersFilter{Limit: 2, After: cursor(1, SortByTimeAdded)},
+			want:   []string{ids[3], ids[4]},
+		},
+		{
+			name:        "before cursor",
+			filter:      GetUsersFilter{Limit: 1, Before: cursor(3, SortByTimeAdded)},
+			want:        []string{ids[1]},
+			wantHasMore: true,
+		},
+		{
+			name:   "before first user",
+			filter: GetUsersFilter{Limit: 2, Before: cursor(0, SortByTimeAdded)},
+			want:   nil,
+		},
+		{
+			name:        "descending",
+			filter:      GetUsersFilter{Limit: 2, Descending: true},
+			want:        []string{ids[4], ids[3]},
+			wantHasMore: true,
+		},
+		{
+			name:   "descending before cursor",
+			filter: GetUsersFilter{Limit: 2, Descending: true, Before: cursor(1, SortByTimeAdded)},
+			want:   []string{ids[4], ids[3]},
+		},
+		{
+			name:   "sort by full name",
+			filter: GetUsersFilter{SortBy: SortByFullName},
+			want:   []string{ids[1], ids[3], ids[4], ids[0]},
+		},
+		{
+			name:   "sort by full name after cursor",
+			filter: GetUsersFilter{SortBy: SortByFullName, After: cursor(3, SortByFullName)},
+			want:   []string{ids[4], ids[0]},
+		},
+		{
+			name:        "sort by email descending",
+			filter:      GetUsersFilter{SortBy: SortByEmail, Descending: true, Limit: 3},
+			want:        []string{ids[4], ids[3], ids[1]},
+			wantHasMore: true,
+		},
+		{
+			name:   "country",
+			filter: GetUsersFilter{Country: "NG"},
+			want:   []string{ids[0], ids[3]},
+		},
+		{
+			name: "creation time range",
+			filter: GetUsersFilter{
+				CreatedAfter:  stored[ids[1]].TimeAdded,
+				CreatedBefore: stored[ids[4]].TimeAdded,
+			},
+			want: []string{ids[1], ids[3]},
+		},
+		{
+			name:        "total count ignores the cursor and limit",
+			filter:      GetUsersFilter{Limit: 1, After: cursor(0, SortByTimeAdded), CountTotal: true, Country: "US"},
+			want:        []string{ids[1]},
+			wantHasMore: true,
+			wantTotal:   2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetUsers(ctx, tt.filter)
+			if err != nil {
+				t.Errorf("Repository.GetUsers() error = %v", err)
+				return
+			}
+			var gotIds []string
+			for _, user := range got.Users {
+				gotIds = append(gotIds, user.ID)
+			}
+			if !reflect.DeepEqual(gotIds, tt.want) {
+				t.Errorf("Repository.GetUsers() = %v, want %v", gotIds, tt.want)
+			}
+			if got.HasMore != tt.wantHasMore {
+				t.Errorf("Repository.GetUsers() HasMore = %v, want %v", got.HasMore, tt.wantHasMore)
+			}
+			if got.Total != tt.wantTotal {
+				t.Errorf("Repository.GetUsers() Total = %v, want %v", got.Total, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func testLookups(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	user := &User{FullName: "John Doe", Email: "john@example.com"}
+	repo.CreateUser(ctx, user)
+
+	got, err := repo.GetUserByEmail(ctx, "JOHN@example.com")
+	if err != nil || got == nil || got.ID != user.ID {
+		t.Errorf("Repository.GetUserByEmail() = %v, %v, want user %v", got, err, user.ID)
+	}
+	got, err = repo.GetUserByEmail(ctx, "missing@example.com")
+	if err != nil || got != nil {
+		t.Errorf("Repository.GetUserByEmail() = %v, %v, want nil, nil", got, err)
+	}
+	got, err = repo.GetUserByID(ctx, user.ID)
+	if err != nil || got.Email != "john@example.com" {
+		t.Errorf("Repository.GetUserByID() = %v, %v, want user %v", got, err, user.ID)
+	}
+	_, err = repo.GetUserByID(ctx, "missing")
+	if err != ErrUserNotFound {
+		t.Errorf("Repository.GetUserByID() error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	got.FullName = "Changed Outside"
+	got, _ = repo.GetUserByID(ctx, user.ID)
+	if got.FullName != "John Doe" {
+		t.Errorf("Repository.GetUserByID() returned a user sharing memory with the stored user")
+	}
+}
+
+func testGetUsersByIDs(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	var ids []string
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		user := &User{Email: email}
+		if err := repo.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Repository.CreateUser() error = %v", err)
+		}
+		ids = append(ids, user.ID)
+	}
+	repo.DeleteUser(ctx, ids[1])
+
+	tests := []struct {
+		name string
+		ids  []string
+		want []string
+	}{
+		{name: "no ids", ids: nil, want: nil},
+		{name: "existing users", ids: []string{ids[2], ids[0]}, want: []string{ids[0], ids[2]}},
+		{name: "missing and deleted users are ignored", ids: []string{"missing", ids[1], ids[0]}, want: []string{ids[0]}},
+		{name: "duplicate ids", ids: []string{ids[0], ids[0]}, want: []string{ids[0]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.GetUsersByIDs(ctx, tt.ids)
+			if err != nil {
+				t.Errorf("Repository.GetUsersByIDs() error = %v", err)
+				return
+			}
+			var gotIds []string
+			for _, user := range got {
+				gotIds = append(gotIds, user.ID)
+			}
+			sort.Strings(gotIds)
+			if !reflect.DeepEqual(gotIds, tt.want) {
+				t.Errorf("Repository.GetUsersByIDs() = %v, want %v", gotIds, tt.want)
+			}
+		})
+	}
+}
+
+func testUpdateUser(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	user := &User{FullName: "John Doe", Email: "john@example.com", Country: "Nigeria"}
+	repo.CreateUser(ctx, user)
+	newName, newCountry := "Johnny Doe", "Ghana"
+	version, staleVersion := int64(1), int64(0)
+	verified := true
+
+	tests := []struct {
+		name    string
+		id      string
+		update  UserUpdate
+		want    *User
+		wantErr error
+	}{
+		{
+			name:    "user does not exist",
+			id:      "missing",
+			update:  UserUpdate{FullName: &newName},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "stale version",
+			id:      user.ID,
+			update:  UserUpdate{FullName: &newName, ExpectedVersion: &staleVersion},
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:   "matching version",
+			id:     user.ID,
+			update: UserUpdate{FullName: &newName, ExpectedVersion: &version},
+			want:   &User{FullName: newName, Country: "Nigeria", Version: 2},
+		},
+		{
+			name:   "without version check",
+			id:     user.ID,
+			update: UserUpdate{Country: &newCountry},
+			want:   &User{FullName: newName, Country: newCountry, Version: 3},
+		},
+		{
+			name:   "email verified",
+			id:     user.ID,
+			update: UserUpdate{EmailVerified: &verified},
+			want:   &User{FullName: newName, Country: newCountry, Version: 4, EmailVerified: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.UpdateUser(ctx, tt.id, tt.update)
+			if err != tt.wantErr {
+				t.Errorf("Repository.UpdateUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.FullName != tt.want.FullName || got.Country != tt.want.Country || got.Version != tt.want.Version ||
+				got.EmailVerified != tt.want.EmailVerified {
+				t.Errorf("Repository.UpdateUser() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testUpdatePassword(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	user := &User{FullName: "John Doe", Email: "john@example.com", Password: "oldPasswordHash"}
+	repo.CreateUser(ctx, user)
+
+	tests := []struct {
+		name            string
+		id              string
+		expectedVersion int64
+		want            *User
+		wantErr         error
+	}{
+		{
+			name:            "user does not exist",
+			id:              "missing",
+			expectedVersion: 1,
+			wantErr:         ErrUserNotFound,
+		},
+		{
+			name:            "stale version",
+			id:              user.ID,
+			expectedVersion: 0,
+			wantErr:         ErrVersionConflict,
+		},
+		{
+			name:            "matching version",
+			id:              user.ID,
+			expectedVersion: 1,
+			want:            &User{FullName: "John Doe", Password: "newPasswordHash", Version: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.UpdatePassword(ctx, tt.id, "newPasswordHash", tt.expectedVersion)
+			if err != tt.wantErr {
+				t.Errorf("Repository.UpdatePassword() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.FullName != tt.want.FullName || got.Password != tt.want.Password || got.Version != tt.want.Version {
+				t.Errorf("Repository.UpdatePassword() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testReplacePasswordHash(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	user := &User{FullName: "John Doe", Email: "john@example.com", Password: "oldPasswordHash"}
+	repo.CreateUser(ctx, user)
+
+	tests := []struct {
+		name    string
+		id      string
+		oldHash string
+		want    *User
+		wantErr error
+	}{
+		{
+			name:    "user does not exist",
+			id:      "missing",
+			oldHash: "oldPasswordHash",
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name:    "password changed",
+			id:      user.ID,
+			oldHash: "otherPasswordHash",
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:    "matching hash",
+			id:      user.ID,
+			oldHash: "oldPasswordHash",
+			want:    &User{FullName: "John Doe", Password: "newPasswordHash", Version: 1},
+		},
+		{
+			name:    "hash already replaced",
+			id:      user.ID,
+			oldHash: "oldPasswordHash",
+			wantErr: ErrVersionConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.ReplacePasswordHash(ctx, tt.id, tt.oldHash, "newPasswordHash")
+			if err != tt.wantErr {
+				t.Errorf("Repository.ReplacePasswordHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.FullName != tt.want.FullName || got.Password != tt.want.Password || got.Version != tt.want.Version {
+				t.Errorf("Repository.ReplacePasswordHash() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testDeleteRestorePurge(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	user := &User{FullName: "John Doe", Email: "john@example.com"}
+	repo.CreateUser(ctx, user)
+
+	deleted, err := repo.DeleteUser(ctx, user.ID)
+	if err != nil || deleted.DeletedAt == nil {
+		t.Fatalf("Repository.DeleteUser() = %v, %v", deleted, err)
+	}
+	if _, err := repo.DeleteUser(ctx, user.ID); err != ErrUserNotFound {
+		t.Errorf("Repository.DeleteUser() of deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if got, _ := repo.GetUserByEmail(ctx, user.Email); got != nil {
+		t.Errorf("Repository.GetUserByEmail() returned soft deleted user")
+	}
+	if _, err := repo.GetUserByID(ctx, user.ID); err != ErrUserNotFound {
+		t.Errorf("Repository.GetUserByID() of deleted user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if err := repo.CreateUser(ctx, &User{Email: user.Email}); err != ErrEmailTaken {
+		t.Errorf("Repository.CreateUser() with email of deleted user error = %v, want %v", err, ErrEmailTaken)
+	}
+
+	restored, err := repo.RestoreUser(ctx, user.ID)
+	if err != nil || restored.DeletedAt != nil {
+		t.Fatalf("Repository.RestoreUser() = %v, %v", restored, err)
+	}
+	if _, err := repo.RestoreUser(ctx, user.ID); err != ErrUserNotFound {
+		t.Errorf("Repository.RestoreUser() of active user error = %v, want %v", err, ErrUserNotFound)
+	}
+
+	purged, err := repo.PurgeUser(ctx, user.ID)
+	if err != nil || purged.ID != user.ID {
+		t.Fatalf("Repository.PurgeUser() = %v, %v", purged, err)
+	}
+	if _, err := repo.PurgeUser(ctx, user.ID); err != ErrUserNotFound {
+		t.Errorf("Repository.PurgeUser() of purged user error = %v, want %v", err, ErrUserNotFound)
+	}
+	if err := repo.CreateUser(ctx, &User{Email: user.Email}); err != nil {
+		t.Errorf("Repository.CreateUser() with email of purged user error = %v", err)
+	}
+
+	// a soft deleted user keeps its email until it is purged.
+	deletedUser := &User{FullName: "Jane Doe", Email: "jane@example.com"}
+	repo.CreateUser(ctx, deletedUser)
+	if _, err := repo.DeleteUser(ctx, deletedUser.ID); err != nil {
+		t.Fatalf("Repository.DeleteUser() error = %v", err)
+	}
+	if err := repo.CreateUser(ctx, &User{Email: "JANE@example.com"}); err != ErrEmailTaken {
+		t.Errorf("Repository.CreateUser() with email of deleted user error = %v, want %v", err, ErrEmailTaken)
+	}
+	if _, err := repo.PurgeUser(ctx, deletedUser.ID); err != nil {
+		t.Fatalf("Repository.PurgeUser() of deleted user error = %v", err)
+	}
+	if err := repo.CreateUser(ctx, &User{Email: deletedUser.Email}); err != nil {
+		t.Errorf("Repository.CreateUser() with email of purged deleted user error = %v", err)
+	}
+}
@@ -10,4 +10,21 @@ type User struct {
 	Country     string    `json:"country" bson:"country,omitempty"`
 	TimeAdded   time.Time `json:"timeAdded" bson:"timeAdded,omitempty"`
 	LastUpdated time.Time `json:"lastUpdated" bson:"lastUpdated,omitempty"`
+	Version     int64     `json:"version" bson:"version,omitempty"`
+	// DeletedAt is set when the user has been soft deleted, soft deleted
+	// users are hidden from every lookup until they are restored.
+	DeletedAt *time.Time `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// EmailVerified is set once the user has proven to own the email.
+	EmailVerified bool `json:"emailVerified" bson:"emailVerified"`
+}
+
+// UserUpdate is a partial update of a user, nil fields are left untouched.
+type UserUpdate struct {
+	FullName *string
+	Country  *string
+	// EmailVerified marks the email of the user as verified or not.
+	EmailVerified *bool
+	// ExpectedVersion makes the update fail with ErrVersionConflict when the
+	// stored user has a different version, nil skips the check.
+	ExpectedVersion *int64
 }
@@ -0,0 +1,18 @@
+package users
+
+// Subjects of the nats events published when a user changes, services caching
+// or indexing users subscribe to them to drop stale copies.
+const (
+	EventCreated  = "user.Created"
+	EventUpdated  = "user.Updated"
+	EventDeleted  = "user.Deleted"
+	EventRestored = "user.Restored"
+	EventPurged   = "user.Purged"
+)
+
+// ChangeEvent is the payload of the user change events.
+type ChangeEvent struct {
+	UserID  string `json:"userId"`
+	Email   string `json:"email,omitempty"`
+	Version int64  `json:"version,omitempty"`
+}
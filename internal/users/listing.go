@@ -0,0 +1,179 @@
+package users
+
+import (
+	"strings"
+	"time"
+)
+
+// SortField is a user field GetUsers can sort by.
+type SortField string
+
+const (
+	SortByTimeAdded SortField = "timeAdded"
+	SortByFullName  SortField = "fullName"
+	SortByEmail     SortField = "email"
+)
+
+// Valid reports whether users can be sorted by the field.
+func (f SortField) Valid() bool {
+	switch f {
+	case SortByTimeAdded, SortByFullName, SortByEmail:
+		return true
+	}
+	return false
+}
+
+// GetUsersFilter selects, orders and paginates the users returned by
+// GetUsers. Users are always ordered by id after the sort field so that the
+// order is stable.
+type GetUsersFilter struct {
+	// SortBy defaults to SortByTimeAdded.
+	SortBy     SortField
+	Descending bool
+	Country    string
+	// CreatedAfter and CreatedBefore limit the users to those added in
+	// [CreatedAfter, CreatedBefore), zero values leave the range open.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// After returns the users that follow the cursor and Before the users that
+	// precede it, at most one of them may be set. Either way the users are
+	// returned in the sort order.
+	After  *Cursor
+	Before *Cursor
+	// Limit of 0 returns every matching user.
+	Limit int32
+	// CountTotal makes GetUsers count every user matching the filter,
+	// regardless of the cursor and limit.
+	CountTotal bool
+}
+
+func (f GetUsersFilter) sortField() SortField {
+	if f.SortBy == "" {
+		return SortByTimeAdded
+	}
+	return f.SortBy
+}
+
+// position returns the cursor the listing continues from, if any.
+func (f GetUsersFilter) position() *Cursor {
+	if f.Before != nil {
+		return f.Before
+	}
+	return f.After
+}
+
+// scanDescending reports whether users have to be read in descending order,
+// users before a cursor are read backwards from it.
+func (f GetUsersFilter) scanDescending() bool {
+	return f.Descending != (f.Before != nil)
+}
+
+// Cursor is the position of a user in a sorted listing of users, it holds the
+// id of the user and the value of the field the listing is sorted by.
+type Cursor struct {
+	ID        string    `json:"id"`
+	TimeAdded time.Time `json:"timeAdded,omitempty"`
+	FullName  string    `json:"fullName,omitempty"`
+	Email     string    `json:"email,omitempty"`
+}
+
+// NewCursor returns the position of user in a listing sorted by sortBy.
+func NewCursor(user *User, sortBy SortField) Cursor {
+	cursor := Cursor{ID: user.ID}
+	switch sortBy {
+	case SortByFullName:
+		cursor.FullName = user.FullName
+	case SortByEmail:
+		cursor.Email = user.Email
+	default:
+		cursor.TimeAdded = user.TimeAdded
+	}
+	return cursor
+}
+
+func (c Cursor) value(sortBy SortField) interface{} {
+	switch sortBy {
+	case SortByFullName:
+		return c.FullName
+	case SortByEmail:
+		return c.Email
+	}
+	return c.TimeAdded
+}
+
+// compare returns -1, 0 or 1 as c comes before, at or after other in an
+// ascending listing sorted by sortBy.
+func (c Cursor) compare(other Cursor, sortBy SortField) int {
+	result := 0
+	switch sortBy {
+	case SortByFullName:
+		result = strings.Compare(c.FullName, other.FullName)
+	case SortByEmail:
+		result = strings.Compare(c.Email, other.Email)
+	default:
+		if c.TimeAdded.Before(other.TimeAdded) {
+			result = -1
+		} else if c.TimeAdded.After(other.TimeAdded) {
+			result = 1
+		}
+	}
+	if result != 0 {
+		return result
+	}
+	return strings.Compare(c.ID, other.ID)
+}
+
+// UsersPage is a page of users returned by GetUsers.
+type UsersPage struct {
+	Users []User
+	// HasMore reports whether there are more users in the direction the
+	// listing moves in, after the page for After and before it for Before.
+	HasMore bool
+	// Total is only set when the filter asks for it.
+	Total int64
+}
+
+// newUsersPage turns the users read in scan order, reading one user more than
+// the limit tells whether there are more users, into a page.
+func newUsersPage(users []User, filter GetUsersFilter, total int64) *UsersPage {
+	page := &UsersPage{Total: total}
+	if filter.Limit > 0 && len(users) > int(filter.Limit) {
+		users = users[:filter.Limit]
+		page.HasMore = true
+	}
+	if filter.Before != nil {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+	page.Users = users
+	return page
+}
+
+// GetUsersRequest selects the page of users returned by the GetUsers method
+// of the user service, its page token is resolved into a GetUsersFilter.
+type GetUsersRequest struct {
+	Limit int32
+	// PageToken is a NextPageToken or PrevPageToken of a previous response, it
+	// is only accepted with the filters and sort order it was issued for.
+	PageToken string
+	// SortBy defaults to SortByTimeAdded.
+	SortBy     SortField
+	Descending bool
+	Country    string
+	// CreatedAfter and CreatedBefore select the users added in
+	// [CreatedAfter, CreatedBefore), zero values leave the range open.
+	CreatedAfter      time.Time
+	CreatedBefore     time.Time
+	IncludeTotalCount bool
+}
+
+// GetUsersResponse is a page of users, its tokens are empty when there is no
+// page in their direction.
+type GetUsersResponse struct {
+	Users         []User
+	NextPageToken string
+	PrevPageToken string
+	// TotalCount is only set when the request asks for it.
+	TotalCount int64
+}
@@ -0,0 +1,265 @@
+package users
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRepo is a Repository that keeps users in a map keyed by id. Lookups
+// by email scan the map, which is fine for the handful of users of a local
+// setup or a test. Writes hold the lock while they check the version and the
+// email uniqueness, so they are atomic like those of the other repositories.
+type MemoryRepo struct {
+	mu    sync.RWMutex
+	users map[string]*User
+}
+
+// NewMemoryRepository returns an empty in memory user repository.
+func NewMemoryRepository() *MemoryRepo {
+	return &MemoryRepo{
+		users: map[string]*User{},
+	}
+}
+
+// CreateUser adds a new user to the repository.
+func (r *MemoryRepo) CreateUser(ctx context.Context, newUser *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email := NormalizeEmail(newUser.Email)
+	for _, user := range r.users {
+		if user.Email == email {
+			return ErrEmailTaken
+		}
+	}
+	newUser.ID = primitive.NewObjectID().Hex()
+	newUser.Email = email
+	newUser.TimeAdded = time.Now()
+	newUser.LastUpdated = time.Now()
+	newUser.Version = 1
+	r.users[newUser.ID] = copyUser(newUser)
+	return nil
+}
+
+// GetUsers returns a page of the users matching the filter.
+func (r *MemoryRepo) GetUsers(ctx context.Context, filter GetUsersFilter) (*UsersPage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sortBy := filter.sortField()
+	descending := filter.scanDescending()
+	position := filter.position()
+	var total int64
+	var users []User
+	for _, user := range r.users {
+		if !r.matches(user, filter) {
+			continue
+		}
+		total++
+		if position != nil {
+			comparison := NewCursor(user, sortBy).compare(*position, sortBy)
+			if (!descending && comparison <= 0) || (descending && comparison >= 0) {
+				continue
+			}
+		}
+		users = append(users, *copyUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		comparison := NewCursor(&users[i], sortBy).compare(NewCursor(&users[j], sortBy), sortBy)
+		if descending {
+			return comparison > 0
+		}
+		return comparison < 0
+	})
+	if filter.Limit > 0 && len(users) > int(filter.Limit)+1 {
+		users = users[:filter.Limit+1]
+	}
+	if !filter.CountTotal {
+		total = 0
+	}
+	return newUsersPage(users, filter, total), nil
+}
+
+// matches reports whether user is selected by the filter, ignoring its
+// cursors.
+func (r *MemoryRepo) matches(user *User, filter GetUsersFilter) bool {
+	if user.DeletedAt != nil {
+		return false
+	}
+	if filter.Country != "" && user.Country != filter.Country {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && user.TimeAdded.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !user.TimeAdded.Before(filter.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+// GetUserByEmail returns the user with the email or nil if there is none.
+func (r *MemoryRepo) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email = NormalizeEmail(email)
+	for _, user := range r.users {
+		if user.DeletedAt == nil && user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MemoryRepo) GetUserByID(ctx context.Context, id string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+// GetUsersByIDs returns the users with the ids, ids without a user are
+// ignored.
+func (r *MemoryRepo) GetUsersByIDs(ctx context.Context, ids []string) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []User
+	seen := map[string]bool{}
+	for _, id := range ids {
+		user, ok := r.users[id]
+		if !ok || user.DeletedAt != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		users = append(users, *copyUser(user))
+	}
+	return users, nil
+}
+
+// UpdateUser applies a partial update to the user and returns the updated
+// user.
+func (r *MemoryRepo) UpdateUser(ctx context.Context, id string, update UserUpdate) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if update.ExpectedVersion != nil && *update.ExpectedVersion != user.Version {
+		return nil, ErrVersionConflict
+	}
+	if update.FullName != nil {
+		user.FullName = *update.FullName
+	}
+	if update.Country != nil {
+		user.Country = *update.Country
+	}
+	if update.EmailVerified != nil {
+		user.EmailVerified = *update.EmailVerified
+	}
+	user.LastUpdated = time.Now()
+	user.Version++
+	return copyUser(user), nil
+}
+
+// UpdatePassword replaces the password hash of the user.
+func (r *MemoryRepo) UpdatePassword(ctx context.Context, id, passwordHash string, expectedVersion int64) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+	user.Password = passwordHash
+	user.LastUpdated = time.Now()
+	user.Version++
+	return copyUser(user), nil
+}
+
+// ReplacePasswordHash replaces the password hash of the user without bumping
+// its version.
+func (r *MemoryRepo) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Password != oldHash {
+		return nil, ErrVersionConflict
+	}
+	user.Password = newHash
+	return copyUser(user), nil
+}
+
+// DeleteUser soft deletes the user by setting its deletedAt timestamp.
+func (r *MemoryRepo) DeleteUser(ctx context.Context, id string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	user.LastUpdated = now
+	user.Version++
+	return copyUser(user), nil
+}
+
+// RestoreUser reverts the soft delete of a user.
+func (r *MemoryRepo) RestoreUser(ctx context.Context, id string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, ErrUserNotFound
+	}
+	user.DeletedAt = nil
+	user.LastUpdated = time.Now()
+	user.Version++
+	return copyUser(user), nil
+}
+
+// PurgeUser permanently removes the user whether or not it has been soft
+// deleted, the removed user is returned.
+func (r *MemoryRepo) PurgeUser(ctx context.Context, id string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	delete(r.users, id)
+	return user, nil
+}
+
+// copyUser returns a copy of user that shares no memory with it, so callers
+// cannot modify the stored users.
+func copyUser(user *User) *User {
+	userCopy := *user
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		userCopy.DeletedAt = &deletedAt
+	}
+	return &userCopy
+}
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    full_name TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL,
+    password TEXT NOT NULL DEFAULT '',
+    country TEXT NOT NULL DEFAULT '',
+    time_added TIMESTAMPTZ NOT NULL,
+    last_updated TIMESTAMPTZ NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX users_email_unique ON users (lower(email));
@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- users created before email verification existed are treated as verified.
+UPDATE users SET email_verified = TRUE;
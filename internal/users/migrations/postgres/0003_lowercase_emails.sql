@@ -0,0 +1,4 @@
+-- the unique index on lower(email) has kept emails unique regardless of case
+-- since the table was created, so lower-casing them cannot collide. Rows
+-- imported with mixed case emails are normalized like new users.
+UPDATE users SET email = lower(email) WHERE email <> lower(email);
@@ -3,6 +3,8 @@ package users
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
@@ -15,10 +17,44 @@ import (
 )
 
 type Repository interface {
+	// CreateUser stores the user, it fails with ErrEmailTaken when another
+	// user has the email, soft deleted users included so that they can be
+	// restored. Their email is only freed by PurgeUser.
 	CreateUser(ctx context.Context, user *User) error
-	GetUsers(ctx context.Context, afterId string, limit int32) ([]User, error)
+	GetUsers(ctx context.Context, filter GetUsersFilter) (*UsersPage, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByID(ctx context.Context, id string) (*User, error)
+	GetUsersByIDs(ctx context.Context, ids []string) ([]User, error)
+	UpdateUser(ctx context.Context, id string, update UserUpdate) (*User, error)
+	// UpdatePassword replaces the password hash of the user, it fails with
+	// ErrVersionConflict when the stored user has another version.
+	UpdatePassword(ctx context.Context, id, passwordHash string, expectedVersion int64) (*User, error)
+	// ReplacePasswordHash replaces the password hash of the user with a new
+	// hash of the same password, it keeps the version as the password did not
+	// change. It fails with ErrVersionConflict when the stored hash is no
+	// longer oldHash.
+	ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (*User, error)
+	DeleteUser(ctx context.Context, id string) (*User, error)
+	RestoreUser(ctx context.Context, id string) (*User, error)
+	PurgeUser(ctx context.Context, id string) (*User, error)
+}
+
+// notDeleted filters out soft deleted users.
+var notDeleted = bson.M{"$exists": false}
+
+// emailCollation makes email comparisons case insensitive, it must be used by
+// every query on the email field for the unique email index to be used.
+var emailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+var (
+	ErrUserNotFound    = errors.New("user does not exist")
+	ErrVersionConflict = errors.New("user has been modified since it was last read")
+	ErrEmailTaken      = errors.New("user with this email already exist")
+)
+
+// NormalizeEmail returns the form emails are stored and looked up in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 type UserRepo struct {
@@ -35,6 +71,162 @@ func NewRepository(db *mongo.Database, tracer opentracing.Tracer) *UserRepo {
 	}
 }
 
+// EnsureIndexes creates the indexes the repository relies on, it is safe to
+// call on every startup. The unique email index covers soft deleted users on
+// purpose, like the other repositories, so that restoring a user cannot clash
+// with a user created since.
+func (r *UserRepo) EnsureIndexes(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "EnsureIndexes")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	_, err := r.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true).SetCollation(emailCollation),
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Indexes.CreateOne"))
+		return err
+	}
+	return nil
+}
+
+// BackfillEmailVerified marks the users stored before email verification
+// existed as verified and returns how many it changed. Every user stored
+// since has the emailVerified field, so it is safe to call on every startup.
+func (r *UserRepo) BackfillEmailVerified(ctx context.Context) (int64, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "BackfillEmailVerified")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	result, err := r.collection.UpdateMany(ctx, bson.M{"emailVerified": bson.M{"$exists": false}}, bson.M{
+		"$set": bson.M{"emailVerified": true},
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateMany"))
+		return 0, err
+	}
+	span.SetTag("backfilled", result.ModifiedCount)
+	return result.ModifiedCount, nil
+}
+
+// EmailConflict is a set of users that were stored with the same email
+// before the unique email index existed.
+type EmailConflict struct {
+	Email string
+	// UserIDs are the ids of the users sharing the email, oldest first.
+	UserIDs []string
+}
+
+// DuplicateEmail returns the email a user sharing email with older users is
+// renamed to, it is unique as it holds the user id.
+func DuplicateEmail(email, userID string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email + "+duplicate-" + userID
+	}
+	return email[:at] + "+duplicate-" + userID + email[at:]
+}
+
+// normalizedEmail is the aggregation expression of the email of a user
+// lower-cased and trimmed, the way CreateUser stores it.
+var normalizedEmail = bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}
+
+// FindEmailConflicts returns the users stored before emails were unique that
+// share an email regardless of case, the unique email index cannot be
+// created while there are any. Users without an email are ignored.
+func (r *UserRepo) FindEmailConflicts(ctx context.Context) ([]EmailConflict, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "FindEmailConflicts")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": bson.M{"$type": "string"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "timeAdded", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": normalizedEmail, "userIds": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"userIds.1": bson.M{"$exists": true}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Aggregate"))
+		return nil, err
+	}
+	var groups []struct {
+		Email   string   `bson:"_id"`
+		UserIDs []string `bson:"userIds"`
+	}
+	err = cursor.All(ctx, &groups)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Cursor.All"))
+		return nil, err
+	}
+	conflicts := make([]EmailConflict, 0, len(groups))
+	for _, group := range groups {
+		conflicts = append(conflicts, EmailConflict{Email: group.Email, UserIDs: group.UserIDs})
+	}
+	span.SetTag("conflicts", len(conflicts))
+	return conflicts, nil
+}
+
+// ResolveEmailConflicts keeps the email of each conflict for the oldest of
+// its users and renames the others with DuplicateEmail, so that they can be
+// told apart and merged by hand. It changes user emails, so it is only run
+// when an operator asks for it, and returns the conflicts it resolved.
+func (r *UserRepo) ResolveEmailConflicts(ctx context.Context) ([]EmailConflict, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "ResolveEmailConflicts")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	conflicts, err := r.FindEmailConflicts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, conflict := range conflicts {
+		for _, userID := range conflict.UserIDs[1:] {
+			_, err = r.collection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+				"$set": bson.M{"email": DuplicateEmail(conflict.Email, userID), "lastUpdated": time.Now()},
+				"$inc": bson.M{"version": 1},
+			})
+			if err != nil {
+				ext.Error.Set(span, true)
+				span.LogFields(log.Error(err), log.Event("mongodb.UpdateOne"))
+				return nil, err
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// NormalizeEmails lower-cases and trims the emails of the users stored before
+// emails were normalized and returns how many it changed. Users without an
+// email are left alone. It is safe to call on every startup once
+// FindEmailConflicts finds none.
+func (r *UserRepo) NormalizeEmails(ctx context.Context) (int64, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "NormalizeEmails")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{
+			"email": bson.M{"$type": "string"},
+			"$expr": bson.M{"$ne": bson.A{"$email", normalizedEmail}},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"email": normalizedEmail}}}},
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.UpdateMany"))
+		return 0, err
+	}
+	span.SetTag("normalized", result.ModifiedCount)
+	return result.ModifiedCount, nil
+}
+
 func (r *UserRepo) setMongoDBSpanComponentTags(span opentracing.Span, collectionName string) {
 	ext.DBInstance.Set(span, collectionName)
 	ext.DBType.Set(span, "mongodb")
@@ -58,11 +250,16 @@ func (r *UserRepo) CreateUser(ctx context.Context, newUser *User) error {
 	r.setMongoDBSpanComponentTags(span, r.collection.Name())
 
 	newUser.ID = primitive.NewObjectID().Hex()
+	newUser.Email = NormalizeEmail(newUser.Email)
 	newUser.TimeAdded = time.Now()
 	newUser.LastUpdated = time.Now()
+	newUser.Version = 1
 	span.SetTag("param.newUser", r.toJSON(span, newUser))
 
 	_, err := r.collection.InsertOne(ctx, newUser)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrEmailTaken
+	}
 	if err != nil {
 		ext.Error.Set(span, true)
 		span.LogKV("error.object", err.Error(), "event", "mongodb.InsertOne")
@@ -71,19 +268,58 @@ func (r *UserRepo) CreateUser(ctx context.Context, newUser *User) error {
 	return nil
 }
 
-func (r *UserRepo) GetUsers(ctx context.Context, afterId string, limit int32) ([]User, error) {
+// GetUsers returns a page of the users matching the filter.
+func (r *UserRepo) GetUsers(ctx context.Context, filter GetUsersFilter) (*UsersPage, error) {
 	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUsers")
 	defer span.Finish()
 	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+	span.SetTag("param.filter", r.toJSON(span, filter))
 
-	filter := bson.M{
-		"_id": bson.M{"$gt": afterId},
+	query := bson.M{"deletedAt": notDeleted}
+	if filter.Country != "" {
+		query["country"] = filter.Country
 	}
-	findOpts := options.Find().SetLimit(int64(limit))
-	span.SetTag("param.afterId", afterId).SetTag("param.limit", limit)
-	span.SetTag("mongodb.filter", r.toJSON(span, filter))
+	timeAdded := bson.M{}
+	if !filter.CreatedAfter.IsZero() {
+		timeAdded["$gte"] = filter.CreatedAfter
+	}
+	if !filter.CreatedBefore.IsZero() {
+		timeAdded["$lt"] = filter.CreatedBefore
+	}
+	if len(timeAdded) > 0 {
+		query["timeAdded"] = timeAdded
+	}
+
+	var total int64
+	var err error
+	if filter.CountTotal {
+		total, err = r.collection.CountDocuments(ctx, query)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("mongodb.CountDocuments"))
+			return nil, err
+		}
+	}
+
+	sortBy := filter.sortField()
+	order, comparison := 1, "$gt"
+	if filter.scanDescending() {
+		order, comparison = -1, "$lt"
+	}
+	if cursor := filter.position(); cursor != nil {
+		value := cursor.value(sortBy)
+		query["$or"] = bson.A{
+			bson.M{string(sortBy): bson.M{comparison: value}},
+			bson.M{string(sortBy): value, "_id": bson.M{comparison: cursor.ID}},
+		}
+	}
+	findOpts := options.Find().SetSort(bson.D{{Key: string(sortBy), Value: order}, {Key: "_id", Value: order}})
+	if filter.Limit > 0 {
+		findOpts.SetLimit(int64(filter.Limit) + 1)
+	}
+	span.SetTag("mongodb.filter", r.toJSON(span, query))
 
-	cursor, err := r.collection.Find(ctx, filter, findOpts)
+	cursor, err := r.collection.Find(ctx, query, findOpts)
 	if err != nil {
 		ext.Error.Set(span, true)
 		span.LogKV("error.object", err.Error(), "event", "mongodb.Find")
@@ -96,7 +332,7 @@ func (r *UserRepo) GetUsers(ctx context.Context, afterId string, limit int32) ([
 		span.LogKV("error.object", err.Error(), "event", "mongodb.Cursor.All")
 		return nil, err
 	}
-	return users, nil
+	return newUsersPage(users, filter, total), nil
 }
 
 func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*User, error) {
@@ -104,10 +340,10 @@ func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*User, err
 	defer span.Finish()
 	r.setMongoDBSpanComponentTags(span, r.collection.Name())
 
-	filter := bson.M{"email": email}
+	filter := bson.M{"email": NormalizeEmail(email), "deletedAt": notDeleted}
 	span.SetTag("param.email", email).SetTag("mongodb.filter", r.toJSON(span, filter))
 	var user User
-	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	err := r.collection.FindOne(ctx, filter, options.FindOne().SetCollation(emailCollation)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -124,10 +360,13 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (*User, error) {
 	defer span.Finish()
 	r.setMongoDBSpanComponentTags(span, r.collection.Name())
 
-	filter := bson.M{"_id": id}
+	filter := bson.M{"_id": id, "deletedAt": notDeleted}
 	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
 	var user User
 	err := r.collection.FindOne(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		ext.Error.Set(span, true)
 		span.LogFields(log.Error(err), log.Event("mongodb.FindOne"))
@@ -135,3 +374,198 @@ func (r *UserRepo) GetUserByID(ctx context.Context, id string) (*User, error) {
 	}
 	return &user, nil
 }
+
+// GetUsersByIDs returns the users with the ids in a single query, in no
+// particular order. Ids without a user are ignored.
+func (r *UserRepo) GetUsersByIDs(ctx context.Context, ids []string) ([]User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUsersByIDs")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+	span.SetTag("param.ids", ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": ids}, "deletedAt": notDeleted}
+	span.SetTag("mongodb.filter", r.toJSON(span, filter))
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Find"))
+		return nil, err
+	}
+	var users []User
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.Cursor.All"))
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateUser applies a partial update to the user and returns the updated
+// user.
+func (r *UserRepo) UpdateUser(ctx context.Context, id string, update UserUpdate) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "UpdateUser")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	filter := bson.M{"_id": id, "deletedAt": notDeleted}
+	if update.ExpectedVersion != nil {
+		filter["version"] = versionFilter(*update.ExpectedVersion)
+	}
+	fields := bson.M{"lastUpdated": time.Now()}
+	if update.FullName != nil {
+		fields["fullName"] = *update.FullName
+	}
+	if update.Country != nil {
+		fields["country"] = *update.Country
+	}
+	if update.EmailVerified != nil {
+		fields["emailVerified"] = *update.EmailVerified
+	}
+	change := bson.M{"$set": fields, "$inc": bson.M{"version": 1}}
+	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
+	span.SetTag("mongodb.update", r.toJSON(span, change))
+
+	user, err := r.findOneAndUpdate(ctx, span, filter, change)
+	if err == ErrUserNotFound && update.ExpectedVersion != nil {
+		// the filter matched nothing, either the user is gone or it was
+		// modified by someone else.
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// UpdatePassword replaces the password hash of the user, the hash is kept out
+// of the traces.
+func (r *UserRepo) UpdatePassword(ctx context.Context, id, passwordHash string, expectedVersion int64) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "UpdatePassword")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	filter := bson.M{"_id": id, "deletedAt": notDeleted, "version": versionFilter(expectedVersion)}
+	change := bson.M{
+		"$set": bson.M{"password": passwordHash, "lastUpdated": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
+
+	user, err := r.findOneAndUpdate(ctx, span, filter, change)
+	if err == ErrUserNotFound {
+		// the filter matched nothing, either the user is gone or it was
+		// modified by someone else.
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// ReplacePasswordHash replaces the password hash of the user without bumping
+// its version, the hashes are kept out of the traces.
+func (r *UserRepo) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "ReplacePasswordHash")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id)
+
+	filter := bson.M{"_id": id, "deletedAt": notDeleted, "password": oldHash}
+	user, err := r.findOneAndUpdate(ctx, span, filter, bson.M{"$set": bson.M{"password": newHash}})
+	if err == ErrUserNotFound {
+		// the filter matched nothing, either the user is gone or its
+		// password was changed in the meantime.
+		if _, err := r.GetUserByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// DeleteUser soft deletes the user by setting its deletedAt timestamp.
+func (r *UserRepo) DeleteUser(ctx context.Context, id string) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "DeleteUser")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	now := time.Now()
+	filter := bson.M{"_id": id, "deletedAt": notDeleted}
+	change := bson.M{
+		"$set": bson.M{"deletedAt": now, "lastUpdated": now},
+		"$inc": bson.M{"version": 1},
+	}
+	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
+	return r.findOneAndUpdate(ctx, span, filter, change)
+}
+
+// RestoreUser reverts the soft delete of a user.
+func (r *UserRepo) RestoreUser(ctx context.Context, id string) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "RestoreUser")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	filter := bson.M{"_id": id, "deletedAt": bson.M{"$exists": true}}
+	change := bson.M{
+		"$set":   bson.M{"lastUpdated": time.Now()},
+		"$unset": bson.M{"deletedAt": ""},
+		"$inc":   bson.M{"version": 1},
+	}
+	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
+	return r.findOneAndUpdate(ctx, span, filter, change)
+}
+
+func (r *UserRepo) findOneAndUpdate(ctx context.Context, span opentracing.Span, filter, change bson.M) (*User, error) {
+	var user User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, filter, change, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndUpdate"))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PurgeUser permanently removes the user from the database whether or not it
+// has been soft deleted, the removed user is returned.
+func (r *UserRepo) PurgeUser(ctx context.Context, id string) (*User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "PurgeUser")
+	defer span.Finish()
+	r.setMongoDBSpanComponentTags(span, r.collection.Name())
+
+	filter := bson.M{"_id": id}
+	span.SetTag("param.id", id).SetTag("mongodb.filter", r.toJSON(span, filter))
+	var user User
+	err := r.collection.FindOneAndDelete(ctx, filter).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mongodb.FindOneAndDelete"))
+		return nil, err
+	}
+	return &user, nil
+}
+
+// versionFilter matches documents with the given version, users created
+// before versioning was introduced have no version field and are matched by
+// version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$exists": false}
+	}
+	return version
+}
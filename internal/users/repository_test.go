@@ -0,0 +1,96 @@
+package users
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUserRepo_BackfillEmailVerified(t *testing.T) {
+	ctx := context.Background()
+	db := storetest.Mongo(t)(t)
+	repo := NewRepository(db, &opentracing.NoopTracer{})
+
+	// a user stored before email verification existed has no emailVerified.
+	_, err := db.Collection("users").InsertOne(ctx, bson.M{"_id": "user.old", "fullName": "John Doe", "email": "john@example.com", "version": 1})
+	if err != nil {
+		t.Fatalf("inserting a user error = %v", err)
+	}
+	newUser := &User{FullName: "Jane Doe", Email: "jane@example.com"}
+	if err := repo.CreateUser(ctx, newUser); err != nil {
+		t.Fatalf("UserRepo.CreateUser() error = %v", err)
+	}
+
+	if backfilled, err := repo.BackfillEmailVerified(ctx); err != nil || backfilled != 1 {
+		t.Fatalf("UserRepo.BackfillEmailVerified() = %d, %v, want 1", backfilled, err)
+	}
+	if old, err := repo.GetUserByID(ctx, "user.old"); err != nil || !old.EmailVerified {
+		t.Errorf("UserRepo.GetUserByID() of the old user = %+v, %v, want a verified email", old, err)
+	}
+	if got, err := repo.GetUserByID(ctx, newUser.ID); err != nil || got.EmailVerified {
+		t.Errorf("UserRepo.GetUserByID() of the new user = %+v, %v, want an unverified email", got, err)
+	}
+	if backfilled, err := repo.BackfillEmailVerified(ctx); err != nil || backfilled != 0 {
+		t.Errorf("UserRepo.BackfillEmailVerified() again = %d, %v, want 0", backfilled, err)
+	}
+}
+
+func TestUserRepo_ResolveEmailConflicts(t *testing.T) {
+	ctx := context.Background()
+	db := storetest.Mongo(t)(t)
+	repo := NewRepository(db, &opentracing.NoopTracer{})
+
+	// users stored before emails were unique.
+	now := time.Now()
+	_, err := db.Collection("users").InsertMany(ctx, []interface{}{
+		bson.M{"_id": "user.first", "email": "John@Example.com", "timeAdded": now.Add(-2 * time.Hour), "version": 1},
+		bson.M{"_id": "user.second", "email": "john@example.com ", "timeAdded": now.Add(-time.Hour), "version": 1},
+		bson.M{"_id": "user.other", "email": "Jane@Example.com", "timeAdded": now, "version": 1},
+		bson.M{"_id": "user.noEmail", "timeAdded": now, "version": 1},
+	})
+	if err != nil {
+		t.Fatalf("inserting users error = %v", err)
+	}
+
+	want := []EmailConflict{{Email: "john@example.com", UserIDs: []string{"user.first", "user.second"}}}
+	conflicts, err := repo.FindEmailConflicts(ctx)
+	if err != nil || !reflect.DeepEqual(conflicts, want) {
+		t.Fatalf("UserRepo.FindEmailConflicts() = %+v, %v, want %+v", conflicts, err, want)
+	}
+	if got, err := repo.GetUserByID(ctx, "user.second"); err != nil || got.Email != "john@example.com " {
+		t.Errorf("UserRepo.GetUserByID() after finding the conflicts = %+v, %v, want the email unchanged", got, err)
+	}
+
+	conflicts, err = repo.ResolveEmailConflicts(ctx)
+	if err != nil || !reflect.DeepEqual(conflicts, want) {
+		t.Fatalf("UserRepo.ResolveEmailConflicts() = %+v, %v, want %+v", conflicts, err, want)
+	}
+	if normalized, err := repo.NormalizeEmails(ctx); err != nil || normalized != 2 {
+		t.Fatalf("UserRepo.NormalizeEmails() = %d, %v, want 2", normalized, err)
+	}
+	if err := repo.EnsureIndexes(ctx); err != nil {
+		t.Fatalf("UserRepo.EnsureIndexes() after resolving the conflicts error = %v", err)
+	}
+	for id, email := range map[string]string{
+		"user.first":  "john@example.com",
+		"user.second": DuplicateEmail("john@example.com", "user.second"),
+		"user.other":  "jane@example.com",
+	} {
+		if got, err := repo.GetUserByID(ctx, id); err != nil || got.Email != email {
+			t.Errorf("UserRepo.GetUserByID(%q) = %+v, %v, want email %q", id, got, err, email)
+		}
+	}
+	var noEmail bson.M
+	err = db.Collection("users").FindOne(ctx, bson.M{"_id": "user.noEmail"}).Decode(&noEmail)
+	if _, ok := noEmail["email"]; err != nil || ok {
+		t.Errorf("user without an email = %+v, %v, want no email field", noEmail, err)
+	}
+	if conflicts, err := repo.FindEmailConflicts(ctx); err != nil || len(conflicts) != 0 {
+		t.Errorf("UserRepo.FindEmailConflicts() after resolving them = %+v, %v, want no conflicts", conflicts, err)
+	}
+}
@@ -0,0 +1,485 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+const userColumns = "id, full_name, email, password, country, time_added, last_updated, version, deleted_at, email_verified"
+
+// SQLRepo is a Repository backed by a postgres or sqlite database.
+type SQLRepo struct {
+	db     *sqldb.DB
+	tracer opentracing.Tracer
+}
+
+// NewSQLRepository returns a new user repository object that stores users in
+// an sql database, Migrate must be called before it is used.
+func NewSQLRepository(db *sqldb.DB, tracer opentracing.Tracer) *SQLRepo {
+	return &SQLRepo{
+		db:     db,
+		tracer: tracer,
+	}
+}
+
+// Migrate creates or updates the users table, it is safe to call on every
+// startup.
+func (r *SQLRepo) Migrate(ctx context.Context) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "Migrate")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, "")
+
+	migrationsFS, _ := fs.Sub(migrations, "migrations")
+	err := sqldb.Migrate(ctx, r.db, "users", migrationsFS)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Migrate"))
+		return err
+	}
+	return nil
+}
+
+func (r *SQLRepo) setSQLSpanComponentTags(span opentracing.Span, statement string) {
+	ext.DBInstance.Set(span, "users")
+	ext.DBType.Set(span, string(r.db.Dialect))
+	ext.SpanKindRPCClient.Set(span)
+	if statement != "" {
+		ext.DBStatement.Set(span, statement)
+	}
+}
+
+// CreateUser adds a new user to the database.
+func (r *SQLRepo) CreateUser(ctx context.Context, newUser *User) error {
+	query := r.db.Rebind(`INSERT INTO users (` + userColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "CreateUser")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+
+	newUser.ID = primitive.NewObjectID().Hex()
+	newUser.Email = NormalizeEmail(newUser.Email)
+	// postgres keeps microseconds, truncating keeps the returned user equal
+	// to the stored one.
+	newUser.TimeAdded = time.Now().UTC().Truncate(time.Microsecond)
+	newUser.LastUpdated = newUser.TimeAdded
+	newUser.Version = 1
+	span.SetTag("param.newUser.id", newUser.ID).SetTag("param.newUser.email", newUser.Email)
+
+	_, err := r.db.ExecContext(ctx, query,
+		newUser.ID, newUser.FullName, newUser.Email, newUser.Password, newUser.Country,
+		newUser.TimeAdded, newUser.LastUpdated, newUser.Version, nil, newUser.EmailVerified,
+	)
+	if sqldb.IsUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return err
+	}
+	return nil
+}
+
+// sortColumns maps the sort fields to the columns holding them.
+var sortColumns = map[SortField]string{
+	SortByTimeAdded: "time_added",
+	SortByFullName:  "full_name",
+	SortByEmail:     "email",
+}
+
+// GetUsers returns a page of the users matching the filter.
+func (r *SQLRepo) GetUsers(ctx context.Context, filter GetUsersFilter) (*UsersPage, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUsers")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, "")
+	span.SetTag("param.filter", filter)
+
+	conditions := []string{"deleted_at IS NULL"}
+	var args []interface{}
+	if filter.Country != "" {
+		conditions = append(conditions, "country = ?")
+		args = append(args, filter.Country)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "time_added >= ?")
+		args = append(args, filter.CreatedAfter.UTC())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "time_added < ?")
+		args = append(args, filter.CreatedBefore.UTC())
+	}
+
+	var total int64
+	if filter.CountTotal {
+		query := r.db.Rebind(`SELECT COUNT(*) FROM users WHERE ` + strings.Join(conditions, " AND "))
+		err := r.db.QueryRowContext(ctx, query, args...).Scan(&total)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.QueryRow"), log.String("db.statement", query))
+			return nil, err
+		}
+	}
+
+	sortBy := filter.sortField()
+	column, id := r.binaryCollation(sortColumns[sortBy]), r.binaryCollation("id")
+	order, comparison := "ASC", ">"
+	if filter.scanDescending() {
+		order, comparison = "DESC", "<"
+	}
+	if cursor := filter.position(); cursor != nil {
+		value := cursor.value(sortBy)
+		if timeAdded, ok := value.(time.Time); ok {
+			value = timeAdded.UTC()
+		}
+		conditions = append(conditions, "("+column+" "+comparison+" ? OR ("+column+" = ? AND "+id+" "+comparison+" ?))")
+		args = append(args, value, value, cursor.ID)
+	}
+	query := `SELECT ` + userColumns + ` FROM users WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY ` + column + ` ` + order + `, ` + id + ` ` + order
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit+1)
+	}
+	query = r.db.Rebind(query)
+	ext.DBStatement.Set(span, query)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Next"))
+		return nil, err
+	}
+	return newUsersPage(users, filter, total), nil
+}
+
+// binaryCollation makes the text column compare byte by byte, like mongodb
+// and go do, whatever the collation of the database is.
+func (r *SQLRepo) binaryCollation(column string) string {
+	if r.db.Dialect == sqldb.Postgres {
+		return column + ` COLLATE "C"`
+	}
+	return column
+}
+
+func (r *SQLRepo) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := r.db.Rebind(`SELECT ` + userColumns + ` FROM users WHERE lower(email) = ? AND deleted_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUserByEmail")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.email", email)
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, NormalizeEmail(email)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *SQLRepo) GetUserByID(ctx context.Context, id string) (*User, error) {
+	query := r.db.Rebind(`SELECT ` + userColumns + ` FROM users WHERE id = ? AND deleted_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUserByID")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsersByIDs returns the users with the ids in a single query, in no
+// particular order. Ids without a user are ignored.
+func (r *SQLRepo) GetUsersByIDs(ctx context.Context, ids []string) ([]User, error) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	query := r.db.Rebind(`SELECT ` + userColumns + ` FROM users WHERE id IN (` + strings.Join(placeholders, ", ") + `) AND deleted_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "GetUsersByIDs")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.ids", ids)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Query"))
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("sql.Rows.Scan"))
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	err = rows.Err()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Rows.Next"))
+		return nil, err
+	}
+	return users, nil
+}
+
+// UpdateUser applies a partial update to the user and returns the updated
+// user.
+func (r *SQLRepo) UpdateUser(ctx context.Context, id string, update UserUpdate) (*User, error) {
+	sets := []string{"last_updated = ?", "version = version + 1"}
+	args := []interface{}{time.Now().UTC()}
+	if update.FullName != nil {
+		sets = append(sets, "full_name = ?")
+		args = append(args, *update.FullName)
+	}
+	if update.Country != nil {
+		sets = append(sets, "country = ?")
+		args = append(args, *update.Country)
+	}
+	if update.EmailVerified != nil {
+		sets = append(sets, "email_verified = ?")
+		args = append(args, *update.EmailVerified)
+	}
+	query := `UPDATE users SET ` + strings.Join(sets, ", ") + ` WHERE id = ? AND deleted_at IS NULL`
+	args = append(args, id)
+	if update.ExpectedVersion != nil {
+		query += ` AND version = ?`
+		args = append(args, *update.ExpectedVersion)
+	}
+	query = r.db.Rebind(query)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "UpdateUser")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	user, err := r.updateAndGet(ctx, span, id, `deleted_at IS NULL`, query, args...)
+	if err == ErrUserNotFound && update.ExpectedVersion != nil {
+		// the update matched nothing, either the user is gone or it was
+		// modified by someone else.
+		if _, err := r.GetUserByID(opentracing.ContextWithSpan(ctx, span), id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// UpdatePassword replaces the password hash of the user, the hash is kept out
+// of the traces.
+func (r *SQLRepo) UpdatePassword(ctx context.Context, id, passwordHash string, expectedVersion int64) (*User, error) {
+	query := r.db.Rebind(`UPDATE users SET password = ?, last_updated = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND version = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "UpdatePassword")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id).SetTag("param.expectedVersion", expectedVersion)
+
+	user, err := r.updateAndGet(ctx, span, id, `deleted_at IS NULL`, query, passwordHash, time.Now().UTC(), id, expectedVersion)
+	if err == ErrUserNotFound {
+		// the update matched nothing, either the user is gone or it was
+		// modified by someone else.
+		if _, err := r.GetUserByID(opentracing.ContextWithSpan(ctx, span), id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// ReplacePasswordHash replaces the password hash of the user without bumping
+// its version, the hashes are kept out of the traces.
+func (r *SQLRepo) ReplacePasswordHash(ctx context.Context, id, oldHash, newHash string) (*User, error) {
+	query := r.db.Rebind(`UPDATE users SET password = ? WHERE id = ? AND deleted_at IS NULL AND password = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "ReplacePasswordHash")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	user, err := r.updateAndGet(ctx, span, id, `deleted_at IS NULL`, query, newHash, id, oldHash)
+	if err == ErrUserNotFound {
+		// the update matched nothing, either the user is gone or its
+		// password was changed in the meantime.
+		if _, err := r.GetUserByID(opentracing.ContextWithSpan(ctx, span), id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+	return user, err
+}
+
+// DeleteUser soft deletes the user by setting its deleted_at timestamp.
+func (r *SQLRepo) DeleteUser(ctx context.Context, id string) (*User, error) {
+	query := r.db.Rebind(`UPDATE users SET deleted_at = ?, last_updated = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "DeleteUser")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	now := time.Now().UTC()
+	return r.updateAndGet(ctx, span, id, `deleted_at IS NOT NULL`, query, now, now, id)
+}
+
+// RestoreUser reverts the soft delete of a user.
+func (r *SQLRepo) RestoreUser(ctx context.Context, id string) (*User, error) {
+	query := r.db.Rebind(`UPDATE users SET deleted_at = NULL, last_updated = ?, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "RestoreUser")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	return r.updateAndGet(ctx, span, id, `deleted_at IS NULL`, query, time.Now().UTC(), id)
+}
+
+// updateAndGet runs the update statement and reads the updated user back in
+// the same transaction, the user is read with the condition it satisfies
+// after the update. ErrUserNotFound is returned when no row was updated.
+func (r *SQLRepo) updateAndGet(ctx context.Context, span opentracing.Span, id, condition, query string, args ...interface{}) (*User, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Result.RowsAffected"))
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, ErrUserNotFound
+	}
+	selectQuery := r.db.Rebind(`SELECT ` + userColumns + ` FROM users WHERE id = ? AND ` + condition)
+	user, err := scanUser(tx.QueryRowContext(ctx, selectQuery, id))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeUser permanently removes the user from the database whether or not it
+// has been soft deleted, the removed user is returned.
+func (r *SQLRepo) PurgeUser(ctx context.Context, id string) (*User, error) {
+	query := r.db.Rebind(`DELETE FROM users WHERE id = ?`)
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, r.tracer, "PurgeUser")
+	defer span.Finish()
+	r.setSQLSpanComponentTags(span, query)
+	span.SetTag("param.id", id)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.BeginTx"))
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRowContext(ctx, r.db.Rebind(`SELECT `+userColumns+` FROM users WHERE id = ?`), id))
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.QueryRow"))
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Exec"))
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("sql.Tx.Commit"))
+		return nil, err
+	}
+	return user, nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser reads a user selected with userColumns.
+func scanUser(row rowScanner) (*User, error) {
+	var user User
+	var deletedAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.FullName, &user.Email, &user.Password, &user.Country,
+		&user.TimeAdded, &user.LastUpdated, &user.Version, &deletedAt, &user.EmailVerified,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return &user, nil
+}
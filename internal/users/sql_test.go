@@ -0,0 +1,67 @@
+package users
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/storetest"
+)
+
+func TestSQLRepo_Migrate_EmailVerified(t *testing.T) {
+	ctx := context.Background()
+	db := storetest.SQLite(t)
+	createUsers, _ := migrations.ReadFile("migrations/sqlite3/0001_create_users.sql")
+	err := sqldb.Migrate(ctx, db, "users", fstest.MapFS{"sqlite3/0001_create_users.sql": {Data: createUsers}})
+	if err != nil {
+		t.Fatalf("sqldb.Migrate() error = %v", err)
+	}
+	now := time.Now().UTC()
+	_, err = db.Exec(`INSERT INTO users (id, full_name, email, time_added, last_updated) VALUES ('user.old', 'John Doe', 'john@example.com', ?, ?)`, now, now)
+	if err != nil {
+		t.Fatalf("inserting a user error = %v", err)
+	}
+
+	// users stored before email verification existed are verified, new
+	// users are not.
+	repo := newMigratedSQLRepo(t, db)
+	if old, err := repo.GetUserByID(ctx, "user.old"); err != nil || !old.EmailVerified {
+		t.Errorf("SQLRepo.GetUserByID() of a user stored before the migration = %+v, %v, want a verified email", old, err)
+	}
+	newUser := &User{FullName: "Jane Doe", Email: "jane@example.com"}
+	if err := repo.CreateUser(ctx, newUser); err != nil {
+		t.Fatalf("SQLRepo.CreateUser() error = %v", err)
+	}
+	if got, err := repo.GetUserByID(ctx, newUser.ID); err != nil || got.EmailVerified {
+		t.Errorf("SQLRepo.GetUserByID() of a new user = %+v, %v, want an unverified email", got, err)
+	}
+}
+
+func TestSQLRepo_Migrate_LowercaseEmails(t *testing.T) {
+	ctx := context.Background()
+	db := storetest.SQLite(t)
+	createUsers, _ := migrations.ReadFile("migrations/sqlite3/0001_create_users.sql")
+	err := sqldb.Migrate(ctx, db, "users", fstest.MapFS{"sqlite3/0001_create_users.sql": {Data: createUsers}})
+	if err != nil {
+		t.Fatalf("sqldb.Migrate() error = %v", err)
+	}
+	now := time.Now().UTC()
+	_, err = db.Exec(`INSERT INTO users (id, full_name, email, time_added, last_updated) VALUES ('user.imported', 'John Doe', 'John@Example.com', ?, ?)`, now, now)
+	if err != nil {
+		t.Fatalf("inserting a user error = %v", err)
+	}
+
+	repo := newMigratedSQLRepo(t, db)
+	if got, err := repo.GetUserByID(ctx, "user.imported"); err != nil || got.Email != "john@example.com" {
+		t.Errorf("SQLRepo.GetUserByID() of a user imported with a mixed case email = %+v, %v, want john@example.com", got, err)
+	}
+}
+
+func newMigratedSQLRepo(t *testing.T, db *sqldb.DB) *SQLRepo {
+	repo := NewSQLRepository(db, &opentracing.NoopTracer{})
+	storetest.Prepare(t, repo.Migrate)
+	return repo
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"flag"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,6 +21,17 @@ import (
 	"github.com/uber/jaeger-client-go/config"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/grpc/proto"
 	servers "github.com/wisdommatt/ecommerce-microservice-user-service/grpc/service-servers"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/lockout"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/passwords"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sqldb"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/usercache"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/services"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -29,7 +45,13 @@ func main() {
 	log.SetReportCaller(true)
 	log.SetOutput(os.Stdout)
 
+	resolveEmailConflicts := flag.Bool("resolve-email-conflicts", false, "rename the mongodb users sharing an email with an older user, then exit")
+	flag.Parse()
 	mustLoadDotenv(log)
+	if *resolveEmailConflicts {
+		mustResolveEmailConflicts(log)
+		return
+	}
 
 	natsConn, err := nats.Connect(os.Getenv("NATS_URI"))
 	if err != nil {
@@ -38,7 +60,8 @@ func main() {
 	}
 	defer natsConn.Close()
 
-	serviceTracer := initTracer("user-service")
+	serviceTracer, serviceTracerCloser := initTracer("user-service")
+	defer serviceTracerCloser.Close()
 	opentracing.SetGlobalTracer(serviceTracer)
 
 	port := os.Getenv("PORT")
@@ -49,19 +72,397 @@ func main() {
 	if err != nil {
 		log.WithError(err).Fatal("TCP conn error")
 	}
-	mongoDBClient := mustConnectMongoDB(log)
-	userRepository := users.NewRepository(mongoDBClient, initTracer("mongodb"))
-	userService := services.NewUserService(userRepository, initTracer("user.ServiceHandler"), natsConn)
+	store := mustInitStorage(log)
+	defer store.Close()
+	cacheTracer, cacheTracerCloser := initTracer("user.Cache")
+	defer cacheTracerCloser.Close()
+	cachedUserRepository := usercache.NewRepository(store.users, cacheTracer, usercache.Options{
+		Size: envInt(log, "USER_CACHE_SIZE"),
+		TTL:  envDuration(log, "USER_CACHE_TTL"),
+	})
+	if natsConn != nil {
+		err = cachedUserRepository.SubscribeInvalidations(natsConn)
+		if err != nil {
+			log.WithError(err).Error("an error occured while subscribing to user change events")
+		}
+	}
+	searchIndex := search.NewIndex()
+	userRepository := search.NewRepository(cachedUserRepository, searchIndex)
+	if natsConn != nil {
+		searchTracer, searchTracerCloser := initTracer("user.SearchIndex")
+		defer searchTracerCloser.Close()
+		err = search.NewSubscriber(searchIndex, store.users, searchTracer).Subscribe(natsConn)
+		if err != nil {
+			log.WithError(err).Error("an error occured while subscribing the search index to user change events")
+		}
+	}
+	go rebuildSearchIndex(log, searchIndex, userRepository)
+	tokenKeys := mustLoadTokenKeys(log)
+	handlerTracer, handlerTracerCloser := initTracer("user.ServiceHandler")
+	defer handlerTracerCloser.Close()
+	userService := services.NewUserService(
+		userRepository, handlerTracer, natsConn,
+		services.WithPageTokenSecret(mustSecret(log, "PAGE_TOKEN_SECRET")),
+		services.WithSearchIndex(searchIndex),
+		services.WithSessionStore(store.sessions),
+		services.WithTokenLifetimes(envDuration(log, "ACCESS_TOKEN_TTL"), envDuration(log, "REFRESH_TOKEN_TTL")),
+		services.WithTokenIssuer(tokenKeys),
+		services.WithTokenVerifier(tokenKeys),
+		services.WithTokenClaims(os.Getenv("JWT_ISSUER"), envList("JWT_AUDIENCE"), envDuration(log, "JWT_LEEWAY")),
+		services.WithOneTimeTokenStore(store.oneTimeTokens),
+		services.WithPasswordReset(os.Getenv("PASSWORD_RESET_URL"), envDuration(log, "PASSWORD_RESET_TTL")),
+		services.WithMagicLink(os.Getenv("MAGIC_LINK_URL"), envDuration(log, "MAGIC_LINK_TTL")),
+		services.WithEmailVerification(os.Getenv("EMAIL_VERIFICATION_URL"), envDuration(log, "EMAIL_VERIFICATION_TTL")),
+		services.WithEmailTokenSecret(mustSecret(log, "EMAIL_TOKEN_SECRET")),
+		services.WithUnverifiedLoginPolicy(mustUnverifiedLoginPolicy(log)),
+		services.WithPasswordPolicy(mustLoadPasswordPolicy(log)),
+		services.WithPasswordHasher(mustPasswordHasher(log)),
+		services.WithLoginThrottling(store.loginAttempts, loginPolicy(log, "LOGIN_EMAIL", lockout.DefaultEmailPolicy), loginPolicy(log, "LOGIN_IP", lockout.DefaultIPPolicy)),
+		services.WithTOTP(store.totp, os.Getenv("TOTP_ISSUER")),
+		services.WithOIDC(store.identities, mustLoadOIDCProviders(log)),
+		services.WithServiceAccounts(apikeys.NewCachedStore(store.serviceAccounts, envDuration(log, "API_KEY_CACHE_TTL"))),
+	)
+	if apiKey := os.Getenv("BOOTSTRAP_ADMIN_API_KEY"); apiKey != "" {
+		key, err := userService.BootstrapAdminKey(context.Background(), apiKey)
+		if err != nil {
+			log.WithError(err).Fatal("an error occured while storing the bootstrap admin api key")
+		}
+		log.WithField("keyId", key.ID).Info("Bootstrap admin api key is stored, revoke it once other admin keys are issued")
+	}
 
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(otgrpc.OpenTracingServerInterceptor(serviceTracer)),
+		grpc.ChainUnaryInterceptor(
+			otgrpc.OpenTracingServerInterceptor(serviceTracer),
+			servers.AuthInterceptor(userService, mustAnonymousScopes(log)...),
+		),
 		grpc.StreamInterceptor(otgrpc.OpenTracingStreamServerInterceptor(serviceTracer)),
 	)
 	proto.RegisterUserServiceServer(grpcServer, servers.NewUserServiceServer(userService))
+	go serveJWKS(log, tokenKeys)
 	log.WithField("nats_uri", os.Getenv("NATS_URI")).Info("Server running on port: ", port)
 	grpcServer.Serve(lis)
 }
 
+// rebuildSearchIndex fills the search index with the users of the repository
+// and rebuilds it every SEARCH_REBUILD_INTERVAL to pick up the writes of
+// other replicas whose events were missed.
+func rebuildSearchIndex(log *logrus.Logger, index *search.Index, userRepository users.Repository) {
+	interval := envDuration(log, "SEARCH_REBUILD_INTERVAL")
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for {
+		start := time.Now()
+		err := index.Rebuild(context.Background(), userRepository)
+		if err != nil {
+			log.WithError(err).Error("an error occured while rebuilding the search index")
+		} else {
+			log.WithField("users", index.Len()).WithField("duration", time.Since(start).String()).
+				Info("Search index rebuilt")
+		}
+		time.Sleep(interval)
+	}
+}
+
+// envInt returns the integer in the env variable, or 0 when it is unset or
+// invalid.
+func envInt(log *logrus.Logger, key string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.WithField(key, value).WithError(err).Warn("invalid integer, using the default value")
+	}
+	return n
+}
+
+// envDuration returns the duration in the env variable, or 0 when it is unset
+// or invalid.
+func envDuration(log *logrus.Logger, key string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.WithField(key, value).WithError(err).Warn("invalid duration, using the default value")
+	}
+	return d
+}
+
+// envList returns the comma separated values of the env variable.
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// mustLoadTokenKeys returns the key ring signing access tokens with the PEM
+// key at JWT_SIGNING_KEY, the keys at JWT_VERIFICATION_KEYS only verify
+// tokens. Tokens are signed with HS256 and JWT_SECRET_KEY when there is no
+// signing key.
+func mustLoadTokenKeys(log *logrus.Logger) *keyring.Ring {
+	signingKeyPath := os.Getenv("JWT_SIGNING_KEY")
+	if signingKeyPath == "" {
+		log.Warn("JWT_SIGNING_KEY is not set, access tokens are signed with JWT_SECRET_KEY")
+		ring, err := keyring.New(keyring.NewHMACKey("", []byte(os.Getenv("JWT_SECRET_KEY"))))
+		if err != nil {
+			log.WithError(err).Fatal("Unable to create the token key ring")
+		}
+		return ring
+	}
+	signingKey, err := keyring.LoadPEMFile(signingKeyPath)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to load the token signing key")
+	}
+	var verificationKeys []*keyring.Key
+	for _, path := range envList("JWT_VERIFICATION_KEYS") {
+		key, err := keyring.LoadPEMFile(path)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to load a token verification key")
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+	ring, err := keyring.New(signingKey, verificationKeys...)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to create the token key ring")
+	}
+	log.WithField("kid", signingKey.ID).WithField("alg", signingKey.Algorithm()).Info("Loaded the token signing key")
+	return ring
+}
+
+// serveJWKS serves the public keys verifying access tokens over http on
+// JWKS_PORT, for the services that cannot call GetJWKS.
+func serveJWKS(log *logrus.Logger, tokenKeys *keyring.Ring) {
+	port := os.Getenv("JWKS_PORT")
+	if port == "" {
+		port = "2021"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/jwks.json", tokenKeys.JWKSHandler())
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Info("JWKS served on port: ", port)
+	err := server.ListenAndServe()
+	if err != nil {
+		log.WithError(err).Error("an error occured while serving the jwks")
+	}
+}
+
+// mustUnverifiedLoginPolicy returns the UNVERIFIED_LOGIN policy, unverified
+// users are allowed to log in by default.
+func mustUnverifiedLoginPolicy(log *logrus.Logger) services.UnverifiedLoginPolicy {
+	policy := services.UnverifiedLoginPolicy(os.Getenv("UNVERIFIED_LOGIN"))
+	if policy == "" {
+		return services.UnverifiedLoginAllow
+	}
+	if !policy.Valid() {
+		log.WithField("UNVERIFIED_LOGIN", policy).Fatal("Unknown unverified login policy, use allow, limit or block")
+	}
+	return policy
+}
+
+// mustAnonymousScopes returns the scopes requests without an API key are
+// given, per ANONYMOUS_ACCESS. They are denied every scope by default, read
+// lets them read users while callers move to API keys.
+func mustAnonymousScopes(log *logrus.Logger) []string {
+	switch os.Getenv("ANONYMOUS_ACCESS") {
+	case "", "deny":
+		return nil
+	case "read":
+		return []string{apikeys.ScopeUsersRead}
+	}
+	log.WithField("ANONYMOUS_ACCESS", os.Getenv("ANONYMOUS_ACCESS")).Fatal("Unknown anonymous access, use deny or read")
+	return nil
+}
+
+// mustLoadPasswordPolicy returns the password policy of PASSWORD_MIN_LENGTH
+// and PASSWORD_MAX_BYTES, passwords are also checked against the breached
+// passwords of BREACHED_PASSWORDS_FILE when it is set.
+func mustLoadPasswordPolicy(log *logrus.Logger) passwords.Policy {
+	policy := passwords.DefaultPolicy()
+	if minLength := envInt(log, "PASSWORD_MIN_LENGTH"); minLength > 0 {
+		policy.MinLength = minLength
+	}
+	if maxBytes := envInt(log, "PASSWORD_MAX_BYTES"); maxBytes > 0 {
+		if maxBytes > passwords.MaxBcryptBytes {
+			log.WithField("PASSWORD_MAX_BYTES", maxBytes).Fatal("Passwords longer than 72 bytes are truncated by bcrypt")
+		}
+		policy.MaxBytes = maxBytes
+	}
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		return policy
+	}
+	start := time.Now()
+	breached, err := passwords.LoadBreachedPasswords(path, 0.001)
+	if err != nil {
+		log.WithError(err).Fatal("an error occured while loading the breached passwords")
+	}
+	log.WithField("file", path).WithField("duration", time.Since(start).String()).Info("Breached passwords loaded")
+	policy.Breached = breached
+	return policy
+}
+
+// mustPasswordHasher returns the hasher of the PASSWORD_HASH_ALGORITHM, with
+// the parameters of the BCRYPT_COST and ARGON2_* env variables and the
+// PASSWORD_PEPPER. Unset parameters keep their default.
+func mustPasswordHasher(log *logrus.Logger) *passwords.Hasher {
+	hasher := passwords.DefaultHasher()
+	if algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm != "" {
+		hasher.Algorithm = passwords.Algorithm(algorithm)
+	}
+	if hasher.Algorithm != passwords.Bcrypt && hasher.Algorithm != passwords.Argon2id {
+		log.WithField("PASSWORD_HASH_ALGORITHM", hasher.Algorithm).Fatal("Unknown password hash algorithm, use bcrypt or argon2id")
+	}
+	if cost := envInt(log, "BCRYPT_COST"); cost > 0 {
+		hasher.BcryptCost = cost
+	}
+	if memory := envInt(log, "ARGON2_MEMORY_KIB"); memory > 0 {
+		hasher.Argon2id.Memory = uint32(memory)
+	}
+	if iterations := envInt(log, "ARGON2_ITERATIONS"); iterations > 0 {
+		hasher.Argon2id.Iterations = uint32(iterations)
+	}
+	if parallelism := envInt(log, "ARGON2_PARALLELISM"); parallelism > 0 && parallelism < 256 {
+		hasher.Argon2id.Parallelism = uint8(parallelism)
+	}
+	hasher.Pepper = []byte(os.Getenv("PASSWORD_PEPPER"))
+	return hasher
+}
+
+// loginPolicy returns policy with the limits set by the env variables of the
+// prefix: _FREE_FAILURES, _LOCKOUT_FAILURES and _LOCKOUT_DURATION.
+func loginPolicy(log *logrus.Logger, prefix string, policy lockout.Policy) lockout.Policy {
+	if freeFailures := envInt(log, prefix+"_FREE_FAILURES"); freeFailures > 0 {
+		policy.FreeFailures = freeFailures
+	}
+	if lockoutFailures := envInt(log, prefix+"_LOCKOUT_FAILURES"); lockoutFailures > 0 {
+		policy.LockoutFailures = lockoutFailures
+	}
+	if lockoutDuration := envDuration(log, prefix+"_LOCKOUT_DURATION"); lockoutDuration > 0 {
+		policy.LockoutDuration = lockoutDuration
+	}
+	return policy
+}
+
+// mustLoadOIDCProviders returns the verifiers of the OpenID Connect providers
+// named in OIDC_PROVIDERS, each configured by the env variables of its upper
+// cased name: OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_IDS and the optional
+// OIDC_<NAME>_JWKS_URL.
+func mustLoadOIDCProviders(log *logrus.Logger) map[string]services.IDTokenVerifier {
+	verifiers := map[string]services.IDTokenVerifier{}
+	for _, name := range envList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(name)
+		provider := oidc.Provider{
+			Name:      name,
+			Issuer:    os.Getenv(prefix + "_ISSUER"),
+			ClientIDs: envList(prefix + "_CLIENT_IDS"),
+			JWKSURL:   os.Getenv(prefix + "_JWKS_URL"),
+		}
+		if provider.Issuer == "" || len(provider.ClientIDs) == 0 {
+			log.WithField("provider", name).Fatal(prefix + "_ISSUER and " + prefix + "_CLIENT_IDS are required")
+		}
+		verifiers[name] = oidc.NewVerifier(provider, nil)
+	}
+	return verifiers
+}
+
+// storage holds the repositories of the configured storage.
+type storage struct {
+	users         users.Repository
+	sessions      sessions.Store
+	oneTimeTokens onetime.Store
+	loginAttempts lockout.Store
+	totp          mfa.Store
+	identities    oidc.IdentityStore
+
+	serviceAccounts apikeys.Store
+	// tracerCloser flushes the spans of the storage tracer shared by the
+	// repositories, it is nil for memory storage.
+	tracerCloser io.Closer
+}
+
+// Close flushes the spans of the storage tracer.
+func (s storage) Close() error {
+	if s.tracerCloser == nil {
+		return nil
+	}
+	return s.tracerCloser.Close()
+}
+
+// mustInitStorage returns the repositories for the STORAGE env variable, data
+// is stored in mongodb by default.
+func mustInitStorage(log *logrus.Logger) storage {
+	switch os.Getenv("STORAGE") {
+	case "memory":
+		log.Warn("Users are stored in memory and will be lost when the server stops")
+		return storage{
+			users:         users.NewMemoryRepository(),
+			sessions:      sessions.NewMemoryStore(),
+			oneTimeTokens: onetime.NewMemoryStore(),
+			loginAttempts: lockout.NewMemoryStore(),
+			totp:          mfa.NewMemoryStore(),
+			identities:    oidc.NewMemoryStore(),
+
+			serviceAccounts: apikeys.NewMemoryStore(),
+		}
+	case "postgres":
+		return mustInitSQLStorage(log, sqldb.Postgres)
+	case "sqlite":
+		return mustInitSQLStorage(log, sqldb.SQLite)
+	case "", "mongodb":
+		mongoDBClient := mustConnectMongoDB(log)
+		tracer, tracerCloser := initTracer("mongodb")
+		userRepository := users.NewRepository(mongoDBClient, tracer)
+		sessionStore := sessions.NewMongoStore(mongoDBClient, tracer)
+		oneTimeTokenStore := onetime.NewMongoStore(mongoDBClient, tracer)
+		loginAttemptStore := lockout.NewMongoStore(mongoDBClient, tracer)
+		identityStore := oidc.NewMongoStore(mongoDBClient, tracer)
+		serviceAccountStore := apikeys.NewMongoStore(mongoDBClient, tracer)
+		mustNormalizeEmails(log, userRepository)
+		mustEnsureIndexes(log, userRepository, sessionStore, oneTimeTokenStore, loginAttemptStore, identityStore, serviceAccountStore)
+		mustBackfillEmailVerified(log, userRepository)
+		totpStore := mfa.NewMongoStore(mongoDBClient, tracer)
+		return storage{users: userRepository, sessions: sessionStore, oneTimeTokens: oneTimeTokenStore, loginAttempts: loginAttemptStore, totp: totpStore, identities: identityStore, serviceAccounts: serviceAccountStore, tracerCloser: tracerCloser}
+	}
+	log.WithField("storage", os.Getenv("STORAGE")).Fatal("Unknown storage, use mongodb, postgres, sqlite or memory")
+	return storage{}
+}
+
+func mustInitSQLStorage(log *logrus.Logger, dialect sqldb.Dialect) storage {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db, err := sqldb.Open(ctx, dialect, os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.WithError(err).WithField("dialect", dialect).Fatal("Unable to connect to sql database")
+	}
+	tracer, tracerCloser := initTracer(string(dialect))
+	userRepository := users.NewSQLRepository(db, tracer)
+	sessionStore := sessions.NewSQLStore(db, tracer)
+	oneTimeTokenStore := onetime.NewSQLStore(db, tracer)
+	loginAttemptStore := lockout.NewSQLStore(db, tracer)
+	totpStore := mfa.NewSQLStore(db, tracer)
+	identityStore := oidc.NewSQLStore(db, tracer)
+	serviceAccountStore := apikeys.NewSQLStore(db, tracer)
+	for _, migrator := range []interface{ Migrate(context.Context) error }{userRepository, sessionStore, oneTimeTokenStore, loginAttemptStore, totpStore, identityStore, serviceAccountStore} {
+		err = migrator.Migrate(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to migrate sql database")
+		}
+	}
+	return storage{users: userRepository, sessions: sessionStore, oneTimeTokens: oneTimeTokenStore, loginAttempts: loginAttemptStore, totp: totpStore, identities: identityStore, serviceAccounts: serviceAccountStore, tracerCloser: tracerCloser}
+}
+
 func mustConnectMongoDB(log *logrus.Logger) *mongo.Database {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -72,6 +473,91 @@ func mustConnectMongoDB(log *logrus.Logger) *mongo.Database {
 	return client.Database(os.Getenv("MONGODB_DATABASE_NAME"))
 }
 
+func mustEnsureIndexes(log *logrus.Logger, collections ...interface{ EnsureIndexes(context.Context) error }) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, collection := range collections {
+		err := collection.EnsureIndexes(ctx)
+		if err != nil {
+			log.WithError(err).Fatal("Unable to create mongodb indexes")
+		}
+	}
+}
+
+// mustNormalizeEmails lower-cases the emails of the mongodb users so that the
+// unique email index can be created. It refuses to start while users share an
+// email, listing them for an operator to run the service once with
+// -resolve-email-conflicts or to merge them by hand.
+func mustNormalizeEmails(log *logrus.Logger, userRepository *users.UserRepo) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conflicts, err := userRepository.FindEmailConflicts(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to look for users sharing an email")
+	}
+	if len(conflicts) > 0 {
+		log.WithField("conflicts", conflicts).
+			Fatal("Users share an email, merge them or run the service once with -resolve-email-conflicts to rename all but the oldest")
+	}
+	normalized, err := userRepository.NormalizeEmails(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to normalize the emails of users")
+	}
+	if normalized > 0 {
+		log.WithField("users", normalized).Info("Lower-cased the emails of users")
+	}
+}
+
+// mustResolveEmailConflicts renames the mongodb users sharing an email with
+// an older user, and logs each conflict for the users to be merged by hand.
+// It runs when the service is started with -resolve-email-conflicts.
+func mustResolveEmailConflicts(log *logrus.Logger) {
+	if storage := os.Getenv("STORAGE"); storage != "" && storage != "mongodb" {
+		log.WithField("storage", storage).Fatal("-resolve-email-conflicts only applies to mongodb storage")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	tracer, tracerCloser := initTracer("mongodb")
+	defer tracerCloser.Close()
+	userRepository := users.NewRepository(mustConnectMongoDB(log), tracer)
+	conflicts, err := userRepository.ResolveEmailConflicts(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to resolve users sharing an email")
+	}
+	for _, conflict := range conflicts {
+		log.WithField("email", conflict.Email).
+			WithField("keptUserId", conflict.UserIDs[0]).
+			WithField("renamedUserIds", conflict.UserIDs[1:]).
+			Warn("Users shared an email, the oldest keeps it and the others were renamed")
+	}
+	log.WithField("conflicts", len(conflicts)).Info("Resolved users sharing an email")
+}
+
+// mustBackfillEmailVerified marks the mongodb users stored before email
+// verification existed as verified.
+func mustBackfillEmailVerified(log *logrus.Logger, userRepository *users.UserRepo) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	backfilled, err := userRepository.BackfillEmailVerified(ctx)
+	if err != nil {
+		log.WithError(err).Fatal("Unable to backfill the emailVerified field of users")
+	}
+	if backfilled > 0 {
+		log.WithField("users", backfilled).Info("Marked users stored before email verification as verified")
+	}
+}
+
+// mustSecret returns the secret in the env variable name. Replicas must share
+// it, so the service refuses to start without it rather than using a random
+// secret only this replica knows.
+func mustSecret(log *logrus.Logger, name string) []byte {
+	secret := os.Getenv(name)
+	if secret == "" {
+		log.WithField("variable", name).Fatal("Secret is not set, generate one with make secret")
+	}
+	return []byte(secret)
+}
+
 func mustLoadDotenv(log *logrus.Logger) {
 	err := godotenv.Load(".env", ".env-defaults")
 	if err != nil {
@@ -79,11 +565,13 @@ func mustLoadDotenv(log *logrus.Logger) {
 	}
 }
 
-func initTracer(serviceName string) opentracing.Tracer {
+// initTracer returns the tracer of serviceName and the closer flushing its
+// spans, which must be closed before the process exits.
+func initTracer(serviceName string) (opentracing.Tracer, io.Closer) {
 	return initJaegerTracer(serviceName)
 }
 
-func initJaegerTracer(serviceName string) opentracing.Tracer {
+func initJaegerTracer(serviceName string) (opentracing.Tracer, io.Closer) {
 	cfg := &config.Configuration{
 		ServiceName: serviceName,
 		Sampler: &config.SamplerConfig{
@@ -91,9 +579,9 @@ func initJaegerTracer(serviceName string) opentracing.Tracer {
 			Param: 1,
 		},
 	}
-	tracer, _, err := cfg.NewTracer(config.Logger(jaeger.StdLogger))
+	tracer, closer, err := cfg.NewTracer(config.Logger(jaeger.StdLogger))
 	if err != nil {
 		log.Fatal("ERROR: cannot init Jaeger", err)
 	}
-	return tracer
+	return tracer, closer
 }
@@ -0,0 +1,38 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+	oidc "github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+)
+
+// IDTokenVerifier is an autogenerated mock type for the IDTokenVerifier type
+type IDTokenVerifier struct {
+	mock.Mock
+}
+
+// Verify provides a mock function with given fields: ctx, idToken, nonce
+func (_m *IDTokenVerifier) Verify(ctx context.Context, idToken string, nonce string) (*oidc.Claims, error) {
+	ret := _m.Called(ctx, idToken, nonce)
+
+	var r0 *oidc.Claims
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *oidc.Claims); ok {
+		r0 = rf(ctx, idToken, nonce)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oidc.Claims)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, idToken, nonce)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,89 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+	oidc "github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+)
+
+// IdentityStore is an autogenerated mock type for the IdentityStore type
+type IdentityStore struct {
+	mock.Mock
+}
+
+// CreateIdentity provides a mock function with given fields: ctx, identity
+func (_m *IdentityStore) CreateIdentity(ctx context.Context, identity *oidc.Identity) error {
+	ret := _m.Called(ctx, identity)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *oidc.Identity) error); ok {
+		r0 = rf(ctx, identity)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUserIdentities provides a mock function with given fields: ctx, userID
+func (_m *IdentityStore) DeleteUserIdentities(ctx context.Context, userID string) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetIdentity provides a mock function with given fields: ctx, provider, subject
+func (_m *IdentityStore) GetIdentity(ctx context.Context, provider string, subject string) (*oidc.Identity, error) {
+	ret := _m.Called(ctx, provider, subject)
+
+	var r0 *oidc.Identity
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *oidc.Identity); ok {
+		r0 = rf(ctx, provider, subject)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*oidc.Identity)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, provider, subject)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListUserIdentities provides a mock function with given fields: ctx, userID
+func (_m *IdentityStore) ListUserIdentities(ctx context.Context, userID string) ([]oidc.Identity, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []oidc.Identity
+	if rf, ok := ret.Get(0).(func(context.Context, string) []oidc.Identity); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]oidc.Identity)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
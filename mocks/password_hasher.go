@@ -0,0 +1,66 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import mock "github.com/stretchr/testify/mock"
+
+// PasswordHasher is an autogenerated mock type for the PasswordHasher type
+type PasswordHasher struct {
+	mock.Mock
+}
+
+// Hash provides a mock function with given fields: password
+func (_m *PasswordHasher) Hash(password string) (string, error) {
+	ret := _m.Called(password)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(string) string); ok {
+		r0 = rf(password)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NeedsRehash provides a mock function with given fields: hash
+func (_m *PasswordHasher) NeedsRehash(hash string) bool {
+	ret := _m.Called(hash)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string) bool); ok {
+		r0 = rf(hash)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	return r0
+}
+
+// Verify provides a mock function with given fields: hash, password
+func (_m *PasswordHasher) Verify(hash string, password string) (bool, error) {
+	ret := _m.Called(hash, password)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(string, string) bool); ok {
+		r0 = rf(hash, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(hash, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -28,6 +28,29 @@ func (_m *Repository) CreateUser(ctx context.Context, user *users.User) error {
 	return r0
 }
 
+// DeleteUser provides a mock function with given fields: ctx, id
+func (_m *Repository) DeleteUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserByEmail provides a mock function with given fields: ctx, email
 func (_m *Repository) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
 	ret := _m.Called(ctx, email)
@@ -74,13 +97,36 @@ func (_m *Repository) GetUserByID(ctx context.Context, id string) (*users.User,
 	return r0, r1
 }
 
-// GetUsers provides a mock function with given fields: ctx, afterId, limit
-func (_m *Repository) GetUsers(ctx context.Context, afterId string, limit int32) ([]users.User, error) {
-	ret := _m.Called(ctx, afterId, limit)
+// GetUsers provides a mock function with given fields: ctx, filter
+func (_m *Repository) GetUsers(ctx context.Context, filter users.GetUsersFilter) (*users.UsersPage, error) {
+	ret := _m.Called(ctx, filter)
+
+	var r0 *users.UsersPage
+	if rf, ok := ret.Get(0).(func(context.Context, users.GetUsersFilter) *users.UsersPage); ok {
+		r0 = rf(ctx, filter)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.UsersPage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, users.GetUsersFilter) error); ok {
+		r1 = rf(ctx, filter)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsersByIDs provides a mock function with given fields: ctx, ids
+func (_m *Repository) GetUsersByIDs(ctx context.Context, ids []string) ([]users.User, error) {
+	ret := _m.Called(ctx, ids)
 
 	var r0 []users.User
-	if rf, ok := ret.Get(0).(func(context.Context, string, int32) []users.User); ok {
-		r0 = rf(ctx, afterId, limit)
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []users.User); ok {
+		r0 = rf(ctx, ids)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]users.User)
@@ -88,8 +134,123 @@ func (_m *Repository) GetUsers(ctx context.Context, afterId string, limit int32)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, int32) error); ok {
-		r1 = rf(ctx, afterId, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeUser provides a mock function with given fields: ctx, id
+func (_m *Repository) PurgeUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReplacePasswordHash provides a mock function with given fields: ctx, id, oldHash, newHash
+func (_m *Repository) ReplacePasswordHash(ctx context.Context, id string, oldHash string, newHash string) (*users.User, error) {
+	ret := _m.Called(ctx, id, oldHash, newHash)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *users.User); ok {
+		r0 = rf(ctx, id, oldHash, newHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, id, oldHash, newHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *Repository) RestoreUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePassword provides a mock function with given fields: ctx, id, passwordHash, expectedVersion
+func (_m *Repository) UpdatePassword(ctx context.Context, id string, passwordHash string, expectedVersion int64) (*users.User, error) {
+	ret := _m.Called(ctx, id, passwordHash, expectedVersion)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) *users.User); ok {
+		r0 = rf(ctx, id, passwordHash, expectedVersion)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64) error); ok {
+		r1 = rf(ctx, id, passwordHash, expectedVersion)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, id, update
+func (_m *Repository) UpdateUser(ctx context.Context, id string, update users.UserUpdate) (*users.User, error) {
+	ret := _m.Called(ctx, id, update)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, users.UserUpdate) *users.User); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, users.UserUpdate) error); ok {
+		r1 = rf(ctx, id, update)
 	} else {
 		r1 = ret.Error(1)
 	}
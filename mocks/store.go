@@ -0,0 +1,139 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+	time "time"
+
+	mock "github.com/stretchr/testify/mock"
+	sessions "github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+)
+
+// Store is an autogenerated mock type for the Store type
+type Store struct {
+	mock.Mock
+}
+
+// CreateSession provides a mock function with given fields: ctx, session
+func (_m *Store) CreateSession(ctx context.Context, session *sessions.Session) error {
+	ret := _m.Called(ctx, session)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *sessions.Session) error); ok {
+		r0 = rf(ctx, session)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUserSessions provides a mock function with given fields: ctx, userID
+func (_m *Store) DeleteUserSessions(ctx context.Context, userID string) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Deny provides a mock function with given fields: ctx, id, expiresAt
+func (_m *Store) Deny(ctx context.Context, id string, expiresAt time.Time) error {
+	ret := _m.Called(ctx, id, expiresAt)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, expiresAt)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// IsDenied provides a mock function with given fields: ctx, ids, now
+func (_m *Store) IsDenied(ctx context.Context, ids []string, now time.Time) (bool, error) {
+	ret := _m.Called(ctx, ids, now)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, []string, time.Time) bool); ok {
+		r0 = rf(ctx, ids, now)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string, time.Time) error); ok {
+		r1 = rf(ctx, ids, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeSession provides a mock function with given fields: ctx, id, now
+func (_m *Store) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	ret := _m.Called(ctx, id, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, id, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeUserSessions provides a mock function with given fields: ctx, userID, now
+func (_m *Store) RevokeUserSessions(ctx context.Context, userID string, now time.Time) ([]string, error) {
+	ret := _m.Called(ctx, userID, now)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) []string); ok {
+		r0 = rf(ctx, userID, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, userID, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RotateToken provides a mock function with given fields: ctx, tokenHash, newTokenHash, expiresAt, now
+func (_m *Store) RotateToken(ctx context.Context, tokenHash string, newTokenHash string, expiresAt time.Time, now time.Time) (*sessions.Session, error) {
+	ret := _m.Called(ctx, tokenHash, newTokenHash, expiresAt, now)
+
+	var r0 *sessions.Session
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time, time.Time) *sessions.Session); ok {
+		r0 = rf(ctx, tokenHash, newTokenHash, expiresAt, now)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sessions.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, tokenHash, newTokenHash, expiresAt, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
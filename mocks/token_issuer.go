@@ -0,0 +1,49 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	jwt "github.com/golang-jwt/jwt/v4"
+	mock "github.com/stretchr/testify/mock"
+	keyring "github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+)
+
+// TokenIssuer is an autogenerated mock type for the TokenIssuer type
+type TokenIssuer struct {
+	mock.Mock
+}
+
+// IssueToken provides a mock function with given fields: claims
+func (_m *TokenIssuer) IssueToken(claims jwt.Claims) (string, error) {
+	ret := _m.Called(claims)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(jwt.Claims) string); ok {
+		r0 = rf(claims)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(jwt.Claims) error); ok {
+		r1 = rf(claims)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// JWKS provides a mock function with given fields:
+func (_m *TokenIssuer) JWKS() keyring.JWKS {
+	ret := _m.Called()
+
+	var r0 keyring.JWKS
+	if rf, ok := ret.Get(0).(func() keyring.JWKS); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(keyring.JWKS)
+	}
+
+	return r0
+}
@@ -0,0 +1,27 @@
+// Code generated by mockery v2.9.4. DO NOT EDIT.
+
+package mocks
+
+import (
+	jwt "github.com/golang-jwt/jwt/v4"
+	mock "github.com/stretchr/testify/mock"
+)
+
+// TokenVerifier is an autogenerated mock type for the TokenVerifier type
+type TokenVerifier struct {
+	mock.Mock
+}
+
+// VerifyToken provides a mock function with given fields: token, claims
+func (_m *TokenVerifier) VerifyToken(token string, claims jwt.Claims) error {
+	ret := _m.Called(token, claims)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, jwt.Claims) error); ok {
+		r0 = rf(token, claims)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -5,8 +5,20 @@ package mocks
 import (
 	context "context"
 
+	apikeys "github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+
+	keyring "github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+
+	mfa "github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+
 	mock "github.com/stretchr/testify/mock"
 
+	search "github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+
+	sessions "github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+
+	time "time"
+
 	users "github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
 )
 
@@ -15,6 +27,226 @@ type UserService struct {
 	mock.Mock
 }
 
+// AuthenticateAPIKey provides a mock function with given fields: ctx, apiKey
+func (_m *UserService) AuthenticateAPIKey(ctx context.Context, apiKey string) (*apikeys.Principal, error) {
+	ret := _m.Called(ctx, apiKey)
+
+	var r0 *apikeys.Principal
+	if rf, ok := ret.Get(0).(func(context.Context, string) *apikeys.Principal); ok {
+		r0 = rf(ctx, apiKey)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeys.Principal)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, apiKey)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BatchGetUsers provides a mock function with given fields: ctx, ids
+func (_m *UserService) BatchGetUsers(ctx context.Context, ids []string) ([]users.User, []string, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []users.User
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []users.User); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]users.User)
+		}
+	}
+
+	var r1 []string
+	if rf, ok := ret.Get(1).(func(context.Context, []string) []string); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).([]string)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, []string) error); ok {
+		r2 = rf(ctx, ids)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// BeginTOTPEnrollment provides a mock function with given fields: ctx, jwtToken, userID, currentPassword
+func (_m *UserService) BeginTOTPEnrollment(ctx context.Context, jwtToken string, userID string, currentPassword string) (*mfa.Setup, error) {
+	ret := _m.Called(ctx, jwtToken, userID, currentPassword)
+
+	var r0 *mfa.Setup
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *mfa.Setup); ok {
+		r0 = rf(ctx, jwtToken, userID, currentPassword)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mfa.Setup)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, jwtToken, userID, currentPassword)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangePassword provides a mock function with given fields: ctx, jwtToken, userID, currentPassword, newPassword
+func (_m *UserService) ChangePassword(ctx context.Context, jwtToken string, userID string, currentPassword string, newPassword string) (*sessions.TokenPair, error) {
+	ret := _m.Called(ctx, jwtToken, userID, currentPassword, newPassword)
+
+	var r0 *sessions.TokenPair
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string) *sessions.TokenPair); ok {
+		r0 = rf(ctx, jwtToken, userID, currentPassword, newPassword)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sessions.TokenPair)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string) error); ok {
+		r1 = rf(ctx, jwtToken, userID, currentPassword, newPassword)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteLoginMFA provides a mock function with given fields: ctx, challengeToken, code
+func (_m *UserService) CompleteLoginMFA(ctx context.Context, challengeToken string, code string) (*users.User, *sessions.TokenPair, error) {
+	ret := _m.Called(ctx, challengeToken, code)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *users.User); ok {
+		r0 = rf(ctx, challengeToken, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 *sessions.TokenPair
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) *sessions.TokenPair); ok {
+		r1 = rf(ctx, challengeToken, code)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*sessions.TokenPair)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string) error); ok {
+		r2 = rf(ctx, challengeToken, code)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ConfirmTOTPEnrollment provides a mock function with given fields: ctx, jwtToken, userID, code
+func (_m *UserService) ConfirmTOTPEnrollment(ctx context.Context, jwtToken string, userID string, code string) ([]string, error) {
+	ret := _m.Called(ctx, jwtToken, userID, code)
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) []string); ok {
+		r0 = rf(ctx, jwtToken, userID, code)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, jwtToken, userID, code)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConsumeMagicLink provides a mock function with given fields: ctx, token
+func (_m *UserService) ConsumeMagicLink(ctx context.Context, token string) (*users.User, *sessions.TokenPair, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 *sessions.TokenPair
+	if rf, ok := ret.Get(1).(func(context.Context, string) *sessions.TokenPair); ok {
+		r1 = rf(ctx, token)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*sessions.TokenPair)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string) error); ok {
+		r2 = rf(ctx, token)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// CreateServiceAccount provides a mock function with given fields: ctx, name, scopes
+func (_m *UserService) CreateServiceAccount(ctx context.Context, name string, scopes []string) (*apikeys.ServiceAccount, *apikeys.IssuedKey, error) {
+	ret := _m.Called(ctx, name, scopes)
+
+	var r0 *apikeys.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) *apikeys.ServiceAccount); ok {
+		r0 = rf(ctx, name, scopes)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeys.ServiceAccount)
+		}
+	}
+
+	var r1 *apikeys.IssuedKey
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) *apikeys.IssuedKey); ok {
+		r1 = rf(ctx, name, scopes)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*apikeys.IssuedKey)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, []string) error); ok {
+		r2 = rf(ctx, name, scopes)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // CreateUser provides a mock function with given fields: ctx, newUser
 func (_m *UserService) CreateUser(ctx context.Context, newUser *users.User) (*users.User, error) {
 	ret := _m.Called(ctx, newUser)
@@ -38,6 +270,98 @@ func (_m *UserService) CreateUser(ctx context.Context, newUser *users.User) (*us
 	return r0, r1
 }
 
+// DeleteUser provides a mock function with given fields: ctx, id
+func (_m *UserService) DeleteUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJWKS provides a mock function with given fields: ctx
+func (_m *UserService) GetJWKS(ctx context.Context) (*keyring.JWKS, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *keyring.JWKS
+	if rf, ok := ret.Get(0).(func(context.Context) *keyring.JWKS); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*keyring.JWKS)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUser provides a mock function with given fields: ctx, id
+func (_m *UserService) GetUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByEmail provides a mock function with given fields: ctx, email
+func (_m *UserService) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserFromJWT provides a mock function with given fields: ctx, jwtToken
 func (_m *UserService) GetUserFromJWT(ctx context.Context, jwtToken string) (*users.User, error) {
 	ret := _m.Called(ctx, jwtToken)
@@ -61,22 +385,68 @@ func (_m *UserService) GetUserFromJWT(ctx context.Context, jwtToken string) (*us
 	return r0, r1
 }
 
-// GetUsers provides a mock function with given fields: ctx, afterId, limit
-func (_m *UserService) GetUsers(ctx context.Context, afterId string, limit int32) ([]users.User, error) {
-	ret := _m.Called(ctx, afterId, limit)
+// GetUsers provides a mock function with given fields: ctx, req
+func (_m *UserService) GetUsers(ctx context.Context, req users.GetUsersRequest) (*users.GetUsersResponse, error) {
+	ret := _m.Called(ctx, req)
 
-	var r0 []users.User
-	if rf, ok := ret.Get(0).(func(context.Context, string, int32) []users.User); ok {
-		r0 = rf(ctx, afterId, limit)
+	var r0 *users.GetUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, users.GetUsersRequest) *users.GetUsersResponse); ok {
+		r0 = rf(ctx, req)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]users.User)
+			r0 = ret.Get(0).(*users.GetUsersResponse)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, int32) error); ok {
-		r1 = rf(ctx, afterId, limit)
+	if rf, ok := ret.Get(1).(func(context.Context, users.GetUsersRequest) error); ok {
+		r1 = rf(ctx, req)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAPIKeys provides a mock function with given fields: ctx, serviceAccountID
+func (_m *UserService) ListAPIKeys(ctx context.Context, serviceAccountID string) ([]apikeys.Key, error) {
+	ret := _m.Called(ctx, serviceAccountID)
+
+	var r0 []apikeys.Key
+	if rf, ok := ret.Get(0).(func(context.Context, string) []apikeys.Key); ok {
+		r0 = rf(ctx, serviceAccountID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]apikeys.Key)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, serviceAccountID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListServiceAccounts provides a mock function with given fields: ctx
+func (_m *UserService) ListServiceAccounts(ctx context.Context) ([]apikeys.ServiceAccount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []apikeys.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context) []apikeys.ServiceAccount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]apikeys.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -85,7 +455,7 @@ func (_m *UserService) GetUsers(ctx context.Context, afterId string, limit int32
 }
 
 // LoginUser provides a mock function with given fields: ctx, email, password
-func (_m *UserService) LoginUser(ctx context.Context, email string, password string) (*users.User, string, error) {
+func (_m *UserService) LoginUser(ctx context.Context, email string, password string) (*users.User, *sessions.TokenPair, error) {
 	ret := _m.Called(ctx, email, password)
 
 	var r0 *users.User
@@ -97,11 +467,13 @@ func (_m *UserService) LoginUser(ctx context.Context, email string, password str
 		}
 	}
 
-	var r1 string
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) string); ok {
+	var r1 *sessions.TokenPair
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) *sessions.TokenPair); ok {
 		r1 = rf(ctx, email, password)
 	} else {
-		r1 = ret.Get(1).(string)
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*sessions.TokenPair)
+		}
 	}
 
 	var r2 error
@@ -113,3 +485,292 @@ func (_m *UserService) LoginUser(ctx context.Context, email string, password str
 
 	return r0, r1, r2
 }
+
+// LoginWithIDToken provides a mock function with given fields: ctx, provider, idToken, nonce
+func (_m *UserService) LoginWithIDToken(ctx context.Context, provider string, idToken string, nonce string) (*users.User, *sessions.TokenPair, error) {
+	ret := _m.Called(ctx, provider, idToken, nonce)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *users.User); ok {
+		r0 = rf(ctx, provider, idToken, nonce)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 *sessions.TokenPair
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) *sessions.TokenPair); ok {
+		r1 = rf(ctx, provider, idToken, nonce)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*sessions.TokenPair)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string) error); ok {
+		r2 = rf(ctx, provider, idToken, nonce)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// LogoutUser provides a mock function with given fields: ctx, jwtToken
+func (_m *UserService) LogoutUser(ctx context.Context, jwtToken string) error {
+	ret := _m.Called(ctx, jwtToken)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, jwtToken)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeUser provides a mock function with given fields: ctx, id
+func (_m *UserService) PurgeUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RefreshToken provides a mock function with given fields: ctx, refreshToken
+func (_m *UserService) RefreshToken(ctx context.Context, refreshToken string) (*sessions.TokenPair, error) {
+	ret := _m.Called(ctx, refreshToken)
+
+	var r0 *sessions.TokenPair
+	if rf, ok := ret.Get(0).(func(context.Context, string) *sessions.TokenPair); ok {
+		r0 = rf(ctx, refreshToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sessions.TokenPair)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, refreshToken)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestMagicLink provides a mock function with given fields: ctx, email
+func (_m *UserService) RequestMagicLink(ctx context.Context, email string) error {
+	ret := _m.Called(ctx, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequestPasswordReset provides a mock function with given fields: ctx, email
+func (_m *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	ret := _m.Called(ctx, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResendVerificationEmail provides a mock function with given fields: ctx, email
+func (_m *UserService) ResendVerificationEmail(ctx context.Context, email string) error {
+	ret := _m.Called(ctx, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResetPassword provides a mock function with given fields: ctx, token, newPassword
+func (_m *UserService) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	ret := _m.Called(ctx, token, newPassword)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, token, newPassword)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *UserService) RestoreUser(ctx context.Context, id string) (*users.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAPIKey provides a mock function with given fields: ctx, keyID
+func (_m *UserService) RevokeAPIKey(ctx context.Context, keyID string) error {
+	ret := _m.Called(ctx, keyID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, keyID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeAllSessions provides a mock function with given fields: ctx, userID
+func (_m *UserService) RevokeAllSessions(ctx context.Context, userID string) (int, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, string) int); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RotateAPIKey provides a mock function with given fields: ctx, serviceAccountID, gracePeriod
+func (_m *UserService) RotateAPIKey(ctx context.Context, serviceAccountID string, gracePeriod time.Duration) (*apikeys.IssuedKey, error) {
+	ret := _m.Called(ctx, serviceAccountID, gracePeriod)
+
+	var r0 *apikeys.IssuedKey
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) *apikeys.IssuedKey); ok {
+		r0 = rf(ctx, serviceAccountID, gracePeriod)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*apikeys.IssuedKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, serviceAccountID, gracePeriod)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchUsers provides a mock function with given fields: ctx, query, limit
+func (_m *UserService) SearchUsers(ctx context.Context, query string, limit int32) ([]search.Hit, error) {
+	ret := _m.Called(ctx, query, limit)
+
+	var r0 []search.Hit
+	if rf, ok := ret.Get(0).(func(context.Context, string, int32) []search.Hit); ok {
+		r0 = rf(ctx, query, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]search.Hit)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int32) error); ok {
+		r1 = rf(ctx, query, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, id, changes, fieldMask, version
+func (_m *UserService) UpdateUser(ctx context.Context, id string, changes *users.User, fieldMask []string, version int64) (*users.User, error) {
+	ret := _m.Called(ctx, id, changes, fieldMask, version)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string, *users.User, []string, int64) *users.User); ok {
+		r0 = rf(ctx, id, changes, fieldMask, version)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *users.User, []string, int64) error); ok {
+		r1 = rf(ctx, id, changes, fieldMask, version)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyEmail provides a mock function with given fields: ctx, token
+func (_m *UserService) VerifyEmail(ctx context.Context, token string) (*users.User, error) {
+	ret := _m.Called(ctx, token)
+
+	var r0 *users.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *users.User); ok {
+		r0 = rf(ctx, token)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*users.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, token)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -17,6 +17,216 @@ type UserServiceClient struct {
 	mock.Mock
 }
 
+// BatchGetUsers provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) BatchGetUsers(ctx context.Context, in *proto.BatchGetUsersInput, opts ...grpc.CallOption) (*proto.BatchGetUsersResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.BatchGetUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.BatchGetUsersInput, ...grpc.CallOption) *proto.BatchGetUsersResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.BatchGetUsersResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.BatchGetUsersInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BeginTOTPEnrollment provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) BeginTOTPEnrollment(ctx context.Context, in *proto.BeginTOTPEnrollmentInput, opts ...grpc.CallOption) (*proto.BeginTOTPEnrollmentResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.BeginTOTPEnrollmentResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.BeginTOTPEnrollmentInput, ...grpc.CallOption) *proto.BeginTOTPEnrollmentResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.BeginTOTPEnrollmentResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.BeginTOTPEnrollmentInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangePassword provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ChangePassword(ctx context.Context, in *proto.ChangePasswordInput, opts ...grpc.CallOption) (*proto.ChangePasswordResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ChangePasswordResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ChangePasswordInput, ...grpc.CallOption) *proto.ChangePasswordResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ChangePasswordResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ChangePasswordInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteLoginMFA provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) CompleteLoginMFA(ctx context.Context, in *proto.CompleteLoginMFAInput, opts ...grpc.CallOption) (*proto.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.CompleteLoginMFAInput, ...grpc.CallOption) *proto.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.CompleteLoginMFAInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConfirmTOTPEnrollment provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ConfirmTOTPEnrollment(ctx context.Context, in *proto.ConfirmTOTPEnrollmentInput, opts ...grpc.CallOption) (*proto.ConfirmTOTPEnrollmentResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ConfirmTOTPEnrollmentResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ConfirmTOTPEnrollmentInput, ...grpc.CallOption) *proto.ConfirmTOTPEnrollmentResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ConfirmTOTPEnrollmentResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ConfirmTOTPEnrollmentInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConsumeMagicLink provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ConsumeMagicLink(ctx context.Context, in *proto.ConsumeMagicLinkInput, opts ...grpc.CallOption) (*proto.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ConsumeMagicLinkInput, ...grpc.CallOption) *proto.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ConsumeMagicLinkInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateServiceAccount provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) CreateServiceAccount(ctx context.Context, in *proto.CreateServiceAccountInput, opts ...grpc.CallOption) (*proto.CreateServiceAccountResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.CreateServiceAccountResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.CreateServiceAccountInput, ...grpc.CallOption) *proto.CreateServiceAccountResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.CreateServiceAccountResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.CreateServiceAccountInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateUser provides a mock function with given fields: ctx, in, opts
 func (_m *UserServiceClient) CreateUser(ctx context.Context, in *proto.NewUser, opts ...grpc.CallOption) (*proto.User, error) {
 	_va := make([]interface{}, len(opts))
@@ -47,8 +257,8 @@ func (_m *UserServiceClient) CreateUser(ctx context.Context, in *proto.NewUser,
 	return r0, r1
 }
 
-// GetUserFromJWT provides a mock function with given fields: ctx, in, opts
-func (_m *UserServiceClient) GetUserFromJWT(ctx context.Context, in *proto.GetUserFromJWTInput, opts ...grpc.CallOption) (*proto.GetUserFromJWTResponse, error) {
+// DeleteUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) DeleteUser(ctx context.Context, in *proto.DeleteUserInput, opts ...grpc.CallOption) (*proto.User, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -58,17 +268,17 @@ func (_m *UserServiceClient) GetUserFromJWT(ctx context.Context, in *proto.GetUs
 	_ca = append(_ca, _va...)
 	ret := _m.Called(_ca...)
 
-	var r0 *proto.GetUserFromJWTResponse
-	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserFromJWTInput, ...grpc.CallOption) *proto.GetUserFromJWTResponse); ok {
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.DeleteUserInput, ...grpc.CallOption) *proto.User); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*proto.GetUserFromJWTResponse)
+			r0 = ret.Get(0).(*proto.User)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserFromJWTInput, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.DeleteUserInput, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -77,8 +287,8 @@ func (_m *UserServiceClient) GetUserFromJWT(ctx context.Context, in *proto.GetUs
 	return r0, r1
 }
 
-// GetUsers provides a mock function with given fields: ctx, in, opts
-func (_m *UserServiceClient) GetUsers(ctx context.Context, in *proto.GetUsersFilter, opts ...grpc.CallOption) (*proto.GetUsersResponse, error) {
+// GetJWKS provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) GetJWKS(ctx context.Context, in *proto.GetJWKSInput, opts ...grpc.CallOption) (*proto.JSONWebKeySet, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -88,17 +298,17 @@ func (_m *UserServiceClient) GetUsers(ctx context.Context, in *proto.GetUsersFil
 	_ca = append(_ca, _va...)
 	ret := _m.Called(_ca...)
 
-	var r0 *proto.GetUsersResponse
-	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUsersFilter, ...grpc.CallOption) *proto.GetUsersResponse); ok {
+	var r0 *proto.JSONWebKeySet
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetJWKSInput, ...grpc.CallOption) *proto.JSONWebKeySet); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*proto.GetUsersResponse)
+			r0 = ret.Get(0).(*proto.JSONWebKeySet)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUsersFilter, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetJWKSInput, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
@@ -107,8 +317,8 @@ func (_m *UserServiceClient) GetUsers(ctx context.Context, in *proto.GetUsersFil
 	return r0, r1
 }
 
-// LoginUser provides a mock function with given fields: ctx, in, opts
-func (_m *UserServiceClient) LoginUser(ctx context.Context, in *proto.LoginInput, opts ...grpc.CallOption) (*proto.LoginResponse, error) {
+// GetUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) GetUser(ctx context.Context, in *proto.GetUserInput, opts ...grpc.CallOption) (*proto.User, error) {
 	_va := make([]interface{}, len(opts))
 	for _i := range opts {
 		_va[_i] = opts[_i]
@@ -118,17 +328,647 @@ func (_m *UserServiceClient) LoginUser(ctx context.Context, in *proto.LoginInput
 	_ca = append(_ca, _va...)
 	ret := _m.Called(_ca...)
 
-	var r0 *proto.LoginResponse
-	if rf, ok := ret.Get(0).(func(context.Context, *proto.LoginInput, ...grpc.CallOption) *proto.LoginResponse); ok {
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserInput, ...grpc.CallOption) *proto.User); ok {
 		r0 = rf(ctx, in, opts...)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*proto.LoginResponse)
+			r0 = ret.Get(0).(*proto.User)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *proto.LoginInput, ...grpc.CallOption) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByEmail provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) GetUserByEmail(ctx context.Context, in *proto.GetUserByEmailInput, opts ...grpc.CallOption) (*proto.User, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserByEmailInput, ...grpc.CallOption) *proto.User); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserByEmailInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserFromJWT provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) GetUserFromJWT(ctx context.Context, in *proto.GetUserFromJWTInput, opts ...grpc.CallOption) (*proto.GetUserFromJWTResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.GetUserFromJWTResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserFromJWTInput, ...grpc.CallOption) *proto.GetUserFromJWTResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.GetUserFromJWTResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserFromJWTInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsers provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) GetUsers(ctx context.Context, in *proto.GetUsersRequest, opts ...grpc.CallOption) (*proto.GetUsersResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.GetUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUsersRequest, ...grpc.CallOption) *proto.GetUsersResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.GetUsersResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUsersRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAPIKeys provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ListAPIKeys(ctx context.Context, in *proto.ListAPIKeysInput, opts ...grpc.CallOption) (*proto.ListAPIKeysResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ListAPIKeysResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ListAPIKeysInput, ...grpc.CallOption) *proto.ListAPIKeysResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ListAPIKeysResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ListAPIKeysInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListServiceAccounts provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ListServiceAccounts(ctx context.Context, in *proto.ListServiceAccountsInput, opts ...grpc.CallOption) (*proto.ListServiceAccountsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ListServiceAccountsResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ListServiceAccountsInput, ...grpc.CallOption) *proto.ListServiceAccountsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ListServiceAccountsResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ListServiceAccountsInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LoginUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) LoginUser(ctx context.Context, in *proto.LoginInput, opts ...grpc.CallOption) (*proto.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.LoginInput, ...grpc.CallOption) *proto.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.LoginInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LoginWithIDToken provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) LoginWithIDToken(ctx context.Context, in *proto.LoginWithIDTokenInput, opts ...grpc.CallOption) (*proto.LoginResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.LoginWithIDTokenInput, ...grpc.CallOption) *proto.LoginResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.LoginWithIDTokenInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LogoutUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) LogoutUser(ctx context.Context, in *proto.LogoutUserInput, opts ...grpc.CallOption) (*proto.LogoutUserResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.LogoutUserResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.LogoutUserInput, ...grpc.CallOption) *proto.LogoutUserResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LogoutUserResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.LogoutUserInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) PurgeUser(ctx context.Context, in *proto.PurgeUserInput, opts ...grpc.CallOption) (*proto.PurgeUserResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.PurgeUserResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.PurgeUserInput, ...grpc.CallOption) *proto.PurgeUserResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.PurgeUserResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.PurgeUserInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RefreshToken provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RefreshToken(ctx context.Context, in *proto.RefreshTokenInput, opts ...grpc.CallOption) (*proto.RefreshTokenResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RefreshTokenResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RefreshTokenInput, ...grpc.CallOption) *proto.RefreshTokenResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RefreshTokenResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RefreshTokenInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestMagicLink provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RequestMagicLink(ctx context.Context, in *proto.RequestMagicLinkInput, opts ...grpc.CallOption) (*proto.RequestMagicLinkResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RequestMagicLinkResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RequestMagicLinkInput, ...grpc.CallOption) *proto.RequestMagicLinkResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RequestMagicLinkResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RequestMagicLinkInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestPasswordReset provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RequestPasswordReset(ctx context.Context, in *proto.RequestPasswordResetInput, opts ...grpc.CallOption) (*proto.RequestPasswordResetResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RequestPasswordResetResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RequestPasswordResetInput, ...grpc.CallOption) *proto.RequestPasswordResetResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RequestPasswordResetResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RequestPasswordResetInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResendVerificationEmail provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ResendVerificationEmail(ctx context.Context, in *proto.ResendVerificationEmailInput, opts ...grpc.CallOption) (*proto.ResendVerificationEmailResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ResendVerificationEmailResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ResendVerificationEmailInput, ...grpc.CallOption) *proto.ResendVerificationEmailResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ResendVerificationEmailResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ResendVerificationEmailInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResetPassword provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) ResetPassword(ctx context.Context, in *proto.ResetPasswordInput, opts ...grpc.CallOption) (*proto.ResetPasswordResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.ResetPasswordResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ResetPasswordInput, ...grpc.CallOption) *proto.ResetPasswordResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ResetPasswordResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ResetPasswordInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RestoreUser(ctx context.Context, in *proto.RestoreUserInput, opts ...grpc.CallOption) (*proto.User, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RestoreUserInput, ...grpc.CallOption) *proto.User); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RestoreUserInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAPIKey provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RevokeAPIKey(ctx context.Context, in *proto.RevokeAPIKeyInput, opts ...grpc.CallOption) (*proto.RevokeAPIKeyResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RevokeAPIKeyResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RevokeAPIKeyInput, ...grpc.CallOption) *proto.RevokeAPIKeyResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RevokeAPIKeyResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RevokeAPIKeyInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAllSessions provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RevokeAllSessions(ctx context.Context, in *proto.RevokeAllSessionsInput, opts ...grpc.CallOption) (*proto.RevokeAllSessionsResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RevokeAllSessionsResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RevokeAllSessionsInput, ...grpc.CallOption) *proto.RevokeAllSessionsResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RevokeAllSessionsResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RevokeAllSessionsInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RotateAPIKey provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) RotateAPIKey(ctx context.Context, in *proto.RotateAPIKeyInput, opts ...grpc.CallOption) (*proto.RotateAPIKeyResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.RotateAPIKeyResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RotateAPIKeyInput, ...grpc.CallOption) *proto.RotateAPIKeyResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RotateAPIKeyResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RotateAPIKeyInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchUsers provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) SearchUsers(ctx context.Context, in *proto.SearchUsersInput, opts ...grpc.CallOption) (*proto.SearchUsersResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.SearchUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.SearchUsersInput, ...grpc.CallOption) *proto.SearchUsersResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.SearchUsersResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.SearchUsersInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) UpdateUser(ctx context.Context, in *proto.UpdateUserInput, opts ...grpc.CallOption) (*proto.User, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.UpdateUserInput, ...grpc.CallOption) *proto.User); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.UpdateUserInput, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyEmail provides a mock function with given fields: ctx, in, opts
+func (_m *UserServiceClient) VerifyEmail(ctx context.Context, in *proto.VerifyEmailInput, opts ...grpc.CallOption) (*proto.User, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.VerifyEmailInput, ...grpc.CallOption) *proto.User); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.VerifyEmailInput, ...grpc.CallOption) error); ok {
 		r1 = rf(ctx, in, opts...)
 	} else {
 		r1 = ret.Error(1)
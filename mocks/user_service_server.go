@@ -14,6 +14,167 @@ type UserServiceServer struct {
 	mock.Mock
 }
 
+// BatchGetUsers provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) BatchGetUsers(_a0 context.Context, _a1 *proto.BatchGetUsersInput) (*proto.BatchGetUsersResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.BatchGetUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.BatchGetUsersInput) *proto.BatchGetUsersResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.BatchGetUsersResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.BatchGetUsersInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BeginTOTPEnrollment provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) BeginTOTPEnrollment(_a0 context.Context, _a1 *proto.BeginTOTPEnrollmentInput) (*proto.BeginTOTPEnrollmentResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.BeginTOTPEnrollmentResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.BeginTOTPEnrollmentInput) *proto.BeginTOTPEnrollmentResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.BeginTOTPEnrollmentResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.BeginTOTPEnrollmentInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ChangePassword provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ChangePassword(_a0 context.Context, _a1 *proto.ChangePasswordInput) (*proto.ChangePasswordResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ChangePasswordResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ChangePasswordInput) *proto.ChangePasswordResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ChangePasswordResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ChangePasswordInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CompleteLoginMFA provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) CompleteLoginMFA(_a0 context.Context, _a1 *proto.CompleteLoginMFAInput) (*proto.LoginResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.CompleteLoginMFAInput) *proto.LoginResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.CompleteLoginMFAInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConfirmTOTPEnrollment provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ConfirmTOTPEnrollment(_a0 context.Context, _a1 *proto.ConfirmTOTPEnrollmentInput) (*proto.ConfirmTOTPEnrollmentResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ConfirmTOTPEnrollmentResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ConfirmTOTPEnrollmentInput) *proto.ConfirmTOTPEnrollmentResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ConfirmTOTPEnrollmentResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ConfirmTOTPEnrollmentInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConsumeMagicLink provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ConsumeMagicLink(_a0 context.Context, _a1 *proto.ConsumeMagicLinkInput) (*proto.LoginResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ConsumeMagicLinkInput) *proto.LoginResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ConsumeMagicLinkInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateServiceAccount provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) CreateServiceAccount(_a0 context.Context, _a1 *proto.CreateServiceAccountInput) (*proto.CreateServiceAccountResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.CreateServiceAccountResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.CreateServiceAccountInput) *proto.CreateServiceAccountResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.CreateServiceAccountResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.CreateServiceAccountInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateUser provides a mock function with given fields: _a0, _a1
 func (_m *UserServiceServer) CreateUser(_a0 context.Context, _a1 *proto.NewUser) (*proto.User, error) {
 	ret := _m.Called(_a0, _a1)
@@ -37,6 +198,98 @@ func (_m *UserServiceServer) CreateUser(_a0 context.Context, _a1 *proto.NewUser)
 	return r0, r1
 }
 
+// DeleteUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) DeleteUser(_a0 context.Context, _a1 *proto.DeleteUserInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.DeleteUserInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.DeleteUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJWKS provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) GetJWKS(_a0 context.Context, _a1 *proto.GetJWKSInput) (*proto.JSONWebKeySet, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.JSONWebKeySet
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetJWKSInput) *proto.JSONWebKeySet); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.JSONWebKeySet)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetJWKSInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) GetUser(_a0 context.Context, _a1 *proto.GetUserInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByEmail provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) GetUserByEmail(_a0 context.Context, _a1 *proto.GetUserByEmailInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUserByEmailInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUserByEmailInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetUserFromJWT provides a mock function with given fields: _a0, _a1
 func (_m *UserServiceServer) GetUserFromJWT(_a0 context.Context, _a1 *proto.GetUserFromJWTInput) (*proto.GetUserFromJWTResponse, error) {
 	ret := _m.Called(_a0, _a1)
@@ -61,11 +314,11 @@ func (_m *UserServiceServer) GetUserFromJWT(_a0 context.Context, _a1 *proto.GetU
 }
 
 // GetUsers provides a mock function with given fields: _a0, _a1
-func (_m *UserServiceServer) GetUsers(_a0 context.Context, _a1 *proto.GetUsersFilter) (*proto.GetUsersResponse, error) {
+func (_m *UserServiceServer) GetUsers(_a0 context.Context, _a1 *proto.GetUsersRequest) (*proto.GetUsersResponse, error) {
 	ret := _m.Called(_a0, _a1)
 
 	var r0 *proto.GetUsersResponse
-	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUsersFilter) *proto.GetUsersResponse); ok {
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.GetUsersRequest) *proto.GetUsersResponse); ok {
 		r0 = rf(_a0, _a1)
 	} else {
 		if ret.Get(0) != nil {
@@ -74,7 +327,53 @@ func (_m *UserServiceServer) GetUsers(_a0 context.Context, _a1 *proto.GetUsersFi
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUsersFilter) error); ok {
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.GetUsersRequest) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListAPIKeys provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ListAPIKeys(_a0 context.Context, _a1 *proto.ListAPIKeysInput) (*proto.ListAPIKeysResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ListAPIKeysResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ListAPIKeysInput) *proto.ListAPIKeysResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ListAPIKeysResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ListAPIKeysInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListServiceAccounts provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ListServiceAccounts(_a0 context.Context, _a1 *proto.ListServiceAccountsInput) (*proto.ListServiceAccountsResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ListServiceAccountsResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ListServiceAccountsInput) *proto.ListServiceAccountsResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ListServiceAccountsResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ListServiceAccountsInput) error); ok {
 		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
@@ -106,6 +405,351 @@ func (_m *UserServiceServer) LoginUser(_a0 context.Context, _a1 *proto.LoginInpu
 	return r0, r1
 }
 
+// LoginWithIDToken provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) LoginWithIDToken(_a0 context.Context, _a1 *proto.LoginWithIDTokenInput) (*proto.LoginResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.LoginResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.LoginWithIDTokenInput) *proto.LoginResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LoginResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.LoginWithIDTokenInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LogoutUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) LogoutUser(_a0 context.Context, _a1 *proto.LogoutUserInput) (*proto.LogoutUserResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.LogoutUserResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.LogoutUserInput) *proto.LogoutUserResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.LogoutUserResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.LogoutUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// PurgeUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) PurgeUser(_a0 context.Context, _a1 *proto.PurgeUserInput) (*proto.PurgeUserResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.PurgeUserResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.PurgeUserInput) *proto.PurgeUserResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.PurgeUserResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.PurgeUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RefreshToken provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RefreshToken(_a0 context.Context, _a1 *proto.RefreshTokenInput) (*proto.RefreshTokenResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RefreshTokenResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RefreshTokenInput) *proto.RefreshTokenResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RefreshTokenResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RefreshTokenInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestMagicLink provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RequestMagicLink(_a0 context.Context, _a1 *proto.RequestMagicLinkInput) (*proto.RequestMagicLinkResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RequestMagicLinkResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RequestMagicLinkInput) *proto.RequestMagicLinkResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RequestMagicLinkResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RequestMagicLinkInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RequestPasswordReset provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RequestPasswordReset(_a0 context.Context, _a1 *proto.RequestPasswordResetInput) (*proto.RequestPasswordResetResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RequestPasswordResetResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RequestPasswordResetInput) *proto.RequestPasswordResetResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RequestPasswordResetResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RequestPasswordResetInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResendVerificationEmail provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ResendVerificationEmail(_a0 context.Context, _a1 *proto.ResendVerificationEmailInput) (*proto.ResendVerificationEmailResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ResendVerificationEmailResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ResendVerificationEmailInput) *proto.ResendVerificationEmailResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ResendVerificationEmailResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ResendVerificationEmailInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResetPassword provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) ResetPassword(_a0 context.Context, _a1 *proto.ResetPasswordInput) (*proto.ResetPasswordResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.ResetPasswordResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.ResetPasswordInput) *proto.ResetPasswordResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.ResetPasswordResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.ResetPasswordInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RestoreUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RestoreUser(_a0 context.Context, _a1 *proto.RestoreUserInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RestoreUserInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RestoreUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAPIKey provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RevokeAPIKey(_a0 context.Context, _a1 *proto.RevokeAPIKeyInput) (*proto.RevokeAPIKeyResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RevokeAPIKeyResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RevokeAPIKeyInput) *proto.RevokeAPIKeyResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RevokeAPIKeyResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RevokeAPIKeyInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RevokeAllSessions provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RevokeAllSessions(_a0 context.Context, _a1 *proto.RevokeAllSessionsInput) (*proto.RevokeAllSessionsResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RevokeAllSessionsResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RevokeAllSessionsInput) *proto.RevokeAllSessionsResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RevokeAllSessionsResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RevokeAllSessionsInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RotateAPIKey provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) RotateAPIKey(_a0 context.Context, _a1 *proto.RotateAPIKeyInput) (*proto.RotateAPIKeyResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.RotateAPIKeyResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.RotateAPIKeyInput) *proto.RotateAPIKeyResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.RotateAPIKeyResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.RotateAPIKeyInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SearchUsers provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) SearchUsers(_a0 context.Context, _a1 *proto.SearchUsersInput) (*proto.SearchUsersResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.SearchUsersResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.SearchUsersInput) *proto.SearchUsersResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.SearchUsersResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.SearchUsersInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) UpdateUser(_a0 context.Context, _a1 *proto.UpdateUserInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.UpdateUserInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.UpdateUserInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// VerifyEmail provides a mock function with given fields: _a0, _a1
+func (_m *UserServiceServer) VerifyEmail(_a0 context.Context, _a1 *proto.VerifyEmailInput) (*proto.User, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *proto.User
+	if rf, ok := ret.Get(0).(func(context.Context, *proto.VerifyEmailInput) *proto.User); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*proto.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *proto.VerifyEmailInput) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // mustEmbedUnimplementedUserServiceServer provides a mock function with given fields:
 func (_m *UserServiceServer) mustEmbedUnimplementedUserServiceServer() {
 	_m.Called()
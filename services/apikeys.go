@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAPIKeyRotationGrace bounds how long replaced keys keep working after a
+// rotation.
+const maxAPIKeyRotationGrace = 30 * 24 * time.Hour
+
+// WithServiceAccounts keeps service accounts and their API keys in store, they
+// are kept in memory by default.
+func WithServiceAccounts(store apikeys.Store) Option {
+	return func(s *UserServiceImpl) {
+		s.serviceAccountStore = store
+	}
+}
+
+// CreateServiceAccount is the service handler to create a service account with
+// the scopes, it returns the account along with its first API key. The API key
+// cannot be retrieved later.
+func (s *UserServiceImpl) CreateServiceAccount(ctx context.Context, name string, scopes []string) (*apikeys.ServiceAccount, *apikeys.IssuedKey, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateServiceAccount")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.name", name).SetTag("param.scopes", scopes)
+
+	fieldErr := &FieldError{}
+	if strings.TrimSpace(name) == "" {
+		fieldErr.Violations = append(fieldErr.Violations, FieldViolation{Field: "name", Description: "is required"})
+	}
+	if len(scopes) == 0 {
+		fieldErr.Violations = append(fieldErr.Violations, FieldViolation{Field: "scopes", Description: "must contain at least one scope"})
+	}
+	for _, scope := range scopes {
+		if !apikeys.ValidScope(scope) {
+			fieldErr.Violations = append(fieldErr.Violations, FieldViolation{
+				Field:       "scopes",
+				Description: fmt.Sprintf("has unknown scope %q, use %s", scope, strings.Join(apikeys.KnownScopes, ", ")),
+			})
+		}
+	}
+	if len(fieldErr.Violations) > 0 {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(fieldErr), log.Event("input validation"))
+		return nil, nil, fieldErr
+	}
+
+	account := &apikeys.ServiceAccount{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      strings.TrimSpace(name),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := s.serviceAccountStore.CreateServiceAccount(ctx, account)
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	span.SetTag("serviceAccountId", account.ID)
+	key, err := s.issueAPIKey(ctx, span, account.ID, account.CreatedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return account, key, nil
+}
+
+// ListServiceAccounts is the service handler to list every service account.
+func (s *UserServiceImpl) ListServiceAccounts(ctx context.Context) ([]apikeys.ServiceAccount, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListServiceAccounts")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+
+	accounts, err := s.serviceAccountStore.ListServiceAccounts(ctx)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	return accounts, nil
+}
+
+// ListAPIKeys is the service handler to list the keys of a service account,
+// including the revoked and expired ones.
+func (s *UserServiceImpl) ListAPIKeys(ctx context.Context, serviceAccountID string) ([]apikeys.Key, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ListAPIKeys")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.serviceAccountId", serviceAccountID)
+
+	_, err := s.serviceAccountStore.GetServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, serviceAccountStoreError(span, err, "serviceAccountStore.GetServiceAccount")
+	}
+	keys, err := s.serviceAccountStore.ListKeys(ctx, serviceAccountID)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	return keys, nil
+}
+
+// RotateAPIKey is the service handler to issue a new API key to a service
+// account, its other keys stop working once gracePeriod has passed so that
+// the new key can be rolled out first.
+func (s *UserServiceImpl) RotateAPIKey(ctx context.Context, serviceAccountID string, gracePeriod time.Duration) (*apikeys.IssuedKey, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RotateAPIKey")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.serviceAccountId", serviceAccountID).SetTag("param.gracePeriod", gracePeriod.String())
+	if gracePeriod < 0 || gracePeriod > maxAPIKeyRotationGrace {
+		err := &FieldError{Violations: []FieldViolation{
+			{Field: "gracePeriod", Description: fmt.Sprintf("must be between 0 and %s", maxAPIKeyRotationGrace)},
+		}}
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("input validation"))
+		return nil, err
+	}
+
+	_, err := s.serviceAccountStore.GetServiceAccount(ctx, serviceAccountID)
+	if err != nil {
+		return nil, serviceAccountStoreError(span, err, "serviceAccountStore.GetServiceAccount")
+	}
+	now := time.Now().UTC()
+	// the old keys are expired first, so a failure leaves them working
+	// rather than a new key nobody knows about.
+	expired, err := s.serviceAccountStore.ExpireKeys(ctx, serviceAccountID, now.Add(gracePeriod))
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	span.SetTag("expiredKeys", expired)
+	return s.issueAPIKey(ctx, span, serviceAccountID, now)
+}
+
+// RevokeAPIKey is the service handler to revoke an API key right away.
+func (s *UserServiceImpl) RevokeAPIKey(ctx context.Context, keyID string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeAPIKey")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.keyId", keyID)
+
+	key, err := s.serviceAccountStore.RevokeKey(ctx, keyID, time.Now().UTC())
+	if err != nil {
+		return serviceAccountStoreError(span, err, "serviceAccountStore.RevokeKey")
+	}
+	span.SetTag("serviceAccountId", key.ServiceAccountID)
+	return nil
+}
+
+// AuthenticateAPIKey returns the principal of the service account of an
+// active API key, other keys fail with apikeys.ErrInvalidKey.
+func (s *UserServiceImpl) AuthenticateAPIKey(ctx context.Context, apiKey string) (*apikeys.Principal, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "AuthenticateAPIKey")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if !apikeys.WellFormed(apiKey) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "malformed api key"), log.Event("input validation"))
+		return nil, apikeys.ErrInvalidKey
+	}
+
+	key, err := s.serviceAccountStore.GetKeyByHash(ctx, apikeys.HashKey(apiKey))
+	if err == nil && !key.Active(time.Now()) {
+		err = apikeys.ErrKeyNotFound
+	}
+	var account *apikeys.ServiceAccount
+	if err == nil {
+		span.SetTag("keyId", key.ID).SetTag("serviceAccountId", key.ServiceAccountID)
+		account, err = s.serviceAccountStore.GetServiceAccount(ctx, key.ServiceAccountID)
+	}
+	if errors.Is(err, apikeys.ErrKeyNotFound) || errors.Is(err, apikeys.ErrServiceAccountNotFound) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("api key lookup"))
+		return nil, apikeys.ErrInvalidKey
+	}
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	return &apikeys.Principal{
+		ServiceAccountID: account.ID,
+		Name:             account.Name,
+		KeyID:            key.ID,
+		Scopes:           account.Scopes,
+	}, nil
+}
+
+// BootstrapAdminKey makes apiKey, a key generated by the operator, a key of
+// a service account with the service-accounts:admin scope so that the first
+// service accounts can be created. It does nothing when the key is already
+// stored, so a revoked bootstrap key stays revoked across restarts.
+func (s *UserServiceImpl) BootstrapAdminKey(ctx context.Context, apiKey string) (*apikeys.Key, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "BootstrapAdminKey")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if !apikeys.WellFormed(apiKey) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "malformed api key"), log.Event("input validation"))
+		return nil, apikeys.ErrInvalidKey
+	}
+
+	hash := apikeys.HashKey(apiKey)
+	key, err := s.serviceAccountStore.GetKeyByHash(ctx, hash)
+	if err == nil {
+		span.SetTag("keyId", key.ID)
+		return key, nil
+	}
+	if !errors.Is(err, apikeys.ErrKeyNotFound) {
+		return nil, ErrTryAgain
+	}
+	account := &apikeys.ServiceAccount{
+		ID:        primitive.NewObjectID().Hex(),
+		Name:      "bootstrap admin",
+		Scopes:    []string{apikeys.ScopeServiceAccountsAdmin},
+		CreatedAt: time.Now().UTC(),
+	}
+	err = s.serviceAccountStore.CreateServiceAccount(ctx, account)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	key = &apikeys.Key{
+		ID:               primitive.NewObjectID().Hex(),
+		ServiceAccountID: account.ID,
+		Hash:             hash,
+		Hint:             apikeys.Hint(apiKey),
+		CreatedAt:        account.CreatedAt,
+	}
+	err = s.serviceAccountStore.CreateKey(ctx, key)
+	if err != nil {
+		// another replica may have stored the key first.
+		if stored, getErr := s.serviceAccountStore.GetKeyByHash(ctx, hash); getErr == nil {
+			return stored, nil
+		}
+		return nil, ErrTryAgain
+	}
+	span.SetTag("serviceAccountId", account.ID).SetTag("keyId", key.ID)
+	return key, nil
+}
+
+// issueAPIKey creates a new key for the service account.
+func (s *UserServiceImpl) issueAPIKey(ctx context.Context, span opentracing.Span, serviceAccountID string, now time.Time) (*apikeys.IssuedKey, error) {
+	apiKey, hash, hint, err := apikeys.NewKey()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("api key generation"))
+		return nil, ErrTryAgain
+	}
+	key := apikeys.Key{
+		ID:               primitive.NewObjectID().Hex(),
+		ServiceAccountID: serviceAccountID,
+		Hash:             hash,
+		Hint:             hint,
+		CreatedAt:        now,
+	}
+	err = s.serviceAccountStore.CreateKey(ctx, &key)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	span.SetTag("keyId", key.ID)
+	return &apikeys.IssuedKey{Key: key, APIKey: apiKey}, nil
+}
+
+// serviceAccountStoreError traces err and returns the errors callers can act
+// on, ErrTryAgain for any other.
+func serviceAccountStoreError(span opentracing.Span, err error, event string) error {
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(err), log.Event(event))
+	if errors.Is(err, apikeys.ErrServiceAccountNotFound) || errors.Is(err, apikeys.ErrKeyNotFound) {
+		return err
+	}
+	return ErrTryAgain
+}
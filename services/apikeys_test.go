@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_CreateServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+
+	var fieldErr *FieldError
+	if _, _, err := s.CreateServiceAccount(ctx, " ", []string{"users:delete"}); !errors.As(err, &fieldErr) || len(fieldErr.Violations) != 2 {
+		t.Errorf("UserServiceImpl.CreateServiceAccount() with a blank name and an unknown scope error = %v, want 2 violations", err)
+	}
+	if _, _, err := s.CreateServiceAccount(ctx, "nightly export", nil); !errors.As(err, &fieldErr) {
+		t.Errorf("UserServiceImpl.CreateServiceAccount() without scopes error = %v, want a FieldError", err)
+	}
+
+	account, key, err := s.CreateServiceAccount(ctx, "nightly export", []string{apikeys.ScopeUsersRead})
+	if err != nil || account.Name != "nightly export" || key.ServiceAccountID != account.ID || !apikeys.WellFormed(key.APIKey) {
+		t.Fatalf("UserServiceImpl.CreateServiceAccount() = %+v, %+v, %v, want the account and a key", account, key, err)
+	}
+	principal, err := s.AuthenticateAPIKey(ctx, key.APIKey)
+	if err != nil || principal.ServiceAccountID != account.ID || principal.KeyID != key.ID || !principal.HasScope(apikeys.ScopeUsersRead) {
+		t.Errorf("UserServiceImpl.AuthenticateAPIKey() = %+v, %v, want the principal of the account", principal, err)
+	}
+	accounts, err := s.ListServiceAccounts(ctx)
+	if err != nil || len(accounts) != 1 || accounts[0].ID != account.ID {
+		t.Errorf("UserServiceImpl.ListServiceAccounts() = %+v, %v, want the account", accounts, err)
+	}
+}
+
+func TestUserServiceImpl_AuthenticateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	_, key, err := s.CreateServiceAccount(ctx, "nightly export", []string{apikeys.ScopeUsersRead})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateServiceAccount() error = %v", err)
+	}
+	unknown, _, _, _ := apikeys.NewKey()
+
+	tests := []struct {
+		name   string
+		apiKey string
+	}{
+		{name: "empty key", apiKey: ""},
+		{name: "malformed key", apiKey: "not-an-api-key"},
+		{name: "unknown key", apiKey: unknown},
+		{name: "key with another prefix", apiKey: "xsk_" + key.APIKey[len(apikeys.Prefix):]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.AuthenticateAPIKey(ctx, tt.apiKey); err != apikeys.ErrInvalidKey {
+				t.Errorf("UserServiceImpl.AuthenticateAPIKey() error = %v, want %v", err, apikeys.ErrInvalidKey)
+			}
+		})
+	}
+}
+
+func TestUserServiceImpl_RotateAPIKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	account, first, err := s.CreateServiceAccount(ctx, "nightly export", []string{apikeys.ScopeUsersRead})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateServiceAccount() error = %v", err)
+	}
+
+	var fieldErr *FieldError
+	if _, err := s.RotateAPIKey(ctx, account.ID, -time.Minute); !errors.As(err, &fieldErr) {
+		t.Errorf("UserServiceImpl.RotateAPIKey() with a negative grace period error = %v, want a FieldError", err)
+	}
+	if _, err := s.RotateAPIKey(ctx, account.ID, 31*24*time.Hour); !errors.As(err, &fieldErr) {
+		t.Errorf("UserServiceImpl.RotateAPIKey() with a grace period over 30 days error = %v, want a FieldError", err)
+	}
+	if _, err := s.RotateAPIKey(ctx, "unknown", time.Hour); err != apikeys.ErrServiceAccountNotFound {
+		t.Errorf("UserServiceImpl.RotateAPIKey() of an unknown account error = %v, want %v", err, apikeys.ErrServiceAccountNotFound)
+	}
+
+	// the first key keeps working during the grace period.
+	second, err := s.RotateAPIKey(ctx, account.ID, time.Hour)
+	if err != nil || second.APIKey == first.APIKey {
+		t.Fatalf("UserServiceImpl.RotateAPIKey() = %+v, %v, want a new key", second, err)
+	}
+	for _, apiKey := range []string{first.APIKey, second.APIKey} {
+		if _, err := s.AuthenticateAPIKey(ctx, apiKey); err != nil {
+			t.Errorf("UserServiceImpl.AuthenticateAPIKey() during the grace period error = %v", err)
+		}
+	}
+	keys, err := s.ListAPIKeys(ctx, account.ID)
+	if err != nil || len(keys) != 2 || keys[0].ExpiresAt == nil || keys[1].ExpiresAt != nil {
+		t.Errorf("UserServiceImpl.ListAPIKeys() = %+v, %v, want the first key expiring", keys, err)
+	}
+
+	// without a grace period the other keys stop working right away.
+	third, err := s.RotateAPIKey(ctx, account.ID, 0)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.RotateAPIKey() error = %v", err)
+	}
+	for _, apiKey := range []string{first.APIKey, second.APIKey} {
+		if _, err := s.AuthenticateAPIKey(ctx, apiKey); err != apikeys.ErrInvalidKey {
+			t.Errorf("UserServiceImpl.AuthenticateAPIKey() of a rotated key error = %v, want %v", err, apikeys.ErrInvalidKey)
+		}
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, third.APIKey); err != nil {
+		t.Errorf("UserServiceImpl.AuthenticateAPIKey() of the new key error = %v", err)
+	}
+	if _, err := s.ListAPIKeys(ctx, "unknown"); err != apikeys.ErrServiceAccountNotFound {
+		t.Errorf("UserServiceImpl.ListAPIKeys() of an unknown account error = %v, want %v", err, apikeys.ErrServiceAccountNotFound)
+	}
+}
+
+func TestUserServiceImpl_RevokeAPIKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	_, key, err := s.CreateServiceAccount(ctx, "nightly export", []string{apikeys.ScopeUsersRead})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateServiceAccount() error = %v", err)
+	}
+
+	if err := s.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("UserServiceImpl.RevokeAPIKey() error = %v", err)
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, key.APIKey); err != apikeys.ErrInvalidKey {
+		t.Errorf("UserServiceImpl.AuthenticateAPIKey() of a revoked key error = %v, want %v", err, apikeys.ErrInvalidKey)
+	}
+	if err := s.RevokeAPIKey(ctx, key.ID); err != apikeys.ErrKeyNotFound {
+		t.Errorf("UserServiceImpl.RevokeAPIKey() of a revoked key error = %v, want %v", err, apikeys.ErrKeyNotFound)
+	}
+}
+
+func TestUserServiceImpl_BootstrapAdminKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	apiKey, _, _, _ := apikeys.NewKey()
+
+	if _, err := s.BootstrapAdminKey(ctx, "not-an-api-key"); err != apikeys.ErrInvalidKey {
+		t.Errorf("UserServiceImpl.BootstrapAdminKey() with a malformed key error = %v, want %v", err, apikeys.ErrInvalidKey)
+	}
+	key, err := s.BootstrapAdminKey(ctx, apiKey)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.BootstrapAdminKey() error = %v", err)
+	}
+	principal, err := s.AuthenticateAPIKey(ctx, apiKey)
+	if err != nil || principal.KeyID != key.ID || !principal.HasScope(apikeys.ScopeServiceAccountsAdmin) {
+		t.Errorf("UserServiceImpl.AuthenticateAPIKey() of the bootstrap key = %+v, %v, want an admin principal", principal, err)
+	}
+
+	// restarts keep the key, and a revoked key is not brought back.
+	if err := s.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("UserServiceImpl.RevokeAPIKey() error = %v", err)
+	}
+	if again, err := s.BootstrapAdminKey(ctx, apiKey); err != nil || again.ID != key.ID {
+		t.Errorf("UserServiceImpl.BootstrapAdminKey() again = %+v, %v, want key %s", again, err, key.ID)
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, apiKey); err != apikeys.ErrInvalidKey {
+		t.Errorf("UserServiceImpl.AuthenticateAPIKey() of the revoked bootstrap key error = %v, want %v", err, apikeys.ErrInvalidKey)
+	}
+	if accounts, err := s.ListServiceAccounts(ctx); err != nil || len(accounts) != 1 {
+		t.Errorf("UserServiceImpl.ListServiceAccounts() = %+v, %v, want the bootstrap account only", accounts, err)
+	}
+}
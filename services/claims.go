@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// AccessTokenClaims are the claims of the access tokens issued by the
+// service, the subject is the id of the user.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	// UserID repeats the subject for the readers of the tokens issued before
+	// the registered claims were used.
+	UserID    string `json:"userId,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// AuthTime is when the user logged in to start the session, refreshed
+	// tokens keep it.
+	AuthTime  *jwt.NumericDate `json:"auth_time,omitempty"`
+	TimeAdded time.Time        `json:"timeAdded"`
+	// Scope is ScopeUnverified for the limited tokens of users who have not
+	// verified their email, other tokens have no scope.
+	Scope string `json:"scope,omitempty"`
+
+	// validation is set before the claims are decoded, it is not part of the
+	// token.
+	validation claimsValidation
+}
+
+// claimsValidation holds what the registered claims of access tokens are
+// checked against.
+type claimsValidation struct {
+	// issuer and audience are not checked when empty.
+	issuer   string
+	audience []string
+	// leeway tolerates the clock skew between the issuer and the verifier.
+	leeway time.Duration
+	// maxLifetime is the longest exp - iat accepted, the lifetime of the
+	// access tokens issued by the service.
+	maxLifetime time.Duration
+}
+
+var (
+	errTokenNoExpiry     = errors.New("token has no exp claim")
+	errTokenNoIssuedAt   = errors.New("token has no iat claim")
+	errTokenNoID         = errors.New("token has no jti or sid claim")
+	errTokenLongLifetime = errors.New("token lifetime is longer than the access token lifetime")
+)
+
+// WithTokenClaims sets the iss and aud claims of the issued access tokens,
+// verified tokens must have the issuer and one of the audiences. The leeway
+// tolerates clock skew when checking exp, nbf and iat. Empty values are not
+// checked.
+func WithTokenClaims(issuer string, audience []string, leeway time.Duration) Option {
+	return func(s *UserServiceImpl) {
+		s.claimsValidation = claimsValidation{
+			issuer:   issuer,
+			audience: audience,
+			leeway:   leeway,
+		}
+	}
+}
+
+// Valid implements jwt.Claims. The exp, iat, jti and sid claims are optional
+// in RFC 7519 but every token issued by the service has them, tokens without
+// them cannot be bounded in time or revoked so they are rejected. So are
+// tokens valid for longer than the access token lifetime.
+func (c *AccessTokenClaims) Valid() error {
+	now := jwt.TimeFunc()
+	leeway := c.validation.leeway
+	switch {
+	case c.ExpiresAt == nil:
+		return errTokenNoExpiry
+	case c.IssuedAt == nil:
+		return errTokenNoIssuedAt
+	case c.ID == "" || c.SessionID == "":
+		return errTokenNoID
+	case c.validation.maxLifetime > 0 && c.ExpiresAt.Sub(c.IssuedAt.Time) > c.validation.maxLifetime:
+		return errTokenLongLifetime
+	case !now.Before(c.ExpiresAt.Add(leeway)):
+		return jwt.ErrTokenExpired
+	case c.NotBefore != nil && now.Add(leeway).Before(c.NotBefore.Time):
+		return jwt.ErrTokenNotValidYet
+	case now.Add(leeway).Before(c.IssuedAt.Time):
+		return jwt.ErrTokenUsedBeforeIssued
+	case c.validation.issuer != "" && c.Issuer != c.validation.issuer:
+		return jwt.ErrTokenInvalidIssuer
+	case len(c.validation.audience) > 0 && !c.hasAudience(c.validation.audience):
+		return jwt.ErrTokenInvalidAudience
+	}
+	return nil
+}
+
+// hasAudience reports whether the aud claim holds one of audience.
+func (c *AccessTokenClaims) hasAudience(audience []string) bool {
+	for _, want := range audience {
+		for _, got := range c.Audience {
+			if got == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// userID returns the id of the user the token was issued to.
+func (c *AccessTokenClaims) userID() string {
+	if c.Subject != "" {
+		return c.Subject
+	}
+	return c.UserID
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_AccessTokenClaims(t *testing.T) {
+	ctx := context.Background()
+	keys, _ := keyring.New(keyring.NewHMACKey("test", []byte("secret")))
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithTokenIssuer(keys), WithTokenVerifier(keys), WithTokenLifetimes(time.Minute, time.Hour),
+		WithTokenClaims("user-service", []string{"cart-service", "product-service"}, 30*time.Second),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, tokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	issued := &AccessTokenClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokens.AccessToken, issued)
+	if err != nil {
+		t.Fatalf("jwt.Parser.ParseUnverified() error = %v", err)
+	}
+	if issued.Issuer != "user-service" || issued.Subject != user.ID || len(issued.Audience) != 2 || issued.ID == "" {
+		t.Errorf("LoginUser() claims iss %v sub %v aud %v jti %v, want user-service %v [cart-service product-service] and an id",
+			issued.Issuer, issued.Subject, issued.Audience, issued.ID, user.ID)
+	}
+	if lifetime := issued.ExpiresAt.Sub(issued.IssuedAt.Time); lifetime != time.Minute {
+		t.Errorf("LoginUser() claims exp - iat = %v, want %v", lifetime, time.Minute)
+	}
+	if !issued.ExpiresAt.Time.Equal(tokens.AccessTokenExpiresAt.Truncate(time.Second)) {
+		t.Errorf("LoginUser() claims exp = %v, want %v in seconds", issued.ExpiresAt.Time, tokens.AccessTokenExpiresAt)
+	}
+
+	now := time.Now()
+	sign := func(claims *AccessTokenClaims) string {
+		token, err := keys.IssueToken(claims)
+		if err != nil {
+			t.Fatalf("Ring.IssueToken() error = %v", err)
+		}
+		return token
+	}
+	valid := func(change func(claims *AccessTokenClaims)) *AccessTokenClaims {
+		claims := &AccessTokenClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "token.test",
+				Issuer:    "user-service",
+				Subject:   user.ID,
+				Audience:  jwt.ClaimStrings{"product-service"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+			SessionID: "session.test",
+		}
+		change(claims)
+		return claims
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "issued token", token: tokens.AccessToken},
+		{name: "valid claims", token: sign(valid(func(c *AccessTokenClaims) {}))},
+		{
+			name:  "expired within the leeway",
+			token: sign(valid(func(c *AccessTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) })),
+		},
+		{
+			name:    "expired",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) })),
+			wantErr: true,
+		},
+		{
+			name:  "not valid yet within the leeway",
+			token: sign(valid(func(c *AccessTokenClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) })),
+		},
+		{
+			name:    "not valid yet",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) })),
+			wantErr: true,
+		},
+		{
+			name:    "issued in the future",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.Issuer = "other-service" })),
+			wantErr: true,
+		},
+		{
+			name:    "no issuer",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.Issuer = "" })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.Audience = jwt.ClaimStrings{"payment-service"} })),
+			wantErr: true,
+		},
+		{
+			name:    "no audience",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.Audience = nil })),
+			wantErr: true,
+		},
+		{
+			name:    "no expiry",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.ExpiresAt = nil })),
+			wantErr: true,
+		},
+		{
+			name:    "no issued at",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.IssuedAt = nil })),
+			wantErr: true,
+		},
+		{
+			name:    "longer than the access token lifetime",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(time.Hour)) })),
+			wantErr: true,
+		},
+		{
+			name:    "no token id",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.ID = "" })),
+			wantErr: true,
+		},
+		{
+			name:    "no session id",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.SessionID = "" })),
+			wantErr: true,
+		},
+		{
+			name:    "no subject",
+			token:   sign(valid(func(c *AccessTokenClaims) { c.Subject = "" })),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetUserFromJWT(ctx, tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UserServiceImpl.GetUserFromJWT() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.ID != user.ID {
+				t.Errorf("UserServiceImpl.GetUserFromJWT() = %v, want user %v", got.ID, user.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/lockout"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// LoginThrottledError is returned by LoginUser and the other handlers
+// checking credentials or tokens when too many attempts failed for the email,
+// the user or the client ip.
+type LoginThrottledError struct {
+	// RetryAfter is how long the client must wait before trying again.
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts, please try again later"
+}
+
+// WithLoginThrottling keeps the failed login attempts in store and throttles
+// logins per email and per client ip with the policies. Attempts are kept in
+// memory with lockout.DefaultEmailPolicy and lockout.DefaultIPPolicy by
+// default.
+func WithLoginThrottling(store lockout.Store, emailPolicy, ipPolicy lockout.Policy) Option {
+	return func(s *UserServiceImpl) {
+		s.loginAttemptStore = store
+		s.emailLoginPolicy = emailPolicy
+		s.ipLoginPolicy = ipPolicy
+	}
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the ip of the client making the
+// request, failed logins are throttled per client ip as well as per email.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// loginAttemptKey returns the key of the attempts of the policy for value.
+func loginAttemptKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+// reserveAttempt records a failed attempt for key before the attempt is made,
+// so that concurrent attempts cannot all pass the check before any failure is
+// recorded. It returns how long key must wait because of the failures before
+// the attempt. Throttled attempts are not counted, they are refused before
+// being recorded or taken back when concurrent attempts were recorded first,
+// so that retrying while throttled does not extend the wait.
+func (s *UserServiceImpl) reserveAttempt(ctx context.Context, span opentracing.Span, key string, policy lockout.Policy, now time.Time) (*lockout.Attempts, time.Duration, error) {
+	attempts, err := s.loginAttemptStore.GetAttempts(ctx, key, now)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.GetAttempts"))
+		return nil, 0, ErrTryAgain
+	}
+	if retryAfter := policy.RetryAfter(attempts, now); retryAfter > 0 {
+		return attempts, retryAfter, nil
+	}
+	attempts, err = s.loginAttemptStore.RecordFailure(ctx, key, now, policy.RecordWindow())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.RecordFailure"))
+		return nil, 0, ErrTryAgain
+	}
+	retryAfter := policy.RecordedRetryAfter(attempts, now)
+	if retryAfter > 0 {
+		s.releaseAttempt(ctx, span, key)
+	}
+	return attempts, retryAfter, nil
+}
+
+// throttledError traces and returns the LoginThrottledError of retryAfter,
+// nil when it is zero.
+func throttledError(span opentracing.Span, retryAfter time.Duration, event string) error {
+	if retryAfter <= 0 {
+		return nil
+	}
+	err := &LoginThrottledError{RetryAfter: retryAfter}
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(err), log.String("retryAfter", retryAfter.String()), log.Event(event))
+	return err
+}
+
+// throttleEmailRequest counts a request emailing a token to email, like a
+// password reset, against the email and the client ip. It returns a
+// LoginThrottledError when the requests before it make either wait, so that
+// the handler cannot be used to flood an inbox or to send emails in bulk.
+// The request stays counted whether or not a user has the email.
+func (s *UserServiceImpl) throttleEmailRequest(ctx context.Context, span opentracing.Span, kind, email string) error {
+	now := time.Now()
+	emailKey := loginAttemptKey(kind+"-email", users.NormalizeEmail(email))
+	_, retryAfter, err := s.reserveAttempt(ctx, span, emailKey, s.emailLoginPolicy, now)
+	if err != nil {
+		return err
+	}
+	if ip := clientIP(ctx); retryAfter == 0 && ip != "" {
+		_, retryAfter, err = s.reserveAttempt(ctx, span, loginAttemptKey(kind+"-ip", ip), s.ipLoginPolicy, now)
+		if err != nil || retryAfter > 0 {
+			// the request is not made, so it does not count for the email.
+			s.releaseAttempt(ctx, span, emailKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return throttledError(span, retryAfter, kind+" throttling")
+}
+
+// releaseAttempt takes back the failure reserveAttempt recorded for key,
+// failures are traced as the attempt is over.
+func (s *UserServiceImpl) releaseAttempt(ctx context.Context, span opentracing.Span, key string) {
+	err := s.loginAttemptStore.RemoveFailure(ctx, key)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.RemoveFailure"))
+	}
+}
+
+// reserveLoginAttempt records a failed login for the email and the ip before
+// the password is checked, and returns a LoginThrottledError when the
+// failures before it make the email or the ip wait. The login is released by
+// resetLoginFailures when the password is right and by releaseLoginAttempt
+// when it could not be checked, a wrong password is reported to loginFailed.
+// Nothing stays recorded when the login is throttled or fails to be reserved.
+func (s *UserServiceImpl) reserveLoginAttempt(ctx context.Context, span opentracing.Span, email, ip string, now time.Time) (*lockout.Attempts, error) {
+	emailKey := loginAttemptKey("email", users.NormalizeEmail(email))
+	emailAttempts, retryAfter, err := s.reserveAttempt(ctx, span, emailKey, s.emailLoginPolicy, now)
+	if err != nil {
+		return nil, err
+	}
+	if retryAfter == 0 && ip != "" {
+		_, retryAfter, err = s.reserveAttempt(ctx, span, loginAttemptKey("ip", ip), s.ipLoginPolicy, now)
+		if err != nil || retryAfter > 0 {
+			s.releaseAttempt(ctx, span, emailKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return emailAttempts, throttledError(span, retryAfter, "login throttling")
+}
+
+// loginFailed emails the user when the failed login recorded in
+// emailAttempts locked their email out, user is nil when no user has the
+// email.
+func (s *UserServiceImpl) loginFailed(span opentracing.Span, emailAttempts *lockout.Attempts, user *users.User, ip string) {
+	if user != nil && s.emailLoginPolicy.Locked(emailAttempts) && emailAttempts.Failures == s.emailLoginPolicy.LockoutFailures {
+		span.LogFields(log.Event("email locked out"), log.Int("failures", emailAttempts.Failures))
+		s.publishSuspiciousLoginSendEmailEvent(span, user, emailAttempts.Failures, ip)
+	}
+}
+
+// releaseLoginAttempt takes back a login reserved by reserveLoginAttempt
+// whose password could not be checked.
+func (s *UserServiceImpl) releaseLoginAttempt(ctx context.Context, span opentracing.Span, email, ip string) {
+	s.releaseAttempt(ctx, span, loginAttemptKey("email", users.NormalizeEmail(email)))
+	if ip != "" {
+		s.releaseAttempt(ctx, span, loginAttemptKey("ip", ip))
+	}
+}
+
+// resetLoginFailures forgets the failed logins of the email after a
+// successful login, those of the ip are kept as it may be trying other
+// emails and only the successful login is taken back.
+func (s *UserServiceImpl) resetLoginFailures(ctx context.Context, span opentracing.Span, email, ip string) {
+	err := s.loginAttemptStore.Reset(ctx, loginAttemptKey("email", users.NormalizeEmail(email)))
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.Reset"))
+	}
+	if ip != "" {
+		s.releaseAttempt(ctx, span, loginAttemptKey("ip", ip))
+	}
+}
+
+// reserveIPAttempt records a failed attempt of the client ip, such as trying
+// a token, before it is made. Attempts from unknown ips are not throttled.
+func (s *UserServiceImpl) reserveIPAttempt(ctx context.Context, span opentracing.Span, ip string, now time.Time) error {
+	if ip == "" {
+		return nil
+	}
+	_, retryAfter, err := s.reserveAttempt(ctx, span, loginAttemptKey("ip", ip), s.ipLoginPolicy, now)
+	if err != nil {
+		return err
+	}
+	return throttledError(span, retryAfter, "ip throttling")
+}
+
+// releaseIPAttempt takes back an attempt reserved by reserveIPAttempt that
+// succeeded.
+func (s *UserServiceImpl) releaseIPAttempt(ctx context.Context, span opentracing.Span, ip string) {
+	if ip != "" {
+		s.releaseAttempt(ctx, span, loginAttemptKey("ip", ip))
+	}
+}
+
+func (s *UserServiceImpl) publishSuspiciousLoginSendEmailEvent(span opentracing.Span, user *users.User, failures int, ip string) {
+	from := ""
+	if ip != "" {
+		from = " from " + ip
+	}
+	s.publishEvent(span, "publish-suspicious-login-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Suspicious login activity on your account",
+		"body": fmt.Sprintf(
+			"There were %d failed attempts to log in to your account%s, so logins are locked for %s. If it wasn't you, consider changing your password.",
+			failures, from, s.emailLoginPolicy.LockoutDuration,
+		),
+	})
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/lockout"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+// receiveEmail returns the first email with the subject published on
+// notification.SendEmail, or fails the test.
+func receiveEmail(t *testing.T, messages chan *nats.Msg, subject string) map[string]string {
+	for {
+		select {
+		case msg := <-messages:
+			var email map[string]string
+			json.Unmarshal(msg.Data, &email)
+			if email["subject"] == subject {
+				return email
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %q email was sent", subject)
+			return nil
+		}
+	}
+}
+
+func TestUserServiceImpl_LoginUser_Throttling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	// delays are zero so that the lockout is reached without waiting.
+	emailPolicy := lockout.Policy{FreeFailures: 1, LockoutFailures: 3, LockoutDuration: time.Hour, Window: time.Hour}
+	ipPolicy := lockout.Policy{FreeFailures: 5, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithLoginThrottling(lockout.NewMemoryStore(), emailPolicy, ipPolicy),
+	)
+	for _, email := range []string{"john@example.com", "jane@example.com"} {
+		_, err := s.CreateUser(ctx, &users.User{FullName: "Test User", Email: email, Password: "correct-horse-42"})
+		if err != nil {
+			t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+		}
+	}
+	login := func(email, password string) error {
+		_, _, err := s.LoginUser(ctx, email, password)
+		return err
+	}
+	wantThrottled := func(err error, retryAfter time.Duration) {
+		t.Helper()
+		var throttledErr *LoginThrottledError
+		if !errors.As(err, &throttledErr) || throttledErr.RetryAfter <= retryAfter-time.Minute || throttledErr.RetryAfter > retryAfter {
+			t.Errorf("UserServiceImpl.LoginUser() error = %v, want a retry after about %v", err, retryAfter)
+		}
+	}
+
+	// a successful login forgets the failures of the email.
+	if err := login("john@example.com", "wrong-password"); err == nil || err.Error() != "invalid credentials" {
+		t.Fatalf("UserServiceImpl.LoginUser() with a wrong password error = %v, want invalid credentials", err)
+	}
+	if err := login("john@example.com", "correct-horse-42"); err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := login("John@Example.com", "wrong-password"); err == nil || err.Error() != "invalid credentials" {
+			t.Fatalf("UserServiceImpl.LoginUser() failure %d error = %v, want invalid credentials", i+1, err)
+		}
+	}
+	// the email is locked out, even with the right password.
+	wantThrottled(login("john@example.com", "correct-horse-42"), time.Hour)
+
+	if email := receiveEmail(t, messages, "Suspicious login activity on your account"); email["to"] != "john@example.com" {
+		t.Errorf("suspicious login email sent to %q, want john@example.com", email["to"])
+	}
+
+	// the ip has failed 4 times as the throttled login is not counted, its
+	// next 2 failures delay every email it tries.
+	for i := 0; i < 2; i++ {
+		if err := login("unknown@example.com", "wrong-password"); err == nil || err.Error() != "invalid credentials" {
+			t.Fatalf("UserServiceImpl.LoginUser() of an unknown email error = %v, want invalid credentials", err)
+		}
+	}
+	wantThrottled(login("jane@example.com", "correct-horse-42"), time.Hour)
+	if _, _, err := s.LoginUser(WithClientIP(context.Background(), "198.51.100.1"), "jane@example.com", "correct-horse-42"); err != nil {
+		t.Errorf("UserServiceImpl.LoginUser() from another ip error = %v", err)
+	}
+}
+
+func TestUserServiceImpl_LoginUser_ConcurrentThrottling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	emailPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithLoginThrottling(lockout.NewMemoryStore(), emailPolicy, lockout.DefaultIPPolicy),
+	)
+	_, err := s.CreateUser(ctx, &users.User{FullName: "Test User", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+
+	// every attempt of a burst is recorded before its password is checked,
+	// so only the free failures get to check one.
+	const burst = 10
+	checked := make(chan bool, burst)
+	for i := 0; i < burst; i++ {
+		go func() {
+			_, _, err := s.LoginUser(ctx, "john@example.com", "wrong-password")
+			var throttledErr *LoginThrottledError
+			checked <- !errors.As(err, &throttledErr)
+		}()
+	}
+	passwordsChecked := 0
+	for i := 0; i < burst; i++ {
+		if <-checked {
+			passwordsChecked++
+		}
+	}
+	if passwordsChecked != emailPolicy.FreeFailures+1 {
+		t.Errorf("UserServiceImpl.LoginUser() checked %d passwords of a burst, want %d", passwordsChecked, emailPolicy.FreeFailures+1)
+	}
+}
+
+func TestUserServiceImpl_LoginUser_ThrottledAttemptsNotCounted(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	attemptStore := lockout.NewMemoryStore()
+	emailPolicy := lockout.Policy{FreeFailures: 1, BaseDelay: time.Hour, Window: time.Hour}
+	ipPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithLoginThrottling(attemptStore, emailPolicy, ipPolicy),
+		WithPasswordReset("https://shop.example.com/reset-password", time.Hour),
+	)
+	for _, email := range []string{"john@example.com", "jane@example.com"} {
+		_, err := s.CreateUser(ctx, &users.User{FullName: "Test User", Email: email, Password: "correct-horse-42"})
+		if err != nil {
+			t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+		}
+	}
+	failures := func(key string) *lockout.Attempts {
+		t.Helper()
+		attempts, err := attemptStore.GetAttempts(ctx, key, time.Now())
+		if err != nil {
+			t.Fatalf("MemoryStore.GetAttempts() error = %v", err)
+		}
+		return attempts
+	}
+
+	var throttledErr *LoginThrottledError
+	for i := 0; i < 2; i++ {
+		if _, _, err := s.LoginUser(ctx, "john@example.com", "wrong-password"); err == nil || errors.As(err, &throttledErr) {
+			t.Fatalf("UserServiceImpl.LoginUser() failure %d error = %v, want invalid credentials", i+1, err)
+		}
+	}
+	locked := failures(loginAttemptKey("email", "john@example.com"))
+	// retrying while throttled neither counts nor delays the email further.
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); !errors.As(err, &throttledErr) {
+			t.Fatalf("UserServiceImpl.LoginUser() retry %d error = %v, want a LoginThrottledError", i+1, err)
+		}
+	}
+	if got := failures(loginAttemptKey("email", "john@example.com")); got.Failures != 2 || !got.LastFailureAt.Equal(locked.LastFailureAt) {
+		t.Errorf("email attempts after throttled retries = %+v, want %+v", got, locked)
+	}
+	if got := failures(loginAttemptKey("ip", "203.0.113.7")); got.Failures != 2 {
+		t.Errorf("ip attempts after throttled retries = %d failures, want 2", got.Failures)
+	}
+
+	// a login throttled by its ip does not count for its email.
+	if _, _, err := s.LoginUser(ctx, "jane@example.com", "wrong-password"); err == nil || errors.As(err, &throttledErr) {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v, want invalid credentials", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "jane@example.com", "wrong-password"); !errors.As(err, &throttledErr) {
+		t.Fatalf("UserServiceImpl.LoginUser() from a throttled ip error = %v, want a LoginThrottledError", err)
+	}
+	if got := failures(loginAttemptKey("email", "jane@example.com")); got.Failures != 1 {
+		t.Errorf("email attempts after a login throttled by its ip = %d failures, want 1", got.Failures)
+	}
+
+	// a password reset lifts the lockout of the email.
+	if err := s.RequestPasswordReset(context.Background(), "john@example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestPasswordReset() error = %v", err)
+	}
+	token := receiveResetToken(t, messages, "john@example.com")
+	if err := s.ResetPassword(ctx, token, "battery-staple-7"); err != nil {
+		t.Fatalf("UserServiceImpl.ResetPassword() error = %v", err)
+	}
+	if _, _, err := s.LoginUser(WithClientIP(context.Background(), "198.51.100.1"), "john@example.com", "battery-staple-7"); err != nil {
+		t.Errorf("UserServiceImpl.LoginUser() after a password reset error = %v", err)
+	}
+}
+
+func TestUserServiceImpl_ConsumeMagicLink_Throttling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	ipPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithLoginThrottling(lockout.NewMemoryStore(), lockout.DefaultEmailPolicy, ipPolicy),
+	)
+
+	for i := 0; i < 3; i++ {
+		if _, _, err := s.ConsumeMagicLink(ctx, "guessed-token"); err != onetime.ErrInvalidToken {
+			t.Fatalf("UserServiceImpl.ConsumeMagicLink() attempt %d error = %v, want %v", i+1, err, onetime.ErrInvalidToken)
+		}
+	}
+	var throttledErr *LoginThrottledError
+	if _, _, err := s.ConsumeMagicLink(ctx, "guessed-token"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() after 3 invalid tokens error = %v, want a LoginThrottledError", err)
+	}
+	if _, _, err := s.ConsumeMagicLink(WithClientIP(context.Background(), "198.51.100.1"), "guessed-token"); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() from another ip error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+}
+
+func TestUserServiceImpl_RequestPasswordReset_Throttling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	emailPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	ipPolicy := lockout.Policy{FreeFailures: 3, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithLoginThrottling(lockout.NewMemoryStore(), emailPolicy, ipPolicy),
+	)
+
+	var throttledErr *LoginThrottledError
+	for i := 0; i < 3; i++ {
+		if err := s.RequestPasswordReset(ctx, "john@example.com"); err != nil {
+			t.Fatalf("UserServiceImpl.RequestPasswordReset() request %d error = %v", i+1, err)
+		}
+	}
+	if err := s.RequestPasswordReset(ctx, "John@Example.com"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() after 3 requests for the email error = %v, want a LoginThrottledError", err)
+	}
+	// the throttled request is not counted for the ip.
+	if err := s.RequestPasswordReset(ctx, "jane@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() for another email error = %v, want nil", err)
+	}
+	if err := s.RequestPasswordReset(ctx, "joe@example.com"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() after 4 requests from the ip error = %v, want a LoginThrottledError", err)
+	}
+	if err := s.RequestPasswordReset(WithClientIP(context.Background(), "198.51.100.1"), "joe@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() from another ip error = %v, want nil", err)
+	}
+}
+
+func TestUserServiceImpl_RequestMagicLink_Throttling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	emailPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	ipPolicy := lockout.Policy{FreeFailures: 3, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithLoginThrottling(lockout.NewMemoryStore(), emailPolicy, ipPolicy),
+	)
+
+	var throttledErr *LoginThrottledError
+	for i := 0; i < 3; i++ {
+		if err := s.RequestMagicLink(ctx, "john@example.com"); err != nil {
+			t.Fatalf("UserServiceImpl.RequestMagicLink() request %d error = %v", i+1, err)
+		}
+	}
+	if err := s.RequestMagicLink(ctx, "John@Example.com"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.RequestMagicLink() after 3 requests for the email error = %v, want a LoginThrottledError", err)
+	}
+	// password resets are counted apart.
+	if err := s.RequestPasswordReset(WithClientIP(context.Background(), "198.51.100.1"), "john@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() of the throttled email error = %v, want nil", err)
+	}
+	// the throttled request is not counted for the ip.
+	if err := s.RequestMagicLink(ctx, "jane@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestMagicLink() for another email error = %v, want nil", err)
+	}
+	if err := s.RequestMagicLink(ctx, "joe@example.com"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.RequestMagicLink() after 4 requests from the ip error = %v, want a LoginThrottledError", err)
+	}
+	if err := s.RequestMagicLink(WithClientIP(context.Background(), "198.51.100.1"), "joe@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestMagicLink() from another ip error = %v, want nil", err)
+	}
+}
+
+func TestUserServiceImpl_ChangePassword_Throttling(t *testing.T) {
+	ctx := WithClientIP(context.Background(), "203.0.113.7")
+	emailPolicy := lockout.Policy{FreeFailures: 2, BaseDelay: time.Hour, Window: time.Hour}
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithLoginThrottling(lockout.NewMemoryStore(), emailPolicy, lockout.Policy{}),
+	)
+	_, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	// wrong current passwords count as failed logins of the email.
+	for i := 0; i < 3; i++ {
+		if _, err := s.ChangePassword(ctx, login.AccessToken, "", "wrong-password", "battery-staple-7"); err != ErrIncorrectPassword {
+			t.Fatalf("UserServiceImpl.ChangePassword() failure %d error = %v, want %v", i+1, err, ErrIncorrectPassword)
+		}
+	}
+	var throttledErr *LoginThrottledError
+	if _, err := s.ChangePassword(ctx, login.AccessToken, "", "correct-horse-42", "battery-staple-7"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.ChangePassword() after 3 wrong passwords error = %v, want a LoginThrottledError", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.LoginUser() after the failed password changes error = %v, want a LoginThrottledError", err)
+	}
+}
+
+func TestUserServiceImpl_ConfirmTOTPEnrollment_Throttling(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil,
+		WithTOTP(mfa.NewMemoryStore(), ""),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	setup, err := s.BeginTOTPEnrollment(ctx, login.AccessToken, user.ID, "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.BeginTOTPEnrollment() error = %v", err)
+	}
+
+	wrongCode, _ := mfa.Code(setup.Secret, mfa.Step(time.Now())+5)
+	for i := 0; i < mfaCodePolicy.FreeFailures+1; i++ {
+		if _, err := s.ConfirmTOTPEnrollment(ctx, login.AccessToken, user.ID, wrongCode); err != ErrInvalidMFACode {
+			t.Fatalf("UserServiceImpl.ConfirmTOTPEnrollment() failure %d error = %v, want %v", i+1, err, ErrInvalidMFACode)
+		}
+	}
+	code, _ := mfa.Code(setup.Secret, mfa.Step(time.Now()))
+	var throttledErr *LoginThrottledError
+	if _, err := s.ConfirmTOTPEnrollment(ctx, login.AccessToken, user.ID, code); !errors.As(err, &throttledErr) {
+		t.Errorf("UserServiceImpl.ConfirmTOTPEnrollment() after the free failures error = %v, want a LoginThrottledError", err)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+const defaultMagicLinkLifetime = 15 * time.Minute
+
+// WithMagicLink sets the page magic login emails link to, the token is added
+// to it as the token query parameter, and how long magic link tokens are
+// valid for. An empty loginURL sends the bare token and a zero lifetime keeps
+// the default of 15 minutes.
+func WithMagicLink(loginURL string, lifetime time.Duration) Option {
+	return func(s *UserServiceImpl) {
+		s.magicLinkURL = loginURL
+		if lifetime > 0 {
+			s.magicLinkLifetime = lifetime
+		}
+	}
+}
+
+// RequestMagicLink is the service handler to email a passwordless login link
+// to the user with the email. It succeeds whether or not the user exists so
+// that it cannot be used to find out which emails are registered. Requests
+// are throttled per email and per client ip like failed logins.
+func (s *UserServiceImpl) RequestMagicLink(ctx context.Context, email string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RequestMagicLink")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if email == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no email provided"), log.Event("input validation"))
+		return errors.New("email is required")
+	}
+	err := s.throttleEmailRequest(ctx, span, "magic-link", email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.GetUserByEmail"))
+		return ErrTryAgain
+	}
+	if user == nil {
+		span.LogFields(log.Event("no user with email, no magic link sent"))
+		return nil
+	}
+	span.SetTag("userId", user.ID)
+
+	token, tokenHash, err := onetime.NewToken()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("magic link token generation"))
+		return ErrTryAgain
+	}
+	now := time.Now().UTC()
+	err = s.oneTimeTokenStore.CreateToken(ctx, &onetime.Token{
+		Hash:        tokenHash,
+		Purpose:     onetime.PurposeMagicLink,
+		UserID:      user.ID,
+		UserVersion: user.Version,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.magicLinkLifetime),
+	})
+	if err != nil {
+		return ErrTryAgain
+	}
+	s.publishMagicLinkSendEmailEvent(span, user, token)
+	return nil
+}
+
+func (s *UserServiceImpl) publishMagicLinkSendEmailEvent(span opentracing.Span, user *users.User, token string) {
+	loginLink, err := tokenLink(s.magicLinkURL, token)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("parsing magic link url"))
+		return
+	}
+	s.publishEvent(span, "publish-magic-link-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Your login link",
+		"body": fmt.Sprintf(
+			"Use %s to log in to your account within %s, the link works once. You can ignore this email if you didn't ask for it.",
+			loginLink, s.magicLinkLifetime,
+		),
+	})
+}
+
+// ConsumeMagicLink is the service handler to log a user in with a magic link
+// token, it returns the same as LoginUser. The token is invalidated by its use
+// and by any change to the user since it was issued. Using the link proves
+// that the user owns the email, so unverified emails are verified. Invalid
+// tokens are counted as failed logins of the client ip.
+func (s *UserServiceImpl) ConsumeMagicLink(ctx context.Context, token string) (*users.User, *sessions.TokenPair, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ConsumeMagicLink")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if token == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no token provided"), log.Event("input validation"))
+		return nil, nil, errors.New("token is required")
+	}
+
+	now := time.Now().UTC()
+	ip := clientIP(ctx)
+	err := s.reserveIPAttempt(ctx, span, ip, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	linkToken, err := s.oneTimeTokenStore.ConsumeToken(ctx, onetime.HashToken(token), onetime.PurposeMagicLink, now)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.ConsumeToken"))
+		return nil, nil, err
+	}
+	if err != nil {
+		s.releaseIPAttempt(ctx, span, ip)
+		return nil, nil, ErrTryAgain
+	}
+	span.SetTag("userId", linkToken.UserID)
+	user, err := s.userRepo.GetUserByID(ctx, linkToken.UserID)
+	if err == nil && user.Version != linkToken.UserVersion {
+		err = users.ErrVersionConflict
+	}
+	if errors.Is(err, users.ErrUserNotFound) || errors.Is(err, users.ErrVersionConflict) {
+		// the user has been deleted or changed since the token was issued.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("magic link user"))
+		return nil, nil, onetime.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	s.releaseIPAttempt(ctx, span, ip)
+	if !user.EmailVerified {
+		verified := true
+		verifiedUser, err := s.userRepo.UpdateUser(ctx, user.ID, users.UserUpdate{EmailVerified: &verified})
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("verifying email"))
+		} else {
+			user = verifiedUser
+			s.publishUserChangeEvent(span, users.EventUpdated, user)
+		}
+	}
+	// the link only replaces the password, users with two-factor
+	// authentication still need their code.
+	err = s.requireMFA(ctx, span, user, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var magicLinkPattern = regexp.MustCompile(`https://shop\.example\.com/magic-login\?token=\S+`)
+
+// receiveMagicLinkToken returns the token of the magic link email published
+// to the address, or fails the test.
+func receiveMagicLinkToken(t *testing.T, messages chan *nats.Msg, to string) string {
+	for {
+		select {
+		case msg := <-messages:
+			var email map[string]string
+			json.Unmarshal(msg.Data, &email)
+			link := magicLinkPattern.FindString(email["body"])
+			if email["to"] != to || link == "" {
+				continue
+			}
+			loginURL, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parsing magic link %q error = %v", link, err)
+			}
+			return loginURL.Query().Get("token")
+		case <-time.After(time.Second):
+			t.Fatalf("no magic link email was sent to %s", to)
+			return ""
+		}
+	}
+}
+
+func TestUserServiceImpl_MagicLink(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithMagicLink("https://shop.example.com/magic-login", 15*time.Minute),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+
+	if err := s.RequestMagicLink(ctx, ""); err == nil {
+		t.Errorf("UserServiceImpl.RequestMagicLink() with an empty email should fail")
+	}
+	if err := s.RequestMagicLink(ctx, "unknown@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestMagicLink() of an unknown email error = %v, want nil", err)
+	}
+	if err := s.RequestMagicLink(ctx, "John@Example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestMagicLink() error = %v", err)
+	}
+	token := receiveMagicLinkToken(t, messages, "john@example.com")
+
+	if _, _, err := s.ConsumeMagicLink(ctx, "unknown"); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() with an unknown token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+	got, tokens, err := s.ConsumeMagicLink(ctx, token)
+	if err != nil || got.ID != user.ID || tokens == nil {
+		t.Fatalf("UserServiceImpl.ConsumeMagicLink() = %v, %v, %v, want the user and tokens", got, tokens, err)
+	}
+	// the link was emailed to the user, so using it verifies the email.
+	if !got.EmailVerified {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() user email verified = false, want true")
+	}
+	if _, err := s.GetUserFromJWT(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with the magic link access token error = %v", err)
+	}
+	if _, _, err := s.ConsumeMagicLink(ctx, token); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() with a used token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+
+	// links issued before the password changed cannot be used anymore.
+	if err := s.RequestMagicLink(ctx, "john@example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestMagicLink() error = %v", err)
+	}
+	staleToken := receiveMagicLinkToken(t, messages, "john@example.com")
+	if _, err := s.ChangePassword(ctx, tokens.AccessToken, user.ID, "correct-horse-42", "battery-staple-7"); err != nil {
+		t.Fatalf("UserServiceImpl.ChangePassword() error = %v", err)
+	}
+	if _, _, err := s.ConsumeMagicLink(ctx, staleToken); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() with a stale token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+}
+
+func TestUserServiceImpl_MagicLink_MFA(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithMagicLink("https://shop.example.com/magic-login", 15*time.Minute),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	setup, err := s.BeginTOTPEnrollment(ctx, login.AccessToken, user.ID, "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.BeginTOTPEnrollment() error = %v", err)
+	}
+	step := mfa.Step(time.Now())
+	code, _ := mfa.Code(setup.Secret, step)
+	if _, err := s.ConfirmTOTPEnrollment(ctx, login.AccessToken, user.ID, code); err != nil {
+		t.Fatalf("UserServiceImpl.ConfirmTOTPEnrollment() error = %v", err)
+	}
+
+	// the link replaces the password, not the second factor.
+	if err := s.RequestMagicLink(ctx, "john@example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestMagicLink() error = %v", err)
+	}
+	_, tokens, err := s.ConsumeMagicLink(ctx, receiveMagicLinkToken(t, messages, "john@example.com"))
+	var mfaErr *MFARequiredError
+	if !errors.As(err, &mfaErr) || tokens != nil {
+		t.Fatalf("UserServiceImpl.ConsumeMagicLink() = %v, %v, want an MFARequiredError", tokens, err)
+	}
+	code, _ = mfa.Code(setup.Secret, step+1)
+	if _, tokens, err := s.CompleteLoginMFA(ctx, mfaErr.ChallengeToken, code); err != nil || tokens == nil {
+		t.Errorf("UserServiceImpl.CompleteLoginMFA() = %v, %v, want tokens", tokens, err)
+	}
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/lockout"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var (
+	ErrInvalidMFACode = errors.New("invalid two-factor authentication code")
+	// ErrReauthenticationRequired is returned when a sensitive change needs
+	// the current password or a login more recent than freshLoginWindow.
+	ErrReauthenticationRequired = errors.New("current password or a fresh login is required")
+)
+
+const (
+	defaultTOTPIssuer           = "ecommerce"
+	defaultMFAChallengeLifetime = 5 * time.Minute
+	// freshLoginWindow is how long after logging in users without a
+	// password may start a TOTP enrollment.
+	freshLoginWindow = 5 * time.Minute
+)
+
+// mfaCodePolicy throttles the codes tried for a user, codes are short so
+// they are locked out much sooner than passwords.
+var mfaCodePolicy = lockout.Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        30 * time.Second,
+	LockoutFailures: 10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// MFARequiredError is returned by LoginUser instead of tokens when the
+// password is correct but the user has two-factor authentication enabled,
+// the login is completed by CompleteLoginMFA with the challenge token. Callers
+// unaware of two-factor authentication see it as a failed login.
+type MFARequiredError struct {
+	ChallengeToken string
+	ExpiresAt      time.Time
+}
+
+func (e *MFARequiredError) Error() string {
+	return "two-factor authentication code required"
+}
+
+// WithTOTP keeps the TOTP enrollments of users in store, issuer is the name
+// authenticator apps show for the account. Enrollments are kept in memory by
+// default and an empty issuer keeps the default.
+func WithTOTP(store mfa.Store, issuer string) Option {
+	return func(s *UserServiceImpl) {
+		s.mfaStore = store
+		if issuer != "" {
+			s.totpIssuer = issuer
+		}
+	}
+}
+
+// BeginTOTPEnrollment is the service handler for a logged in user to start
+// setting up TOTP, jwtToken is their access token and userID must be theirs
+// when set. The user confirms it is them with their current password, or
+// without one within freshLoginWindow of logging in. It replaces any pending
+// enrollment with a new secret.
+func (s *UserServiceImpl) BeginTOTPEnrollment(ctx context.Context, jwtToken, userID, currentPassword string) (*mfa.Setup, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "BeginTOTPEnrollment")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.userId", userID)
+
+	user, claims, err := s.accessTokenUser(ctx, span, jwtToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	if currentPassword != "" {
+		err = s.checkCurrentPassword(ctx, span, user, currentPassword)
+		if err != nil {
+			return nil, err
+		}
+	} else if claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > freshLoginWindow {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrReauthenticationRequired), log.Event("reauthentication"))
+		return nil, ErrReauthenticationRequired
+	}
+	secret, err := mfa.NewSecret()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("totp secret generation"))
+		return nil, ErrTryAgain
+	}
+	err = s.mfaStore.SavePendingTOTP(ctx, &mfa.TOTP{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, mfaStoreError(span, err, "mfaStore.SavePendingTOTP")
+	}
+	return &mfa.Setup{
+		Secret: secret,
+		URI:    mfa.KeyURI(s.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTPEnrollment is the service handler for a logged in user to
+// enable their pending TOTP enrollment with a first code from their
+// authenticator app, jwtToken is their access token and userID must be theirs
+// when set. Wrong codes are throttled like the codes of CompleteLoginMFA. It
+// returns the recovery codes of the user, which are not stored in clear and
+// cannot be retrieved later.
+func (s *UserServiceImpl) ConfirmTOTPEnrollment(ctx context.Context, jwtToken, userID, code string) ([]string, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ConfirmTOTPEnrollment")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.userId", userID)
+	if code == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no code provided"), log.Event("input validation"))
+		return nil, errors.New("code is required")
+	}
+
+	user, _, err := s.accessTokenUser(ctx, span, jwtToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	totp, err := s.mfaStore.GetTOTP(ctx, user.ID)
+	if err == nil && totp.Enabled() {
+		err = mfa.ErrAlreadyEnabled
+	}
+	if err != nil {
+		return nil, mfaStoreError(span, err, "mfaStore.GetTOTP")
+	}
+	now := time.Now().UTC()
+	attemptKey := loginAttemptKey("mfa", user.ID)
+	err = s.reserveMFAAttempt(ctx, span, attemptKey, now)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := mfa.Validate(totp.Secret, code, now)
+	if !ok {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrInvalidMFACode), log.Event("totp validation"))
+		return nil, ErrInvalidMFACode
+	}
+	err = s.loginAttemptStore.Reset(ctx, attemptKey)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.Reset"))
+	}
+	codes, hashes, err := mfa.NewRecoveryCodes()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("recovery code generation"))
+		return nil, ErrTryAgain
+	}
+	err = s.mfaStore.EnableTOTP(ctx, user.ID, hashes, step, now)
+	if err != nil {
+		return nil, mfaStoreError(span, err, "mfaStore.EnableTOTP")
+	}
+	s.publishMFAEnabledSendEmailEvent(span, user)
+	return codes, nil
+}
+
+// CompleteLoginMFA is the service handler to finish a login that LoginUser
+// challenged, code is either the current TOTP code or an unused recovery
+// code. The challenge token can be retried with another code until it
+// expires, failures are throttled per user.
+func (s *UserServiceImpl) CompleteLoginMFA(ctx context.Context, challengeToken, code string) (*users.User, *sessions.TokenPair, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CompleteLoginMFA")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if challengeToken == "" || code == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "challenge token or code missing"), log.Event("input validation"))
+		return nil, nil, errors.New("challenge token and code are required")
+	}
+
+	now := time.Now().UTC()
+	tokenHash := onetime.HashToken(challengeToken)
+	challenge, err := s.oneTimeTokenStore.GetToken(ctx, tokenHash, onetime.PurposeMFAChallenge, now)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.GetToken"))
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	span.SetTag("userId", challenge.UserID)
+
+	user, err := s.userRepo.GetUserByID(ctx, challenge.UserID)
+	if err == nil && user.Version != challenge.UserVersion {
+		// the password may have been changed since the challenge was issued.
+		err = users.ErrVersionConflict
+	}
+	if errors.Is(err, users.ErrUserNotFound) || errors.Is(err, users.ErrVersionConflict) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("challenge user"))
+		return nil, nil, onetime.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	totp, err := s.mfaStore.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, nil, mfaStoreError(span, err, "mfaStore.GetTOTP")
+	}
+	attemptKey := loginAttemptKey("mfa", user.ID)
+	err = s.reserveMFAAttempt(ctx, span, attemptKey, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	usedRecoveryCode, err := s.useMFACode(ctx, span, totp, code, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = s.oneTimeTokenStore.ConsumeToken(ctx, tokenHash, onetime.PurposeMFAChallenge, now)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		// the challenge was completed concurrently.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.ConsumeToken"))
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	err = s.loginAttemptStore.Reset(ctx, attemptKey)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("loginAttemptStore.Reset"))
+	}
+	if usedRecoveryCode {
+		s.publishRecoveryCodeUsedSendEmailEvent(span, user, len(totp.RecoveryCodeHashes)-1)
+	}
+	tokens, err := s.startSession(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// requireMFA returns an MFARequiredError with a new challenge when the user
+// has two-factor authentication enabled, nil when they do not.
+func (s *UserServiceImpl) requireMFA(ctx context.Context, span opentracing.Span, user *users.User, now time.Time) error {
+	totp, err := s.mfaStore.GetTOTP(ctx, user.ID)
+	if errors.Is(err, mfa.ErrNotEnrolled) || (err == nil && !totp.Enabled()) {
+		return nil
+	}
+	if err != nil {
+		return mfaStoreError(span, err, "mfaStore.GetTOTP")
+	}
+	token, hash, err := onetime.NewToken()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mfa challenge generation"))
+		return ErrTryAgain
+	}
+	challenge := &onetime.Token{
+		Hash:        hash,
+		Purpose:     onetime.PurposeMFAChallenge,
+		UserID:      user.ID,
+		UserVersion: user.Version,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(defaultMFAChallengeLifetime),
+	}
+	err = s.oneTimeTokenStore.CreateToken(ctx, challenge)
+	if err != nil {
+		return ErrTryAgain
+	}
+	span.LogFields(log.Event("mfa required"))
+	return &MFARequiredError{ChallengeToken: token, ExpiresAt: challenge.ExpiresAt}
+}
+
+// reserveMFAAttempt records a failed code for the attempt key of a user
+// before the code is checked, and returns a LoginThrottledError when the
+// codes that failed before make the user wait. The key is reset once a code
+// is right.
+func (s *UserServiceImpl) reserveMFAAttempt(ctx context.Context, span opentracing.Span, key string, now time.Time) error {
+	_, retryAfter, err := s.reserveAttempt(ctx, span, key, mfaCodePolicy, now)
+	if err != nil {
+		return err
+	}
+	return throttledError(span, retryAfter, "mfa throttling")
+}
+
+// useMFACode checks code against the enrollment and marks it used so that it
+// cannot be replayed, it reports whether code was a recovery code.
+func (s *UserServiceImpl) useMFACode(ctx context.Context, span opentracing.Span, totp *mfa.TOTP, code string, now time.Time) (recoveryCode bool, err error) {
+	if step, ok := mfa.Validate(totp.Secret, code, now); ok {
+		err = s.mfaStore.UseStep(ctx, totp.UserID, step)
+	} else {
+		recoveryCode = true
+		err = s.mfaStore.UseRecoveryCode(ctx, totp.UserID, mfa.HashRecoveryCode(code))
+	}
+	if errors.Is(err, mfa.ErrCodeUsed) || errors.Is(err, mfa.ErrNotEnrolled) {
+		err = ErrInvalidMFACode
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Bool("recoveryCode", recoveryCode), log.Event("mfa code validation"))
+	}
+	if err != nil && err != ErrInvalidMFACode {
+		return false, ErrTryAgain
+	}
+	return recoveryCode, err
+}
+
+// mfaStoreError traces err and returns the mfa errors callers can act on,
+// ErrTryAgain for any other.
+func mfaStoreError(span opentracing.Span, err error, event string) error {
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(err), log.Event(event))
+	if errors.Is(err, mfa.ErrNotEnrolled) || errors.Is(err, mfa.ErrAlreadyEnabled) {
+		return err
+	}
+	return ErrTryAgain
+}
+
+func (s *UserServiceImpl) publishMFAEnabledSendEmailEvent(span opentracing.Span, user *users.User) {
+	s.publishEvent(span, "publish-mfa-enabled-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Two-factor authentication was enabled",
+		"body":    "Logging in to your account now requires a code from your authenticator app. If it wasn't you, reset your password right away.",
+	})
+}
+
+func (s *UserServiceImpl) publishRecoveryCodeUsedSendEmailEvent(span opentracing.Span, user *users.User, remaining int) {
+	s.publishEvent(span, "publish-recovery-code-used-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "A recovery code was used to log in",
+		"body": fmt.Sprintf(
+			"A two-factor recovery code was used to log in to your account, %d recovery codes are left. If it wasn't you, reset your password right away.",
+			remaining,
+		),
+	})
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_LoginUser_MFA(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithTOTP(mfa.NewMemoryStore(), "Marketplace"),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+
+	_, userTokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, "", user.ID, "correct-horse-42"); err != ErrInvalidAccessToken {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() without an access token error = %v, want %v", err, ErrInvalidAccessToken)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, userTokens.AccessToken, "another-user", "correct-horse-42"); err != ErrNotTokenUser {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() for another user error = %v, want %v", err, ErrNotTokenUser)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, "wrong-password"); err != ErrIncorrectPassword {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() with a wrong password error = %v, want %v", err, ErrIncorrectPassword)
+	}
+	// without the password, only a fresh login may start an enrollment.
+	span := opentracing.StartSpan("test")
+	staleLogin, err := s.issueTokenPair(span, user, &sessions.Session{ID: "stale-session", CreatedAt: time.Now().Add(-time.Hour)}, "", time.Now())
+	if err != nil {
+		t.Fatalf("UserServiceImpl.issueTokenPair() error = %v", err)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, staleLogin.AccessToken, user.ID, ""); err != ErrReauthenticationRequired {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() an hour after logging in error = %v, want %v", err, ErrReauthenticationRequired)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, ""); err != nil {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() right after logging in error = %v", err)
+	}
+
+	// logins are a single step until the enrollment is confirmed.
+	setup, err := s.BeginTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.BeginTOTPEnrollment() error = %v", err)
+	}
+	uri, err := url.Parse(setup.URI)
+	if err != nil || uri.Path != "/Marketplace:john@example.com" || uri.Query().Get("secret") != setup.Secret {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() URI = %q, want the secret for Marketplace:john@example.com", setup.URI)
+	}
+	if _, tokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err != nil || tokens == nil {
+		t.Fatalf("UserServiceImpl.LoginUser() with a pending enrollment = %v, %v, want tokens", tokens, err)
+	}
+
+	step := mfa.Step(time.Now())
+	code := func(step int64) string {
+		c, _ := mfa.Code(setup.Secret, step)
+		return c
+	}
+	// the code of a step outside the allowed skew is wrong.
+	if _, err := s.ConfirmTOTPEnrollment(ctx, userTokens.AccessToken, "another-user", code(step)); err != ErrNotTokenUser {
+		t.Errorf("UserServiceImpl.ConfirmTOTPEnrollment() for another user error = %v, want %v", err, ErrNotTokenUser)
+	}
+	if _, err := s.ConfirmTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, code(step+5)); err != ErrInvalidMFACode {
+		t.Errorf("UserServiceImpl.ConfirmTOTPEnrollment() with a wrong code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	recoveryCodes, err := s.ConfirmTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, code(step))
+	if err != nil || len(recoveryCodes) != mfa.RecoveryCodeCount {
+		t.Fatalf("UserServiceImpl.ConfirmTOTPEnrollment() = %v, %v, want %d recovery codes", recoveryCodes, err, mfa.RecoveryCodeCount)
+	}
+	receiveEmail(t, messages, "Two-factor authentication was enabled")
+	if _, err := s.BeginTOTPEnrollment(ctx, userTokens.AccessToken, user.ID, "correct-horse-42"); err != mfa.ErrAlreadyEnabled {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() once enabled error = %v, want %v", err, mfa.ErrAlreadyEnabled)
+	}
+
+	login := func() string {
+		t.Helper()
+		_, tokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+		var mfaErr *MFARequiredError
+		if !errors.As(err, &mfaErr) || tokens != nil || mfaErr.ChallengeToken == "" {
+			t.Fatalf("UserServiceImpl.LoginUser() = %v, %v, want an MFARequiredError", tokens, err)
+		}
+		return mfaErr.ChallengeToken
+	}
+
+	// the code used to confirm the enrollment cannot be replayed, a wrong
+	// code leaves the challenge usable.
+	challenge := login()
+	if _, _, err := s.CompleteLoginMFA(ctx, challenge, code(step)); err != ErrInvalidMFACode {
+		t.Errorf("UserServiceImpl.CompleteLoginMFA() with a replayed code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	got, tokens, err := s.CompleteLoginMFA(ctx, challenge, code(step+1))
+	if err != nil || got.ID != user.ID || tokens == nil {
+		t.Fatalf("UserServiceImpl.CompleteLoginMFA() = %v, %v, %v, want the user and tokens", got, tokens, err)
+	}
+	if _, _, err := s.CompleteLoginMFA(ctx, challenge, code(step+1)); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.CompleteLoginMFA() with a used challenge error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+
+	// recovery codes work once each.
+	challenge = login()
+	if _, _, err := s.CompleteLoginMFA(ctx, challenge, recoveryCodes[0]); err != nil {
+		t.Fatalf("UserServiceImpl.CompleteLoginMFA() with a recovery code error = %v", err)
+	}
+	receiveEmail(t, messages, "A recovery code was used to log in")
+	challenge = login()
+	if _, _, err := s.CompleteLoginMFA(ctx, challenge, recoveryCodes[0]); err != ErrInvalidMFACode {
+		t.Errorf("UserServiceImpl.CompleteLoginMFA() with a used recovery code error = %v, want %v", err, ErrInvalidMFACode)
+	}
+	if _, _, err := s.CompleteLoginMFA(ctx, "unknown-challenge", recoveryCodes[1]); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.CompleteLoginMFA() with an unknown challenge error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUnknownProvider          = errors.New("unknown identity provider")
+	ErrProviderEmailNotVerified = errors.New("the identity provider has not verified the email")
+)
+
+// IDTokenVerifier verifies the ID tokens of an OpenID Connect provider, it is
+// implemented by *oidc.Verifier.
+type IDTokenVerifier interface {
+	Verify(ctx context.Context, idToken, nonce string) (*oidc.Claims, error)
+}
+
+// WithOIDC lets users log in with the ID tokens of the providers, keyed by the
+// name clients use for them. Identities are kept in store, in memory by
+// default.
+func WithOIDC(store oidc.IdentityStore, providers map[string]IDTokenVerifier) Option {
+	return func(s *UserServiceImpl) {
+		s.identityStore = store
+		s.oidcProviders = providers
+	}
+}
+
+// LoginWithIDToken is the service handler to log a user in with an ID token
+// of an OpenID Connect provider, it returns the same as LoginUser. The first
+// login with an account of the provider links it to the user with the
+// verified email of the token, or creates the user.
+func (s *UserServiceImpl) LoginWithIDToken(ctx context.Context, provider, idToken, nonce string) (*users.User, *sessions.TokenPair, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "LoginWithIDToken")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.provider", provider)
+	if provider == "" || idToken == "" || nonce == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "some field are empty"), log.Event("input validation"))
+		return nil, nil, errors.New("provider, id token and nonce are required")
+	}
+	verifier, ok := s.oidcProviders[provider]
+	if !ok {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrUnknownProvider), log.Event("input validation"))
+		return nil, nil, ErrUnknownProvider
+	}
+
+	claims, err := verifier.Verify(ctx, idToken, nonce)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("id token verification"))
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			return nil, nil, oidc.ErrInvalidIDToken
+		}
+		return nil, nil, ErrTryAgain
+	}
+	now := time.Now().UTC()
+	var user *users.User
+	identity, err := s.identityStore.GetIdentity(ctx, provider, claims.Subject)
+	switch {
+	case err == nil:
+		user, err = s.userRepo.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("userRepo.GetUserByID"))
+			return nil, nil, userRepoError(err)
+		}
+	case errors.Is(err, oidc.ErrIdentityNotFound):
+		user, err = s.linkIdentity(ctx, span, provider, claims, now)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("identityStore.GetIdentity"))
+		return nil, nil, ErrTryAgain
+	}
+	span.SetTag("userId", user.ID)
+
+	// the provider replaces the password, not the second factor.
+	err = s.requireMFA(ctx, span, user, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
+}
+
+// linkIdentity links the account of the claims to the user with its email,
+// creating the user when there is none. The provider must have verified the
+// email, as it is what the account is linked by.
+func (s *UserServiceImpl) linkIdentity(ctx context.Context, span opentracing.Span, provider string, claims *oidc.Claims, now time.Time) (*users.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrProviderEmailNotVerified), log.Event("id token email"))
+		return nil, ErrProviderEmailNotVerified
+	}
+	user, err := s.userRepo.GetUserByEmail(ctx, claims.Email)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.GetUserByEmail"))
+		return nil, ErrTryAgain
+	}
+	created := user == nil
+	if created {
+		user, err = s.createIdentityUser(ctx, span, claims)
+	} else if !user.EmailVerified {
+		user, err = s.claimUnverifiedUser(ctx, span, user, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.identityStore.CreateIdentity(ctx, &oidc.Identity{
+		ID:        primitive.NewObjectID().Hex(),
+		Provider:  provider,
+		Subject:   claims.Subject,
+		UserID:    user.ID,
+		Email:     claims.Email,
+		CreatedAt: now,
+	})
+	if errors.Is(err, oidc.ErrIdentityExists) {
+		// a concurrent login with the same account linked it first.
+		identity, err := s.identityStore.GetIdentity(ctx, provider, claims.Subject)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("identityStore.GetIdentity"))
+			return nil, ErrTryAgain
+		}
+		user, err = s.userRepo.GetUserByID(ctx, identity.UserID)
+		if err != nil {
+			return nil, userRepoError(err)
+		}
+		return user, nil
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("identityStore.CreateIdentity"))
+		return nil, ErrTryAgain
+	}
+	span.LogFields(log.Event("identity linked"), log.Bool("userCreated", created))
+	if !created {
+		s.publishIdentityLinkedSendEmailEvent(span, user, provider)
+	}
+	return user, nil
+}
+
+// createIdentityUser creates the user of an account of a provider, the user
+// has no password and its email is verified by the provider.
+func (s *UserServiceImpl) createIdentityUser(ctx context.Context, span opentracing.Span, claims *oidc.Claims) (*users.User, error) {
+	fullName := claims.Name
+	if fullName == "" {
+		fullName = claims.Email
+	}
+	user := &users.User{
+		FullName:      fullName,
+		Email:         claims.Email,
+		EmailVerified: true,
+	}
+	err := s.userRepo.CreateUser(ctx, user)
+	if errors.Is(err, users.ErrEmailTaken) {
+		// a concurrent signup with the same email won the race, or the user
+		// with the email is soft deleted.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.CreateUser"))
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	s.publishUserChangeEvent(span, users.EventCreated, user)
+	s.publishCreateUserSendEmailEvent(span, user)
+	return user, nil
+}
+
+// claimUnverifiedUser hands a user whose email was never verified over to the
+// owner of the email the provider verified. Whoever signed up with the email
+// may not own it, so their TOTP enrollment, the password they set and their
+// sessions are removed before the account is linked. Removing the password
+// changes the version of the user, which invalidates the reset, magic link
+// and MFA challenge tokens issued to them.
+func (s *UserServiceImpl) claimUnverifiedUser(ctx context.Context, span opentracing.Span, user *users.User, now time.Time) (*users.User, error) {
+	err := s.mfaStore.DeleteTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, mfaStoreError(span, err, "mfaStore.DeleteTOTP")
+	}
+	user, err = s.userRepo.UpdatePassword(ctx, user.ID, "", user.Version)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.UpdatePassword"))
+		return nil, ErrTryAgain
+	}
+	s.revokeUserSessions(ctx, span, user.ID, now)
+	verified := true
+	user, err = s.userRepo.UpdateUser(ctx, user.ID, users.UserUpdate{EmailVerified: &verified})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("verifying email"))
+		return nil, ErrTryAgain
+	}
+	s.publishUserChangeEvent(span, users.EventUpdated, user)
+	return user, nil
+}
+
+func (s *UserServiceImpl) publishIdentityLinkedSendEmailEvent(span opentracing.Span, user *users.User, provider string) {
+	s.publishEvent(span, "publish-identity-linked-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "A new sign-in method was added",
+		"body": fmt.Sprintf(
+			"You can now log in to your account with %s. If it wasn't you, reset your password and contact support right away.",
+			provider,
+		),
+	})
+}
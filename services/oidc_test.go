@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc/oidctest"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_LoginWithIDToken(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	google := oidctest.NewIssuer("shop")
+	defer google.Close()
+	apple := oidctest.NewIssuer("shop")
+	defer apple.Close()
+	identities := oidc.NewMemoryStore()
+	userRepo := users.NewMemoryRepository()
+	s := NewUserService(userRepo, &opentracing.NoopTracer{}, natsConn,
+		WithOIDC(identities, map[string]IDTokenVerifier{
+			"google": oidc.NewVerifier(google.Provider("google"), nil),
+			"apple":  oidc.NewVerifier(apple.Provider("apple"), nil),
+		}),
+	)
+
+	if _, _, err := s.LoginWithIDToken(ctx, "github", google.Sign(google.NewClaims("sub-1", "john@example.com")), oidctest.Nonce); err != ErrUnknownProvider {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() with an unknown provider error = %v, want %v", err, ErrUnknownProvider)
+	}
+	if _, _, err := s.LoginWithIDToken(ctx, "google", google.Sign(google.NewClaims("sub-1", "john@example.com")), ""); err == nil {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() without a nonce error = nil, want an error")
+	}
+	// tokens of another provider are not accepted.
+	if _, _, err := s.LoginWithIDToken(ctx, "google", apple.Sign(apple.NewClaims("sub-1", "john@example.com")), oidctest.Nonce); err != oidc.ErrInvalidIDToken {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() with a token of another provider error = %v, want %v", err, oidc.ErrInvalidIDToken)
+	}
+	unverified := google.NewClaims("sub-1", "john@example.com")
+	unverified["email_verified"] = false
+	if _, _, err := s.LoginWithIDToken(ctx, "google", google.Sign(unverified), oidctest.Nonce); err != ErrProviderEmailNotVerified {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() with an unverified email error = %v, want %v", err, ErrProviderEmailNotVerified)
+	}
+
+	// the first login creates the user, later logins find it by the account.
+	claims := google.NewClaims("sub-1", "john@example.com")
+	claims["name"] = "John Doe"
+	user, tokens, err := s.LoginWithIDToken(ctx, "google", google.Sign(claims), oidctest.Nonce)
+	if err != nil || tokens == nil {
+		t.Fatalf("UserServiceImpl.LoginWithIDToken() = %v, %v, %v, want a new user and tokens", user, tokens, err)
+	}
+	if user.FullName != "John Doe" || user.Email != "john@example.com" || !user.EmailVerified || user.Password != "" {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() created %+v, want a verified user without a password", user)
+	}
+	receiveEmail(t, messages, "Welcome to my microservice application")
+	if _, err := s.GetUserFromJWT(ctx, tokens.AccessToken); err != nil {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with the access token error = %v", err)
+	}
+	claims["email"] = "john.doe@example.com"
+	again, _, err := s.LoginWithIDToken(ctx, "google", google.Sign(claims), oidctest.Nonce)
+	if err != nil || again.ID != user.ID {
+		t.Errorf("UserServiceImpl.LoginWithIDToken() after the email changed = %v, %v, want user %s", again, err, user.ID)
+	}
+
+	// another provider with the same email links to the same user.
+	linked, _, err := s.LoginWithIDToken(ctx, "apple", apple.Sign(apple.NewClaims("apple-sub", "john@example.com")), oidctest.Nonce)
+	if err != nil || linked.ID != user.ID {
+		t.Fatalf("UserServiceImpl.LoginWithIDToken() with another provider = %v, %v, want user %s", linked, err, user.ID)
+	}
+	receiveEmail(t, messages, "A new sign-in method was added")
+	userIdentities, err := identities.ListUserIdentities(ctx, user.ID)
+	if err != nil || len(userIdentities) != 2 {
+		t.Errorf("IdentityStore.ListUserIdentities() = %+v, %v, want 2 identities", userIdentities, err)
+	}
+
+	if err := s.PurgeUser(ctx, user.ID); err != nil {
+		t.Fatalf("UserServiceImpl.PurgeUser() error = %v", err)
+	}
+	if userIdentities, _ := identities.ListUserIdentities(ctx, user.ID); len(userIdentities) != 0 {
+		t.Errorf("IdentityStore.ListUserIdentities() after the purge = %+v, want none", userIdentities)
+	}
+}
+
+func TestUserServiceImpl_LoginWithIDToken_UnverifiedUser(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	google := oidctest.NewIssuer("shop")
+	defer google.Close()
+	mfaStore := mfa.NewMemoryStore()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithOIDC(nil, map[string]IDTokenVerifier{"google": oidc.NewVerifier(google.Provider("google"), nil)}),
+		WithTOTP(mfaStore, ""),
+		WithMagicLink("https://shop.example.com/magic-login", 15*time.Minute),
+	)
+	// someone signed up with the email without proving they own it.
+	squatter, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, squatterTokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	// they also enroll TOTP, so that the owner would be asked for their code,
+	// and keep a magic link.
+	setup, err := s.BeginTOTPEnrollment(ctx, squatterTokens.AccessToken, squatter.ID, "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.BeginTOTPEnrollment() error = %v", err)
+	}
+	code, _ := mfa.Code(setup.Secret, mfa.Step(time.Now()))
+	if _, err := s.ConfirmTOTPEnrollment(ctx, squatterTokens.AccessToken, squatter.ID, code); err != nil {
+		t.Fatalf("UserServiceImpl.ConfirmTOTPEnrollment() error = %v", err)
+	}
+	if err := s.RequestMagicLink(ctx, "john@example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestMagicLink() error = %v", err)
+	}
+	squatterLink := receiveMagicLinkToken(t, messages, "john@example.com")
+
+	user, tokens, err := s.LoginWithIDToken(ctx, "google", google.Sign(google.NewClaims("sub-1", "john@example.com")), oidctest.Nonce)
+	if err != nil || user.ID != squatter.ID || !user.EmailVerified || tokens == nil {
+		t.Fatalf("UserServiceImpl.LoginWithIDToken() = %v, %v, %v, want the existing user with a verified email and tokens", user, tokens, err)
+	}
+	if _, err := mfaStore.GetTOTP(ctx, squatter.ID); err != mfa.ErrNotEnrolled {
+		t.Errorf("mfa.Store.GetTOTP() of the squatter enrollment error = %v, want %v", err, mfa.ErrNotEnrolled)
+	}
+	if _, _, err := s.ConsumeMagicLink(ctx, squatterLink); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ConsumeMagicLink() with a link issued before the link error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err == nil {
+		t.Errorf("UserServiceImpl.LoginUser() with the password set before the link succeeded, want an error")
+	}
+	if _, err := s.GetUserFromJWT(ctx, squatterTokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with a token issued before the link error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
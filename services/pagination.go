@@ -0,0 +1,82 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// WithPageTokenSecret sets the key GetUsers page tokens are signed with,
+// instances sharing the key accept each other's tokens. By default a random
+// key is generated, so tokens only work with the instance that issued them,
+// main.go always sets it.
+func WithPageTokenSecret(secret []byte) Option {
+	return func(s *UserServiceImpl) {
+		if len(secret) > 0 {
+			s.pageTokenSecret = secret
+		}
+	}
+}
+
+// pageToken is the content of the opaque page tokens.
+type pageToken struct {
+	Cursor users.Cursor `json:"cursor"`
+	Before bool         `json:"before,omitempty"`
+	// Filter is the fingerprint of the filters and sort order the token was
+	// issued for.
+	Filter string `json:"filter"`
+}
+
+// pageTokenFilter returns the fingerprint of the filters and sort order of
+// the request.
+func pageTokenFilter(req users.GetUsersRequest) string {
+	filter, _ := json.Marshal([]interface{}{
+		req.SortBy, req.Descending, req.Country, req.CreatedAfter.UTC(), req.CreatedBefore.UTC(),
+	})
+	sum := sha256.Sum256(filter)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// encodePageToken returns the token as base64 json followed by its HMAC
+// signature.
+func (s *UserServiceImpl) encodePageToken(token pageToken) string {
+	payload, _ := json.Marshal(token)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.signPageToken(encoded))
+}
+
+// decodePageToken checks the signature of the token and that it was issued
+// for the filter with the given fingerprint.
+func (s *UserServiceImpl) decodePageToken(encoded, filter string) (*pageToken, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidPageToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.signPageToken(parts[0])) {
+		return nil, ErrInvalidPageToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var token pageToken
+	err = json.Unmarshal(payload, &token)
+	if err != nil || token.Filter != filter {
+		return nil, ErrInvalidPageToken
+	}
+	return &token, nil
+}
+
+func (s *UserServiceImpl) signPageToken(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.pageTokenSecret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_GetUsers_Pages(t *testing.T) {
+	ctx := context.Background()
+	repo := users.NewMemoryRepository()
+	for _, name := range []string{"Eve", "Ann", "Dan", "Bob", "Cal"} {
+		repo.CreateUser(ctx, &users.User{FullName: name, Email: name + "@example.com"})
+	}
+	s := NewUserService(repo, &opentracing.NoopTracer{}, nil, WithPageTokenSecret([]byte("secret")))
+	req := users.GetUsersRequest{Limit: 2, SortBy: users.SortByFullName, IncludeTotalCount: true}
+
+	fullNames := func(res *users.GetUsersResponse) []string {
+		names := []string{}
+		for _, user := range res.Users {
+			names = append(names, user.FullName)
+		}
+		return names
+	}
+	getUsers := func(pageToken string) *users.GetUsersResponse {
+		req := req
+		req.PageToken = pageToken
+		res, err := s.GetUsers(ctx, req)
+		if err != nil {
+			t.Fatalf("UserServiceImpl.GetUsers() error = %v", err)
+		}
+		if res.TotalCount != 5 {
+			t.Errorf("UserServiceImpl.GetUsers() TotalCount = %v, want 5", res.TotalCount)
+		}
+		return res
+	}
+
+	// walk forward to the last page.
+	var pages [][]string
+	var responses []*users.GetUsersResponse
+	res := getUsers("")
+	for {
+		pages = append(pages, fullNames(res))
+		responses = append(responses, res)
+		if res.NextPageToken == "" {
+			break
+		}
+		res = getUsers(res.NextPageToken)
+	}
+	var names []string
+	for _, page := range pages {
+		names = append(names, page...)
+	}
+	if want := []string{"Ann", "Bob", "Cal", "Dan", "Eve"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("UserServiceImpl.GetUsers() pages = %v, want %v", pages, want)
+	}
+	if responses[0].PrevPageToken != "" {
+		t.Errorf("UserServiceImpl.GetUsers() first page PrevPageToken = %q, want none", responses[0].PrevPageToken)
+	}
+
+	// walk back from the last page to the first one.
+	res = responses[len(responses)-1]
+	for i := len(pages) - 2; i >= 0; i-- {
+		if res.PrevPageToken == "" {
+			t.Fatalf("UserServiceImpl.GetUsers() page %d has no PrevPageToken", i+1)
+		}
+		res = getUsers(res.PrevPageToken)
+		if got := fullNames(res); !reflect.DeepEqual(got, pages[i]) {
+			t.Errorf("UserServiceImpl.GetUsers() previous page = %v, want %v", got, pages[i])
+		}
+		if res.NextPageToken == "" {
+			t.Errorf("UserServiceImpl.GetUsers() previous page has no NextPageToken")
+		}
+	}
+	if res.PrevPageToken != "" {
+		t.Errorf("UserServiceImpl.GetUsers() first page PrevPageToken = %q, want none", res.PrevPageToken)
+	}
+
+	nextPageToken := responses[0].NextPageToken
+	tests := []struct {
+		name    string
+		service *UserServiceImpl
+		req     users.GetUsersRequest
+	}{
+		{
+			name:    "tampered token",
+			service: s,
+			req:     users.GetUsersRequest{Limit: 2, SortBy: users.SortByFullName, PageToken: "x" + nextPageToken},
+		},
+		{
+			name:    "token of another sort order",
+			service: s,
+			req:     users.GetUsersRequest{Limit: 2, SortBy: users.SortByFullName, Descending: true, PageToken: nextPageToken},
+		},
+		{
+			name:    "token of another filter",
+			service: s,
+			req:     users.GetUsersRequest{Limit: 2, SortBy: users.SortByFullName, CreatedAfter: time.Now(), PageToken: nextPageToken},
+		},
+		{
+			name:    "token signed with another secret",
+			service: NewUserService(repo, &opentracing.NoopTracer{}, nil),
+			req:     users.GetUsersRequest{Limit: 2, SortBy: users.SortByFullName, PageToken: nextPageToken},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.service.GetUsers(ctx, tt.req)
+			if !errors.Is(err, ErrInvalidPageToken) {
+				t.Errorf("UserServiceImpl.GetUsers() error = %v, want %v", err, ErrInvalidPageToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/passwords"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var ErrIncorrectPassword = errors.New("current password is incorrect")
+
+const defaultPasswordResetLifetime = time.Hour
+
+// WithOneTimeTokenStore keeps the single use tokens sent to users by email in
+// store, tokens are kept in memory by default.
+func WithOneTimeTokenStore(store onetime.Store) Option {
+	return func(s *UserServiceImpl) {
+		s.oneTimeTokenStore = store
+	}
+}
+
+// WithPasswordReset sets the page password reset emails link to, the token is
+// added to it as the token query parameter, and how long reset tokens are
+// valid for. An empty resetURL sends the bare token and a zero lifetime keeps
+// the default of 1 hour.
+func WithPasswordReset(resetURL string, lifetime time.Duration) Option {
+	return func(s *UserServiceImpl) {
+		s.passwordResetURL = resetURL
+		if lifetime > 0 {
+			s.passwordResetLifetime = lifetime
+		}
+	}
+}
+
+// WithPasswordPolicy sets the rules new passwords must follow, passwords of
+// 8 to 72 bytes are accepted by default.
+func WithPasswordPolicy(policy passwords.Policy) Option {
+	return func(s *UserServiceImpl) {
+		s.passwordPolicy = policy
+	}
+}
+
+// PasswordHasher hashes the passwords of users.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the hash.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash reports whether the hash should be replaced by a new hash
+	// of the password, such as when it was made with an older algorithm or
+	// weaker parameters.
+	NeedsRehash(hash string) bool
+}
+
+// WithPasswordHasher hashes and verifies passwords with hasher, passwords are
+// hashed with argon2id by default. Hashes the hasher wants to replace are
+// rehashed when their user logs in.
+func WithPasswordHasher(hasher PasswordHasher) Option {
+	return func(s *UserServiceImpl) {
+		s.passwordHasher = hasher
+	}
+}
+
+// RequestPasswordReset is the service handler to email a password reset token
+// to the user with the email. It succeeds whether or not the user exists so
+// that it cannot be used to find out which emails are registered. Requests
+// are throttled per email and per client ip like failed logins.
+func (s *UserServiceImpl) RequestPasswordReset(ctx context.Context, email string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RequestPasswordReset")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if email == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no email provided"), log.Event("input validation"))
+		return errors.New("email is required")
+	}
+	err := s.throttleEmailRequest(ctx, span, "reset", email)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.GetUserByEmail"))
+		return ErrTryAgain
+	}
+	if user == nil {
+		span.LogFields(log.Event("no user with email, no reset email sent"))
+		return nil
+	}
+	span.SetTag("userId", user.ID)
+
+	token, tokenHash, err := onetime.NewToken()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("reset token generation"))
+		return ErrTryAgain
+	}
+	now := time.Now().UTC()
+	err = s.oneTimeTokenStore.CreateToken(ctx, &onetime.Token{
+		Hash:        tokenHash,
+		Purpose:     onetime.PurposePasswordReset,
+		UserID:      user.ID,
+		UserVersion: user.Version,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.passwordResetLifetime),
+	})
+	if err != nil {
+		return ErrTryAgain
+	}
+	s.publishPasswordResetSendEmailEvent(span, user, token)
+	return nil
+}
+
+func (s *UserServiceImpl) publishPasswordResetSendEmailEvent(span opentracing.Span, user *users.User, token string) {
+	resetLink, err := tokenLink(s.passwordResetURL, token)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("parsing password reset url"))
+		return
+	}
+	s.publishEvent(span, "publish-password-reset-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Reset your password",
+		"body": fmt.Sprintf(
+			"Someone asked to reset the password of your account, use %s to choose a new password within %s. You can ignore this email if it wasn't you.",
+			resetLink, s.passwordResetLifetime,
+		),
+	})
+}
+
+// ResetPassword is the service handler to set a new password with a password
+// reset token. The token is invalidated by its use and by any change to the
+// user since it was issued, and every session of the user is revoked.
+func (s *UserServiceImpl) ResetPassword(ctx context.Context, token, newPassword string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ResetPassword")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if token == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no token provided"), log.Event("input validation"))
+		return errors.New("token is required")
+	}
+
+	// the password is checked before the token is consumed so that a password
+	// breaking the policy does not use the token up.
+	now := time.Now().UTC()
+	resetToken, err := s.oneTimeTokenStore.GetToken(ctx, onetime.HashToken(token), onetime.PurposePasswordReset, now)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.GetToken"))
+		return err
+	}
+	if err != nil {
+		return ErrTryAgain
+	}
+	span.SetTag("userId", resetToken.UserID)
+	user, err := s.userRepo.GetUserByID(ctx, resetToken.UserID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		return onetime.ErrInvalidToken
+	}
+	if err != nil {
+		return ErrTryAgain
+	}
+	err = s.checkPassword(span, "newPassword", newPassword, user)
+	if err != nil {
+		return err
+	}
+	resetToken, err = s.oneTimeTokenStore.ConsumeToken(ctx, onetime.HashToken(token), onetime.PurposePasswordReset, now)
+	if errors.Is(err, onetime.ErrInvalidToken) {
+		// the token was used concurrently.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.ConsumeToken"))
+		return err
+	}
+	if err != nil {
+		return ErrTryAgain
+	}
+
+	passwordHash, err := s.hashPassword(span, newPassword)
+	if err != nil {
+		return err
+	}
+	user, err = s.userRepo.UpdatePassword(ctx, resetToken.UserID, passwordHash, resetToken.UserVersion)
+	if errors.Is(err, users.ErrUserNotFound) || errors.Is(err, users.ErrVersionConflict) {
+		// the user has been deleted or changed since the token was issued.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.UpdateUser"))
+		return onetime.ErrInvalidToken
+	}
+	if err != nil {
+		return ErrTryAgain
+	}
+	if !user.EmailVerified {
+		// the reset token was emailed to the user, so using it proves that
+		// the user owns the email.
+		verified := true
+		verifiedUser, err := s.userRepo.UpdateUser(ctx, user.ID, users.UserUpdate{EmailVerified: &verified})
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("verifying email"))
+		} else {
+			user = verifiedUser
+		}
+	}
+	s.publishUserChangeEvent(span, users.EventUpdated, user)
+	// the password has been changed at this point, failing to revoke the
+	// sessions is traced rather than reported to the user.
+	s.revokeUserSessions(ctx, span, user.ID, now)
+	// the user proved they own the email, so the failed logins locking it
+	// out are forgotten.
+	s.resetLoginFailures(ctx, span, user.Email, "")
+	return nil
+}
+
+// ChangePassword is the service handler for a logged in user to change their
+// password, jwtToken is their access token and userID must be theirs when
+// set. Wrong current passwords are throttled like failed logins. Every
+// session of the user is revoked and a new session is started, whose tokens
+// are returned so that the caller stays logged in.
+func (s *UserServiceImpl) ChangePassword(ctx context.Context, jwtToken, userID, currentPassword, newPassword string) (*sessions.TokenPair, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ChangePassword")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.userId", userID)
+	if currentPassword == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no current password provided"), log.Event("input validation"))
+		return nil, errors.New("current password is required")
+	}
+
+	user, _, err := s.accessTokenUser(ctx, span, jwtToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkCurrentPassword(ctx, span, user, currentPassword)
+	if err != nil {
+		return nil, err
+	}
+	if newPassword != "" && newPassword == currentPassword {
+		err := &FieldError{Violations: []FieldViolation{
+			{Field: "newPassword", Description: "must differ from the current password"},
+		}}
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("password policy"))
+		return nil, err
+	}
+	err = s.checkPassword(span, "newPassword", newPassword, user)
+	if err != nil {
+		return nil, err
+	}
+	passwordHash, err := s.hashPassword(span, newPassword)
+	if err != nil {
+		return nil, err
+	}
+	// the version check fails when the password was changed since it was
+	// checked.
+	user, err = s.userRepo.UpdatePassword(ctx, user.ID, passwordHash, user.Version)
+	if err != nil {
+		return nil, userRepoError(err)
+	}
+	s.publishUserChangeEvent(span, users.EventUpdated, user)
+	s.publishPasswordChangedSendEmailEvent(span, user)
+
+	now := time.Now().UTC()
+	s.revokeUserSessions(ctx, span, user.ID, now)
+	return s.startSession(ctx, span, user)
+}
+
+func (s *UserServiceImpl) publishPasswordChangedSendEmailEvent(span opentracing.Span, user *users.User) {
+	s.publishEvent(span, "publish-password-changed-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Your password was changed",
+		"body": fmt.Sprintf(
+			"The password of your account was changed on %s and every session was logged out. If it wasn't you, reset your password right away.",
+			user.LastUpdated.UTC().Format(time.RFC1123),
+		),
+	})
+}
+
+// revokeUserSessions revokes every session of the user and denies their
+// access tokens after a password change or a deletion, failures are traced as
+// the change has already been made.
+func (s *UserServiceImpl) revokeUserSessions(ctx context.Context, span opentracing.Span, userID string, now time.Time) {
+	revoked, err := s.sessionStore.RevokeUserSessions(ctx, userID, now)
+	if err == nil {
+		err = s.denySessions(ctx, revoked, now)
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("revoking user sessions"))
+		return
+	}
+	span.SetTag("revokedSessions", len(revoked))
+}
+
+// checkPassword checks the new password of the user against the password
+// policy, violations are reported for field.
+func (s *UserServiceImpl) checkPassword(span opentracing.Span, field, password string, user *users.User) error {
+	descriptions := s.passwordPolicy.Check(password, user.Email, user.FullName)
+	if len(descriptions) == 0 {
+		return nil
+	}
+	err := &FieldError{}
+	for _, description := range descriptions {
+		err.Violations = append(err.Violations, FieldViolation{Field: field, Description: description})
+	}
+	ext.Error.Set(span, true)
+	span.LogFields(log.Error(err), log.Event("password policy"))
+	return err
+}
+
+// hashPassword returns the hash new passwords are stored as.
+func (s *UserServiceImpl) hashPassword(span opentracing.Span, password string) (string, error) {
+	passwordHash, err := s.passwordHasher.Hash(password)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.String("event", "password hash error"))
+		return "", ErrTryAgain
+	}
+	return passwordHash, nil
+}
+
+// verifyPassword reports whether the password is the password of the user.
+func (s *UserServiceImpl) verifyPassword(span opentracing.Span, user *users.User, password string) bool {
+	ok, err := s.passwordHasher.Verify(user.Password, password)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("password validation"))
+		return false
+	}
+	if !ok {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "password does not match"), log.Event("password validation"))
+	}
+	return ok
+}
+
+// checkCurrentPassword checks the password a logged in user gave to confirm
+// a sensitive change, wrong passwords count as failed logins of the user's
+// email and the client ip.
+func (s *UserServiceImpl) checkCurrentPassword(ctx context.Context, span opentracing.Span, user *users.User, password string) error {
+	ip := clientIP(ctx)
+	emailAttempts, err := s.reserveLoginAttempt(ctx, span, user.Email, ip, time.Now())
+	if err != nil {
+		return err
+	}
+	if !s.verifyPassword(span, user, password) {
+		s.loginFailed(span, emailAttempts, user, ip)
+		return ErrIncorrectPassword
+	}
+	s.resetLoginFailures(ctx, span, user.Email, ip)
+	return nil
+}
+
+// rehashPassword replaces the password hash of the user after a successful
+// login if the hasher wants to, so that hashes are migrated to the current
+// algorithm and parameters as users log in. The version of the user is kept so
+// that its pending tokens and the clients holding it are not invalidated. The
+// user is returned as stored, failures are traced as the login can go on with
+// the old hash.
+func (s *UserServiceImpl) rehashPassword(ctx context.Context, span opentracing.Span, user *users.User, password string) *users.User {
+	if !s.passwordHasher.NeedsRehash(user.Password) {
+		return user
+	}
+	passwordHash, err := s.hashPassword(span, password)
+	if err != nil {
+		return user
+	}
+	// a concurrent change of the password fails the hash check, the hash is
+	// then replaced on a later login.
+	rehashed, err := s.userRepo.ReplacePasswordHash(ctx, user.ID, user.Password, passwordHash)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.ReplacePasswordHash"))
+		return user
+	}
+	span.LogFields(log.Event("password rehashed"))
+	s.publishUserChangeEvent(span, users.EventUpdated, rehashed)
+	return rehashed
+}
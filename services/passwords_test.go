@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/passwords"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var resetLinkPattern = regexp.MustCompile(`https://shop\.example\.com/reset-password\?token=\S+`)
+
+// receiveResetToken returns the token of the password reset email published
+// to the address, or fails the test.
+func receiveResetToken(t *testing.T, messages chan *nats.Msg, to string) string {
+	for {
+		select {
+		case msg := <-messages:
+			var email map[string]string
+			json.Unmarshal(msg.Data, &email)
+			link := resetLinkPattern.FindString(email["body"])
+			if email["to"] != to || link == "" {
+				continue
+			}
+			resetURL, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parsing reset link %q error = %v", link, err)
+			}
+			return resetURL.Query().Get("token")
+		case <-time.After(time.Second):
+			t.Fatalf("no password reset email was sent to %s", to)
+			return ""
+		}
+	}
+}
+
+func TestUserServiceImpl_PasswordReset(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithPasswordReset("https://shop.example.com/reset-password", time.Hour),
+	)
+	_, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	if err := s.RequestPasswordReset(ctx, ""); err == nil {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() with an empty email should fail")
+	}
+	if err := s.RequestPasswordReset(ctx, "unknown@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.RequestPasswordReset() of an unknown email error = %v, want nil", err)
+	}
+	if err := s.RequestPasswordReset(ctx, "John@Example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestPasswordReset() error = %v", err)
+	}
+	staleToken := receiveResetToken(t, messages, "john@example.com")
+	if err := s.RequestPasswordReset(ctx, "john@example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.RequestPasswordReset() error = %v", err)
+	}
+	token := receiveResetToken(t, messages, "john@example.com")
+
+	if err := s.ResetPassword(ctx, token, ""); err == nil {
+		t.Errorf("UserServiceImpl.ResetPassword() with an empty password should fail")
+	}
+	// a password breaking the policy leaves the token usable.
+	var fieldErr *FieldError
+	if err := s.ResetPassword(ctx, token, "short"); !errors.As(err, &fieldErr) || fieldErr.Violations[0].Field != "newPassword" {
+		t.Errorf("UserServiceImpl.ResetPassword() with a short password error = %v, want a newPassword violation", err)
+	}
+	if err := s.ResetPassword(ctx, "unknown", "battery-staple-7"); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ResetPassword() with an unknown token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+	if err := s.ResetPassword(ctx, token, "battery-staple-7"); err != nil {
+		t.Fatalf("UserServiceImpl.ResetPassword() error = %v", err)
+	}
+	if err := s.ResetPassword(ctx, token, "tr0ub4dor-and-3"); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ResetPassword() with a used token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+	// tokens issued before the password changed cannot be used anymore.
+	if err := s.ResetPassword(ctx, staleToken, "tr0ub4dor-and-3"); err != onetime.ErrInvalidToken {
+		t.Errorf("UserServiceImpl.ResetPassword() with a stale token error = %v, want %v", err, onetime.ErrInvalidToken)
+	}
+
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err == nil {
+		t.Errorf("UserServiceImpl.LoginUser() with the old password should fail")
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "battery-staple-7"); err != nil {
+		t.Errorf("UserServiceImpl.LoginUser() with the new password error = %v", err)
+	}
+	if _, err := s.RefreshToken(ctx, login.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() of a session started before the reset error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+	if _, err := s.GetUserFromJWT(ctx, login.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with an access token issued before the reset error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestUserServiceImpl_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		jwtToken        string
+		userID          string
+		currentPassword string
+		newPassword     string
+		wantErr         error
+	}{
+		{name: "missing current password", jwtToken: login.AccessToken, userID: user.ID, newPassword: "battery-staple-7", wantErr: errors.New("current password is required")},
+		{name: "missing access token", userID: user.ID, currentPassword: "correct-horse-42", newPassword: "battery-staple-7", wantErr: ErrInvalidAccessToken},
+		{name: "another user", jwtToken: login.AccessToken, userID: "missing", currentPassword: "correct-horse-42", newPassword: "battery-staple-7", wantErr: ErrNotTokenUser},
+		{name: "empty new password", jwtToken: login.AccessToken, userID: user.ID, currentPassword: "correct-horse-42", wantErr: errors.New("newPassword is required")},
+		{name: "unchanged password", jwtToken: login.AccessToken, userID: user.ID, currentPassword: "correct-horse-42", newPassword: "correct-horse-42", wantErr: errors.New("newPassword must differ from the current password")},
+		{name: "new password with the name", jwtToken: login.AccessToken, currentPassword: "correct-horse-42", newPassword: "the-doe-family-99", wantErr: errors.New("newPassword must not contain your name")},
+		{name: "incorrect current password", jwtToken: login.AccessToken, userID: user.ID, currentPassword: "000000", newPassword: "battery-staple-7", wantErr: ErrIncorrectPassword},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ChangePassword(ctx, tt.jwtToken, tt.userID, tt.currentPassword, tt.newPassword)
+			if err == nil || err.Error() != tt.wantErr.Error() {
+				t.Errorf("UserServiceImpl.ChangePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	tokens, err := s.ChangePassword(ctx, login.AccessToken, user.ID, "correct-horse-42", "battery-staple-7")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.ChangePassword() error = %v", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err == nil {
+		t.Errorf("UserServiceImpl.LoginUser() with the old password should fail")
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "battery-staple-7"); err != nil {
+		t.Errorf("UserServiceImpl.LoginUser() with the new password error = %v", err)
+	}
+	if _, err := s.GetUserFromJWT(ctx, login.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with an access token issued before the change error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, err := s.RefreshToken(ctx, login.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() of a session started before the change error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+	if got, err := s.GetUserFromJWT(ctx, tokens.AccessToken); err != nil || got.ID != user.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with the returned access token = %v, %v, want user %v", got, err, user.ID)
+	}
+
+	for {
+		select {
+		case msg := <-messages:
+			var email map[string]string
+			json.Unmarshal(msg.Data, &email)
+			if email["subject"] == "Your password was changed" && email["to"] == "john@example.com" {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("UserServiceImpl.ChangePassword() did not send a password changed email")
+		}
+	}
+}
+
+func TestUserServiceImpl_LoginUser_Rehash(t *testing.T) {
+	ctx := context.Background()
+	userRepo := users.NewMemoryRepository()
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("correct-horse-42"), bcrypt.MinCost)
+	user := &users.User{FullName: "John Doe", Email: "john@example.com", Password: string(bcryptHash)}
+	err := userRepo.CreateUser(ctx, user)
+	if err != nil {
+		t.Fatalf("Repository.CreateUser() error = %v", err)
+	}
+	hasher := &passwords.Hasher{
+		Algorithm: passwords.Argon2id,
+		Argon2id:  passwords.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		Pepper:    []byte("pepper"),
+	}
+	s := NewUserService(userRepo, &opentracing.NoopTracer{}, nil, WithPasswordHasher(hasher))
+
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "battery-staple-7"); err == nil {
+		t.Fatalf("UserServiceImpl.LoginUser() with a wrong password should fail")
+	}
+	stored, _ := userRepo.GetUserByID(ctx, user.ID)
+	if stored.Password != string(bcryptHash) {
+		t.Errorf("UserServiceImpl.LoginUser() with a wrong password rehashed the password")
+	}
+
+	got, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	stored, _ = userRepo.GetUserByID(ctx, user.ID)
+	// rehashing keeps the version, the password itself did not change.
+	if !strings.HasPrefix(stored.Password, "$pepper$argon2id$") || got.Version != user.Version || stored.Version != user.Version {
+		t.Errorf("UserServiceImpl.LoginUser() stored hash = %q version %d, want a peppered argon2id hash at version %d", stored.Password, stored.Version, user.Version)
+	}
+	rehashed := stored.Password
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() with the rehashed password error = %v", err)
+	}
+	stored, _ = userRepo.GetUserByID(ctx, user.ID)
+	if stored.Password != rehashed {
+		t.Errorf("UserServiceImpl.LoginUser() rehashed a current hash")
+	}
+}
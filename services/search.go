@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+)
+
+var ErrSearchDisabled = errors.New("user search is not enabled")
+
+// defaultSearchLimit is the number of hits returned when no limit is given.
+const defaultSearchLimit = 20
+
+// WithSearchIndex enables SearchUsers over the index, the index has to be kept
+// in sync with the repository by the caller.
+func WithSearchIndex(index *search.Index) Option {
+	return func(s *UserServiceImpl) {
+		s.searchIndex = index
+	}
+}
+
+// SearchUsers is the service handler to find users from part of their full
+// name or email, best matches first.
+func (s *UserServiceImpl) SearchUsers(ctx context.Context, query string, limit int32) ([]search.Hit, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "SearchUsers")
+	defer span.Finish()
+	span.SetTag("param.query", query).SetTag("param.limit", limit)
+
+	var err error
+	switch {
+	case s.searchIndex == nil:
+		err = ErrSearchDisabled
+	case strings.TrimSpace(query) == "":
+		err = errors.New("search query is required")
+	case limit < 0:
+		err = errors.New("search limit cannot be negative")
+	case limit > 100:
+		err = ErrPaginationLimit
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("input validation"))
+		return nil, err
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	hits := s.searchIndex.Search(query, int(limit))
+	span.SetTag("search.hits", len(hits))
+	return hits, nil
+}
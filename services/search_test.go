@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_SearchUsers(t *testing.T) {
+	index := search.NewIndex()
+	for _, user := range []users.User{
+		{ID: "1", FullName: "John Doe", Email: "john@example.com"},
+		{ID: "2", FullName: "Johnny Bravo", Email: "bravo@example.com"},
+		{ID: "3", FullName: "Jane Doe", Email: "jane@example.com"},
+	} {
+		user := user
+		index.Add(&user)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		query   string
+		limit   int32
+		want    []string
+		wantErr bool
+	}{
+		{name: "search disabled", query: "john", wantErr: true},
+		{name: "empty query", opts: []Option{WithSearchIndex(index)}, query: " ", wantErr: true},
+		{name: "limit > 100", opts: []Option{WithSearchIndex(index)}, query: "john", limit: 101, wantErr: true},
+		{name: "default limit", opts: []Option{WithSearchIndex(index)}, query: "john", want: []string{"1", "2"}},
+		{name: "limit", opts: []Option{WithSearchIndex(index)}, query: "doe", limit: 1, want: []string{"3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUserService(&users.MemoryRepo{}, &opentracing.NoopTracer{}, nil, tt.opts...)
+			got, err := s.SearchUsers(context.Background(), tt.query, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UserServiceImpl.SearchUsers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("UserServiceImpl.SearchUsers() = %v, want %v", got, tt.want)
+				return
+			}
+			for i := range got {
+				if got[i].User.ID != tt.want[i] {
+					t.Errorf("UserServiceImpl.SearchUsers() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrTokenRevoked       = errors.New("token has been revoked")
+	ErrInvalidAccessToken = errors.New("access token is missing or invalid")
+	ErrNotTokenUser       = errors.New("access token belongs to another user")
+)
+
+const (
+	defaultAccessTokenLifetime  = 15 * time.Minute
+	defaultRefreshTokenLifetime = 30 * 24 * time.Hour
+)
+
+// WithSessionStore keeps the login sessions in store, sessions are kept in
+// memory by default.
+func WithSessionStore(store sessions.Store) Option {
+	return func(s *UserServiceImpl) {
+		s.sessionStore = store
+	}
+}
+
+// WithTokenLifetimes sets how long access tokens and refresh tokens are valid
+// for, zero values keep the defaults of 15 minutes and 30 days. A refresh
+// token is valid for the refresh lifetime from its last use.
+func WithTokenLifetimes(access, refresh time.Duration) Option {
+	return func(s *UserServiceImpl) {
+		if access > 0 {
+			s.accessTokenLifetime = access
+		}
+		if refresh > 0 {
+			s.refreshTokenLifetime = refresh
+		}
+	}
+}
+
+// startSession creates a new login session for the user and returns its
+// tokens.
+func (s *UserServiceImpl) startSession(ctx context.Context, span opentracing.Span, user *users.User) (*sessions.TokenPair, error) {
+	refreshToken, refreshTokenHash, err := sessions.NewRefreshToken()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("refresh token generation"))
+		return nil, ErrTryAgain
+	}
+	now := time.Now().UTC()
+	session := &sessions.Session{
+		ID:         primitive.NewObjectID().Hex(),
+		UserID:     user.ID,
+		TokenHash:  refreshTokenHash,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(s.refreshTokenLifetime),
+	}
+	err = s.sessionStore.CreateSession(ctx, session)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	span.SetTag("sessionId", session.ID)
+	return s.issueTokenPair(span, user, session, refreshToken, now)
+}
+
+// issueTokenPair signs an access token for the session and pairs it with its
+// current refresh token.
+func (s *UserServiceImpl) issueTokenPair(span opentracing.Span, user *users.User, session *sessions.Session, refreshToken string, now time.Time) (*sessions.TokenPair, error) {
+	accessTokenExpiresAt := now.Add(s.accessTokenLifetime)
+	accessToken, err := s.tokenIssuer.IssueToken(&AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        primitive.NewObjectID().Hex(),
+			Issuer:    s.claimsValidation.issuer,
+			Subject:   user.ID,
+			Audience:  s.claimsValidation.audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(accessTokenExpiresAt),
+		},
+		UserID:    user.ID,
+		SessionID: session.ID,
+		AuthTime:  jwt.NewNumericDate(session.CreatedAt),
+		Scope:     s.accessTokenScope(user),
+		TimeAdded: user.TimeAdded,
+	})
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("jwt generation"))
+		return nil, ErrTryAgain
+	}
+	return &sessions.TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// RefreshToken is the service handler to exchange a refresh token for a new
+// access token and a new refresh token, the presented refresh token cannot be
+// used again. Presenting a refresh token that was already exchanged revokes
+// its session.
+func (s *UserServiceImpl) RefreshToken(ctx context.Context, refreshToken string) (*sessions.TokenPair, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RefreshToken")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if refreshToken == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no refresh token provided"), log.Event("input validation"))
+		return nil, errors.New("refresh token is required")
+	}
+
+	newRefreshToken, newRefreshTokenHash, err := sessions.NewRefreshToken()
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("refresh token generation"))
+		return nil, ErrTryAgain
+	}
+	now := time.Now().UTC()
+	session, err := s.sessionStore.RotateToken(ctx, sessions.HashToken(refreshToken), newRefreshTokenHash, now.Add(s.refreshTokenLifetime), now)
+	if errors.Is(err, sessions.ErrRefreshTokenReused) {
+		// the access tokens of the revoked session may be stolen too.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.String("sessionId", session.ID), log.Event("refresh token rotation"))
+		if denyErr := s.denySessions(ctx, []string{session.ID}, now); denyErr != nil {
+			span.LogFields(log.Error(denyErr), log.Event("session denial"))
+		}
+		return nil, err
+	}
+	if errors.Is(err, sessions.ErrInvalidRefreshToken) {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("refresh token rotation"))
+		return nil, err
+	}
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	span.SetTag("sessionId", session.ID).SetTag("userId", session.UserID)
+
+	user, err := s.userRepo.GetUserByID(ctx, session.UserID)
+	if errors.Is(err, users.ErrUserNotFound) {
+		// the user has been deleted since logging in.
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("session user lookup"))
+		err = s.sessionStore.RevokeSession(ctx, session.ID, now)
+		if err != nil {
+			span.LogFields(log.Error(err), log.Event("session revocation"))
+		}
+		return nil, sessions.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	return s.issueTokenPair(span, user, session, newRefreshToken, now)
+}
+
+// parseAccessToken returns the claims of jwtToken if it is a valid access
+// token.
+func (s *UserServiceImpl) parseAccessToken(span opentracing.Span, jwtToken string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{validation: s.claimsValidation}
+	claims.validation.maxLifetime = s.accessTokenLifetime
+	err := s.tokenVerifier.VerifyToken(jwtToken, claims)
+	if err == nil && claims.userID() == "" {
+		err = errors.New("jwt token has no subject")
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("jwt decoding"))
+		return nil, errors.New("invalid jwt")
+	}
+	span.SetTag("jwtClaims", claims)
+	return claims, nil
+}
+
+// accessTokenUser returns the user of an unrevoked access token along with
+// its claims, handlers acting on a user id use it to only act for the user
+// themselves. Tokens limited to ScopeUnverified are refused. It fails with ErrNotTokenUser when userID is set to another
+// user.
+func (s *UserServiceImpl) accessTokenUser(ctx context.Context, span opentracing.Span, jwtToken, userID string) (*users.User, *AccessTokenClaims, error) {
+	claims, err := s.parseAccessToken(span, jwtToken)
+	if err != nil {
+		return nil, nil, ErrInvalidAccessToken
+	}
+	err = s.checkAccessTokenNotRevoked(ctx, span, claims)
+	if err == nil {
+		err = checkAccessTokenScope(span, claims)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if userID != "" && userID != claims.userID() {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrNotTokenUser), log.Event("access token subject"))
+		return nil, nil, ErrNotTokenUser
+	}
+	user, err := s.userRepo.GetUserByID(ctx, claims.userID())
+	if err != nil {
+		return nil, nil, userRepoError(err)
+	}
+	span.SetTag("userId", user.ID)
+	return user, claims, nil
+}
+
+// checkAccessTokenNotRevoked returns ErrTokenRevoked when the access token or
+// its session is on the denylist, parsed claims always have both ids.
+func (s *UserServiceImpl) checkAccessTokenNotRevoked(ctx context.Context, span opentracing.Span, claims *AccessTokenClaims) error {
+	denied, err := s.sessionStore.IsDenied(ctx, []string{claims.ID, claims.SessionID}, time.Now())
+	if err != nil {
+		return ErrTryAgain
+	}
+	if denied {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrTokenRevoked), log.Event("denylist check"))
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// LogoutUser is the service handler to end the session of an access token,
+// the access token and every other access token of the session are revoked
+// and the refresh token of the session can no longer be used.
+func (s *UserServiceImpl) LogoutUser(ctx context.Context, jwtToken string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "LogoutUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	claims, err := s.parseAccessToken(span, jwtToken)
+	if err != nil {
+		return err
+	}
+	sessionID := claims.SessionID
+	if sessionID == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no sid claim"), log.Event("input validation"))
+		return errors.New("jwt token does not belong to a session")
+	}
+
+	now := time.Now().UTC()
+	err = s.sessionStore.RevokeSession(ctx, sessionID, now)
+	if err != nil && !errors.Is(err, sessions.ErrSessionNotFound) {
+		return ErrTryAgain
+	}
+	// the token itself is denied until it expires, the other access tokens
+	// of the session through the session id.
+	if claims.ID != "" {
+		expiresAt := now.Add(s.accessTokenLifetime)
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Add(s.claimsValidation.leeway)
+		}
+		err = s.sessionStore.Deny(ctx, claims.ID, expiresAt)
+		if err != nil {
+			return ErrTryAgain
+		}
+	}
+	return s.denySessions(ctx, []string{sessionID}, now)
+}
+
+// RevokeAllSessions is the service handler to log a user out everywhere, it
+// returns the number of sessions that were revoked.
+func (s *UserServiceImpl) RevokeAllSessions(ctx context.Context, userID string) (int, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RevokeAllSessions")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.userId", userID)
+	if userID == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no user id provided"), log.Event("input validation"))
+		return 0, errors.New("user id is required")
+	}
+
+	now := time.Now().UTC()
+	revoked, err := s.sessionStore.RevokeUserSessions(ctx, userID, now)
+	if err != nil {
+		return 0, ErrTryAgain
+	}
+	err = s.denySessions(ctx, revoked, now)
+	if err != nil {
+		return 0, err
+	}
+	span.SetTag("revokedSessions", len(revoked))
+	return len(revoked), nil
+}
+
+// denySessions denies the access tokens of the sessions, which are valid for
+// at most the access token lifetime and the leeway from now.
+func (s *UserServiceImpl) denySessions(ctx context.Context, sessionIDs []string, now time.Time) error {
+	for _, sessionID := range sessionIDs {
+		err := s.sessionStore.Deny(ctx, sessionID, now.Add(s.accessTokenLifetime+s.claimsValidation.leeway))
+		if err != nil {
+			return ErrTryAgain
+		}
+	}
+	return nil
+}
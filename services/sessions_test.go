@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_RefreshToken(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil, WithTokenLifetimes(time.Minute, time.Hour))
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	if lifetime := time.Until(login.AccessTokenExpiresAt); lifetime <= 0 || lifetime > time.Minute {
+		t.Errorf("UserServiceImpl.LoginUser() access token lifetime = %v, want at most %v", lifetime, time.Minute)
+	}
+	if lifetime := time.Until(login.RefreshTokenExpiresAt); lifetime <= time.Minute || lifetime > time.Hour {
+		t.Errorf("UserServiceImpl.LoginUser() refresh token lifetime = %v, want at most %v", lifetime, time.Hour)
+	}
+
+	if _, err := s.RefreshToken(ctx, ""); err == nil {
+		t.Errorf("UserServiceImpl.RefreshToken() with an empty token should fail")
+	}
+	if _, err := s.RefreshToken(ctx, login.AccessToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() with an access token error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+
+	refreshed, err := s.RefreshToken(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.RefreshToken() error = %v", err)
+	}
+	if refreshed.RefreshToken == login.RefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() did not rotate the refresh token")
+	}
+	got, err := s.GetUserFromJWT(ctx, refreshed.AccessToken)
+	if err != nil || got.ID != user.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with a refreshed access token = %v, %v, want user %v", got, err, user.ID)
+	}
+
+	// reusing the first refresh token revokes the session, so the refresh
+	// token issued with it cannot be used either.
+	if _, err := s.RefreshToken(ctx, login.RefreshToken); err != sessions.ErrRefreshTokenReused {
+		t.Errorf("UserServiceImpl.RefreshToken() with a used token error = %v, want %v", err, sessions.ErrRefreshTokenReused)
+	}
+	if _, err := s.RefreshToken(ctx, refreshed.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() on a revoked session error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+	// nor can the access tokens of the session.
+	if _, err := s.GetUserFromJWT(ctx, refreshed.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with an access token of the revoked session error = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	// other sessions of the user are not affected.
+	_, otherLogin, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	otherRefreshed, err := s.RefreshToken(ctx, otherLogin.RefreshToken)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.RefreshToken() of another session error = %v", err)
+	}
+	if _, err := s.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("UserServiceImpl.DeleteUser() error = %v", err)
+	}
+	if _, err := s.RefreshToken(ctx, otherRefreshed.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() of a deleted user error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+	if _, err := s.GetUserFromJWT(ctx, otherRefreshed.AccessToken); err != ErrTokenRevoked {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() of a deleted user error = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestUserServiceImpl_LogoutUser(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	refreshed, err := s.RefreshToken(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.RefreshToken() error = %v", err)
+	}
+	_, otherLogin, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	if err := s.LogoutUser(ctx, "invalidJwtToken"); err == nil {
+		t.Errorf("UserServiceImpl.LogoutUser() with an invalid token should fail")
+	}
+	if err := s.LogoutUser(ctx, refreshed.AccessToken); err != nil {
+		t.Fatalf("UserServiceImpl.LogoutUser() error = %v", err)
+	}
+	// every access token of the session is revoked along with its refresh
+	// token.
+	for _, accessToken := range []string{login.AccessToken, refreshed.AccessToken} {
+		if _, err := s.GetUserFromJWT(ctx, accessToken); err != ErrTokenRevoked {
+			t.Errorf("UserServiceImpl.GetUserFromJWT() after logout error = %v, want %v", err, ErrTokenRevoked)
+		}
+	}
+	if _, err := s.RefreshToken(ctx, refreshed.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+		t.Errorf("UserServiceImpl.RefreshToken() after logout error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+	}
+	got, err := s.GetUserFromJWT(ctx, otherLogin.AccessToken)
+	if err != nil || got.ID != user.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() of another session = %v, %v, want user %v", got, err, user.ID)
+	}
+}
+
+func TestUserServiceImpl_RevokeAllSessions(t *testing.T) {
+	ctx := context.Background()
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil)
+	for _, email := range []string{"john@example.com", "jane@example.com"} {
+		_, err := s.CreateUser(ctx, &users.User{FullName: "Test User", Email: email, Password: "correct-horse-42"})
+		if err != nil {
+			t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+		}
+	}
+	var logins []*sessions.TokenPair
+	for i := 0; i < 2; i++ {
+		_, login, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+		if err != nil {
+			t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+		}
+		logins = append(logins, login)
+	}
+	jane, janeLogin, err := s.LoginUser(ctx, "jane@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	john, err := s.GetUserFromJWT(ctx, logins[0].AccessToken)
+	if err != nil {
+		t.Fatalf("UserServiceImpl.GetUserFromJWT() error = %v", err)
+	}
+
+	if _, err := s.RevokeAllSessions(ctx, ""); err == nil {
+		t.Errorf("UserServiceImpl.RevokeAllSessions() without a user id should fail")
+	}
+	revoked, err := s.RevokeAllSessions(ctx, john.ID)
+	if err != nil || revoked != 2 {
+		t.Fatalf("UserServiceImpl.RevokeAllSessions() = %v, %v, want 2", revoked, err)
+	}
+	for _, login := range logins {
+		if _, err := s.GetUserFromJWT(ctx, login.AccessToken); err != ErrTokenRevoked {
+			t.Errorf("UserServiceImpl.GetUserFromJWT() of a revoked session error = %v, want %v", err, ErrTokenRevoked)
+		}
+		if _, err := s.RefreshToken(ctx, login.RefreshToken); err != sessions.ErrInvalidRefreshToken {
+			t.Errorf("UserServiceImpl.RefreshToken() of a revoked session error = %v, want %v", err, sessions.ErrInvalidRefreshToken)
+		}
+	}
+	if got, err := s.GetUserFromJWT(ctx, janeLogin.AccessToken); err != nil || got.ID != jane.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() of another user = %v, %v, want user %v", got, err, jane.ID)
+	}
+	if revoked, err := s.RevokeAllSessions(ctx, john.ID); err != nil || revoked != 0 {
+		t.Errorf("UserServiceImpl.RevokeAllSessions() again = %v, %v, want 0", revoked, err)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+)
+
+// TokenIssuer signs the access tokens issued by the service.
+type TokenIssuer interface {
+	IssueToken(claims jwt.Claims) (string, error)
+	// JWKS returns the public keys verifying the issued tokens, it is empty
+	// when tokens are signed with a shared secret.
+	JWKS() keyring.JWKS
+}
+
+// TokenVerifier decodes the claims of an access token into claims if the
+// token has a valid signature and claims.Valid accepts them.
+type TokenVerifier interface {
+	VerifyToken(token string, claims jwt.Claims) error
+}
+
+// WithTokenIssuer signs the access tokens with issuer. Tokens are signed with
+// HS256 and the JWT_SECRET_KEY env variable by default.
+func WithTokenIssuer(issuer TokenIssuer) Option {
+	return func(s *UserServiceImpl) {
+		s.tokenIssuer = issuer
+	}
+}
+
+// WithTokenVerifier verifies the access tokens with verifier, it must accept
+// the tokens of the issuer. Tokens are verified with HS256 and the
+// JWT_SECRET_KEY env variable by default.
+func WithTokenVerifier(verifier TokenVerifier) Option {
+	return func(s *UserServiceImpl) {
+		s.tokenVerifier = verifier
+	}
+}
+
+// defaultTokenKeys returns the key ring used when no issuer or verifier is
+// given, it has a single HMAC key without id so that tokens have no kid
+// header as before key rings were supported.
+func defaultTokenKeys() *keyring.Ring {
+	ring, _ := keyring.New(keyring.NewHMACKey("", []byte(os.Getenv("JWT_SECRET_KEY"))))
+	return ring
+}
+
+// GetJWKS is the service handler returning the JSON web key set other services
+// verify access tokens with.
+func (s *UserServiceImpl) GetJWKS(ctx context.Context) (*keyring.JWKS, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetJWKS")
+	defer span.Finish()
+
+	jwks := s.tokenIssuer.JWKS()
+	span.SetTag("keys", len(jwks.Keys))
+	return &jwks, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"reflect"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+func TestUserServiceImpl_TokenKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() error = %v", err)
+	}
+	oldKey, _ := keyring.NewKey("old", ecKey)
+	newKey, _ := keyring.NewKey("new", edKey)
+	oldKeys, _ := keyring.New(oldKey)
+	rotatedKeys, _ := keyring.New(newKey, oldKey)
+
+	userRepo := users.NewMemoryRepository()
+	before := NewUserService(userRepo, &opentracing.NoopTracer{}, nil, WithTokenIssuer(oldKeys), WithTokenVerifier(oldKeys))
+	user, err := before.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	_, oldTokens, err := before.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+
+	// replicas signing with the new key keep accepting the tokens signed
+	// with the old key.
+	after := NewUserService(userRepo, &opentracing.NoopTracer{}, nil, WithTokenIssuer(rotatedKeys), WithTokenVerifier(rotatedKeys))
+	if got, err := after.GetUserFromJWT(ctx, oldTokens.AccessToken); err != nil || got.ID != user.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() of a token signed with the old key = %v, %v, want user %v", got, err, user.ID)
+	}
+	_, newTokens, err := after.LoginUser(ctx, "john@example.com", "correct-horse-42")
+	if err != nil {
+		t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+	}
+	if _, err := before.GetUserFromJWT(ctx, newTokens.AccessToken); err == nil {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() of a token signed with a key unknown to the replica should fail")
+	}
+
+	// downstream services only need the public keys.
+	publicKey, _ := keyring.NewKey(newKey.ID, newKey.PublicKey())
+	downstream, _ := keyring.NewVerifier(publicKey)
+	claims := &AccessTokenClaims{}
+	err = downstream.VerifyToken(newTokens.AccessToken, claims)
+	if err != nil || claims.Subject != user.ID {
+		t.Errorf("Ring.VerifyToken() with the public key = %v, %v, want userId %v", claims, err, user.ID)
+	}
+}
+
+func TestUserServiceImpl_GetJWKS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() error = %v", err)
+	}
+	key, _ := keyring.NewKey("2021-11", ecKey)
+	keys, _ := keyring.New(key)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantKids []string
+	}{
+		{name: "hmac secret", wantKids: []string{}},
+		{name: "ecdsa key", opts: []Option{WithTokenIssuer(keys), WithTokenVerifier(keys)}, wantKids: []string{"2021-11"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, nil, tt.opts...)
+			got, err := s.GetJWKS(context.Background())
+			if err != nil {
+				t.Fatalf("UserServiceImpl.GetJWKS() error = %v", err)
+			}
+			kids := []string{}
+			for _, jwk := range got.Keys {
+				kids = append(kids, jwk.KeyID)
+			}
+			if !reflect.DeepEqual(kids, tt.wantKids) {
+				t.Errorf("UserServiceImpl.GetJWKS() kids = %v, want %v", kids, tt.wantKids)
+			}
+		})
+	}
+}
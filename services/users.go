@@ -2,46 +2,187 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
+	"net/url"
 	"time"
 
-	"github.com/golang-jwt/jwt"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/not.go"
 	"github.com/opentracing/opentracing-go"
 	"github.com/opentracing/opentracing-go/ext"
 	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/apikeys"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/keyring"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/lockout"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/oidc"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/onetime"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/passwords"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/search"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/sessions"
 	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService interface {
 	CreateUser(ctx context.Context, newUser *users.User) (*users.User, error)
-	GetUsers(ctx context.Context, afterId string, limit int32) ([]users.User, error)
-	LoginUser(ctx context.Context, email, password string) (*users.User, string, error)
+	GetUsers(ctx context.Context, req users.GetUsersRequest) (*users.GetUsersResponse, error)
+	SearchUsers(ctx context.Context, query string, limit int32) ([]search.Hit, error)
+	BatchGetUsers(ctx context.Context, ids []string) (found []users.User, missingIds []string, err error)
+	GetUser(ctx context.Context, id string) (*users.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*users.User, error)
+	LoginUser(ctx context.Context, email, password string) (*users.User, *sessions.TokenPair, error)
+	CompleteLoginMFA(ctx context.Context, challengeToken, code string) (*users.User, *sessions.TokenPair, error)
+	RequestMagicLink(ctx context.Context, email string) error
+	ConsumeMagicLink(ctx context.Context, token string) (*users.User, *sessions.TokenPair, error)
+	LoginWithIDToken(ctx context.Context, provider, idToken, nonce string) (*users.User, *sessions.TokenPair, error)
+	RefreshToken(ctx context.Context, refreshToken string) (*sessions.TokenPair, error)
 	GetUserFromJWT(ctx context.Context, jwtToken string) (*users.User, error)
+	LogoutUser(ctx context.Context, jwtToken string) error
+	RevokeAllSessions(ctx context.Context, userID string) (int, error)
+	GetJWKS(ctx context.Context) (*keyring.JWKS, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	ChangePassword(ctx context.Context, jwtToken, userID, currentPassword, newPassword string) (*sessions.TokenPair, error)
+	BeginTOTPEnrollment(ctx context.Context, jwtToken, userID, currentPassword string) (*mfa.Setup, error)
+	ConfirmTOTPEnrollment(ctx context.Context, jwtToken, userID, code string) ([]string, error)
+	VerifyEmail(ctx context.Context, token string) (*users.User, error)
+	ResendVerificationEmail(ctx context.Context, email string) error
+	UpdateUser(ctx context.Context, id string, changes *users.User, fieldMask []string, version int64) (*users.User, error)
+	DeleteUser(ctx context.Context, id string) (*users.User, error)
+	RestoreUser(ctx context.Context, id string) (*users.User, error)
+	PurgeUser(ctx context.Context, id string) error
+	CreateServiceAccount(ctx context.Context, name string, scopes []string) (*apikeys.ServiceAccount, *apikeys.IssuedKey, error)
+	ListServiceAccounts(ctx context.Context) ([]apikeys.ServiceAccount, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID string) ([]apikeys.Key, error)
+	RotateAPIKey(ctx context.Context, serviceAccountID string, gracePeriod time.Duration) (*apikeys.IssuedKey, error)
+	RevokeAPIKey(ctx context.Context, keyID string) error
+	AuthenticateAPIKey(ctx context.Context, apiKey string) (*apikeys.Principal, error)
 }
 
 type UserServiceImpl struct {
-	userRepo users.Repository
-	natsConn *nats.Conn
-	tracer   opentracing.Tracer
+	userRepo        users.Repository
+	natsConn        *nats.Conn
+	tracer          opentracing.Tracer
+	pageTokenSecret []byte
+	searchIndex     *search.Index
+
+	sessionStore         sessions.Store
+	accessTokenLifetime  time.Duration
+	refreshTokenLifetime time.Duration
+	tokenIssuer          TokenIssuer
+	tokenVerifier        TokenVerifier
+	claimsValidation     claimsValidation
+
+	oneTimeTokenStore     onetime.Store
+	passwordResetURL      string
+	passwordResetLifetime time.Duration
+	passwordPolicy        passwords.Policy
+	passwordHasher        PasswordHasher
+	magicLinkURL          string
+	magicLinkLifetime     time.Duration
+
+	emailVerificationURL      string
+	emailVerificationLifetime time.Duration
+	emailTokenSecret          []byte
+	unverifiedLoginPolicy     UnverifiedLoginPolicy
+
+	loginAttemptStore lockout.Store
+	emailLoginPolicy  lockout.Policy
+	ipLoginPolicy     lockout.Policy
+
+	mfaStore   mfa.Store
+	totpIssuer string
+
+	identityStore oidc.IdentityStore
+	oidcProviders map[string]IDTokenVerifier
+
+	serviceAccountStore apikeys.Store
 }
 
+// Option configures optional behaviour of the user service.
+type Option func(*UserServiceImpl)
+
 var (
 	ErrPaginationLimit = errors.New("pagination limit max is 100")
+	ErrBatchLimit      = errors.New("batch size max is 100")
 	ErrTryAgain        = errors.New("an error occured, please try again later")
 )
 
 // NewUserService returns a new user service.
-func NewUserService(userRepo users.Repository, tracer opentracing.Tracer, natsConn *nats.Conn) *UserServiceImpl {
-	return &UserServiceImpl{
-		userRepo: userRepo,
-		natsConn: natsConn,
-		tracer:   tracer,
+func NewUserService(userRepo users.Repository, tracer opentracing.Tracer, natsConn *nats.Conn, opts ...Option) *UserServiceImpl {
+	s := &UserServiceImpl{
+		userRepo:             userRepo,
+		natsConn:             natsConn,
+		tracer:               tracer,
+		accessTokenLifetime:  defaultAccessTokenLifetime,
+		refreshTokenLifetime: defaultRefreshTokenLifetime,
+
+		passwordResetLifetime: defaultPasswordResetLifetime,
+		passwordPolicy:        passwords.DefaultPolicy(),
+		magicLinkLifetime:     defaultMagicLinkLifetime,
+
+		emailVerificationLifetime: defaultEmailVerificationLifetime,
+		unverifiedLoginPolicy:     UnverifiedLoginAllow,
+
+		emailLoginPolicy: lockout.DefaultEmailPolicy,
+		ipLoginPolicy:    lockout.DefaultIPPolicy,
+
+		totpIssuer: defaultTOTPIssuer,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.pageTokenSecret == nil {
+		s.pageTokenSecret = randomSecret()
+	}
+	if s.emailTokenSecret == nil {
+		s.emailTokenSecret = randomSecret()
+	}
+	if s.sessionStore == nil {
+		s.sessionStore = sessions.NewMemoryStore()
+	}
+	if s.oneTimeTokenStore == nil {
+		s.oneTimeTokenStore = onetime.NewMemoryStore()
+	}
+	if s.loginAttemptStore == nil {
+		s.loginAttemptStore = lockout.NewMemoryStore()
+	}
+	if s.mfaStore == nil {
+		s.mfaStore = mfa.NewMemoryStore()
+	}
+	if s.identityStore == nil {
+		s.identityStore = oidc.NewMemoryStore()
+	}
+	if s.serviceAccountStore == nil {
+		s.serviceAccountStore = apikeys.NewMemoryStore()
+	}
+	if s.passwordHasher == nil {
+		s.passwordHasher = passwords.DefaultHasher()
+	}
+	if s.tokenIssuer == nil || s.tokenVerifier == nil {
+		keys := defaultTokenKeys()
+		if s.tokenIssuer == nil {
+			s.tokenIssuer = keys
+		}
+		if s.tokenVerifier == nil {
+			s.tokenVerifier = keys
+		}
+	}
+	return s
+}
+
+// randomSecret returns a new random key for the secrets that are not set, it
+// panics when the system has no source of randomness as no key can be made.
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(fmt.Sprintf("services: generating a random secret: %v", err))
+	}
+	return secret
 }
 
 // CreateUser is the service handler to create new user.
@@ -49,6 +190,10 @@ func (s *UserServiceImpl) CreateUser(ctx context.Context, newUser *users.User) (
 	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "CreateUser")
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
+	err := s.checkPassword(span, "password", newUser.Password, newUser)
+	if err != nil {
+		return nil, err
+	}
 	existingUser, err := s.userRepo.GetUserByEmail(ctx, newUser.Email)
 	if err != nil {
 		ext.Error.Set(span, true)
@@ -61,29 +206,42 @@ func (s *UserServiceImpl) CreateUser(ctx context.Context, newUser *users.User) (
 			log.String("error.object", "user with email already exist"),
 			log.Event("existing user email validation"),
 		)
-		return nil, errors.New("user with this email already exist")
+		return nil, users.ErrEmailTaken
 	}
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
-	span.SetTag("bcrypt.passwordCost", bcrypt.DefaultCost)
+	passwordHash, err := s.hashPassword(span, newUser.Password)
 	if err != nil {
-		ext.Error.Set(span, true)
-		span.SetTag("param.passwordStr", newUser.Password)
-		span.LogFields(log.Error(err), log.String("event", "password hash error"))
-		return nil, ErrTryAgain
+		return nil, err
 	}
-	newUser.Password = string(passwordHash)
+	newUser.Password = passwordHash
+	newUser.EmailVerified = false
 	err = s.userRepo.CreateUser(ctx, newUser)
+	if errors.Is(err, users.ErrEmailTaken) {
+		// a concurrent signup with the same email won the race.
+		return nil, err
+	}
 	if err != nil {
 		return nil, ErrTryAgain
 	}
+	s.publishUserChangeEvent(span, users.EventCreated, newUser)
 	s.publishCreateUserSendEmailEvent(span, newUser)
+	s.publishVerificationSendEmailEvent(span, newUser)
 	return newUser, nil
 }
 
 func (s *UserServiceImpl) publishCreateUserSendEmailEvent(span opentracing.Span, user *users.User) {
-	span = s.tracer.StartSpan("publish-create-user-email-event", ext.SpanKindProducer, opentracing.ChildOf(span.Context()))
+	s.publishEvent(span, "publish-create-user-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Welcome to my microservice application",
+		"body":    "It's glad to have you onboard, thanks for checking it out",
+	})
+}
+
+// publishEvent publishes message as json to the nats subject, the span context
+// is injected into the message so that subscribers can continue the trace.
+func (s *UserServiceImpl) publishEvent(span opentracing.Span, operationName, subject string, message interface{}) {
+	span = s.tracer.StartSpan(operationName, ext.SpanKindProducer, opentracing.ChildOf(span.Context()))
 	defer span.Finish()
-	ext.MessageBusDestination.Set(span, "notification.SendEmail")
+	ext.MessageBusDestination.Set(span, subject)
 
 	var traceMsg not.TraceMsg
 	err := s.tracer.Inject(span.Context(), opentracing.Binary, &traceMsg)
@@ -95,53 +253,206 @@ func (s *UserServiceImpl) publishCreateUserSendEmailEvent(span opentracing.Span,
 		)
 		return
 	}
-	natsMessage := map[string]string{
-		"to":      user.Email,
-		"subject": "Welcome to my microservice application",
-		"body":    "It's glad to have you onboard, thanks for checking it out",
-	}
-	natsMessageJSON, err := json.Marshal(natsMessage)
+	natsMessageJSON, err := json.Marshal(message)
 	if err != nil {
 		ext.Error.Set(span, true)
-		span.LogFields(log.Error(err), log.Event("converting object to json"), log.Object("object", natsMessage))
+		span.LogFields(log.Error(err), log.Event("converting object to json"), log.Object("object", message))
 		return
 	}
 	traceMsg.Write(natsMessageJSON)
 	span.SetTag("nats.message", string(traceMsg.String()))
 
-	err = s.natsConn.Publish("notification.SendEmail", traceMsg.Bytes())
+	err = s.natsConn.Publish(subject, traceMsg.Bytes())
 	if err != nil {
 		ext.Error.Set(span, true)
-		span.LogFields(log.Error(err), log.Event("nats.notification.SendEmail"))
+		span.LogFields(log.Error(err), log.Event("nats."+subject))
 	}
 }
 
-func (s *UserServiceImpl) GetUsers(ctx context.Context, afterId string, limit int32) ([]users.User, error) {
+// tokenLink returns baseURL with the token added as the token query parameter,
+// or the bare token when baseURL is empty.
+func tokenLink(baseURL, token string) (string, error) {
+	if baseURL == "" {
+		return token, nil
+	}
+	link, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// GetUsers is the service handler to list users a page at a time.
+func (s *UserServiceImpl) GetUsers(ctx context.Context, req users.GetUsersRequest) (*users.GetUsersResponse, error) {
 	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetUsers")
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
-	if limit == 0 {
+	span.SetTag("param.request", req)
+	if req.Limit == 0 {
 		ext.Error.Set(span, true)
 		span.LogFields(
 			log.String("event", "no filter limit provided"),
 		)
 		return nil, errors.New("filter limit must be provided")
 	}
-	if limit > 100 {
+	if req.Limit > 100 {
 		ext.Error.Set(span, true)
 		span.LogFields(
 			log.Error(ErrPaginationLimit),
 		)
 		return nil, ErrPaginationLimit
 	}
-	users, err := s.userRepo.GetUsers(ctx, afterId, limit)
+	if req.SortBy == "" {
+		req.SortBy = users.SortByTimeAdded
+	}
+	filter := users.GetUsersFilter{
+		SortBy:        req.SortBy,
+		Descending:    req.Descending,
+		Country:       req.Country,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		Limit:         req.Limit,
+		CountTotal:    req.IncludeTotalCount,
+	}
+	var err error
+	if !req.SortBy.Valid() {
+		err = fmt.Errorf("users cannot be sorted by %q", req.SortBy)
+	} else if req.Limit < 0 {
+		err = errors.New("filter limit cannot be negative")
+	} else if !req.CreatedAfter.IsZero() && !req.CreatedBefore.IsZero() && req.CreatedBefore.Before(req.CreatedAfter) {
+		err = errors.New("createdBefore cannot be before createdAfter")
+	}
+	fingerprint := pageTokenFilter(req)
+	if err == nil && req.PageToken != "" {
+		var token *pageToken
+		token, err = s.decodePageToken(req.PageToken, fingerprint)
+		if err == nil && token.Before {
+			filter.Before = &token.Cursor
+		} else if err == nil {
+			filter.After = &token.Cursor
+		}
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("input validation"))
+		return nil, err
+	}
+	page, err := s.userRepo.GetUsers(ctx, filter)
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	response := &users.GetUsersResponse{Users: page.Users, TotalCount: page.Total}
+	if len(page.Users) == 0 {
+		return response, nil
+	}
+	forward := filter.Before == nil
+	if !forward || page.HasMore {
+		last := users.NewCursor(&page.Users[len(page.Users)-1], req.SortBy)
+		response.NextPageToken = s.encodePageToken(pageToken{Cursor: last, Filter: fingerprint})
+	}
+	if (forward && filter.After != nil) || (!forward && page.HasMore) {
+		first := users.NewCursor(&page.Users[0], req.SortBy)
+		response.PrevPageToken = s.encodePageToken(pageToken{Cursor: first, Before: true, Filter: fingerprint})
+	}
+	return response, nil
+}
+
+// BatchGetUsers is the service handler to get many users at once, the users
+// are returned in the order of ids along with the ids that have no user.
+func (s *UserServiceImpl) BatchGetUsers(ctx context.Context, ids []string) ([]users.User, []string, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "BatchGetUsers")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.ids", ids)
+
+	var uniqueIds []string
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIds = append(uniqueIds, id)
+		}
+	}
+	var err error
+	if len(uniqueIds) == 0 {
+		err = errors.New("at least one user id is required")
+	} else if len(uniqueIds) > 100 {
+		err = ErrBatchLimit
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("input validation"))
+		return nil, nil, err
+	}
+	found, err := s.userRepo.GetUsersByIDs(ctx, uniqueIds)
+	if err != nil {
+		return nil, nil, ErrTryAgain
+	}
+	byId := make(map[string]users.User, len(found))
+	for _, user := range found {
+		byId[user.ID] = user
+	}
+	result := make([]users.User, 0, len(found))
+	var missingIds []string
+	for _, id := range uniqueIds {
+		user, ok := byId[id]
+		if !ok {
+			missingIds = append(missingIds, id)
+			continue
+		}
+		result = append(result, user)
+	}
+	return result, missingIds, nil
+}
+
+// GetUser is the service handler to get the user with the id.
+func (s *UserServiceImpl) GetUser(ctx context.Context, id string) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id)
+	if id == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no user id provided"), log.Event("input validation"))
+		return nil, errors.New("user id is required")
+	}
+	user, err := s.userRepo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, userRepoError(err)
+	}
+	return user, nil
+}
+
+// GetUserByEmail is the service handler to get the user with the email.
+func (s *UserServiceImpl) GetUserByEmail(ctx context.Context, email string) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetUserByEmail")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.email", email)
+	if email == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no email provided"), log.Event("input validation"))
+		return nil, errors.New("email is required")
+	}
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
 	if err != nil {
 		return nil, ErrTryAgain
 	}
-	return users, nil
+	if user == nil {
+		return nil, users.ErrUserNotFound
+	}
+	return user, nil
 }
 
-func (s *UserServiceImpl) LoginUser(ctx context.Context, email, password string) (*users.User, string, error) {
+// LoginUser is the service handler to log a user in, it starts a new session
+// and returns a short lived access token along with the refresh token of the
+// session. Users with two-factor authentication enabled get an
+// MFARequiredError instead, whose challenge CompleteLoginMFA exchanges for
+// the session.
+func (s *UserServiceImpl) LoginUser(ctx context.Context, email, password string) (*users.User, *sessions.TokenPair, error) {
 	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "LoginUser")
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
@@ -151,69 +462,225 @@ func (s *UserServiceImpl) LoginUser(ctx context.Context, email, password string)
 			log.String("error.object", "some field are empty"),
 			log.Event("input validation"),
 		)
-		return nil, "", errors.New("all fields are required")
+		return nil, nil, errors.New("all fields are required")
+	}
+	now := time.Now()
+	ip := clientIP(ctx)
+	emailAttempts, err := s.reserveLoginAttempt(ctx, span, email, ip, now)
+	if err != nil {
+		return nil, nil, err
 	}
 	user, err := s.userRepo.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, "", errors.New("invalid credentials")
+		s.releaseLoginAttempt(ctx, span, email, ip)
+		return nil, nil, errors.New("invalid credentials")
 	}
 	if user == nil {
 		ext.Error.Set(span, true)
 		span.LogFields(log.String("error.object", "user with email does not exist"))
-		return nil, "", errors.New("invalid credentials")
+		return nil, nil, errors.New("invalid credentials")
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil {
+	if !s.verifyPassword(span, user, password) {
+		s.loginFailed(span, emailAttempts, user, ip)
+		return nil, nil, errors.New("invalid credentials")
+	}
+	s.resetLoginFailures(ctx, span, email, ip)
+	user = s.rehashPassword(ctx, span, user, password)
+	// the password is checked first so that the error does not tell whether
+	// an email is registered.
+	if !user.EmailVerified && s.unverifiedLoginPolicy == UnverifiedLoginBlock {
 		ext.Error.Set(span, true)
-		span.LogFields(
-			log.Error(err),
-			log.Event("password validation"),
-		)
-		return nil, "", errors.New("invalid credentials")
+		span.LogFields(log.Error(ErrEmailNotVerified), log.Event("email verification"))
+		return nil, nil, ErrEmailNotVerified
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId":    user.ID,
-		"timeAdded": user.TimeAdded,
-		"exp":       time.Now().AddDate(0, 0, 4).UTC().UnixNano(),
-	})
-	jwtToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET_KEY")))
+	err = s.requireMFA(ctx, span, user, now.UTC())
 	if err != nil {
-		ext.Error.Set(span, true)
-		span.LogFields(log.Error(err), log.Event("jwt generation"))
-		return nil, "", ErrTryAgain
+		return nil, nil, err
 	}
-	return user, jwtToken, nil
+	tokens, err := s.startSession(ctx, span, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, tokens, nil
 }
 
 func (s *UserServiceImpl) GetUserFromJWT(ctx context.Context, jwtToken string) (*users.User, error) {
 	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "GetUserFromJWT")
 	defer span.Finish()
 	ctx = opentracing.ContextWithSpan(ctx, span)
-	token, err := jwt.Parse(jwtToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return "", errors.New("invalid jwt token string")
-		}
-		return []byte(os.Getenv("JWT_SECRET_KEY")), nil
+	claims, err := s.parseAccessToken(span, jwtToken)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkAccessTokenNotRevoked(ctx, span, claims)
+	if err == nil {
+		err = checkAccessTokenScope(span, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, claims.userID())
+	if err != nil {
+		return nil, errors.New("user does not exist")
+	}
+	return user, nil
+}
+
+// UpdateUser is the service handler to update the fields of a user listed in
+// fieldMask, version must match the version of the stored user.
+func (s *UserServiceImpl) UpdateUser(ctx context.Context, id string, changes *users.User, fieldMask []string, version int64) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "UpdateUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id).SetTag("param.fieldMask", fieldMask).SetTag("param.version", version)
+
+	update, err := userUpdateFromFieldMask(changes, fieldMask)
+	if err == nil && id == "" {
+		err = errors.New("user id is required")
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("input validation"))
+		return nil, err
+	}
+	update.ExpectedVersion = &version
+	user, err := s.userRepo.UpdateUser(ctx, id, update)
+	if err != nil {
+		return nil, userRepoError(err)
+	}
+	s.publishUserChangeEvent(span, users.EventUpdated, user)
+	return user, nil
+}
+
+// DeleteUser is the service handler to soft delete a user, soft deleted users
+// cannot be retrieved or log in until they are restored. The sessions of the
+// user are revoked so its tokens stop working right away.
+func (s *UserServiceImpl) DeleteUser(ctx context.Context, id string) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "DeleteUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id)
+
+	user, err := s.userRepo.DeleteUser(ctx, id)
+	if err != nil {
+		return nil, userRepoError(err)
+	}
+	s.revokeUserSessions(ctx, span, user.ID, time.Now())
+	s.publishUserChangeEvent(span, users.EventDeleted, user)
+	return user, nil
+}
+
+// RestoreUser is the service handler to restore a soft deleted user.
+func (s *UserServiceImpl) RestoreUser(ctx context.Context, id string) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "RestoreUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id)
+
+	user, err := s.userRepo.RestoreUser(ctx, id)
+	if err != nil {
+		return nil, userRepoError(err)
+	}
+	s.publishUserChangeEvent(span, users.EventRestored, user)
+	return user, nil
+}
+
+// PurgeUser is the service handler to permanently remove a user along with the
+// identities, sessions, one time tokens, TOTP enrollment and login attempts
+// kept for it, a user.Purged event is published so that other services can
+// clean up the user's data. The event carries no email, as the user is gone.
+func (s *UserServiceImpl) PurgeUser(ctx context.Context, id string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "PurgeUser")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	span.SetTag("param.id", id)
+
+	user, err := s.userRepo.PurgeUser(ctx, id)
+	if err != nil {
+		return userRepoError(err)
+	}
+	// left over identities would keep their accounts from linking to a new
+	// user, failing to remove them is traced as the user is already gone.
+	err = s.identityStore.DeleteUserIdentities(ctx, user.ID)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("identityStore.DeleteUserIdentities"))
+	}
+	s.deleteUserData(ctx, span, user)
+	s.publishEvent(span, "publish-user-purged-event", users.EventPurged, map[string]interface{}{
+		"userId":   user.ID,
+		"purgedAt": time.Now().UTC(),
 	})
+	return nil
+}
+
+// deleteUserData removes what the other stores keep for a purged user, the
+// sessions are revoked first so that their access tokens are denied until
+// they expire. Failures are traced as the user is already gone.
+func (s *UserServiceImpl) deleteUserData(ctx context.Context, span opentracing.Span, user *users.User) {
+	s.revokeUserSessions(ctx, span, user.ID, time.Now())
+	err := s.sessionStore.DeleteUserSessions(ctx, user.ID)
 	if err != nil {
 		ext.Error.Set(span, true)
-		span.LogFields(log.Error(err), log.Event("jwt decoding"))
-		return nil, errors.New("invalid jwt")
+		span.LogFields(log.Error(err), log.Event("sessionStore.DeleteUserSessions"))
 	}
-	if !token.Valid {
+	err = s.oneTimeTokenStore.DeleteUserTokens(ctx, user.ID)
+	if err != nil {
 		ext.Error.Set(span, true)
-		span.LogFields(
-			log.Error(errors.New("invalid jwt token")),
-			log.Event("jwt token validation"),
-		)
-		return nil, errors.New("jwt token is not valid")
+		span.LogFields(log.Error(err), log.Event("oneTimeTokenStore.DeleteUserTokens"))
 	}
-	claims := token.Claims.(jwt.MapClaims)
-	userId := claims["userId"].(string)
-	span.SetTag("jwtClaims", claims)
-	user, err := s.userRepo.GetUserByID(ctx, userId)
+	err = s.mfaStore.DeleteTOTP(ctx, user.ID)
 	if err != nil {
-		return nil, errors.New("user does not exist")
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("mfaStore.DeleteTOTP"))
 	}
-	return user, nil
+	for _, key := range []string{loginAttemptKey("email", users.NormalizeEmail(user.Email)), loginAttemptKey("mfa", user.ID)} {
+		err = s.loginAttemptStore.Reset(ctx, key)
+		if err != nil {
+			ext.Error.Set(span, true)
+			span.LogFields(log.Error(err), log.Event("loginAttemptStore.Reset"))
+		}
+	}
+}
+
+// publishUserChangeEvent tells the other services and replicas that the user
+// changed.
+func (s *UserServiceImpl) publishUserChangeEvent(span opentracing.Span, subject string, user *users.User) {
+	s.publishEvent(span, "publish-"+subject+"-event", subject, users.ChangeEvent{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Version: user.Version,
+	})
+}
+
+// userRepoError passes through the repository errors clients can act on and
+// replaces the others with ErrTryAgain.
+func userRepoError(err error) error {
+	if errors.Is(err, users.ErrUserNotFound) || errors.Is(err, users.ErrVersionConflict) {
+		return err
+	}
+	return ErrTryAgain
+}
+
+// userUpdateFromFieldMask builds the repository update for the fields named in
+// fieldMask, taking their new values from changes.
+func userUpdateFromFieldMask(changes *users.User, fieldMask []string) (users.UserUpdate, error) {
+	var update users.UserUpdate
+	if len(fieldMask) == 0 {
+		return update, errors.New("field mask must contain at least one field")
+	}
+	for _, field := range fieldMask {
+		switch field {
+		case "fullName":
+			if changes.FullName == "" {
+				return update, errors.New("fullName cannot be empty")
+			}
+			update.FullName = &changes.FullName
+		case "country":
+			update.Country = &changes.Country
+		default:
+			return update, fmt.Errorf("field %q cannot be updated", field)
+		}
+	}
+	return update, nil
 }
@@ -0,0 +1,23 @@
+package services
+
+import "strings"
+
+// FieldViolation is a problem with a field of a request.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// FieldError is returned when fields of a request are invalid, it holds every
+// violation so that clients can show them next to the fields at once.
+type FieldError struct {
+	Violations []FieldViolation
+}
+
+func (e *FieldError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Field + " " + violation.Description
+	}
+	return strings.Join(messages, ", ")
+}
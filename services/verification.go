@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrEmailNotVerified         = errors.New("email has not been verified")
+)
+
+// UnverifiedLoginPolicy is what users who have not verified their email can
+// do when they log in.
+type UnverifiedLoginPolicy string
+
+const (
+	// UnverifiedLoginAllow logs unverified users in like any other user.
+	UnverifiedLoginAllow UnverifiedLoginPolicy = "allow"
+	// UnverifiedLoginLimit logs unverified users in with access tokens whose
+	// scope is ScopeUnverified.
+	UnverifiedLoginLimit UnverifiedLoginPolicy = "limit"
+	// UnverifiedLoginBlock fails the login of unverified users with
+	// ErrEmailNotVerified.
+	UnverifiedLoginBlock UnverifiedLoginPolicy = "block"
+)
+
+// Valid reports whether p is one of the known policies.
+func (p UnverifiedLoginPolicy) Valid() bool {
+	return p == UnverifiedLoginAllow || p == UnverifiedLoginLimit || p == UnverifiedLoginBlock
+}
+
+// ScopeUnverified is the scope of the access tokens of unverified users under
+// UnverifiedLoginLimit. The service only accepts these tokens to log out,
+// the handlers acting for the user of a token refuse them with
+// ErrEmailNotVerified.
+const ScopeUnverified = "unverified"
+
+const defaultEmailVerificationLifetime = 72 * time.Hour
+
+// WithEmailVerification sets the page verification emails link to, the token
+// is added to it as the token query parameter, and how long verification
+// tokens are valid for. An empty verifyURL sends the bare token and a zero
+// lifetime keeps the default of 72 hours.
+func WithEmailVerification(verifyURL string, lifetime time.Duration) Option {
+	return func(s *UserServiceImpl) {
+		s.emailVerificationURL = verifyURL
+		if lifetime > 0 {
+			s.emailVerificationLifetime = lifetime
+		}
+	}
+}
+
+// WithEmailTokenSecret sets the key email verification tokens are signed
+// with, instances sharing the key accept each other's tokens. By default a
+// random key is generated, so tokens only work with the instance that issued
+// them, main.go always sets it.
+func WithEmailTokenSecret(secret []byte) Option {
+	return func(s *UserServiceImpl) {
+		if len(secret) > 0 {
+			s.emailTokenSecret = secret
+		}
+	}
+}
+
+// WithUnverifiedLoginPolicy sets what users who have not verified their email
+// can do when they log in, they are allowed like any other user by default.
+// Unknown policies are ignored.
+func WithUnverifiedLoginPolicy(policy UnverifiedLoginPolicy) Option {
+	return func(s *UserServiceImpl) {
+		if policy.Valid() {
+			s.unverifiedLoginPolicy = policy
+		}
+	}
+}
+
+// emailVerificationToken is the content of the signed email verification
+// tokens, a token only verifies the email it was issued for.
+type emailVerificationToken struct {
+	UserID    string `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// encodeEmailVerificationToken returns the token as base64 json followed by
+// its HMAC signature.
+func (s *UserServiceImpl) encodeEmailVerificationToken(token emailVerificationToken) string {
+	payload, _ := json.Marshal(token)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.signEmailToken(encoded))
+}
+
+// decodeEmailVerificationToken checks the signature and the expiry of the
+// token.
+func (s *UserServiceImpl) decodeEmailVerificationToken(encoded string, now time.Time) (*emailVerificationToken, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidVerificationToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, s.signEmailToken(parts[0])) {
+		return nil, ErrInvalidVerificationToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	var token emailVerificationToken
+	err = json.Unmarshal(payload, &token)
+	if err != nil || token.UserID == "" || now.Unix() >= token.ExpiresAt {
+		return nil, ErrInvalidVerificationToken
+	}
+	return &token, nil
+}
+
+func (s *UserServiceImpl) signEmailToken(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.emailTokenSecret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func (s *UserServiceImpl) publishVerificationSendEmailEvent(span opentracing.Span, user *users.User) {
+	token := s.encodeEmailVerificationToken(emailVerificationToken{
+		UserID:    user.ID,
+		Email:     users.NormalizeEmail(user.Email),
+		ExpiresAt: time.Now().Add(s.emailVerificationLifetime).Unix(),
+	})
+	verifyLink, err := tokenLink(s.emailVerificationURL, token)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("parsing email verification url"))
+		return
+	}
+	s.publishEvent(span, "publish-verification-email-event", "notification.SendEmail", map[string]string{
+		"to":      user.Email,
+		"subject": "Verify your email",
+		"body": fmt.Sprintf(
+			"Please confirm that this is your email by opening %s within %s. You can ignore this email if you did not sign up.",
+			verifyLink, s.emailVerificationLifetime,
+		),
+	})
+}
+
+// VerifyEmail is the service handler to mark the email of a user as verified
+// with the token of a verification email. Verifying an email again succeeds.
+func (s *UserServiceImpl) VerifyEmail(ctx context.Context, token string) (*users.User, error) {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "VerifyEmail")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	verification, err := s.decodeEmailVerificationToken(token, time.Now())
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("decoding verification token"))
+		return nil, err
+	}
+	span.SetTag("userId", verification.UserID)
+
+	user, err := s.userRepo.GetUserByID(ctx, verification.UserID)
+	if err != nil && !errors.Is(err, users.ErrUserNotFound) {
+		return nil, ErrTryAgain
+	}
+	// the user is gone or the token is for an email it no longer has.
+	if user == nil || users.NormalizeEmail(user.Email) != verification.Email {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrInvalidVerificationToken), log.Event("matching verification token to user"))
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+	verified := true
+	user, err = s.userRepo.UpdateUser(ctx, user.ID, users.UserUpdate{EmailVerified: &verified})
+	if errors.Is(err, users.ErrUserNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, ErrTryAgain
+	}
+	s.publishUserChangeEvent(span, users.EventUpdated, user)
+	return user, nil
+}
+
+// ResendVerificationEmail is the service handler to send a new verification
+// email to the user with the email. It succeeds whether or not the user
+// exists so that it cannot be used to find out which emails are registered.
+// Requests are counted per client ip like failed logins, and kept counted, so
+// that the handler cannot be used to flood inboxes.
+func (s *UserServiceImpl) ResendVerificationEmail(ctx context.Context, email string) error {
+	span, _ := opentracing.StartSpanFromContextWithTracer(ctx, s.tracer, "ResendVerificationEmail")
+	defer span.Finish()
+	ctx = opentracing.ContextWithSpan(ctx, span)
+	if email == "" {
+		ext.Error.Set(span, true)
+		span.LogFields(log.String("error.object", "no email provided"), log.Event("input validation"))
+		return errors.New("email is required")
+	}
+	if ip := clientIP(ctx); ip != "" {
+		_, retryAfter, err := s.reserveAttempt(ctx, span, loginAttemptKey("resend", ip), s.ipLoginPolicy, time.Now())
+		if err == nil {
+			err = throttledError(span, retryAfter, "resend throttling")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(err), log.Event("userRepo.GetUserByEmail"))
+		return ErrTryAgain
+	}
+	if user == nil || user.EmailVerified {
+		span.LogFields(log.Event("no unverified user with email, no verification email sent"))
+		return nil
+	}
+	span.SetTag("userId", user.ID)
+	s.publishVerificationSendEmailEvent(span, user)
+	return nil
+}
+
+// checkAccessTokenScope returns ErrEmailNotVerified when the access token is
+// limited to ScopeUnverified.
+func checkAccessTokenScope(span opentracing.Span, claims *AccessTokenClaims) error {
+	if claims.Scope == ScopeUnverified {
+		ext.Error.Set(span, true)
+		span.LogFields(log.Error(ErrEmailNotVerified), log.Event("access token scope"))
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// accessTokenScope returns the scope of the access tokens issued to the user.
+func (s *UserServiceImpl) accessTokenScope(user *users.User) string {
+	if !user.EmailVerified && s.unverifiedLoginPolicy == UnverifiedLoginLimit {
+		return ScopeUnverified
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/nats-io/nats.go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/mfa"
+	"github.com/wisdommatt/ecommerce-microservice-user-service/internal/users"
+)
+
+var verifyLinkPattern = regexp.MustCompile(`https://shop\.example\.com/verify-email\?token=\S+`)
+
+// receiveVerificationToken returns the token of the verification email
+// published to the address, or fails the test.
+func receiveVerificationToken(t *testing.T, messages chan *nats.Msg, to string) string {
+	for {
+		select {
+		case msg := <-messages:
+			var email map[string]string
+			json.Unmarshal(msg.Data, &email)
+			link := verifyLinkPattern.FindString(email["body"])
+			if email["to"] != to || link == "" {
+				continue
+			}
+			verifyURL, err := url.Parse(link)
+			if err != nil {
+				t.Fatalf("parsing verification link %q error = %v", link, err)
+			}
+			return verifyURL.Query().Get("token")
+		case <-time.After(time.Second):
+			t.Fatalf("no verification email was sent to %s", to)
+			return ""
+		}
+	}
+}
+
+func TestUserServiceImpl_VerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	natsConn, messages := subscribeToNatsSubject(t, "notification.SendEmail")
+	s := NewUserService(users.NewMemoryRepository(), &opentracing.NoopTracer{}, natsConn,
+		WithEmailVerification("https://shop.example.com/verify-email", time.Hour),
+		WithUnverifiedLoginPolicy(UnverifiedLoginBlock),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+	if user.EmailVerified {
+		t.Errorf("UserServiceImpl.CreateUser() emailVerified = true, want false")
+	}
+	token := receiveVerificationToken(t, messages, "john@example.com")
+
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err != ErrEmailNotVerified {
+		t.Errorf("UserServiceImpl.LoginUser() of an unverified user error = %v, want %v", err, ErrEmailNotVerified)
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "battery-staple-7"); err == nil || err == ErrEmailNotVerified {
+		t.Errorf("UserServiceImpl.LoginUser() with a wrong password error = %v, want invalid credentials", err)
+	}
+
+	if err := s.ResendVerificationEmail(ctx, "unknown@example.com"); err != nil {
+		t.Errorf("UserServiceImpl.ResendVerificationEmail() of an unknown email error = %v, want nil", err)
+	}
+	if err := s.ResendVerificationEmail(ctx, "John@Example.com"); err != nil {
+		t.Fatalf("UserServiceImpl.ResendVerificationEmail() error = %v", err)
+	}
+	resentToken := receiveVerificationToken(t, messages, "john@example.com")
+
+	expiredToken := s.encodeEmailVerificationToken(emailVerificationToken{
+		UserID: user.ID, Email: user.Email, ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	otherEmailToken := s.encodeEmailVerificationToken(emailVerificationToken{
+		UserID: user.ID, Email: "old@example.com", ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	unknownUserToken := s.encodeEmailVerificationToken(emailVerificationToken{
+		UserID: "unknown", Email: user.Email, ExpiresAt: time.Now().Add(time.Minute).Unix(),
+	})
+	for name, invalidToken := range map[string]string{
+		"malformed":    "invalid",
+		"tampered":     token[:len(token)-2] + "xx",
+		"expired":      expiredToken,
+		"other email":  otherEmailToken,
+		"unknown user": unknownUserToken,
+	} {
+		if _, err := s.VerifyEmail(ctx, invalidToken); err != ErrInvalidVerificationToken {
+			t.Errorf("UserServiceImpl.VerifyEmail() with a %s token error = %v, want %v", name, err, ErrInvalidVerificationToken)
+		}
+	}
+
+	verified, err := s.VerifyEmail(ctx, token)
+	if err != nil || !verified.EmailVerified {
+		t.Fatalf("UserServiceImpl.VerifyEmail() = %+v, %v, want a verified user", verified, err)
+	}
+	if _, err := s.VerifyEmail(ctx, resentToken); err != nil {
+		t.Errorf("UserServiceImpl.VerifyEmail() of a verified user error = %v, want nil", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42"); err != nil {
+		t.Errorf("UserServiceImpl.LoginUser() of a verified user error = %v", err)
+	}
+}
+
+func TestUserServiceImpl_UnverifiedLoginLimit(t *testing.T) {
+	ctx := context.Background()
+	userRepo := users.NewMemoryRepository()
+	s := NewUserService(userRepo, &opentracing.NoopTracer{}, nil,
+		WithUnverifiedLoginPolicy(UnverifiedLoginLimit), WithTOTP(mfa.NewMemoryStore(), ""),
+	)
+	user, err := s.CreateUser(ctx, &users.User{FullName: "John Doe", Email: "john@example.com", Password: "correct-horse-42"})
+	if err != nil {
+		t.Fatalf("UserServiceImpl.CreateUser() error = %v", err)
+	}
+
+	login := func() (string, string) {
+		_, tokens, err := s.LoginUser(ctx, "john@example.com", "correct-horse-42")
+		if err != nil {
+			t.Fatalf("UserServiceImpl.LoginUser() error = %v", err)
+		}
+		claims := &AccessTokenClaims{}
+		_, _, err = new(jwt.Parser).ParseUnverified(tokens.AccessToken, claims)
+		if err != nil {
+			t.Fatalf("jwt.Parser.ParseUnverified() error = %v", err)
+		}
+		return tokens.AccessToken, claims.Scope
+	}
+	limited, scope := login()
+	if scope != ScopeUnverified {
+		t.Errorf("UserServiceImpl.LoginUser() scope of an unverified user = %q, want %q", scope, ScopeUnverified)
+	}
+	// limited tokens are refused by every handler acting for their user.
+	if _, err := s.GetUserFromJWT(ctx, limited); err != ErrEmailNotVerified {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with a limited token error = %v, want %v", err, ErrEmailNotVerified)
+	}
+	if _, err := s.ChangePassword(ctx, limited, user.ID, "correct-horse-42", "battery-staple-7"); err != ErrEmailNotVerified {
+		t.Errorf("UserServiceImpl.ChangePassword() with a limited token error = %v, want %v", err, ErrEmailNotVerified)
+	}
+	if _, err := s.BeginTOTPEnrollment(ctx, limited, user.ID, "correct-horse-42"); err != ErrEmailNotVerified {
+		t.Errorf("UserServiceImpl.BeginTOTPEnrollment() with a limited token error = %v, want %v", err, ErrEmailNotVerified)
+	}
+	if err := s.LogoutUser(ctx, limited); err != nil {
+		t.Errorf("UserServiceImpl.LogoutUser() with a limited token error = %v, want nil", err)
+	}
+
+	verified := true
+	userRepo.UpdateUser(ctx, user.ID, users.UserUpdate{EmailVerified: &verified})
+	full, scope := login()
+	if scope != "" {
+		t.Errorf("UserServiceImpl.LoginUser() scope of a verified user = %q, want none", scope)
+	}
+	if got, err := s.GetUserFromJWT(ctx, full); err != nil || got.ID != user.ID {
+		t.Errorf("UserServiceImpl.GetUserFromJWT() with a full token = %v, %v, want user %s", got, err, user.ID)
+	}
+}